@@ -0,0 +1,295 @@
+package scipipe
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	str "strings"
+	"time"
+)
+
+// ======= Run archives ========
+
+// ArchiveOptions are the options for WriteArchive
+type ArchiveOptions struct {
+	// The outputs to include in the archive, given as PROCESSNAME, for all
+	// outputs of a process, or as PROCESSNAME.PORTNAME
+	Outputs []string
+}
+
+// ArchiveManifest describes the contents of a run archive, and is included
+// in it, as manifest.json
+type ArchiveManifest struct {
+	Workflow   string
+	Created    time.Time
+	StartTime  time.Time
+	FinishTime time.Time
+	Tasks      []TaskRecord
+	Files      []ArchiveFile
+}
+
+// ArchiveFile describes a file in a run archive: its path in the archive,
+// the path it was added from (for audit files, logs and outputs), its size,
+// and its SHA-256 checksum
+type ArchiveFile struct {
+	Path       string
+	SourcePath string `json:",omitempty"`
+	Size       int64
+	SHA256     string
+}
+
+// Write an archive of the (completed) run of the workflow to the file at
+// path, for archiving, or sharing with collaborators. The archive is a
+// gzipped tar file, if path ends in .tar.gz or .tgz, or a zip file, if it
+// ends in .zip. It contains:
+//
+//	manifest.json  the manifest (see ArchiveManifest), with the records of all tasks, including their params
+//	graph.dot      the workflow graph (see WriteDOT)
+//	status.json    the status of the workflow (see GetStatus)
+//	report.html    the timing report (see WriteReport)
+//	audit/         the audit files of the outputs of all tasks
+//	logs/          the log files of all tasks, with TaskLogFiles set
+//	outputs/       the outputs selected in opts
+//
+// Files from the workflow are stored at their paths, relative to the
+// working directory (or, for absolute paths, to the root), under the
+// directories above. The records of the tasks are only available if they
+// were kept in the run (see KeepTaskRecords).
+func (wf *Workflow) WriteArchive(path string, opts ArchiveOptions) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	var aw archiveWriter
+	switch {
+	case str.HasSuffix(path, ".tar.gz") || str.HasSuffix(path, ".tgz"):
+		aw = newTarArchiveWriter(f)
+	case str.HasSuffix(path, ".zip"):
+		aw = &zipArchiveWriter{zip.NewWriter(f)}
+	default:
+		f.Close()
+		os.Remove(path)
+		return fmt.Errorf("Unknown archive format, of %s (use .tar.gz, .tgz or .zip)", path)
+	}
+	err = wf.writeArchive(aw, opts)
+	if closeErr := aw.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+	Audit.Printf("Workflow %s: Wrote run archive to %s\n", wf.Name, path)
+	return nil
+}
+
+// Write the contents of the archive of the run to aw
+func (wf *Workflow) writeArchive(aw archiveWriter, opts ArchiveOptions) error {
+	rs := wf.GetStats()
+	records := wf.GetTaskRecords()
+	manifest := &ArchiveManifest{
+		Workflow:   wf.Name,
+		Created:    time.Now(),
+		StartTime:  rs.StartTime,
+		FinishTime: rs.FinishTime,
+		Tasks:      records,
+	}
+	selected := make(map[string]bool)
+	for _, spec := range opts.Outputs {
+		selected[spec] = true
+	}
+
+	// Generated files
+	generated := []struct {
+		name  string
+		write func(io.Writer) error
+	}{
+		{"graph.dot", wf.WriteDOT},
+		{"status.json", func(w io.Writer) error {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			return enc.Encode(wf.GetStatus())
+		}},
+		{"report.html", wf.WriteReport},
+	}
+	for _, gen := range generated {
+		buf := new(bytes.Buffer)
+		if err := gen.write(buf); err != nil {
+			return err
+		}
+		af, err := addArchiveFile(aw, gen.name, "", bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			return err
+		}
+		manifest.Files = append(manifest.Files, af)
+	}
+
+	// Files of the tasks, in the order they finished, without duplicates
+	added := make(map[string]bool)
+	addFile := func(dir string, path string) error {
+		name := dir + "/" + archiveRelPath(path)
+		if added[name] {
+			return nil
+		}
+		added[name] = true
+		afs, err := addArchivePath(aw, name, path)
+		manifest.Files = append(manifest.Files, afs...)
+		return err
+	}
+	for _, tr := range records {
+		onames := []string{}
+		for oname := range tr.Outputs {
+			onames = append(onames, oname)
+		}
+		sort.Strings(onames)
+		for _, oname := range onames {
+			opath := tr.Outputs[oname]
+			if _, err := os.Stat(opath + ".audit.json"); err == nil {
+				if err := addFile("audit", opath+".audit.json"); err != nil {
+					return err
+				}
+			}
+			if tr.Succeeded && (selected[tr.Name] || selected[tr.Name+"."+oname]) {
+				if err := addFile("outputs", opath); err != nil {
+					return err
+				}
+			}
+		}
+		if tr.LogPath != "" {
+			if _, err := os.Stat(tr.LogPath); err == nil {
+				if err := addFile("logs", tr.LogPath); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = addArchiveFile(aw, "manifest.json", "", bytes.NewReader(data), int64(len(data)))
+	return err
+}
+
+// Get path relative to the working directory, or, if absolute, to the
+// root, with slashes, for use in archives
+func archiveRelPath(path string) string {
+	path = filepath.ToSlash(filepath.Clean(path))
+	path = str.TrimPrefix(path, filepath.ToSlash(filepath.VolumeName(path)))
+	path = str.TrimLeft(path, "/")
+	return str.Replace(path, "../", "", -1)
+}
+
+// Add the file, or, recursively, the files of the directory, at path, to
+// the archive, as name
+func addArchivePath(aw archiveWriter, name string, path string) ([]ArchiveFile, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		af, err := addArchiveFile(aw, name, path, f, fi.Size())
+		return []ArchiveFile{af}, err
+	}
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	afs := []ArchiveFile{}
+	for _, e := range entries {
+		eafs, err := addArchivePath(aw, name+"/"+e.Name(), filepath.Join(path, e.Name()))
+		afs = append(afs, eafs...)
+		if err != nil {
+			return afs, err
+		}
+	}
+	return afs, nil
+}
+
+// Add the contents of r, of the size size, to the archive, as name,
+// returning its description for the manifest
+func addArchiveFile(aw archiveWriter, name string, sourcePath string, r io.Reader, size int64) (ArchiveFile, error) {
+	w, err := aw.Create(name, size)
+	if err != nil {
+		return ArchiveFile{}, err
+	}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(w, h), r)
+	if err != nil {
+		return ArchiveFile{}, err
+	}
+	if n != size {
+		return ArchiveFile{}, fmt.Errorf("File %s changed size while being archived", sourcePath)
+	}
+	return ArchiveFile{Path: name, SourcePath: sourcePath, Size: size, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// archiveWriter writes files to an archive
+type archiveWriter interface {
+	// Create a file named name, of the size size, in the archive, returning
+	// a writer for its contents
+	Create(name string, size int64) (io.Writer, error)
+	Close() error
+}
+
+type tarArchiveWriter struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+func newTarArchiveWriter(w io.Writer) *tarArchiveWriter {
+	gz := gzip.NewWriter(w)
+	return &tarArchiveWriter{gz: gz, tw: tar.NewWriter(gz)}
+}
+
+func (aw *tarArchiveWriter) Create(name string, size int64) (io.Writer, error) {
+	err := aw.tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    size,
+		ModTime: time.Now(),
+	})
+	return aw.tw, err
+}
+
+func (aw *tarArchiveWriter) Close() error {
+	if err := aw.tw.Close(); err != nil {
+		return err
+	}
+	return aw.gz.Close()
+}
+
+type zipArchiveWriter struct {
+	zw *zip.Writer
+}
+
+func (aw *zipArchiveWriter) Create(name string, size int64) (io.Writer, error) {
+	return aw.zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+}
+
+func (aw *zipArchiveWriter) Close() error {
+	return aw.zw.Close()
+}
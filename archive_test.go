@@ -0,0 +1,70 @@
+package scipipe
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"os"
+	t "testing"
+)
+
+func TestWriteArchive(t *t.T) {
+	initTestLogs()
+
+	wf := newTestFooBarWorkflow("/tmp/archive_")
+	wf.KeepTaskRecords = true
+	foo := wf.GetSciProcess("foo")
+	foo.SetCommand("echo {p:word} > {o:out}")
+	foo.SetParamDefault("word", "foo")
+	wf.GetSciProcess("f2b").TaskLogFiles = true
+	assert.Nil(t, wf.Run())
+	defer cleanFiles("/tmp/archive_foo.txt", "/tmp/archive_foo.txt.bar", "/tmp/archive_foo.txt.bar.log")
+
+	// Read the files of a tar.gz archive
+	err := wf.WriteArchive("/tmp/archive_test.tar.gz", ArchiveOptions{Outputs: []string{"f2b.out"}})
+	assert.Nil(t, err)
+	defer os.Remove("/tmp/archive_test.tar.gz")
+	f, err := os.Open("/tmp/archive_test.tar.gz")
+	assert.Nil(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	assert.Nil(t, err)
+	tr := tar.NewReader(gz)
+	files := make(map[string]string)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		data, _ := ioutil.ReadAll(tr)
+		files[hdr.Name] = string(data)
+	}
+	for _, name := range []string{"manifest.json", "graph.dot", "status.json", "report.html", "audit/tmp/archive_foo.txt.audit.json", "audit/tmp/archive_foo.txt.bar.audit.json", "logs/tmp/archive_foo.txt.bar.log"} {
+		assert.Contains(t, files, name)
+	}
+	assert.EqualValues(t, "bar\n", files["outputs/tmp/archive_foo.txt.bar"])
+	assert.NotContains(t, files, "outputs/tmp/archive_foo.txt")
+
+	manifest := &ArchiveManifest{}
+	assert.Nil(t, json.Unmarshal([]byte(files["manifest.json"]), manifest))
+	assert.EqualValues(t, "wf", manifest.Workflow)
+	assert.Len(t, manifest.Tasks, 2)
+	assert.EqualValues(t, "foo", manifest.Tasks[0].Params["word"])
+	assert.Len(t, manifest.Files, len(files)-1)
+
+	// Check that the files of a zip archive are the same
+	err = wf.WriteArchive("/tmp/archive_test.zip", ArchiveOptions{Outputs: []string{"f2b"}})
+	assert.Nil(t, err)
+	defer os.Remove("/tmp/archive_test.zip")
+	zr, err := zip.OpenReader("/tmp/archive_test.zip")
+	assert.Nil(t, err)
+	defer zr.Close()
+	assert.Len(t, zr.File, len(files))
+
+	assert.Error(t, wf.WriteArchive("/tmp/archive_test.rar", ArchiveOptions{}))
+}
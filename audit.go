@@ -0,0 +1,78 @@
+package scipipe
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+// ======= AuditInfo ========
+
+// AuditInfo contains structured audit information about the task that
+// produced a file, as well as (recursively) the audit info of the tasks that
+// produced its inputs, keyed on the in-port name. This way a single output
+// file carries its complete upstream history. It also contains the tags (key
+// value metadata) of the file.
+type AuditInfo struct {
+	Command    string
+	Params     map[string]string
+	Tags       map[string]string
+	StartTime  time.Time
+	FinishTime time.Time
+	ExecTimeMS int64
+	Upstream   map[string]*AuditInfo
+	// The resources used by the command, if profiled (see
+	// SciProcess.Profile)
+	Resources *ResourceUsage `json:",omitempty"`
+	// The tool environment activated before the command, if any (see
+	// SciProcess.ToolEnv)
+	ToolEnv *ToolEnv `json:",omitempty"`
+}
+
+// auditInfoLock guards the fields of audit info that tasks set while
+// executing, since the audit info of a task is shared with the tasks
+// consuming its streamed outputs, which may write it to their audit files
+// meanwhile
+var auditInfoLock sync.RWMutex
+
+// Create new AuditInfo "object"
+func NewAuditInfo() *AuditInfo {
+	return &AuditInfo{
+		Params:   make(map[string]string),
+		Tags:     make(map[string]string),
+		Upstream: make(map[string]*AuditInfo),
+	}
+}
+
+// Read AuditInfo from a JSON encoded audit file
+func NewAuditInfoFromFile(auditFilePath string) (*AuditInfo, error) {
+	dat, err := ioutil.ReadFile(auditFilePath)
+	if err != nil {
+		return nil, err
+	}
+	ai := NewAuditInfo()
+	err = json.Unmarshal(dat, ai)
+	if err != nil {
+		return nil, err
+	}
+	return ai, nil
+}
+
+// Write the AuditInfo, JSON encoded, to the file at auditFilePath
+func (ai *AuditInfo) WriteToFile(auditFilePath string) {
+	auditInfoLock.RLock()
+	dat, err := json.MarshalIndent(ai, "", "    ")
+	auditInfoLock.RUnlock()
+	Check(err)
+	err = ioutil.WriteFile(auditFilePath, dat, 0644)
+	Check(err)
+}
+
+// Update the AuditInfo with the function update, while no audit info is
+// being written to file
+func (ai *AuditInfo) update(update func(*AuditInfo)) {
+	auditInfoLock.Lock()
+	defer auditInfoLock.Unlock()
+	update(ai)
+}
@@ -0,0 +1,33 @@
+package scipipe
+
+import (
+	"github.com/stretchr/testify/assert"
+	t "testing"
+)
+
+func TestAuditInfoUpstreamChaining(t *t.T) {
+	initTestLogs()
+
+	foo := NewFromShell("foo", "echo foo > {o:foo}")
+	foo.SetPathStatic("foo", "/tmp/audit_foo.txt")
+
+	f2b := NewFromShell("f2b", "sed 's/foo/bar/g' {i:foo} > {o:bar}")
+	f2b.SetPathExtend("foo", "bar", ".bar.txt")
+
+	snk := NewSink()
+
+	f2b.In["foo"].Connect(foo.Out["foo"])
+	snk.Connect(f2b.Out["bar"])
+
+	pl := NewPipelineRunner()
+	pl.AddProcesses(foo, f2b, snk)
+	pl.Run()
+
+	ai, err := NewAuditInfoFromFile("/tmp/audit_foo.txt.bar.txt.audit.json")
+	assert.Nil(t, err)
+	assert.EqualValues(t, "sed 's/foo/bar/g' /tmp/audit_foo.txt > /tmp/audit_foo.txt.bar.txt.tmp", ai.Command)
+	assert.NotNil(t, ai.Upstream["foo"], "Upstream audit info missing for in-port foo")
+	assert.EqualValues(t, "echo foo > /tmp/audit_foo.txt.tmp", ai.Upstream["foo"].Command)
+
+	cleanFiles("/tmp/audit_foo.txt", "/tmp/audit_foo.txt.bar.txt")
+}
@@ -0,0 +1,214 @@
+package scipipe
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	str "strings"
+	"time"
+)
+
+// ======= Task batching ========
+
+// Check whether the task t is executed in a batch with other tasks of the
+// process (see BatchSize). Tasks with custom execution functions, tasks
+// failing in strict mode (see SciProcess.Strict), and tasks reading or
+// writing streams, which need to run at the same time as the tasks at the
+// other end of the streams, are executed on their own, as are
+// all tasks in dry runs, mocked runs and partial runs. Tasks of rate limited
+// processes are not batched either, since each of them waits for its turn to
+// start, nor are tasks of profiled processes, since the resources used are
+// only reported for the batch as a whole.
+func (p *SciProcess) doesBatch(t *SciTask) bool {
+	if p.BatchSize < 2 || p.dryRunWriter != nil || p.mock != nil || p.partialRun != partialRunExecute {
+		return false
+	}
+	if t.CustomExecute != nil || t.formatErr != nil || p.RateLimit > 0 || p.Profile || !isPosixShell(p.getBatchShell()) {
+		return false
+	}
+	for _, itgt := range t.InTargets {
+		if itgt.IsStreaming() {
+			return false
+		}
+	}
+	for _, otgt := range t.OutTargets {
+		if otgt.IsStreaming() {
+			return false
+		}
+	}
+	return true
+}
+
+// Execute the commands of the tasks with one shell invocation, in order,
+// each in its own subshell, so that a failing command does not stop the
+// others. The exit status of each command is written to a status file, so
+// that each task can fail, or have its outputs atomized, on its own. The
+// batch occupies one slot of the scheduler, and the prepend string of its
+// first task is used for the whole batch, as for submitting it as one
+// cluster job. Tasks whose outputs already exist are skipped as usual.
+func (p *SciProcess) executeBatch(tasks []*SciTask) {
+	run := []*SciTask{}
+	for _, t := range tasks {
+		if t.anyOutputExists() {
+			// Skipped, and Done sent, as for tasks that are not batched
+			go t.Execute()
+			continue
+		}
+		run = append(run, t)
+	}
+	if len(run) == 0 {
+		return
+	}
+	if len(run) == 1 {
+		run[0].Execute()
+		return
+	}
+
+	staged := []*SciTask{}
+	for _, t := range run {
+		t.openLogFile()
+		if t.err = t.stageInTargets(); t.err == nil {
+			t.err = t.linkStagedInputs()
+		}
+		if t.err != nil {
+			// Fails on its own, without being executed in the batch
+			p.recordTaskStarted(t)
+			t.finishBatched()
+			continue
+		}
+		staged = append(staged, t)
+	}
+	run = staged
+	if len(run) == 0 {
+		return
+	}
+	out, status, err := p.executeBatchScript(run)
+
+	for i, t := range run {
+		t.AuditInfo.update(func(ai *AuditInfo) { ai.FinishTime = time.Now() })
+		if t.logFile != nil {
+			fmt.Fprintf(t.logFile, "---- Output of batch of commands ----\n%s---- End of output ----\n", string(out))
+		}
+		exitCode, ok := status[i]
+		if p.getContext().Err() != nil {
+			t.err = ErrCancelled
+		} else if !ok {
+			t.err = fmt.Errorf("Batch of commands failed (%v) before command [%s] finished, with output:\n%s", err, t.Command, string(out))
+		} else if exitCode != 0 {
+			t.err = fmt.Errorf("Command [%s] failed (exit status %d), in batch of commands with output:\n%s", t.Command, exitCode, string(out))
+		}
+		t.finishBatched()
+	}
+}
+
+// Finish the execution of the task t, executed in a batch, and send Done
+func (t *SciTask) finishBatched() {
+	t.finishExecution()
+	t.closeLogFile()
+	t.releaseSignature()
+	t.Done <- 1
+	close(t.Done)
+}
+
+// Execute the commands of the tasks run as one shell script, holding one
+// slot of the scheduler while doing so, and return the combined output,
+// and the exit status of each command that finished, by its index in run
+func (p *SciProcess) executeBatchScript(run []*SciTask) ([]byte, map[int]int, error) {
+	first := run[0]
+	if p.scheduler != nil {
+		if err := p.scheduler.acquire(first); err != nil {
+			return nil, map[int]int{}, err
+		}
+		defer p.scheduler.release(first)
+	}
+	statusPath := p.getBatchStatusPath(first)
+	script := ""
+	for i, t := range run {
+		p.recordTaskStarted(t)
+		t.AuditInfo.update(func(ai *AuditInfo) { ai.StartTime = time.Now() })
+		cmd := t.getBatchCommand()
+		if p.IsolateWorkDir {
+			cmd = "cd " + shellQuote(t.GetStagingDir()) + " && " + cmd
+		}
+		script += fmt.Sprintf("(\n%s\n)\necho %d $? >> %s\n", cmd, i, shellQuote(statusPath))
+	}
+	cmd := script
+	if prepend := first.formatPlaceHolders(first.getPrepend(), false); prepend != "" {
+		cmd = prepend + " " + p.getBatchShell() + " -c " + shellQuote(script)
+	}
+	out, err := first.executeBatchCommand(cmd)
+	status := readBatchStatus(statusPath)
+	os.Remove(statusPath)
+	return out, status, err
+}
+
+// Get the command of the task t, without the prepend string, to be executed
+// in a batch
+func (t *SciTask) getBatchCommand() string {
+	if args := t.process.getCommandArgs(); args != nil {
+		fargs := []string{}
+		for _, arg := range args {
+			fargs = append(fargs, t.formatPlaceHolders(arg, true))
+		}
+		return shellQuoteJoin(fargs, " ") + t.formatPlaceHolders(t.process.getStdioPattern(), false)
+	}
+	return t.addToolEnvActivation(t.formatPlaceHolders(t.process.getShellCommandPattern(), false))
+}
+
+// Execute the command cmd of a batch of tasks, of which t is the first,
+// returning its output
+func (t *SciTask) executeBatchCommand(cmd string) ([]byte, error) {
+	t.logStructured(LevelAudit, "Executing batch of commands", Fields{"command": cmd})
+	command := exec.Command(t.process.getBatchShell(), "-c", cmd)
+	command.Env = t.getCommandEnv()
+	if t.process.workers != nil {
+		return t.process.workers.execute(t, command, "", "")
+	}
+	return t.runCommand(command)
+}
+
+// Get the shell that batches of commands of the process are executed with,
+// which is bash for processes executing their commands without a shell
+func (p *SciProcess) getBatchShell() string {
+	if p.Shell == ShellNone {
+		return "bash"
+	}
+	return p.getShell()
+}
+
+// Get the (absolute) path of the status file of the batch of tasks starting
+// with the task t, in the working directory, so that it is available to
+// batches executed on cluster nodes or workers too
+func (p *SciProcess) getBatchStatusPath(t *SciTask) string {
+	path, err := filepath.Abs(fmt.Sprintf(".scipipe-batch.%d.%s.%d.status", os.Getpid(), p.Name, t.Index))
+	Check(err)
+	return path
+}
+
+// Read the exit statuses of the commands of a batch from the status file at
+// path, by the numbers of the commands in the batch. Commands that did not
+// finish are missing.
+func readBatchStatus(path string) map[int]int {
+	status := make(map[int]int)
+	f, err := os.Open(path)
+	if err != nil {
+		return status
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := str.Fields(sc.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		i, err1 := strconv.Atoi(fields[0])
+		code, err2 := strconv.Atoi(fields[1])
+		if err1 == nil && err2 == nil {
+			status[i] = code
+		}
+	}
+	return status
+}
@@ -0,0 +1,143 @@
+package scipipe
+
+import (
+	"os"
+	"sort"
+	"time"
+)
+
+// ======= Checkpoints ========
+
+// Check whether the state of the run is written as checkpoints while it
+// runs (see CheckpointInterval)
+func (wf *Workflow) doesCheckpoint() bool {
+	return wf.CheckpointInterval > 0 && wf.StateDir != "" && !wf.noExecute
+}
+
+// Set up the tracking of the tasks that are queued and running, for
+// checkpoints, if the workflow is checkpointed
+func (wf *Workflow) setUpCheckpointing() {
+	if !wf.doesCheckpoint() || wf.checkpointHooksAdded {
+		return
+	}
+	wf.checkpointHooksAdded = true
+	wf.OnTaskCreated(wf.addQueuedTask)
+	wf.OnTaskStart(wf.addRunningTask)
+	wf.OnTaskSuccess(wf.removePendingTask)
+	wf.OnTaskSkipped(wf.removePendingTask)
+	wf.OnTaskFailure(func(t *SciTask, err error) {
+		wf.removePendingTask(t)
+	})
+}
+
+// Record that the task t is created, but not yet started, for checkpoints
+func (wf *Workflow) addQueuedTask(t *SciTask) {
+	tr := newTaskRecord(t)
+	tr.Succeeded = false
+	wf.lock.Lock()
+	wf.queuedTasks[t] = tr
+	wf.lock.Unlock()
+}
+
+// Record that the task t has started, for checkpoints
+func (wf *Workflow) addRunningTask(t *SciTask) {
+	tr := newTaskRecord(t)
+	tr.Succeeded = false
+	wf.lock.Lock()
+	delete(wf.queuedTasks, t)
+	wf.runningTasks[t] = tr
+	wf.lock.Unlock()
+}
+
+// Record that the task t is no longer queued or running, since it is done,
+// failed or skipped
+func (wf *Workflow) removePendingTask(t *SciTask) {
+	wf.lock.Lock()
+	delete(wf.queuedTasks, t)
+	delete(wf.runningTasks, t)
+	wf.lock.Unlock()
+}
+
+// Get the records of the tasks of the run of the workflow that are running,
+// ordered by start time, and of those that are queued, ordered by process
+// and index
+func (wf *Workflow) getPendingTaskRecords() (running []TaskRecord, queued []TaskRecord) {
+	wf.lock.Lock()
+	defer wf.lock.Unlock()
+	for _, tr := range wf.runningTasks {
+		running = append(running, tr)
+	}
+	sort.SliceStable(running, func(i, j int) bool {
+		return running[i].StartTime.Before(running[j].StartTime)
+	})
+	for _, tr := range wf.queuedTasks {
+		queued = append(queued, tr)
+	}
+	sort.SliceStable(queued, func(i, j int) bool {
+		if queued[i].Name != queued[j].Name {
+			return queued[i].Name < queued[j].Name
+		}
+		return queued[i].Index < queued[j].Index
+	})
+	return running, queued
+}
+
+// Start writing the state of the run, as a checkpoint, every
+// CheckpointInterval, if set, returning a function that stops it
+func (wf *Workflow) startCheckpointing() (stop func()) {
+	if !wf.doesCheckpoint() {
+		return func() {}
+	}
+	done := make(chan bool)
+	stopped := make(chan bool)
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(wf.CheckpointInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				wf.writeRunState(false, nil)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// Restart from the latest checkpoint of the workflow in StateDir, if Restart
+// is set and the run it records was interrupted. The tasks that were done
+// are skipped, since their outputs exist. The tasks that were running or
+// queued are executed again, unless they finished after the checkpoint, with
+// all outputs and audit files in place: their temporary files, and any
+// outputs they had finalized, are removed (see GetUnfinishedPaths).
+func (wf *Workflow) restartFromCheckpoint() {
+	if !wf.Restart || wf.StateDir == "" || wf.noExecute {
+		return
+	}
+	state, err := ReadLastRunState(wf.StateDir, wf.Name)
+	if err != nil {
+		Info.Printf("Workflow %s: No checkpoint to restart from: %s\n", wf.Name, err)
+		return
+	}
+	if state.State != RunRunning {
+		return
+	}
+	Audit.Printf("Workflow %s: Restarting from checkpoint %s, with %d tasks done, %d tasks running and %d tasks queued\n", wf.Name, state.Path, len(state.Tasks), len(state.Running), len(state.Queued))
+	for _, path := range state.GetLeftoverTempPaths() {
+		Audit.Printf("Workflow %s: Removing leftover temp path: %s\n", wf.Name, path)
+		if err := os.RemoveAll(path); err != nil {
+			Warning.Printf("Workflow %s: Could not remove leftover temp path %s: %s\n", wf.Name, path, err)
+		}
+	}
+	for _, path := range state.GetUnfinishedPaths() {
+		Audit.Printf("Workflow %s: Removing output of unfinished task, to execute it again: %s\n", wf.Name, path)
+		if err := os.RemoveAll(path); err != nil {
+			Warning.Printf("Workflow %s: Could not remove output of unfinished task %s: %s\n", wf.Name, path, err)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package scipipe
+
+import (
+	"fmt"
+)
+
+// ======= Chunker ========
+
+// Chunker is a component that receives all targets on its In-port, splits
+// them into NumChunks chunks (of as equal size as possible, keeping the
+// order of the targets), and sends each chunk as a list target (see
+// NewFileListTarget) on its Out-port. This way, a downstream process expands
+// into an indexed array of tasks, one per chunk, which can use {task.index}
+// as the array index (e.g. for mapping onto cluster array jobs), and
+// {i:PORTNAME} for the paths of the chunk. Each chunk is also tagged with
+// its index, as "chunk_index", and the number of chunks, as "chunk_count".
+type Chunker struct {
+	Process
+	Name      string
+	In        *InPort
+	Out       *OutPort
+	NumChunks int
+}
+
+// Instantiate a Chunker component, splitting its inputs into numChunks
+// chunks
+func NewChunker(name string, numChunks int) *Chunker {
+	return &Chunker{
+		Name:      name,
+		In:        NewInPort(),
+		Out:       NewOutPort(),
+		NumChunks: numChunks,
+	}
+}
+
+func (proc *Chunker) IsConnected() bool {
+	return proc.In.IsConnected() && proc.Out.IsConnected()
+}
+
+// Execute the Chunker component
+func (proc *Chunker) Run() {
+	defer proc.Out.Close()
+	targets := []*FileTarget{}
+	for tgt := range proc.In.Chan {
+		targets = append(targets, tgt)
+	}
+	for _, chunk := range ChunkTargets(targets, proc.NumChunks) {
+		Debug.Printf("Chunker %s: Sending chunk %s of %d targets\n", proc.Name, chunk.GetTag("chunk_index"), len(chunk.GetTargets()))
+		proc.Out.Chan <- chunk
+	}
+}
+
+// Split targets into (at most) numChunks list targets of as equal size as
+// possible, keeping the order of the targets. Each chunk is tagged with its
+// index, as "chunk_index", and the number of chunks, as "chunk_count".
+func ChunkTargets(targets []*FileTarget, numChunks int) []*FileTarget {
+	if numChunks > len(targets) {
+		numChunks = len(targets)
+	}
+	chunks := []*FileTarget{}
+	start := 0
+	for i := 0; i < numChunks; i++ {
+		// Spread the remainder over the first chunks
+		size := len(targets) / numChunks
+		if i < len(targets)%numChunks {
+			size++
+		}
+		chunk := NewFileListTarget(targets[start : start+size]...)
+		chunk.AddTag("chunk_index", fmt.Sprintf("%d", i))
+		chunk.AddTag("chunk_count", fmt.Sprintf("%d", numChunks))
+		chunks = append(chunks, chunk)
+		start += size
+	}
+	return chunks
+}
@@ -0,0 +1,49 @@
+package scipipe
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	t "testing"
+)
+
+func TestChunkTargets(t *t.T) {
+	targets := []*FileTarget{}
+	for i := 0; i < 5; i++ {
+		targets = append(targets, NewFileTarget(fmt.Sprintf("/tmp/f%d.txt", i)))
+	}
+	chunks := ChunkTargets(targets, 2)
+	assert.EqualValues(t, 2, len(chunks))
+	assert.EqualValues(t, []string{"/tmp/f0.txt", "/tmp/f1.txt", "/tmp/f2.txt"}, chunks[0].GetPaths())
+	assert.EqualValues(t, []string{"/tmp/f3.txt", "/tmp/f4.txt"}, chunks[1].GetPaths())
+	assert.EqualValues(t, "1", chunks[1].GetTag("chunk_index"))
+	assert.EqualValues(t, "2", chunks[1].GetTag("chunk_count"))
+
+	assert.EqualValues(t, 2, len(ChunkTargets(targets[:2], 4)))
+}
+
+func TestChunker(t *t.T) {
+	initTestLogs()
+
+	fq := NewFileQueue("/tmp/c0.txt", "/tmp/c1.txt", "/tmp/c2.txt")
+	chk := NewChunker("chk", 2)
+	prt := NewFromShell("prt", "echo {task.index} {i:files|basename} > {o:out}")
+	prt.PathFormatters["out"] = func(task *SciTask) string {
+		return "/tmp/chunk_" + task.GetTag("chunk_index") + ".txt"
+	}
+
+	chk.In.Connect(fq.Out)
+	prt.In["files"].Connect(chk.Out)
+	prt.Out["out"].Chan = make(chan *FileTarget, BUFSIZE)
+
+	go fq.Run()
+	go chk.Run()
+	go prt.Run()
+
+	outs := []string{}
+	for ft := range prt.Out["out"].Chan {
+		outs = append(outs, string(ft.Read()))
+	}
+	assert.EqualValues(t, []string{"0 c0.txt c1.txt\n", "1 c2.txt\n"}, outs)
+
+	cleanFiles("/tmp/chunk_0.txt", "/tmp/chunk_1.txt")
+}
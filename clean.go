@@ -0,0 +1,109 @@
+package scipipe
+
+import (
+	"os"
+	"sort"
+	str "strings"
+	"sync"
+)
+
+// ======= Cleaning ========
+
+// CleanLevel says what Workflow.Clean removes. Each level includes the
+// files removed by the levels before it.
+type CleanLevel int
+
+const (
+	// Temporary files of outputs, left by interrupted tasks, and FIFO files
+	// of streaming outputs, left by interrupted runs
+	CleanTemp CleanLevel = iota
+	// Intermediate outputs, that is, those used as inputs by other tasks of
+	// the workflow (rather than only sent to a sink), with their audit and
+	// log files
+	CleanIntermediate
+	// All outputs, with their audit and log files
+	CleanAll
+)
+
+// Remove the files of the workflow on the level level (see CleanLevel),
+// returning the paths of the removed files. The paths of the files are
+// found by passing the inputs through the workflow, in a pass where no
+// tasks are executed. Since the processes of a workflow can only be run
+// once, a new workflow must be created, after cleaning, to run it.
+func (wf *Workflow) Clean(level CleanLevel) ([]string, error) {
+	tasks, err := wf.createAllTasks()
+	if err != nil {
+		return nil, err
+	}
+
+	inPaths := make(map[string]bool)
+	for _, t := range tasks {
+		for _, itgt := range t.InTargets {
+			if itgt.IsList() {
+				for _, tgt := range itgt.GetTargets() {
+					inPaths[tgt.GetPath()] = true
+				}
+			} else {
+				inPaths[itgt.GetPath()] = true
+			}
+		}
+	}
+
+	paths := []string{}
+	for _, t := range tasks {
+		removedOutputs := make(map[string]bool)
+		for _, otgt := range t.OutTargets {
+			if otgt.IsStreaming() {
+				paths = append(paths, otgt.GetFifoPath())
+				if otgt.streamCache != nil {
+					paths = append(paths, otgt.streamCache.tee.GetFifoPath(), otgt.streamCache.getPath()+".tmp")
+				}
+				continue
+			}
+			paths = append(paths, otgt.GetTempPath(), otgt.GetTempPath()+".gz")
+			if level == CleanAll || (level == CleanIntermediate && inPaths[otgt.GetPath()]) {
+				paths = append(paths, otgt.GetPath(), otgt.GetAuditFilePath())
+				removedOutputs[otgt.GetPath()] = true
+			}
+		}
+		if logPath := t.GetLogPath(); logPath != "" && removedOutputs[str.TrimSuffix(logPath, ".log")] {
+			paths = append(paths, logPath)
+		}
+	}
+	sort.Strings(paths)
+
+	removed := []string{}
+	for i, path := range paths {
+		if i > 0 && path == paths[i-1] {
+			continue
+		}
+		if _, err := os.Lstat(path); err != nil {
+			continue
+		}
+		if err := os.RemoveAll(path); err != nil {
+			return removed, err
+		}
+		Audit.Printf("Workflow %s: Removed %s\n", wf.Name, path)
+		removed = append(removed, path)
+	}
+	return removed, nil
+}
+
+// Create all tasks of the workflow, with the paths of their inputs and
+// outputs, by passing the inputs through the workflow, in a pass where no
+// tasks are executed (which is a run of the workflow, so it can not be run
+// afterwards)
+func (wf *Workflow) createAllTasks() ([]*SciTask, error) {
+	lock := new(sync.Mutex)
+	tasks := []*SciTask{}
+	wf.OnTaskSkipped(func(t *SciTask) {
+		lock.Lock()
+		tasks = append(tasks, t)
+		lock.Unlock()
+	})
+	wf.noExecute = true
+	if err := wf.run(); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
@@ -0,0 +1,36 @@
+package scipipe
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	t "testing"
+)
+
+func newTestCleanWorkflow() *Workflow {
+	wf := newTestFooBarWorkflow("/tmp/clean_")
+	wf.GetSciProcess("f2b").TaskLogFiles = true
+	return wf
+}
+
+func TestClean(t *t.T) {
+	initTestLogs()
+	defer cleanFiles("/tmp/clean_foo.txt", "/tmp/clean_foo.txt.bar", "/tmp/clean_foo.txt.bar.log", "/tmp/clean_foo.txt.bar.tmp")
+
+	assert.Nil(t, newTestCleanWorkflow().Run())
+	// A temporary file, as left by an interrupted task
+	err := ioutil.WriteFile("/tmp/clean_foo.txt.bar.tmp", []byte("ba"), 0644)
+	assert.Nil(t, err)
+
+	removed, err := newTestCleanWorkflow().Clean(CleanTemp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{"/tmp/clean_foo.txt.bar.tmp"}, removed)
+
+	removed, err = newTestCleanWorkflow().Clean(CleanIntermediate)
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{"/tmp/clean_foo.txt", "/tmp/clean_foo.txt.audit.json"}, removed)
+	assert.True(t, NewFileTarget("/tmp/clean_foo.txt.bar").Exists())
+
+	removed, err = newTestCleanWorkflow().Clean(CleanAll)
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{"/tmp/clean_foo.txt.bar", "/tmp/clean_foo.txt.bar.audit.json", "/tmp/clean_foo.txt.bar.log"}, removed)
+}
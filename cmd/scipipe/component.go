@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"gopkg.in/urfave/cli.v1"
+	"io/ioutil"
+	"os"
+
+	sp "github.com/scipipe/scipipe"
+)
+
+// Write a typed component for the command pattern given as the second
+// argument, named as the first argument
+func component(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return cli.NewExitError("Usage: scipipe component [options] TYPENAME COMMAND", 2)
+	}
+	pkg := c.String("package")
+	if pkg == "" {
+		// As set by go generate
+		pkg = os.Getenv("GOPACKAGE")
+	}
+	if pkg == "" {
+		pkg = "main"
+	}
+	buf := new(bytes.Buffer)
+	if err := sp.WriteComponent(buf, pkg, c.Args().Get(0), c.Args().Get(1)); err != nil {
+		return err
+	}
+	if c.String("output") == "" {
+		_, err := os.Stdout.Write(buf.Bytes())
+		return err
+	}
+	if err := ioutil.WriteFile(c.String("output"), buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	fmt.Println("Wrote component", c.Args().Get(0), "to", c.String("output"))
+	return nil
+}
@@ -85,6 +85,51 @@ func main() {
 				return nil
 			},
 		},
+		{
+			Name:      "run",
+			Usage:     "Run the workflow defined in the workflow spec file (.json) given as first argument after 'run'.",
+			ArgsUsage: "SPECFILE",
+			Flags:     []cli.Flag{paramFlag, fromFlag, untilFlag, stateDirFlag},
+			Action:    runWorkflow,
+		},
+		{
+			Name:      "resume",
+			Usage:     "Resume the latest run recorded in the state dir (of the workflow named as first argument after 'resume', if given), skipping tasks whose outputs exist.",
+			ArgsUsage: "[WORKFLOWNAME]",
+			Flags:     []cli.Flag{paramFlag, fromFlag, untilFlag, stateDirFlag},
+			Action:    resumeWorkflow,
+		},
+		{
+			Name:      "clean",
+			Usage:     "Remove temporary files and FIFOs, and optionally intermediate or all outputs, of the workflow defined in the workflow spec file given as first argument after 'clean' (default: that of the latest run in the state dir).",
+			ArgsUsage: "[SPECFILE]",
+			Flags: []cli.Flag{
+				cli.BoolFlag{Name: "intermediate", Usage: "Remove also intermediate outputs, used as inputs by other processes"},
+				cli.BoolFlag{Name: "all", Usage: "Remove also all outputs"},
+				stateDirFlag,
+			},
+			Action: clean,
+		},
+		{
+			Name:      "status",
+			Usage:     "Show the runs recorded in the state dir, and which outputs of the workflow defined in the workflow spec file given as first argument after 'status' (default: that of the latest run) exist, are stale or are missing, with the failed tasks of its latest run.",
+			ArgsUsage: "[SPECFILE]",
+			Flags:     []cli.Flag{stateDirFlag},
+			Action:    status,
+		},
+		{
+			Name:      "component",
+			Usage:     "Generate a typed Go component, with fields for its ports, for the shell command pattern given as second argument after 'component', with the type name given as first argument (for use with go:generate).",
+			ArgsUsage: "TYPENAME COMMAND",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "package", Usage: "The Go package of the component (default: $GOPACKAGE, as set by go generate, or main)"},
+				cli.StringFlag{Name: "output, o", Usage: "The file to write the component to (default: stdout)"},
+			},
+			Action: component,
+		},
+	}
+	if err := app.Run(os.Args); err != nil {
+		errLog.Println(err)
+		os.Exit(1)
 	}
-	app.Run(os.Args)
 }
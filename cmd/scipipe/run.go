@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"gopkg.in/urfave/cli.v1"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	sp "github.com/scipipe/scipipe"
+)
+
+var paramFlag = cli.StringSliceFlag{
+	Name:  "param, p",
+	Usage: "Override a param of the workflow, as NAME=VALUE (can be given more than once)",
+}
+
+var fromFlag = cli.StringSliceFlag{
+	Name:  "from",
+	Usage: "Run only the named process, and those downstream of it, assuming that the outputs of those upstream exist (can be given more than once)",
+}
+
+var untilFlag = cli.StringSliceFlag{
+	Name:  "until",
+	Usage: "Run only the named process, and those upstream of it (can be given more than once)",
+}
+
+var stateDirFlag = cli.StringFlag{
+	Name:  "state-dir",
+	Value: ".scipipe",
+	Usage: "The directory where the state of runs is recorded",
+}
+
+// Run the workflow of the spec file given as argument
+func runWorkflow(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return cli.NewExitError("Usage: scipipe run [options] SPECFILE", 2)
+	}
+	spec, err := sp.ReadWorkflowSpec(c.Args().First())
+	if err != nil {
+		return err
+	}
+	return runSpec(c, spec)
+}
+
+// Run the workflow of the latest run recorded in the state dir again, so
+// that the tasks that did not finish are executed
+func resumeWorkflow(c *cli.Context) error {
+	state, err := sp.ReadLastRunState(c.String("state-dir"), c.Args().First())
+	if err != nil {
+		return err
+	}
+	if state.Spec == nil {
+		return fmt.Errorf("Run %s can not be resumed, since its workflow was not created from a spec", state.Path)
+	}
+	if state.State == sp.RunSucceeded {
+		fmt.Printf("Latest run of workflow %s succeeded, so running it again only checks that its outputs exist\n", state.Workflow)
+	}
+	removeTempPaths(state)
+	return runSpec(c, state.Spec)
+}
+
+// Run the workflow of the spec, with the params given as flags, recording
+// its state in the state dir
+func runSpec(c *cli.Context, spec *sp.WorkflowSpec) error {
+	if spec.Params == nil {
+		spec.Params = make(map[string]string)
+	}
+	for _, param := range c.StringSlice("param") {
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) != 2 {
+			return cli.NewExitError("Params must be given as NAME=VALUE, not: "+param, 2)
+		}
+		spec.Params[kv[0]] = kv[1]
+	}
+	wf, err := sp.NewWorkflowFromSpec(spec)
+	if err != nil {
+		return err
+	}
+	wf.StateDir = c.String("state-dir")
+	wf.RunFrom = c.StringSlice("from")
+	wf.RunUntil = c.StringSlice("until")
+	return wf.Run()
+}
+
+// Remove the temporary files, and, optionally, the intermediate or all
+// outputs, of the workflow of the spec file given as argument, or, if none is
+// given, of the latest run recorded in the state dir
+func clean(c *cli.Context) error {
+	spec, err := getSpec(c)
+	if err != nil {
+		return err
+	}
+	level := sp.CleanTemp
+	if c.Bool("intermediate") {
+		level = sp.CleanIntermediate
+	}
+	if c.Bool("all") {
+		level = sp.CleanAll
+	}
+	wf, err := sp.NewWorkflowFromSpec(spec)
+	if err != nil {
+		return err
+	}
+	removed, err := wf.Clean(level)
+	for _, path := range removed {
+		fmt.Println("Removed", path)
+	}
+	return err
+}
+
+// Get the workflow spec of the spec file given as argument, or, if none is
+// given, of the latest run recorded in the state dir
+func getSpec(c *cli.Context) (*sp.WorkflowSpec, error) {
+	if c.NArg() > 0 {
+		return sp.ReadWorkflowSpec(c.Args().First())
+	}
+	state, err := sp.ReadLastRunState(c.String("state-dir"), "")
+	if err != nil {
+		return nil, err
+	}
+	if state.Spec == nil {
+		return nil, fmt.Errorf("The workflow of run %s was not created from a spec, so give the spec file", state.Path)
+	}
+	return state.Spec, nil
+}
+
+// Remove the temporary files left by the run
+func removeTempPaths(state *sp.RunState) {
+	for _, path := range state.GetLeftoverTempPaths() {
+		fmt.Println("Removing", path)
+		if err := os.RemoveAll(path); err != nil {
+			fmt.Fprintln(os.Stderr, "Could not remove:", err)
+		}
+	}
+}
+
+// Show the runs in the state dir, and which outputs of the workflow of the
+// spec file given as argument (or of the latest run) exist, are stale, and
+// are missing, with the failed tasks of its latest run
+func status(c *cli.Context) error {
+	states, err := sp.ReadRunStates(c.String("state-dir"))
+	if err != nil {
+		return err
+	}
+	if len(states) == 0 {
+		fmt.Println("No runs recorded in", c.String("state-dir"))
+	} else {
+		writeRuns(states)
+	}
+	if c.NArg() == 0 && len(states) == 0 {
+		return nil
+	}
+	spec, err := getSpec(c)
+	if err != nil {
+		return err
+	}
+	wf, err := sp.NewWorkflowFromSpec(spec)
+	if err != nil {
+		return err
+	}
+	wf.StateDir = c.String("state-dir")
+	ins, err := wf.Inspect()
+	if err != nil {
+		return err
+	}
+	fmt.Println()
+	return ins.Write(os.Stdout)
+}
+
+// Write a table of the runs to stdout
+func writeRuns(states []*sp.RunState) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "WORKFLOW\tSTARTED\tDURATION\tSTATE\tTASKS\tFAILED")
+	for _, state := range states {
+		failed := 0
+		for _, tr := range state.Tasks {
+			if !tr.Succeeded {
+				failed++
+			}
+		}
+		duration := "-"
+		if !state.FinishTime.IsZero() {
+			duration = state.FinishTime.Sub(state.StartTime).Round(time.Second).String()
+		}
+		stateName := state.State
+		if stateName == sp.RunRunning {
+			stateName = "running (or interrupted)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%d\n", state.Workflow, state.StartTime.Format("2006-01-02 15:04:05"), duration, stateName, len(state.Tasks), failed)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,74 @@
+package scipipe
+
+import (
+	"sort"
+	str "strings"
+)
+
+// ======= Collector ========
+
+// Collector is a component that receives all targets on its In-port, and
+// when the upstream is done, sends them as one list target (see
+// NewFileListTarget) on its Out-port, sorted by path, so that a downstream
+// process runs a single task for all of them (e.g. merging per-chromosome
+// VCF files). If FofnPath is set, a file of filenames, listing the paths of
+// the targets one per line, is written to FofnPath instead, and sent as an
+// ordinary target, for tools that take such a file rather than the paths
+// on the command line.
+type Collector struct {
+	Process
+	Name     string
+	In       *InPort
+	Out      *OutPort
+	FofnPath string
+}
+
+// Instantiate a Collector component, sending all its inputs as one list
+// target
+func NewCollector(name string) *Collector {
+	return &Collector{
+		Name: name,
+		In:   NewInPort(),
+		Out:  NewOutPort(),
+	}
+}
+
+// Instantiate a Collector component, writing the paths of all its inputs to
+// a file of filenames at fofnPath, and sending it as a target
+func NewFofnCollector(name string, fofnPath string) *Collector {
+	proc := NewCollector(name)
+	proc.FofnPath = fofnPath
+	return proc
+}
+
+func (proc *Collector) IsConnected() bool {
+	return proc.In.IsConnected() && proc.Out.IsConnected()
+}
+
+// Execute the Collector component
+func (proc *Collector) Run() {
+	defer proc.Out.Close()
+	targets := []*FileTarget{}
+	for ft := range proc.In.Chan {
+		targets = append(targets, ft)
+	}
+	if len(targets) == 0 {
+		Warning.Printf("Collector %s: Got no targets, so sending nothing\n", proc.Name)
+		return
+	}
+	sort.SliceStable(targets, func(i, j int) bool {
+		return targets[i].GetPath() < targets[j].GetPath()
+	})
+	list := NewFileListTarget(targets...)
+	if proc.FofnPath == "" {
+		Debug.Printf("Collector %s: Sending list of %d targets\n", proc.Name, len(targets))
+		proc.Out.Chan <- list
+		return
+	}
+	fofn := NewFileTarget(proc.FofnPath)
+	fofn.SetAuditInfo(list.GetAuditInfo())
+	fofn.WriteTempFile([]byte(str.Join(list.GetPaths(), "\n") + "\n"))
+	fofn.Atomize()
+	Debug.Printf("Collector %s: Sending file of filenames %s, listing %d targets\n", proc.Name, fofn.GetPath(), len(targets))
+	proc.Out.Chan <- fofn
+}
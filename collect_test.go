@@ -0,0 +1,42 @@
+package scipipe
+
+import (
+	"github.com/stretchr/testify/assert"
+	t "testing"
+)
+
+func TestCollector(t *t.T) {
+	initTestLogs()
+
+	paths := []string{"/tmp/col_chr2.vcf", "/tmp/col_chr1.vcf", "/tmp/col_chr3.vcf"}
+	newInput := func() chan *FileTarget {
+		ch := make(chan *FileTarget, len(paths))
+		for _, p := range paths {
+			ft := NewFileTarget(p)
+			ft.AddTag("sample", "s1")
+			ch <- ft
+		}
+		close(ch)
+		return ch
+	}
+
+	col := NewCollector("col")
+	col.In.Chan = newInput()
+	col.Out.Chan = make(chan *FileTarget, 1)
+	col.Run()
+	list := <-col.Out.Chan
+	assert.True(t, list.IsList())
+	assert.EqualValues(t, []string{"/tmp/col_chr1.vcf", "/tmp/col_chr2.vcf", "/tmp/col_chr3.vcf"}, list.GetPaths())
+	assert.EqualValues(t, "s1", list.GetTag("sample"))
+
+	fcol := NewFofnCollector("fcol", "/tmp/col_vcfs.fofn")
+	fcol.In.Chan = newInput()
+	fcol.Out.Chan = make(chan *FileTarget, 1)
+	fcol.Run()
+	fofn := <-fcol.Out.Chan
+	assert.False(t, fofn.IsList())
+	assert.EqualValues(t, "/tmp/col_chr1.vcf\n/tmp/col_chr2.vcf\n/tmp/col_chr3.vcf\n", string(fofn.Read()))
+	assert.EqualValues(t, "s1", fofn.GetTag("sample"))
+
+	cleanFiles("/tmp/col_vcfs.fofn")
+}
@@ -0,0 +1,138 @@
+package scipipe
+
+import (
+	"sync"
+)
+
+// CombineMode decides how a ParamCombiner combines its param streams
+type CombineMode int
+
+const (
+	// Emit all combinations of the values (the cartesian product)
+	CombineProduct CombineMode = iota
+	// Emit the first values of all streams together, then the second, and
+	// so on, until the shortest stream is exhausted
+	CombineZip
+)
+
+// ======= ParamCombiner ========
+
+// ParamCombiner is a component that receives all values on its param
+// in-ports (in In), and sends their combinations on the param out-ports (in
+// Out) with the same names, so that each combination becomes a task (or
+// chain of tasks) downstream, as for hyperparameter sweeps. In the product
+// mode, the values of the first named port vary the slowest.
+type ParamCombiner struct {
+	Process
+	Name  string
+	In    map[string]*ParamPort
+	Out   map[string]*ParamPort
+	Mode  CombineMode
+	names []string
+}
+
+// Instantiate a ParamCombiner component, with a param in- and out-port for
+// each of names, combining the values according to mode
+func NewParamCombiner(name string, mode CombineMode, names ...string) *ParamCombiner {
+	proc := &ParamCombiner{
+		Name:  name,
+		In:    make(map[string]*ParamPort),
+		Out:   make(map[string]*ParamPort),
+		Mode:  mode,
+		names: names,
+	}
+	for _, n := range names {
+		proc.In[n] = NewParamPort()
+		proc.Out[n] = NewParamPort()
+	}
+	return proc
+}
+
+func (proc *ParamCombiner) IsConnected() bool {
+	isConnected := true
+	for _, n := range proc.names {
+		if !proc.In[n].IsConnected() || !proc.Out[n].IsConnected() {
+			Error.Printf("Param port %s of ParamCombiner %s is not connected - check your workflow code!\n", n, proc.Name)
+			isConnected = false
+		}
+	}
+	return isConnected
+}
+
+// Execute the ParamCombiner component
+func (proc *ParamCombiner) Run() {
+	defer func() {
+		for _, n := range proc.names {
+			proc.Out[n].Close()
+		}
+	}()
+	// Receive on all ports concurrently, since upstream processes may send
+	// on several of them in turn
+	values := make(map[string][]string)
+	lock := new(sync.Mutex)
+	wg := new(sync.WaitGroup)
+	for _, n := range proc.names {
+		wg.Add(1)
+		go func(n string) {
+			defer wg.Done()
+			vals := []string{}
+			for val := range proc.In[n].Chan {
+				vals = append(vals, val)
+			}
+			lock.Lock()
+			values[n] = vals
+			lock.Unlock()
+		}(n)
+	}
+	wg.Wait()
+
+	for _, combination := range proc.combine(values) {
+		for i, n := range proc.names {
+			proc.Out[n].Chan <- combination[i]
+		}
+	}
+}
+
+// Get the combinations of values, as slices of values in the order of the
+// port names
+func (proc *ParamCombiner) combine(values map[string][]string) [][]string {
+	combinations := [][]string{}
+	if len(proc.names) == 0 {
+		return combinations
+	}
+	if proc.Mode == CombineZip {
+		minLen := len(values[proc.names[0]])
+		sameLen := true
+		for _, n := range proc.names {
+			if len(values[n]) != minLen {
+				sameLen = false
+			}
+			if len(values[n]) < minLen {
+				minLen = len(values[n])
+			}
+		}
+		if !sameLen {
+			Warning.Printf("ParamCombiner %s: Streams of different lengths zipped, so ignoring extra values\n", proc.Name)
+		}
+		for i := 0; i < minLen; i++ {
+			combination := []string{}
+			for _, n := range proc.names {
+				combination = append(combination, values[n][i])
+			}
+			combinations = append(combinations, combination)
+		}
+		return combinations
+	}
+	combinations = append(combinations, []string{})
+	for _, n := range proc.names {
+		extended := [][]string{}
+		for _, combination := range combinations {
+			for _, val := range values[n] {
+				c := append(append([]string{}, combination...), val)
+				extended = append(extended, c)
+			}
+		}
+		combinations = extended
+	}
+	return combinations
+}
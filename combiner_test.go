@@ -0,0 +1,35 @@
+package scipipe
+
+import (
+	"github.com/stretchr/testify/assert"
+	t "testing"
+)
+
+func TestParamCombiner(t *t.T) {
+	initTestLogs()
+
+	for _, tc := range []struct {
+		mode CombineMode
+		exp  []string
+	}{
+		{CombineProduct, []string{"a1 b1", "a1 b2", "a2 b1", "a2 b2", "a3 b1", "a3 b2"}},
+		{CombineZip, []string{"a1 b1", "a2 b2"}},
+	} {
+		cmb := NewParamCombiner("cmb", tc.mode, "a", "b")
+		for n, vals := range map[string][]string{"a": {"a1", "a2", "a3"}, "b": {"b1", "b2"}} {
+			cmb.In[n].Chan = make(chan string, len(vals))
+			for _, val := range vals {
+				cmb.In[n].Chan <- val
+			}
+			close(cmb.In[n].Chan)
+			cmb.Out[n].Chan = make(chan string, 10)
+		}
+		cmb.Run()
+
+		got := []string{}
+		for a := range cmb.Out["a"].Chan {
+			got = append(got, a+" "+<-cmb.Out["b"].Chan)
+		}
+		assert.EqualValues(t, tc.exp, got)
+	}
+}
@@ -0,0 +1,170 @@
+package scipipe
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	str "strings"
+)
+
+// ======= Config files ========
+
+// Config holds defaults for running workflows, read from config files (see
+// ConfigFiles), and applied when a PipelineRunner or Workflow is run, unless
+// its NoConfig is set, for the settings not set in the code of the workflow,
+// as in config.yaml:
+//
+//	prepend: srun -c 4
+//	shell: bash
+//	executor: local
+//	max_concurrent_tasks: 16
+//	temp_dir: /scratch/tmp
+//	log_level: info
+//
+// Workers (see WorkerPool) can not be set in config files, so that commands
+// are never sent to other machines without the workflow saying so, and nor
+// can the dry-run and mock executors, so that a stray config file can not
+// make a run skip its commands, or write fake outputs, that later runs take
+// for real ones. Keys not listed here fail the run, so that misspelled ones
+// are not silently ignored.
+type Config struct {
+	// The prepend string of processes without one (see SciProcess.Prepend)
+	Prepend string `json:"prepend" yaml:"prepend"`
+	// The shell of processes without one (see SciProcess.Shell)
+	Shell string `json:"shell" yaml:"shell"`
+	// How the commands of tasks are executed, which can only be local (the
+	// default) in config files. Dry runs (see PipelineRunner.DryRun) and
+	// mocked runs (see MockExecutor) are chosen by the workflow itself.
+	Executor string `json:"executor" yaml:"executor"`
+	// The maximum number of tasks executing their commands at the same time
+	// (see PipelineRunner.MaxConcurrentTasks)
+	MaxConcurrentTasks int `json:"max_concurrent_tasks" yaml:"max_concurrent_tasks"`
+	// The directory that outputs are written to before they are atomized
+	// (see SciProcess.SetOutTempDir)
+	TempDir string `json:"temp_dir" yaml:"temp_dir"`
+	// The log level: debug, info, audit, warning or error. It only applies
+	// if logging is not initiated by the workflow, with InitLog.
+	LogLevel string `json:"log_level" yaml:"log_level"`
+}
+
+// The config files read, without extension, in order, so that settings in
+// later files override those in earlier ones: the per-user file in the home
+// directory, and the per-project file in the working directory. Files are
+// read in the formats of workflow specs (see RegisterSpecFormat), so that
+// config.json, config.yaml and config.yml are supported.
+var ConfigFiles = getDefaultConfigFiles()
+
+func getDefaultConfigFiles() []string {
+	files := []string{}
+	if home, err := os.UserHomeDir(); err == nil {
+		files = append(files, filepath.Join(home, ".scipipe", "config"))
+	}
+	return append(files, filepath.Join(".scipipe", "config"))
+}
+
+// Read the config from the config files in ConfigFiles that exist
+func ReadConfig() (*Config, error) {
+	cfg := &Config{}
+	specRegistryLock.RLock()
+	exts := []string{}
+	for ext := range specFormats {
+		exts = append(exts, ext)
+	}
+	specRegistryLock.RUnlock()
+	sort.Strings(exts)
+	for _, file := range ConfigFiles {
+		for _, ext := range exts {
+			path := file + ext
+			data, err := ioutil.ReadFile(path)
+			if os.IsNotExist(err) {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			specRegistryLock.RLock()
+			unmarshal := specFormats[ext]
+			specRegistryLock.RUnlock()
+			// Settings missing in the file are left as they are
+			if err := unmarshal(data, cfg); err != nil {
+				return nil, fmt.Errorf("Could not parse config file %s: %s", path, err)
+			}
+			Audit.Println("Read config file:", path)
+		}
+	}
+	return cfg, nil
+}
+
+// Read the config, unless NoConfig is set, and apply it to the pipeline and
+// its SciProcesses
+func (pl *PipelineRunner) setUpConfig() error {
+	if pl.NoConfig {
+		return nil
+	}
+	cfg, err := ReadConfig()
+	if err != nil {
+		return err
+	}
+	return pl.applyConfig(cfg)
+}
+
+// Apply the settings of the config cfg that are not set on the pipeline, or
+// its SciProcesses
+func (pl *PipelineRunner) applyConfig(cfg *Config) error {
+	if cfg.LogLevel != "" && logIsDefault {
+		if err := initLogLevel(cfg.LogLevel); err != nil {
+			return err
+		}
+		logIsDefault = true
+	}
+	if pl.MaxConcurrentTasks == 0 {
+		pl.MaxConcurrentTasks = cfg.MaxConcurrentTasks
+	}
+	switch str.ToLower(cfg.Executor) {
+	case "", "local":
+	case "dry-run", "mock":
+		return fmt.Errorf("The %s executor can not be chosen in config files, only by the workflow itself", cfg.Executor)
+	default:
+		return fmt.Errorf("Unknown executor in config: %s", cfg.Executor)
+	}
+	for _, proc := range flattenProcesses(pl.processes) {
+		sp, ok := proc.(*SciProcess)
+		if !ok {
+			continue
+		}
+		if sp.Prepend == "" && sp.PrependFunc == nil {
+			sp.Prepend = cfg.Prepend
+		}
+		if sp.Shell == "" {
+			sp.Shell = cfg.Shell
+		}
+		if cfg.TempDir != "" {
+			for oname := range sp.Out {
+				if sp.OutPortsTempDir[oname] == "" {
+					sp.SetOutTempDir(oname, cfg.TempDir)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Initiate logging with the level level, as named in config files
+func initLogLevel(level string) error {
+	switch str.ToLower(level) {
+	case "debug":
+		InitLogDebug()
+	case "info":
+		InitLogInfo()
+	case "audit":
+		InitLogAudit()
+	case "warning":
+		InitLogWarning()
+	case "error":
+		InitLogError()
+	default:
+		return fmt.Errorf("Unknown log level in config: %s", level)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package scipipe
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	t "testing"
+)
+
+func TestConfig(t *t.T) {
+	initTestLogs()
+	defer func(files []string) { ConfigFiles = files }(ConfigFiles)
+	os.MkdirAll("/tmp/config_test/user", 0777)
+	os.MkdirAll("/tmp/config_test/project", 0777)
+	defer os.RemoveAll("/tmp/config_test")
+	ConfigFiles = []string{"/tmp/config_test/user/config", "/tmp/config_test/project/config"}
+
+	ioutil.WriteFile("/tmp/config_test/user/config.json", []byte(`{"prepend": "nice", "max_concurrent_tasks": 4, "temp_dir": "/tmp/config_test/tmp"}`), 0644)
+	ioutil.WriteFile("/tmp/config_test/project/config.json", []byte(`{"max_concurrent_tasks": 8}`), 0644)
+
+	cfg, err := ReadConfig()
+	assert.Nil(t, err)
+	assert.EqualValues(t, "nice", cfg.Prepend)
+	assert.EqualValues(t, 8, cfg.MaxConcurrentTasks)
+
+	p := NewFromShell("echo", "echo hi > {o:out}")
+	p.SetPathStatic("out", "/tmp/config_test/out.txt")
+	own := NewFromShell("own", "echo hi > {o:out}")
+	own.SetPathStatic("out", "/tmp/config_test/own.txt")
+	own.Prepend = "time"
+	own.SetOutTempDir("out", "/tmp/config_test/owntmp")
+	snk := NewSink()
+	snk.Connect(p.Out["out"])
+	snk.Connect(own.Out["out"])
+	wf := NewWorkflow("config")
+	wf.AddProcesses(p, own, snk)
+	assert.Nil(t, wf.Run())
+
+	assert.EqualValues(t, 8, wf.MaxConcurrentTasks)
+	assert.EqualValues(t, "nice", p.Prepend)
+	assert.EqualValues(t, "/tmp/config_test/tmp", p.OutPortsTempDir["out"])
+	// Settings made in the code are kept
+	assert.EqualValues(t, "time", own.Prepend)
+	assert.EqualValues(t, "/tmp/config_test/owntmp", own.OutPortsTempDir["out"])
+	_, err = os.Stat("/tmp/config_test/out.txt")
+	assert.Nil(t, err)
+
+	ioutil.WriteFile("/tmp/config_test/project/config.json", []byte(`{"max_concurrent_tasks": "many"}`), 0644)
+	_, err = ReadConfig()
+	assert.NotNil(t, err)
+}
+
+func TestConfigYAML(t *t.T) {
+	initTestLogs()
+	defer func(files []string) { ConfigFiles = files }(ConfigFiles)
+	os.MkdirAll("/tmp/config_yaml_test", 0777)
+	defer os.RemoveAll("/tmp/config_yaml_test")
+	ConfigFiles = []string{"/tmp/config_yaml_test/config"}
+
+	// Workers are never set from config files, and unknown keys fail
+	ioutil.WriteFile("/tmp/config_yaml_test/config.yaml", []byte("workers: [node1:7070]\n"), 0644)
+	_, err := ReadConfig()
+	assert.NotNil(t, err)
+
+	ioutil.WriteFile("/tmp/config_yaml_test/config.yaml", []byte("# Defaults\nprepend: nice\nshell: sh\nmax_concurrent_tasks: 2\n"), 0644)
+	cfg, err := ReadConfig()
+	assert.Nil(t, err)
+	assert.EqualValues(t, "nice", cfg.Prepend)
+	assert.EqualValues(t, "sh", cfg.Shell)
+	assert.EqualValues(t, 2, cfg.MaxConcurrentTasks)
+
+	newWf := func() (*Workflow, *SciProcess, *SciProcess) {
+		p := NewFromShell("echo", "echo hi > {o:out}")
+		p.SetPathStatic("out", "/tmp/config_yaml_test/out.txt")
+		own := NewFromShell("own", "echo hi > {o:out}")
+		own.SetPathStatic("out", "/tmp/config_yaml_test/own.txt")
+		// The default shell, set explicitly, is kept
+		own.Shell = DefaultShell
+		wf := NewWorkflow("config")
+		wf.AddProcesses(p, own, NewSink())
+		wf.Connect("echo.out", "sink.in")
+		wf.Connect("own.out", "sink.in")
+		return wf, p, own
+	}
+
+	// Config files are not read when opted out of
+	wf, p, _ := newWf()
+	wf.NoConfig = true
+	assert.Nil(t, wf.Run())
+	assert.EqualValues(t, "", p.Prepend)
+	assert.EqualValues(t, 0, wf.MaxConcurrentTasks)
+	cleanFiles("/tmp/config_yaml_test/out.txt", "/tmp/config_yaml_test/own.txt")
+
+	wf, p, own := newWf()
+	assert.Nil(t, wf.Run())
+	assert.EqualValues(t, "nice", p.Prepend)
+	assert.EqualValues(t, "sh", p.Shell)
+	assert.EqualValues(t, DefaultShell, own.Shell)
+	assert.EqualValues(t, 2, wf.MaxConcurrentTasks)
+	assert.Nil(t, wf.Workers)
+}
+
+func TestConfigExecutor(t *t.T) {
+	initTestLogs()
+	defer func(files []string) { ConfigFiles = files }(ConfigFiles)
+	os.MkdirAll("/tmp/config_executor_test", 0777)
+	defer os.RemoveAll("/tmp/config_executor_test")
+	ConfigFiles = []string{"/tmp/config_executor_test/config"}
+
+	newWf := func() *Workflow {
+		p := NewFromShell("echo", "echo hi > {o:out}")
+		p.SetPathStatic("out", "/tmp/config_executor_test/out.txt")
+		wf := NewWorkflow("config")
+		wf.AddProcesses(p, NewSink())
+		wf.Connect("echo.out", "sink.in")
+		return wf
+	}
+
+	ioutil.WriteFile("/tmp/config_executor_test/config.yaml", []byte("executor: local\n"), 0644)
+	assert.Nil(t, newWf().Run())
+	_, err := os.Stat("/tmp/config_executor_test/out.txt")
+	assert.Nil(t, err)
+	cleanFiles("/tmp/config_executor_test/out.txt")
+
+	// Config files can not make runs skip their commands, or write fake
+	// outputs
+	for _, executor := range []string{"mock", "dry-run"} {
+		ioutil.WriteFile("/tmp/config_executor_test/config.yaml", []byte("executor: "+executor+"\n"), 0644)
+		wf := newWf()
+		err := wf.Run()
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "can not be chosen in config files")
+		assert.Nil(t, wf.Mock)
+		assert.False(t, NewFileTarget("/tmp/config_executor_test/out.txt").Exists())
+	}
+
+	ioutil.WriteFile("/tmp/config_executor_test/config.yaml", []byte("executor: slurm\n"), 0644)
+	err = newWf().Run()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Unknown executor in config: slurm")
+
+	// Misspelled keys fail, rather than being ignored
+	ioutil.WriteFile("/tmp/config_executor_test/config.yaml", []byte("max_concurent_tasks: 2\n"), 0644)
+	err = newWf().Run()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "max_concurent_tasks")
+}
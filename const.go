@@ -4,3 +4,29 @@ const (
 	// Standard buffer size used for channels connecting processes
 	BUFSIZE = 16
 )
+
+// The buffer size of the channels created when connecting ports, unless
+// set on the ports (see OutPort.SetBufferSize). Larger buffers let fast
+// producers run further ahead of slow consumers, at the cost of memory.
+var PortBufferSize = BUFSIZE
+
+// The maximum number of tasks of a process that are in flight (created,
+// but with their outputs not yet sent), unless set on the process (see
+// SciProcess.MaxInFlightTasks). Together with the buffer sizes, this bounds
+// the memory used by processes with very many tasks.
+var DefaultMaxInFlightTasks = 1024
+
+// Get the largest of the buffer sizes sizes set on ports, or PortBufferSize
+// if none is set
+func getBufferSize(sizes ...int) int {
+	size := 0
+	for _, s := range sizes {
+		if s > size {
+			size = s
+		}
+	}
+	if size == 0 {
+		return PortBufferSize
+	}
+	return size
+}
@@ -0,0 +1,133 @@
+package scipipe
+
+import (
+	"encoding/csv"
+	"io"
+	"os"
+	str "strings"
+)
+
+// ======= CSVSource ========
+
+// CSVSource is a component that reads a delimited file with a header row,
+// such as a sample sheet, and emits one set of values per row, so that the
+// file drives the workflow. Each column gets a param port (in ParamPorts),
+// named after the column, on which the values of the column are sent.
+// Columns with file paths can instead be set up (with SetPathColumns) to be
+// sent as targets, on out-ports (in Out), tagged with all values of the row
+// (so that e.g. a sample ID can be used in downstream commands and paths).
+// Ports that are not connected are skipped.
+type CSVSource struct {
+	Process
+	Name       string
+	Path       string
+	Delimiter  rune
+	ParamPorts map[string]*ParamPort
+	Out        map[string]*OutPort
+	columns    []string
+}
+
+// Instantiate a CSVSource component reading the file at path, with its
+// columns detected from the header row. The delimiter is a tab for files
+// with a .tsv extension, and a comma otherwise.
+func NewCSVSource(name string, path string) *CSVSource {
+	proc := &CSVSource{
+		Name:       name,
+		Path:       path,
+		Delimiter:  ',',
+		ParamPorts: make(map[string]*ParamPort),
+		Out:        make(map[string]*OutPort),
+	}
+	if str.HasSuffix(path, ".tsv") {
+		proc.Delimiter = '\t'
+	}
+	f, err := os.Open(path)
+	Check(err)
+	defer f.Close()
+	header, err := proc.newReader(f).Read()
+	Check(err)
+	proc.columns = header
+	for _, col := range header {
+		proc.ParamPorts[col] = NewParamPort()
+	}
+	return proc
+}
+
+// Send the values of the columns cols as targets on out-ports, instead of as
+// params
+func (proc *CSVSource) SetPathColumns(cols ...string) {
+	for _, col := range cols {
+		delete(proc.ParamPorts, col)
+		proc.Out[col] = NewOutPort()
+	}
+}
+
+func (proc *CSVSource) newReader(r io.Reader) *csv.Reader {
+	rd := csv.NewReader(r)
+	rd.Comma = proc.Delimiter
+	rd.Comment = '#'
+	return rd
+}
+
+func (proc *CSVSource) IsConnected() bool {
+	for _, pport := range proc.ParamPorts {
+		if pport.IsConnected() {
+			return true
+		}
+	}
+	for _, oport := range proc.Out {
+		if oport.IsConnected() {
+			return true
+		}
+	}
+	Error.Printf("None of the ports of CSVSource %s is connected - check your workflow code!\n", proc.Name)
+	return false
+}
+
+// Execute the CSVSource component
+func (proc *CSVSource) Run() {
+	defer proc.closePorts()
+	f, err := os.Open(proc.Path)
+	Check(err)
+	defer f.Close()
+	rd := proc.newReader(f)
+	_, err = rd.Read() // Skip header
+	Check(err)
+	for {
+		rec, err := rd.Read()
+		if err == io.EOF {
+			break
+		}
+		Check(err)
+		row := make(map[string]string)
+		for i, col := range proc.columns {
+			row[col] = rec[i]
+		}
+		Debug.Printf("CSVSource %s: Sending row: %v\n", proc.Name, row)
+		for col, pport := range proc.ParamPorts {
+			if pport.Chan != nil {
+				pport.Chan <- row[col]
+			}
+		}
+		for col, oport := range proc.Out {
+			if oport.Chan != nil {
+				ft := NewFileTarget(row[col])
+				ft.AddTags(row)
+				oport.Chan <- ft
+			}
+		}
+	}
+}
+
+func (proc *CSVSource) closePorts() {
+	for _, pport := range proc.ParamPorts {
+		if pport.Chan != nil {
+			pport.Close()
+		}
+	}
+	for _, oport := range proc.Out {
+		if oport.Chan != nil {
+			oport.Close()
+		}
+	}
+}
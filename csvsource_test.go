@@ -0,0 +1,41 @@
+package scipipe
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	t "testing"
+)
+
+func TestCSVSource(t *t.T) {
+	initTestLogs()
+
+	err := ioutil.WriteFile("/tmp/csvsource_sheet.tsv", []byte("sample\treads\tthreads\n"+
+		"# A comment\n"+
+		"s1\t/tmp/csvsource_s1.fq\t2\n"+
+		"s2\t/tmp/csvsource_s2.fq\t4\n"), 0644)
+	Check(err)
+
+	src := NewCSVSource("src", "/tmp/csvsource_sheet.tsv")
+	src.SetPathColumns("reads")
+	assert.NotNil(t, src.Out["reads"])
+	assert.Nil(t, src.ParamPorts["reads"])
+
+	prc := NewFromShell("prc", "echo {t:sample} {i:reads} {p:threads} > {o:out}")
+	prc.PathFormatters["out"] = func(task *SciTask) string {
+		return "/tmp/csvsource_" + task.GetTag("sample") + ".txt"
+	}
+	prc.In["reads"].Connect(src.Out["reads"])
+	prc.ParamPorts["threads"].Connect(src.ParamPorts["threads"])
+	prc.Out["out"].Chan = make(chan *FileTarget, BUFSIZE)
+
+	go src.Run()
+	go prc.Run()
+
+	outs := []string{}
+	for ft := range prc.Out["out"].Chan {
+		outs = append(outs, string(ft.Read()))
+	}
+	assert.EqualValues(t, []string{"s1 /tmp/csvsource_s1.fq 2\n", "s2 /tmp/csvsource_s2.fq 4\n"}, outs)
+
+	cleanFiles("/tmp/csvsource_sheet.tsv", "/tmp/csvsource_s1.txt", "/tmp/csvsource_s2.txt")
+}
@@ -0,0 +1,375 @@
+package scipipe
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	str "strings"
+)
+
+// ======= CWL export ========
+
+// The CWL version of exported documents
+const cwlVersion = "v1.2"
+
+// Write the workflow as Common Workflow Language (CWL) documents to the
+// directory dir: a CommandLineTool document for each SciProcess, named
+// PROCESSNAME.cwl, and a Workflow document, named WORKFLOWNAME.cwl, running
+// them as steps, connected as in the workflow. Documents are written as JSON,
+// which is valid YAML, and so accepted by CWL runners such as cwltool.
+//
+// In-ports not connected to another SciProcess (such as those fed by a
+// FileSource) and params become inputs of the CWL workflow, named
+// PROCESSNAME_PORTNAME, and out-ports not connected to another SciProcess
+// become its outputs. Placeholders in command patterns are translated to
+// CWL parameter references, and output file names are found by calling the
+// path formatters with references to the inputs, so that, for example, a
+// path extended with ".bar" becomes "$(inputs.in.basename).bar". As when
+// executed, the values of placeholders are quoted in commands, unless the
+// raw modifier is used, and the basename, dirname and noext path modifiers
+// of inputs are translated to the properties of CWL File inputs. Processes
+// with placeholders with other modifiers (or that are optional, or have
+// flags or default values), with a CustomExecute function, or with Go
+// template command patterns, can not be exported.
+func (wf *Workflow) WriteCWL(dir string) error {
+	err := os.MkdirAll(dir, 0777)
+	if err != nil {
+		return err
+	}
+	tools := make(map[string]*cwlTool)
+	for _, name := range wf.procNames {
+		p, ok := wf.procsByName[name].(*SciProcess)
+		if !ok {
+			continue
+		}
+		tool, err := newCWLTool(p)
+		if err != nil {
+			return err
+		}
+		tools[name] = tool
+		err = writeCWLFile(filepath.Join(dir, name+".cwl"), tool.doc)
+		if err != nil {
+			return err
+		}
+	}
+	return writeCWLFile(filepath.Join(dir, wf.Name+".cwl"), wf.newCWLWorkflow(tools))
+}
+
+// Create the CWL Workflow document for the workflow, given the tools of its
+// processes, by process name
+func (wf *Workflow) newCWLWorkflow(tools map[string]*cwlTool) map[string]interface{} {
+	// Find the SciProcess out-port that each in-port receives from
+	sources := make(map[string]string)
+	fedOutPorts := make(map[string]bool)
+	for _, c := range wf.GetConnections() {
+		from, to := str.SplitN(c.From, ".", 2), str.SplitN(c.To, ".", 2)
+		if tools[from[0]] == nil || tools[to[0]] == nil {
+			continue
+		}
+		sources[c.To] = from[0] + "/" + from[1]
+		fedOutPorts[c.From] = true
+	}
+
+	inputs := make(map[string]interface{})
+	outputs := make(map[string]interface{})
+	steps := make(map[string]interface{})
+	for _, name := range wf.procNames {
+		tool := tools[name]
+		if tool == nil {
+			continue
+		}
+		stepIn := make(map[string]interface{})
+		for _, iname := range tool.inputNames {
+			if src, ok := sources[name+"."+iname]; ok {
+				stepIn[iname] = src
+				continue
+			}
+			inputs[name+"_"+iname] = tool.inputs[iname]
+			stepIn[iname] = name + "_" + iname
+		}
+		for _, oname := range tool.outputNames {
+			if !fedOutPorts[name+"."+oname] {
+				outputs[name+"_"+oname] = map[string]interface{}{
+					"type":         "File",
+					"outputSource": name + "/" + oname,
+				}
+			}
+		}
+		steps[name] = map[string]interface{}{
+			"run": name + ".cwl",
+			"in":  stepIn,
+			"out": tool.outputNames,
+		}
+	}
+	return map[string]interface{}{
+		"cwlVersion": cwlVersion,
+		"class":      "Workflow",
+		"id":         wf.Name,
+		"inputs":     inputs,
+		"outputs":    outputs,
+		"steps":      steps,
+	}
+}
+
+// cwlTool is the CWL CommandLineTool document for a process, with the names
+// of its inputs and outputs, sorted
+type cwlTool struct {
+	doc         map[string]interface{}
+	inputs      map[string]interface{}
+	inputNames  []string
+	outputNames []string
+}
+
+// Create the CWL CommandLineTool document for the process p
+func newCWLTool(p *SciProcess) (*cwlTool, error) {
+	if err := checkExportable(p, "CWL"); err != nil {
+		return nil, err
+	}
+	tool := &cwlTool{inputs: make(map[string]interface{})}
+	tags := make(map[string]bool)
+	ref := func(typ string, name string) string {
+		switch typ {
+		case "i", "is":
+			return "$(inputs." + name + ".path)"
+		case "p":
+			return "$(inputs." + name + ")"
+		case "t":
+			tags[name] = true
+			return "$(inputs.tag_" + name + ")"
+		}
+		return "${" + name + "}"
+	}
+	// Output file names are relative to the output directory, so contain
+	// the base names of inputs
+	outFileRef := func(typ string, name string) string {
+		if typ == "i" {
+			return "$(inputs." + name + ".basename)"
+		}
+		return ref(typ, name)
+	}
+
+	// Find the output file names, relative to the output directory
+	outFiles := make(map[string]string)
+	for oname := range p.Out {
+		tool.outputNames = append(tool.outputNames, oname)
+		outFiles[oname] = replaceExportMarkers(getExportOutPath(p, oname), outFileRef)
+	}
+	sort.Strings(tool.outputNames)
+
+	// Translate the placeholders in the command, quoted as they are when
+	// executed
+	var phErr error
+	cmd := getShellCommandPlaceHolderRegex().ReplaceAllStringFunc(p.CommandPattern, func(ph string) string {
+		m := getShellCommandPlaceHolderRegex().FindStringSubmatch(ph)
+		val, raw, err := translateCWLPlaceHolder(m[1], m[2], splitPlaceHolderModifiers(m[3]), outFiles, ref)
+		if err != nil {
+			if phErr == nil {
+				phErr = fmt.Errorf("Process %s can not be exported to CWL, since its placeholder %s can not be translated: %s", p.Name, ph, err)
+			}
+			return ph
+		}
+		if raw {
+			return val
+		}
+		if m[1] == "env" {
+			// Quoted so that the variable is still expanded by the shell
+			return `"` + val + `"`
+		}
+		return "'" + val + "'"
+	})
+	if phErr != nil {
+		return nil, phErr
+	}
+	cmd = getTaskPlaceHolderRegex().ReplaceAllStringFunc(cmd, func(ph string) string {
+		switch ph {
+		case "{task.cores}":
+			return "$(runtime.cores)"
+		case "{task.memory}":
+			return "$(runtime.ram)"
+		case "{task.scratch}":
+			return "$(runtime.tmpdir)"
+		}
+		return p.Name
+	})
+	if p.Prepend != "" {
+		cmd = p.Prepend + " " + cmd
+	}
+
+	for iname := range p.In {
+		input := map[string]interface{}{"type": "File"}
+		if path, ok := p.InPortsDefault[iname]; ok {
+			input["default"] = map[string]interface{}{"class": "File", "location": path}
+		} else if p.InPortsOptional[iname] {
+			input["type"] = []interface{}{"null", "File"}
+		}
+		tool.inputs[iname] = input
+	}
+	for pname := range p.ParamPorts {
+		tool.inputs[pname] = newCWLParamInput(p.ParamSpecs[pname])
+	}
+	for tname := range tags {
+		tool.inputs["tag_"+tname] = map[string]interface{}{"type": "string"}
+	}
+	for name := range tool.inputs {
+		tool.inputNames = append(tool.inputNames, name)
+	}
+	sort.Strings(tool.inputNames)
+
+	outputs := make(map[string]interface{})
+	for oname, ofile := range outFiles {
+		outputs[oname] = map[string]interface{}{
+			"type":          "File",
+			"outputBinding": map[string]interface{}{"glob": ofile},
+		}
+	}
+	requirements := []interface{}{
+		map[string]interface{}{"class": "ShellCommandRequirement"},
+	}
+	if len(p.Env) > 0 {
+		envDef := make(map[string]string)
+		for k, v := range p.Env {
+			envDef[k] = v
+		}
+		requirements = append(requirements, map[string]interface{}{"class": "EnvVarRequirement", "envDef": envDef})
+	}
+	if p.Cores > 0 || p.MemoryMB > 0 {
+		resources := map[string]interface{}{"class": "ResourceRequirement"}
+		if p.Cores > 0 {
+			resources["coresMin"] = p.Cores
+		}
+		if p.MemoryMB > 0 {
+			resources["ramMin"] = p.MemoryMB
+		}
+		requirements = append(requirements, resources)
+	}
+	tool.doc = map[string]interface{}{
+		"cwlVersion":   cwlVersion,
+		"class":        "CommandLineTool",
+		"id":           p.Name,
+		"requirements": requirements,
+		"arguments": []interface{}{
+			map[string]interface{}{"valueFrom": cmd, "shellQuote": false},
+		},
+		"inputs":  tool.inputs,
+		"outputs": outputs,
+	}
+	return tool, nil
+}
+
+// The properties of CWL File inputs that the path modifiers of placeholders
+// are translated to, by the property that each is applied to, where
+// "pathnoext" stands for the path without its extension
+var cwlPathModifiers = map[string]map[string]string{
+	"path":      {"basename": "basename", "dirname": "dirname", "noext": "pathnoext"},
+	"basename":  {"basename": "basename", "noext": "nameroot"},
+	"nameroot":  {"basename": "nameroot"},
+	"pathnoext": {"basename": "nameroot"},
+}
+
+// Translate a placeholder of type typ for the port, param or tag name, with
+// the modifiers mods, to a CWL parameter reference (as returned by ref for
+// unmodified inputs, params and tags), given the output file names of the
+// tool, returning whether the raw modifier is used. An error is returned for
+// modifiers that can not be translated.
+func translateCWLPlaceHolder(typ string, name string, mods []string, outFiles map[string]string, ref func(typ string, name string) string) (val string, raw bool, err error) {
+	opts := parsePlaceHolderModifiers(typ, mods)
+	if opts.optional || opts.flag != "" || opts.hasDefault {
+		return "", false, errors.New("Optional placeholders, flags and default values are not supported")
+	}
+	prop := "path"
+	for _, mod := range opts.mods {
+		switch {
+		case mod == "raw":
+			raw = true
+		case (typ == "i" || typ == "is") && cwlPathModifiers[prop][mod] != "":
+			prop = cwlPathModifiers[prop][mod]
+		case (typ == "o" || typ == "os") && mod == "basename":
+			// Outputs are written to the working directory anyway
+		default:
+			return "", false, errors.New("The modifier " + mod + " is not supported")
+		}
+	}
+	switch typ {
+	case "o", "os":
+		return outFiles[name], raw, nil
+	case "i", "is":
+		if prop == "pathnoext" {
+			return "$(inputs." + name + ".dirname)/$(inputs." + name + ".nameroot)", raw, nil
+		}
+		return "$(inputs." + name + "." + prop + ")", raw, nil
+	}
+	return ref(typ, name), raw, nil
+}
+
+// Create the CWL input for a param with the spec ps (which may be nil)
+func newCWLParamInput(ps *ParamSpec) map[string]interface{} {
+	if ps == nil {
+		return map[string]interface{}{"type": "string"}
+	}
+	var typ interface{}
+	switch ps.Type {
+	case ParamTypeInt:
+		typ = "int"
+	case ParamTypeFloat:
+		typ = "double"
+	case ParamTypeBool:
+		typ = "boolean"
+	case ParamTypeEnum:
+		typ = map[string]interface{}{"type": "enum", "symbols": ps.Choices}
+	default:
+		typ = "string"
+	}
+	if ps.Optional && !ps.HasDefault {
+		typ = []interface{}{"null", typ}
+	}
+	input := map[string]interface{}{"type": typ}
+	if ps.HasDefault {
+		input["default"] = cwlDefaultValue(ps.Type, ps.Default)
+	}
+	return input
+}
+
+// Convert the default value of a param to the JSON value of its type
+func cwlDefaultValue(typ ParamType, val string) interface{} {
+	switch typ {
+	case ParamTypeInt:
+		if i, err := strconv.ParseInt(val, 10, 64); err == nil {
+			return i
+		}
+	case ParamTypeFloat:
+		if f, err := strconv.ParseFloat(val, 64); err == nil {
+			return f
+		}
+	case ParamTypeBool:
+		if b, err := strconv.ParseBool(val); err == nil {
+			return b
+		}
+	}
+	return val
+}
+
+// Write the CWL document doc to the file at path
+func writeCWLFile(path string, doc map[string]interface{}) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = writeCWL(f, doc)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Write the CWL document doc to w, as indented JSON
+func writeCWL(w io.Writer, doc map[string]interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
@@ -0,0 +1,86 @@
+package scipipe
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	t "testing"
+)
+
+func TestWriteCWL(t *t.T) {
+	initTestLogs()
+
+	wf := newTestFooBarWorkflow("/tmp/cwl_")
+	foo := wf.GetSciProcess("foo")
+	foo.SetCommand("echo {p:word} > {o:out}")
+	foo.PathFormatters["out"] = func(t *SciTask) string { return "/tmp/" + t.Params["word"] + ".txt" }
+	foo.SetParamDefault("word", "foo")
+	wf.GetSciProcess("f2b").Cores = 2
+
+	dir := "/tmp/cwl_test"
+	err := wf.WriteCWL(dir)
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	readDoc := func(name string) map[string]interface{} {
+		data, err := ioutil.ReadFile(dir + "/" + name)
+		assert.Nil(t, err)
+		doc := make(map[string]interface{})
+		assert.Nil(t, json.Unmarshal(data, &doc))
+		return doc
+	}
+
+	fooTool := readDoc("foo.cwl")
+	assert.EqualValues(t, "CommandLineTool", fooTool["class"])
+	assert.EqualValues(t, "echo '$(inputs.word)' > '$(inputs.word).txt'", fooTool["arguments"].([]interface{})[0].(map[string]interface{})["valueFrom"])
+	assert.EqualValues(t, map[string]interface{}{"type": "string", "default": "foo"}, fooTool["inputs"].(map[string]interface{})["word"])
+
+	f2bTool := readDoc("f2b.cwl")
+	assert.EqualValues(t, "sed 's/foo/bar/' '$(inputs.in.path)' > '$(inputs.in.basename).bar'", f2bTool["arguments"].([]interface{})[0].(map[string]interface{})["valueFrom"])
+	assert.EqualValues(t, map[string]interface{}{"glob": "$(inputs.in.basename).bar"}, f2bTool["outputs"].(map[string]interface{})["out"].(map[string]interface{})["outputBinding"])
+	assert.Contains(t, f2bTool["requirements"], map[string]interface{}{"class": "ResourceRequirement", "coresMin": 2.0})
+
+	wfDoc := readDoc("wf.cwl")
+	assert.EqualValues(t, "Workflow", wfDoc["class"])
+	steps := wfDoc["steps"].(map[string]interface{})
+	assert.EqualValues(t, map[string]interface{}{"word": "foo_word"}, steps["foo"].(map[string]interface{})["in"])
+	assert.EqualValues(t, map[string]interface{}{"in": "foo/out"}, steps["f2b"].(map[string]interface{})["in"])
+	assert.Len(t, wfDoc["inputs"], 1)
+	assert.EqualValues(t, map[string]interface{}{"f2b_out": map[string]interface{}{"type": "File", "outputSource": "f2b/out"}}, wfDoc["outputs"])
+
+	wf.AddProcess(NewSciProcess("custom", ""))
+	wf.GetSciProcess("custom").CustomExecute = func(t *SciTask) error { return nil }
+	assert.Error(t, wf.WriteCWL(dir))
+}
+
+func TestWriteCWLPlaceHolderModifiers(t *t.T) {
+	initTestLogs()
+
+	wf := NewWorkflow("wf")
+	cat := NewFromShell("cat", "cat {i:in|basename|noext} {i:in|noext} {i:in|dirname|raw} > {o:out}")
+	cat.SetPathStatic("out", "/tmp/cwl_cat.txt")
+	wf.AddProcess(cat)
+
+	dir := "/tmp/cwl_test_mods"
+	defer os.RemoveAll(dir)
+	assert.Nil(t, wf.WriteCWL(dir))
+	data, err := ioutil.ReadFile(dir + "/cat.cwl")
+	assert.Nil(t, err)
+	doc := make(map[string]interface{})
+	assert.Nil(t, json.Unmarshal(data, &doc))
+	assert.EqualValues(t, "cat '$(inputs.in.nameroot)' '$(inputs.in.dirname)/$(inputs.in.nameroot)' $(inputs.in.dirname) > 'cwl_cat.txt'", doc["arguments"].([]interface{})[0].(map[string]interface{})["valueFrom"])
+
+	for _, cmd := range []string{
+		"cat {i:in|%.txt} > {o:out}",
+		"cat {i:in|dirname|basename} > {o:out}",
+		"echo {p:x|default:foo} > {o:out}",
+		"cat {i:in} > {o:out|dirname}",
+	} {
+		wf := NewWorkflow("wf")
+		proc := NewFromShell("proc", cmd)
+		proc.SetPathStatic("out", "/tmp/cwl_proc.txt")
+		wf.AddProcess(proc)
+		assert.Error(t, wf.WriteCWL(dir), "Command: %s", cmd)
+	}
+}
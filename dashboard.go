@@ -0,0 +1,178 @@
+package scipipe
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	str "strings"
+)
+
+// ======= Dashboard ========
+
+// Get an http.Handler serving a dashboard for the workflow, showing the
+// workflow graph with the state of each process, the progress and
+// throughput of the run, and the most recently finished tasks. The page
+// ("/") refreshes itself every few seconds, and the status is also served
+// as JSON, at "/status" (see GetStatus).
+func (wf *Workflow) DashboardHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(wf.GetStatus())
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		err := dashboardTemplate.Execute(w, newDashboardPage(wf.GetStatus()))
+		if err != nil {
+			Warning.Printf("Workflow %s: Could not render dashboard: %s\n", wf.Name, err)
+		}
+	})
+	return mux
+}
+
+// Start serving handler on addr, if set, returning a function that stops
+// serving it. What is served is described by what, in log messages.
+func (wf *Workflow) startHTTPServer(addr string, what string, handler http.Handler) (stop func()) {
+	if addr == "" {
+		return func() {}
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		Warning.Printf("Workflow %s: Could not serve %s on %s: %s\n", wf.Name, what, addr, err)
+		return func() {}
+	}
+	Info.Printf("Workflow %s: Serving %s on %s\n", wf.Name, what, ln.Addr())
+	go http.Serve(ln, handler)
+	return func() {
+		ln.Close()
+	}
+}
+
+// ------- Rendering of the dashboard page -------
+
+// The size of, and space between, the boxes of processes in the graph
+const (
+	dashboardBoxWidth  = 160
+	dashboardBoxHeight = 36
+	dashboardGapX      = 60
+	dashboardGapY      = 24
+)
+
+type dashboardPage struct {
+	Status WorkflowStatus
+	Width  int
+	Height int
+	Boxes  []dashboardBox
+	Lines  []dashboardLine
+}
+
+type dashboardBox struct {
+	Name  string
+	State string
+	Tasks string
+	X, Y  int
+}
+
+type dashboardLine struct {
+	X1, Y1, X2, Y2 int
+}
+
+// Lay out the workflow graph of the status ws in columns, by the length of
+// the longest path from a process without upstream processes
+func newDashboardPage(ws WorkflowStatus) *dashboardPage {
+	upstream := make(map[string][]string)
+	for _, c := range ws.Connections {
+		from, to := str.SplitN(c.From, ".", 2)[0], str.SplitN(c.To, ".", 2)[0]
+		if from != to {
+			upstream[to] = append(upstream[to], from)
+		}
+	}
+	depth := make(map[string]int)
+	// Relax the depths at most as many times as there are processes, so that
+	// cycles do not make this loop forever
+	for range ws.Processes {
+		changed := false
+		for _, ps := range ws.Processes {
+			for _, up := range upstream[ps.Name] {
+				if depth[up]+1 > depth[ps.Name] && depth[up]+1 < len(ws.Processes) {
+					depth[ps.Name] = depth[up] + 1
+					changed = true
+				}
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+
+	page := &dashboardPage{Status: ws}
+	rows := make(map[int]int)
+	centers := make(map[string][2]int)
+	for _, ps := range ws.Processes {
+		col := depth[ps.Name]
+		x := dashboardGapX/2 + col*(dashboardBoxWidth+dashboardGapX)
+		y := dashboardGapY/2 + rows[col]*(dashboardBoxHeight+dashboardGapY)
+		rows[col]++
+		box := dashboardBox{Name: ps.Name, State: ps.State, X: x, Y: y}
+		if ps.Stats.TasksCreated > 0 {
+			box.Tasks = fmt.Sprintf("%d/%d tasks", ps.Stats.GetTasksDone(), ps.Stats.TasksCreated)
+		}
+		page.Boxes = append(page.Boxes, box)
+		centers[ps.Name] = [2]int{x, y + dashboardBoxHeight/2}
+		if x+dashboardBoxWidth+dashboardGapX/2 > page.Width {
+			page.Width = x + dashboardBoxWidth + dashboardGapX/2
+		}
+		if y+dashboardBoxHeight+dashboardGapY/2 > page.Height {
+			page.Height = y + dashboardBoxHeight + dashboardGapY/2
+		}
+	}
+	for _, c := range ws.Connections {
+		from, to := centers[str.SplitN(c.From, ".", 2)[0]], centers[str.SplitN(c.To, ".", 2)[0]]
+		page.Lines = append(page.Lines, dashboardLine{X1: from[0] + dashboardBoxWidth, Y1: from[1], X2: to[0], Y2: to[1]})
+	}
+	return page
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="3">
+<title>{{.Status.Name}} - SciPipe</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-top: 1em; }
+td, th { border: 1px solid #ccc; padding: 4px 8px; text-align: left; font-size: 0.9em; }
+rect { stroke: #555; }
+.waiting { fill: #eee; }
+.running { fill: #9cf; }
+.done { fill: #9d9; }
+.failed { fill: #f99; }
+tr.failed td { background: #fdd; }
+</style>
+</head>
+<body>
+<h1>{{.Status.Name}}</h1>
+<p>{{.Status.Progress}} &middot; {{printf "%.1f" .Status.TasksPerMinute}} tasks/min</p>
+<svg width="{{.Width}}" height="{{.Height}}">
+{{range .Lines}}<line x1="{{.X1}}" y1="{{.Y1}}" x2="{{.X2}}" y2="{{.Y2}}" stroke="#888"/>
+{{end}}{{range .Boxes}}<g><rect class="{{.State}}" x="{{.X}}" y="{{.Y}}" width="160" height="36" rx="4"/>
+<text x="{{.X}}" y="{{.Y}}" dx="8" dy="15" font-size="12">{{.Name}}</text>
+<text x="{{.X}}" y="{{.Y}}" dx="8" dy="30" font-size="10">{{.State}} {{.Tasks}}</text></g>
+{{end}}</svg>
+<h2>Recent tasks</h2>
+<table>
+<tr><th>Task</th><th>Duration</th><th>Command</th><th>Error</th></tr>
+{{range .Status.RecentTasks}}<tr{{if not .Succeeded}} class="failed"{{end}}><td>{{.Name}} #{{.Index}}</td><td>{{.GetDuration}}</td><td><code>{{.Command}}</code></td><td><pre>{{.Error}}</pre></td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
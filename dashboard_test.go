@@ -0,0 +1,56 @@
+package scipipe
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http/httptest"
+	t "testing"
+)
+
+func TestWorkflowStatus(t *t.T) {
+	initTestLogs()
+
+	wf := newTestFooBarWorkflow("/tmp/status_")
+
+	status := wf.GetStatus()
+	assert.EqualValues(t, ProcessWaiting, status.Processes[0].State)
+	assert.EqualValues(t, []Connection{
+		{From: "f2b.out", To: "sink.in"},
+		{From: "foo.out", To: "f2b.in"},
+	}, status.Connections)
+
+	err := wf.Run()
+	assert.Nil(t, err)
+
+	status = wf.GetStatus()
+	for _, ps := range status.Processes {
+		assert.EqualValues(t, ProcessDone, ps.State)
+	}
+	// The in-ports of the sink are kept while, and after, it runs
+	assert.Len(t, status.Connections, 2)
+	assert.Len(t, status.RecentTasks, 2)
+	assert.EqualValues(t, "foo", status.RecentTasks[0].Name)
+	assert.True(t, status.RecentTasks[0].Succeeded)
+
+	srv := httptest.NewServer(wf.DashboardHandler())
+	defer srv.Close()
+	resp, err := srv.Client().Get(srv.URL + "/")
+	assert.Nil(t, err)
+	page, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Nil(t, err)
+	assert.Contains(t, string(page), ">f2b</text>")
+	assert.Contains(t, string(page), "2/2 tasks done")
+
+	resp, err = srv.Client().Get(srv.URL + "/status")
+	assert.Nil(t, err)
+	decoded := WorkflowStatus{}
+	err = json.NewDecoder(resp.Body).Decode(&decoded)
+	resp.Body.Close()
+	assert.Nil(t, err)
+	assert.EqualValues(t, "wf", decoded.Name)
+	assert.Len(t, decoded.Processes, 3)
+
+	cleanFiles("/tmp/status_foo.txt", "/tmp/status_foo.txt.bar")
+}
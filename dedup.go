@@ -0,0 +1,96 @@
+package scipipe
+
+import (
+	"fmt"
+	"sort"
+	str "strings"
+	"sync"
+)
+
+// ======= Deduplication of tasks ========
+
+// runningTask is a task being executed, which identical tasks created
+// meanwhile wait for, rather than executing their commands too
+type runningTask struct {
+	task *SciTask
+	done chan struct{}
+	err  error
+}
+
+var (
+	runningTasks     = make(map[string]*runningTask)
+	runningTasksLock sync.Mutex
+)
+
+// Get the signature of the task, identifying tasks that are the same, in
+// that they have the same command and output paths, or "" if it is not
+// deduplicated, since it has no file outputs, or streams any of them. The
+// inputs are not hashed, since tasks running at the same time, writing the
+// same outputs with the same command, also have the same inputs.
+func (t *SciTask) getSignature() string {
+	if t.CustomExecute != nil || len(t.OutTargets) == 0 {
+		return ""
+	}
+	paths := []string{}
+	for _, otgt := range t.OutTargets {
+		if otgt.IsStreaming() || otgt.IsInMemory() {
+			return ""
+		}
+		paths = append(paths, otgt.GetPath())
+	}
+	sort.Strings(paths)
+	return t.Command + "\x00" + str.Join(paths, "\x00")
+}
+
+// Register the task as running, unless the same task (see getSignature) is
+// already running, which is then returned
+func (t *SciTask) claimSignature() *runningTask {
+	sig := t.getSignature()
+	if sig == "" {
+		return nil
+	}
+	runningTasksLock.Lock()
+	defer runningTasksLock.Unlock()
+	if rt, ok := runningTasks[sig]; ok {
+		return rt
+	}
+	runningTasks[sig] = &runningTask{task: t, done: make(chan struct{})}
+	t.signature = sig
+	return nil
+}
+
+// Unregister the task as running, once it is done, letting the identical
+// tasks waiting for it finish with its result
+func (t *SciTask) releaseSignature() {
+	if t.signature == "" {
+		return
+	}
+	runningTasksLock.Lock()
+	rt := runningTasks[t.signature]
+	delete(runningTasks, t.signature)
+	runningTasksLock.Unlock()
+	if rt != nil && rt.task == t {
+		rt.err = t.err
+		close(rt.done)
+	}
+}
+
+// Finish the task, which is the same as the running task rt, with the
+// result of rt, when done, instead of executing its command, since both
+// would write the same outputs
+func (t *SciTask) executeDuplicate(rt *runningTask) {
+	defer close(t.Done)
+	t.logStructured(LevelInfo, "Waiting for identical task to finish, instead of executing its command", Fields{"identical_task": rt.task.Name, "identical_task_index": rt.task.Index, "command": t.Command})
+	<-rt.done
+	if rt.err != nil {
+		t.err = fmt.Errorf("Identical task %s (#%d) failed: %s", rt.task.Name, rt.task.Index, rt.err)
+		t.process.recordTaskStarted(t)
+		t.process.recordTaskFailed(t, t.err)
+	} else {
+		t.process.recordTaskSkipped(t, fmt.Sprintf("since identical task %s (#%d) executed it", rt.task.Name, rt.task.Index))
+		for _, tgt := range t.OutTargets {
+			tgt.SetAuditInfo(nil)
+		}
+	}
+	t.Done <- 1
+}
@@ -38,8 +38,8 @@ func NewFooer() *Fooer {
 	// Set the output formatter to a static string
 	innerFoo.SetPathStatic("foo", "foo.txt")
 	// Create the custom execute function, with pure Go code
-	innerFoo.CustomExecute = func(task *sci.SciTask) {
-		task.OutTargets["foo"].WriteTempFile([]byte("foo\n"))
+	innerFoo.CustomExecute = func(task *sci.SciTask) error {
+		return task.WriteOutString("foo", "foo\n")
 	}
 	// Connect the ports of the outer task to the inner, generic one
 	fooer := &Fooer{
@@ -76,8 +76,8 @@ func NewFoo2Barer() *Foo2Barer {
 	// Set the output formatter to extend the path on the "bar"" in-port
 	innerProc.SetPathExtend("foo", "bar", ".bar.txt")
 	// Create the custom execute function, with pure Go code
-	innerProc.CustomExecute = func(task *sci.SciTask) {
-		task.OutTargets["bar"].WriteTempFile(bytes.Replace(task.InTargets["foo"].Read(), []byte("foo"), []byte("bar"), 1))
+	innerProc.CustomExecute = func(task *sci.SciTask) error {
+		return task.WriteOut("bar", bytes.Replace(task.InTargets["foo"].Read(), []byte("foo"), []byte("bar"), 1))
 	}
 
 	// Connect the ports of the outer task to the inner, generic one
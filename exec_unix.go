@@ -0,0 +1,57 @@
+//go:build !windows
+// +build !windows
+
+package scipipe
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// The shell that commands are executed with by default (see DefaultShell)
+const defaultPlatformShell = "bash"
+
+// Make the command run in its own process group, so that it can be killed
+// together with any processes it starts, such as those of a shell command
+func setKillableProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// Kill the process group of the (started) command
+func killProcessGroup(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// Get the resources used by the (exited) command with the process state
+// state, or nil if not available
+func getResourceUsage(state *os.ProcessState) *ResourceUsage {
+	ru, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return nil
+	}
+	maxRSSKB := int64(ru.Maxrss)
+	if runtime.GOOS == "darwin" {
+		// In bytes, rather than kilobytes
+		maxRSSKB /= 1024
+	}
+	return &ResourceUsage{
+		UserCPUTime:   time.Duration(ru.Utime.Nano()),
+		SystemCPUTime: time.Duration(ru.Stime.Nano()),
+		MaxRSSKB:      maxRSSKB,
+		// In blocks of 512 bytes
+		ReadBytes:    int64(ru.Inblock) * 512,
+		WrittenBytes: int64(ru.Oublock) * 512,
+	}
+}
+
+// Set the command line of the command to args, after the shell, as is.
+// Only needed on Windows, where the command line is a single string.
+func setRawCommandLine(cmd *exec.Cmd, shell string, args string) {}
+
+// Rename the file or directory at srcPath to dstPath
+func renameFile(srcPath string, dstPath string) error {
+	return os.Rename(srcPath, dstPath)
+}
@@ -0,0 +1,55 @@
+//go:build windows
+// +build windows
+
+package scipipe
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// The shell that commands are executed with by default (see DefaultShell)
+const defaultPlatformShell = "cmd"
+
+// Process groups are not used on Windows, where only the command itself is
+// killed
+func setKillableProcessGroup(cmd *exec.Cmd) {}
+
+// Kill the (started) command
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
+
+// Get the resources used by the (exited) command with the process state
+// state, which are only the CPU times on Windows
+func getResourceUsage(state *os.ProcessState) *ResourceUsage {
+	return &ResourceUsage{
+		UserCPUTime:   state.UserTime(),
+		SystemCPUTime: state.SystemTime(),
+	}
+}
+
+// Set the command line of the command to args, after the shell, as is,
+// rather than quoting the arguments of the command
+func setRawCommandLine(cmd *exec.Cmd, shell string, args string) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CmdLine: syscall.EscapeArg(shell) + " " + args}
+}
+
+// Rename the file or directory at srcPath to dstPath. Since files that were
+// just written can be held open for a moment by other programs, such as
+// virus scanners, which makes renaming them fail, it is retried a few times.
+func renameFile(srcPath string, dstPath string) error {
+	var err error
+	for i := 0; i < 10; i++ {
+		if err = os.Rename(srcPath, dstPath); err == nil {
+			return nil
+		}
+		if _, statErr := os.Stat(srcPath); statErr != nil {
+			return err
+		}
+		time.Sleep(time.Duration(i+1) * 50 * time.Millisecond)
+	}
+	return err
+}
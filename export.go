@@ -0,0 +1,87 @@
+package scipipe
+
+import (
+	"fmt"
+	"path/filepath"
+	re "regexp"
+	str "strings"
+)
+
+// ======= Helpers for exporting workflows to other languages ========
+
+// The markers standing in for the paths of inputs, and the values of params
+// and tags, when calling path formatters, to be replaced with references in
+// the exported language afterwards
+var exportMarkerRegex = re.MustCompile(`@@export:(i|p|t):([^@]+)@@`)
+
+func exportMarker(typ string, name string) string {
+	return "@@export:" + typ + ":" + name + "@@"
+}
+
+// Replace the markers in s with what ref returns for the type ("i", "p" or
+// "t") and name of each
+func replaceExportMarkers(s string, ref func(typ string, name string) string) string {
+	return exportMarkerRegex.ReplaceAllStringFunc(s, func(m string) string {
+		parts := exportMarkerRegex.FindStringSubmatch(m)
+		return ref(parts[1], parts[2])
+	})
+}
+
+// Check that the process p can be exported to the language lang, that is,
+// that its commands are given by a (non-template) command pattern
+func checkExportable(p *SciProcess, lang string) error {
+	if p.CustomExecute != nil {
+		return fmt.Errorf("Process %s can not be exported to %s, since it has a CustomExecute function", p.Name, lang)
+	}
+	if p.PrependFunc != nil {
+		return fmt.Errorf("Process %s can not be exported to %s, since it has a PrependFunc function", p.Name, lang)
+	}
+	if p.isTemplateCommand(p.CommandPattern) {
+		return fmt.Errorf("Process %s can not be exported to %s, since its command pattern is a Go template", p.Name, lang)
+	}
+	return nil
+}
+
+// Get the path of the out-port oname of the process p, as returned by its
+// path formatter for a task with markers (see replaceExportMarkers) for the
+// paths of its inputs, and the values of its params and tags. Only the base
+// name of the path is returned, since exported tools write outputs to their
+// working directory. If the path formatter can not be called in this way,
+// the port name is used.
+func getExportOutPath(p *SciProcess, oname string) (path string) {
+	path = oname
+	ofun := p.PathFormatters[oname]
+	if ofun == nil {
+		return
+	}
+	t := &SciTask{
+		Name:       p.Name,
+		InTargets:  make(map[string]*FileTarget),
+		OutTargets: make(map[string]*FileTarget),
+		Params:     make(map[string]string),
+		AuditInfo:  NewAuditInfo(),
+		process:    p,
+	}
+	for iname := range p.In {
+		t.InTargets[iname] = NewFileTarget(exportMarker("i", iname))
+	}
+	for pname := range p.ParamPorts {
+		t.Params[pname] = exportMarker("p", pname)
+	}
+	for _, m := range getShellCommandPlaceHolderRegex().FindAllStringSubmatch(p.CommandPattern, -1) {
+		if m[1] == "t" {
+			t.AuditInfo.Tags[m[2]] = exportMarker("t", m[2])
+		}
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			p.logStructured(LevelWarning, "Could not get the output file name of out-port for export", Fields{"out_port": oname, "error": fmt.Sprint(r)})
+			path = oname
+		}
+	}()
+	path = filepath.Base(ofun(t))
+	if p.OutPortsCompress[oname] && !str.HasSuffix(path, ".gz") {
+		path += ".gz"
+	}
+	return path
+}
@@ -1,29 +1,63 @@
 package scipipe
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"sort"
+	str "strings"
 	"sync"
 )
 
 // ======= FileTarget ========
 
 // FileTarget contains information and helper methods for a physical file on a
-// normal disk.
+// normal disk. It is the information packet sent between processes, and can
+// also wrap custom Target implementations (see NewFileTargetFromTarget).
 type FileTarget struct {
 	path     string
+	url      string
+	remote   RemoteHandler
 	buffer   *bytes.Buffer
 	doStream bool
-	lock     *sync.Mutex
+	glob     string
+	list     []*FileTarget
+	compress bool
+	inMemory bool
+	value    interface{}
+	custom   Target
+	pipe     *targetPipe
+	// The cache of a streamed output, if cached (see
+	// SciProcess.SetOutStreamCache)
+	streamCache *streamCache
+	// Get the content signature of the task writing the stream, if a
+	// streamed output (see SciTask.getContentSignature)
+	getStreamSignature func() string
+	tempDir            string
+	lock               *sync.Mutex
+	auditInfo          *AuditInfo
 }
 
-// Create new FileTarget "object"
+// Create new FileTarget "object". If path is a URL with a scheme for which a
+// RemoteHandler is registered (such as gs:// or az://), the file is staged
+// in to, and out from, a local path under RemoteStagingDir.
 func NewFileTarget(path string) *FileTarget {
 	ft := new(FileTarget)
 	ft.path = path
 	ft.lock = new(sync.Mutex)
+	if handler, ok := getRemoteHandler(path); ok {
+		ft.url = path
+		ft.remote = handler
+		ft.path = remoteLocalPath(path)
+	}
 	//Don't init buffer if not needed?
 	//buf := make([]byte, 0, 128)
 	//ft.buffer = bytes.NewBuffer(buf)
@@ -32,19 +66,344 @@ func NewFileTarget(path string) *FileTarget {
 
 // Get the (final) path of the physical file
 func (ft *FileTarget) GetPath() string {
+	if ft.custom != nil {
+		return ft.custom.GetPath()
+	}
 	return ft.path
 }
 
+// Create a new FileTarget representing the set of files matching the glob
+// pattern pattern, inside the directory dirPath
+func NewFileSetTarget(dirPath string, pattern string) *FileTarget {
+	ft := NewFileTarget(dirPath)
+	ft.glob = pattern
+	return ft
+}
+
+// Create a new FileTarget representing a list of targets, such as the
+// targets gathered from several upstream tasks. Placeholders for list
+// targets are replaced with the paths of all targets, separated by spaces
+// or by the separator given with the join modifier, as in
+// {i:bams|join:" -I "}. The list target has the tags that all its targets
+// have in common, and the audit info of each target as upstream audit info.
+func NewFileListTarget(targets ...*FileTarget) *FileTarget {
+	ft := NewFileTarget("")
+	ft.list = targets
+	ai := NewAuditInfo()
+	for i, tgt := range targets {
+		tags := tgt.GetTags()
+		if i == 0 {
+			ai.Tags = tags
+		}
+		for k, v := range ai.Tags {
+			if tags[k] != v {
+				delete(ai.Tags, k)
+			}
+		}
+		ai.Upstream[fmt.Sprintf("%d", i)] = tgt.GetAuditInfo()
+	}
+	ft.auditInfo = ai
+	return ft
+}
+
+// Get a copy of the target, with a copy of its audit info, so that tags can
+// be added to the copy without affecting the original target (or other
+// targets sharing its audit info)
+func (ft *FileTarget) Copy() *FileTarget {
+	ai := ft.GetAuditInfo()
+	ft.lock.Lock()
+	cp := *ft
+	aiCopy := *ai
+	aiCopy.Tags = make(map[string]string)
+	for k, v := range ai.Tags {
+		aiCopy.Tags[k] = v
+	}
+	ft.lock.Unlock()
+	cp.lock = new(sync.Mutex)
+	cp.auditInfo = &aiCopy
+	return &cp
+}
+
+// Check whether the target is a list of targets
+func (ft *FileTarget) IsList() bool {
+	return ft.list != nil
+}
+
+// Get the targets of a list target
+func (ft *FileTarget) GetTargets() []*FileTarget {
+	return ft.list
+}
+
+// Create a new in-memory target, carrying a value instead of pointing to a
+// file on disk. The value can be a string, a []byte, or any other Go value
+// (such as a struct), and is interpolated into commands, in its string form,
+// where the target is used on an in-port.
+func NewInMemoryTarget(value interface{}) *FileTarget {
+	ft := NewFileTarget("")
+	ft.inMemory = true
+	ft.value = value
+	return ft
+}
+
+// Check whether the target is an in-memory target
+func (ft *FileTarget) IsInMemory() bool {
+	return ft.inMemory
+}
+
+// Get the value of an in-memory target
+func (ft *FileTarget) GetValue() interface{} {
+	return ft.value
+}
+
+// Get the value of an in-memory target as a string. Strings and []byte values
+// are returned as is, while other values are formatted with fmt.Sprint
+func (ft *FileTarget) GetValueString() string {
+	switch v := ft.value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Check whether the file is gzip compressed, which is the case for files set
+// to be compressed, and for files with a .gz extension that start with the
+// gzip magic bytes (or that do not exist yet)
+func (ft *FileTarget) IsCompressed() bool {
+	if ft.compress {
+		return true
+	}
+	if !str.HasSuffix(ft.GetPath(), ".gz") {
+		return false
+	}
+	f, err := os.Open(ft.GetPath())
+	if err != nil {
+		return true
+	}
+	defer f.Close()
+	magic := make([]byte, 2)
+	n, _ := io.ReadFull(f, magic)
+	return n == 2 && magic[0] == 0x1f && magic[1] == 0x8b
+}
+
+// Check whether the target is a set of files in a directory, rather than a
+// single file
+func (ft *FileTarget) IsFileSet() bool {
+	return ft.glob != ""
+}
+
+// Get the glob pattern used to select the files of a file set target
+func (ft *FileTarget) GetGlob() string {
+	return ft.glob
+}
+
+// Get the (final) paths of all files in the target. For normal targets this
+// is just the path of the file, while for file sets, it is the (sorted) paths
+// of all files in the directory matching the target's glob pattern, and for
+// list targets, the paths of the targets in the list.
+func (ft *FileTarget) GetPaths() []string {
+	if ft.IsList() {
+		paths := []string{}
+		for _, tgt := range ft.list {
+			paths = append(paths, tgt.GetPath())
+		}
+		return paths
+	}
+	if !ft.IsFileSet() {
+		return []string{ft.GetPath()}
+	}
+	paths, err := filepath.Glob(filepath.Join(ft.GetPath(), ft.glob))
+	Check(err)
+	sort.Strings(paths)
+	return paths
+}
+
+// Get the URL of a remote file, or an empty string for local files
+func (ft *FileTarget) GetURL() string {
+	return ft.url
+}
+
+// Check whether the file is stored remotely, and staged in and out locally
+func (ft *FileTarget) IsRemote() bool {
+	return ft.remote != nil
+}
+
+// Download a remote file to its local path, unless it is already there
+func (ft *FileTarget) StageIn() error {
+	if !ft.IsRemote() {
+		return nil
+	}
+	ft.lock.Lock()
+	defer ft.lock.Unlock()
+	if _, err := os.Stat(ft.GetPath()); err == nil {
+		cachingHandler, isCaching := ft.remote.(CachingRemoteHandler)
+		if !isCaching || cachingHandler.IsUpToDate(ft.url, ft.GetPath()) {
+			return nil
+		}
+		Debug.Println("FileTarget: Locally staged file is outdated, so downloading again:", ft.url)
+	}
+	Debug.Println("FileTarget: Staging in", ft.url, "->", ft.GetPath())
+	if err := os.MkdirAll(filepath.Dir(ft.GetPath()), 0777); err != nil {
+		return err
+	}
+	// Download to the temp path first, to not leave partial files behind
+	if err := ft.remote.Download(ft.url, ft.GetTempPath()); err != nil {
+		return fmt.Errorf("Could not stage in %s: %s", ft.url, err)
+	}
+	if err := renameFile(ft.GetTempPath(), ft.GetPath()); err != nil {
+		return err
+	}
+	if ft.remote.Exists(ft.url + ".audit.json") {
+		if err := ft.remote.Download(ft.url+".audit.json", ft.GetAuditFilePath()); err != nil {
+			Warning.Println("FileTarget: Could not stage in audit file for", ft.url)
+		}
+	}
+	return nil
+}
+
+// Upload a (finalized) local file to its remote URL, together with its audit
+// file, if any
+func (ft *FileTarget) StageOut() error {
+	if !ft.IsRemote() {
+		return nil
+	}
+	ft.lock.Lock()
+	defer ft.lock.Unlock()
+	Debug.Println("FileTarget: Staging out", ft.GetPath(), "->", ft.url)
+	if err := ft.remote.Upload(ft.GetPath(), ft.url); err != nil {
+		return fmt.Errorf("Could not stage out %s: %s", ft.url, err)
+	}
+	if _, err := os.Stat(ft.GetAuditFilePath()); err == nil {
+		if err := ft.remote.Upload(ft.GetAuditFilePath(), ft.url+".audit.json"); err != nil {
+			return fmt.Errorf("Could not stage out audit file of %s: %s", ft.url, err)
+		}
+	}
+	if metaHandler, ok := ft.remote.(MetadataRemoteHandler); ok && ft.auditInfo != nil {
+		if err := metaHandler.SetMetadata(ft.url, ft.auditInfo); err != nil {
+			return fmt.Errorf("Could not set metadata of %s: %s", ft.url, err)
+		}
+	}
+	return nil
+}
+
 // Get the temporary path of the physical file
 func (ft *FileTarget) GetTempPath() string {
+	if ft.custom != nil {
+		return ft.custom.GetTempPath()
+	}
+	if ft.tempDir != "" {
+		// Named after the whole path, so that targets with the same file
+		// name in different directories do not clash
+		sum := sha1.Sum([]byte(ft.path))
+		return filepath.Join(ft.tempDir, filepath.Base(ft.path)+"."+hex.EncodeToString(sum[:4])+".tmp")
+	}
 	return ft.path + ".tmp"
 }
 
+// Set the directory that the temporary file of the target is written to,
+// rather than next to its final path, such as a directory on a fast local
+// disk. If the directory is on another file system than the final path, the
+// file is copied when atomized, to a hidden file next to the final path,
+// which is then renamed, so that the final path still appears atomically.
+func (ft *FileTarget) SetTempDir(dir string) {
+	ft.tempDir = dir
+}
+
 // Get the path to use when a FIFO file is used instead of a normal file
 func (ft *FileTarget) GetFifoPath() string {
+	if ft.custom != nil {
+		return ft.custom.GetFifoPath()
+	}
 	return ft.path + ".fifo"
 }
 
+// Check whether the file is streamed, via a FIFO file, rather than written
+// to disk
+func (ft *FileTarget) IsStreaming() bool {
+	if ft.custom != nil {
+		return ft.doStream || ft.custom.IsStreaming()
+	}
+	return ft.doStream
+}
+
+// Get the path of the JSON file containing audit info for the file
+func (ft *FileTarget) GetAuditFilePath() string {
+	return ft.GetPath() + ".audit.json"
+}
+
+// Get the audit info for the file. If not set in memory, it is read from the
+// audit file, if one exists, or otherwise an empty AuditInfo is returned.
+// In-memory targets only keep their audit info in memory.
+func (ft *FileTarget) GetAuditInfo() *AuditInfo {
+	ft.lock.Lock()
+	defer ft.lock.Unlock()
+	if ft.auditInfo == nil && ft.inMemory {
+		ft.auditInfo = NewAuditInfo()
+	} else if ft.auditInfo == nil {
+		ai, err := NewAuditInfoFromFile(ft.GetAuditFilePath())
+		if err != nil {
+			ai = NewAuditInfo()
+		}
+		ft.auditInfo = ai
+	}
+	return ft.auditInfo
+}
+
+// Set the audit info for the file
+func (ft *FileTarget) SetAuditInfo(ai *AuditInfo) {
+	ft.lock.Lock()
+	ft.auditInfo = ai
+	ft.lock.Unlock()
+}
+
+// Write the audit info of the file to its audit file
+func (ft *FileTarget) WriteAuditInfo() {
+	ft.GetAuditInfo().WriteToFile(ft.GetAuditFilePath())
+}
+
+// Add a tag (key-value metadata, such as sample ID) to the file. Tags are
+// stored in the audit info of the file, which means that they are shared
+// by all outputs of the task that produced the file, and are inherited by the
+// outputs of downstream tasks.
+func (ft *FileTarget) AddTag(key string, value string) {
+	ai := ft.GetAuditInfo()
+	ft.lock.Lock()
+	if ai.Tags == nil {
+		ai.Tags = make(map[string]string)
+	}
+	ai.Tags[key] = value
+	ft.lock.Unlock()
+}
+
+// Add multiple tags to the file
+func (ft *FileTarget) AddTags(tags map[string]string) {
+	for k, v := range tags {
+		ft.AddTag(k, v)
+	}
+}
+
+// Get the value of the tag with key key, or an empty string if it is not set
+func (ft *FileTarget) GetTag(key string) string {
+	ai := ft.GetAuditInfo()
+	ft.lock.Lock()
+	defer ft.lock.Unlock()
+	return ai.Tags[key]
+}
+
+// Get (a copy of) all tags of the file
+func (ft *FileTarget) GetTags() map[string]string {
+	ai := ft.GetAuditInfo()
+	ft.lock.Lock()
+	defer ft.lock.Unlock()
+	tags := make(map[string]string)
+	for k, v := range ai.Tags {
+		tags[k] = v
+	}
+	return tags
+}
+
 // Open the file and return a file handle (*os.File)
 func (ft *FileTarget) Open() *os.File {
 	f, err := os.Open(ft.GetPath())
@@ -66,66 +425,300 @@ func (ft *FileTarget) OpenWriteTemp() *os.File {
 	return f
 }
 
-// Read the whole content of the file and return as a byte array ([]byte)
+// Create the temp file for writing, with any missing parent directories,
+// returning an error rather than panicking, as OpenWriteTemp does. The file
+// must be closed by the caller.
+func (ft *FileTarget) CreateTemp() (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(ft.GetTempPath()), 0777); err != nil {
+		return nil, err
+	}
+	return os.Create(ft.GetTempPath())
+}
+
+// Write a byte array ([]byte) to the temp file, returning an error rather
+// than panicking, as WriteTempFile does
+func (ft *FileTarget) WriteTemp(dat []byte) error {
+	f, err := ft.CreateTemp()
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(dat); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Write the string s to the temp file, as with WriteTemp
+func (ft *FileTarget) WriteTempString(s string) error {
+	return ft.WriteTemp([]byte(s))
+}
+
+// Read the whole content of the file and return as a byte array ([]byte).
+// For in-memory targets, the value is returned, as a byte array, and gzipped
+// files are transparently decompressed.
 func (ft *FileTarget) Read() []byte {
+	if ft.inMemory {
+		return []byte(ft.GetValueString())
+	}
+	if ft.IsCompressed() {
+		f := ft.Open()
+		defer f.Close()
+		zr, err := gzip.NewReader(f)
+		Check(err)
+		defer zr.Close()
+		dat, err := ioutil.ReadAll(zr)
+		Check(err)
+		return dat
+	}
 	dat, err := ioutil.ReadFile(ft.GetPath())
 	Check(err)
 	return dat
 }
 
+// Open the file for reading, returning an error rather than panicking, as
+// Open does. As with Read, in-memory targets are read from their value, and
+// gzipped files are transparently decompressed. The reader must be closed by
+// the caller.
+func (ft *FileTarget) OpenReader() (io.ReadCloser, error) {
+	if ft.inMemory {
+		return ioutil.NopCloser(str.NewReader(ft.GetValueString())), nil
+	}
+	f, err := os.Open(ft.GetPath())
+	if err != nil {
+		return nil, err
+	}
+	if !ft.IsCompressed() {
+		return f, nil
+	}
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &gzipFileReader{zr, f}, nil
+}
+
+// gzipFileReader decompresses a gzipped file, closing the file when closed
+type gzipFileReader struct {
+	*gzip.Reader
+	f *os.File
+}
+
+func (r *gzipFileReader) Close() error {
+	r.Reader.Close()
+	return r.f.Close()
+}
+
+// Read the whole content of the file, as with Read, but returning an error
+// rather than panicking
+func (ft *FileTarget) ReadAll() ([]byte, error) {
+	r, err := ft.OpenReader()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// Read the whole content of the file as a string, as with ReadAll
+func (ft *FileTarget) ReadString() (string, error) {
+	dat, err := ft.ReadAll()
+	return string(dat), err
+}
+
+// Call fn with each line of the file, without the line ending, stopping at
+// the first error returned by fn. Lines are read buffered, so that large
+// files are not read into memory, and may be of any length.
+func (ft *FileTarget) ReadLines(fn func(line string) error) error {
+	r, err := ft.OpenReader()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if line != "" {
+			line = str.TrimSuffix(str.TrimSuffix(line, "\n"), "\r")
+			if fnErr := fn(line); fnErr != nil {
+				return fnErr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// Read the JSON encoded content of the file into v
+func (ft *FileTarget) ReadJSON(v interface{}) error {
+	r, err := ft.OpenReader()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return json.NewDecoder(r).Decode(v)
+}
+
+// Write dat to the file, by writing it to the temp file, and then atomizing
+// it, so that the file is never seen half-written. Outputs of tasks are
+// atomized when the task finishes, so in custom execution functions, they
+// are written with WriteTemp, or SciTask.WriteOut, instead.
+func (ft *FileTarget) Write(dat []byte) error {
+	if err := ft.WriteTemp(dat); err != nil {
+		return err
+	}
+	return ft.tryAtomize()
+}
+
+// Write the string s to the file, as with Write
+func (ft *FileTarget) WriteString(s string) error {
+	return ft.Write([]byte(s))
+}
+
+// Write v, JSON encoded (and indented, as audit files are), to the file, as
+// with Write
+func (ft *FileTarget) WriteJSON(v interface{}) error {
+	dat, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+	return ft.Write(append(dat, '\n'))
+}
+
+// Atomize the file, returning an error rather than panicking, as Atomize
+// does
+func (ft *FileTarget) tryAtomize() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Could not atomize %s: %v", ft.GetPath(), r)
+		}
+	}()
+	ft.Atomize()
+	return nil
+}
+
 // Write a byte array ([]byte) to the file (first to its temp path, and then atomize)
 func (ft *FileTarget) WriteTempFile(dat []byte) {
 	err := ioutil.WriteFile(ft.GetTempPath(), dat, 0644)
 	Check(err)
 }
 
-// Change from the temporary file name to the final file name
+// Sync outputs to disk when they are atomized (see FileTarget.Atomize), so
+// that they survive a system crash. This is off by default, since syncing
+// many or large outputs, or outputs on network file systems, can take a
+// long time.
+var SyncOnAtomize = false
+
+// Change from the temporary file name to the final file name. For targets
+// set to be compressed, the (uncompressed) temporary file is gzipped first.
+// If the temporary file is on another file system, it is copied (see
+// moveFile). With SyncOnAtomize set, the file is synced to disk before it is
+// renamed, and its directory after, so that it is not lost, or left empty,
+// on a system crash.
 func (ft *FileTarget) Atomize() {
+	if ft.custom != nil {
+		ft.custom.Atomize()
+		return
+	}
 	Debug.Println("FileTarget: Atomizing", ft.GetTempPath(), "->", ft.GetPath())
 	ft.lock.Lock()
-	err := os.Rename(ft.GetTempPath(), ft.path)
+	defer ft.lock.Unlock()
+	tempPath := ft.GetTempPath()
+	if ft.compress {
+		tempPath = ft.GetTempPath() + ".gz"
+		gzipFile(ft.GetTempPath(), tempPath)
+		err := os.Remove(ft.GetTempPath())
+		Check(err)
+	}
+	if SyncOnAtomize {
+		err := syncPath(tempPath)
+		Check(err)
+	}
+	err := moveFile(tempPath, ft.path)
 	Check(err)
-	ft.lock.Unlock()
+	if SyncOnAtomize {
+		err := syncDir(filepath.Dir(ft.path))
+		Check(err)
+	}
 	Debug.Println("FileTarget: Done atomizing", ft.GetTempPath(), "->", ft.GetPath())
 }
 
-// Create FIFO file for the FileTarget
+// Create the stream (normally a FIFO file) for the FileTarget, using the
+// StreamTransport in Streams
 func (ft *FileTarget) CreateFifo() {
 	ft.lock.Lock()
-	cmd := "mkfifo " + ft.GetFifoPath()
-	Debug.Println("Now creating FIFO with command:", cmd)
-
-	if _, err := os.Stat(ft.GetFifoPath()); err == nil {
+	if Streams.Exists(ft) {
 		Warning.Println("FIFO already exists, so not creating a new one:", ft.GetFifoPath())
 	} else {
-		_, err := exec.Command("bash", "-c", cmd).Output()
+		err := Streams.Create(ft)
 		Check(err)
 	}
-
 	ft.lock.Unlock()
 }
 
-// Remove the FIFO file, if it exists
+// Remove the stream (normally a FIFO file), if it exists
 func (ft *FileTarget) RemoveFifo() {
-	// FIXME: Shouldn't we check first whether the fifo exists?
 	ft.lock.Lock()
-	output, err := exec.Command("bash", "-c", "rm "+ft.GetFifoPath()).Output()
-	Check(err)
-	Debug.Println("Removed FIFO output: ", output)
+	if Streams.Exists(ft) {
+		err := Streams.Remove(ft)
+		Check(err)
+		Debug.Println("Removed FIFO:", ft.GetFifoPath())
+	}
 	ft.lock.Unlock()
 }
 
-// Check if the file exists (at its final file name)
+// Check whether the stream (normally a FIFO file) for the FileTarget exists
+func (ft *FileTarget) FifoExists() bool {
+	return Streams.Exists(ft)
+}
+
+// Check if the file exists (at its final file name). For remote files, the
+// file exists if it is either staged locally, or exists at its URL.
 func (ft *FileTarget) Exists() bool {
+	if ft.custom != nil {
+		return ft.custom.Exists()
+	}
+	if ft.IsList() {
+		for _, tgt := range ft.list {
+			if !tgt.Exists() {
+				return false
+			}
+		}
+		return true
+	}
 	exists := false
 	ft.lock.Lock()
-	if _, err := os.Stat(ft.GetPath()); err == nil {
+	if ft.inMemory {
+		exists = true
+	} else if _, err := os.Stat(ft.GetPath()); err == nil {
 		exists = true
+	} else if ft.IsRemote() {
+		exists = ft.remote.Exists(ft.url)
 	}
 	ft.lock.Unlock()
 	return exists
 }
 
+// Write a gzip compressed copy of the file at srcPath, to dstPath
+func gzipFile(srcPath string, dstPath string) {
+	src, err := os.Open(srcPath)
+	Check(err)
+	defer src.Close()
+	dst, err := os.Create(dstPath)
+	Check(err)
+	defer dst.Close()
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	Check(err)
+	err = zw.Close()
+	Check(err)
+}
+
 // ======= FileQueue =======
 
 // FileQueue is initialized by a set of strings with file paths, and from that
@@ -157,7 +750,3 @@ func (proc *FileQueue) Run() {
 func (proc *FileQueue) IsConnected() bool {
 	return proc.Out.IsConnected()
 }
-
-func (proc *Sink) deleteInPortAtKey(i int) {
-	proc.inPorts = append(proc.inPorts[:i], proc.inPorts[i+1:]...)
-}
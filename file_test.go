@@ -2,6 +2,7 @@ package scipipe
 
 import (
 	"github.com/stretchr/testify/assert"
+	"os"
 	"testing"
 )
 
@@ -19,3 +20,68 @@ func TestFileTargetPaths(t *testing.T) {
 func assertPathsEqual(t *testing.T, path1 string, path2 string) {
 	assert.Equal(t, path1, path2, "Wrong path returned! (Was", path1, "but should be", path2, ")")
 }
+
+func TestFileTargetReadWriteHelpers(t *testing.T) {
+	initTestLogs()
+	defer cleanFiles("/tmp/helpers.json", "/tmp/helpers.txt.gz")
+
+	ft := NewFileTarget("/tmp/helpers.json")
+	err := ft.WriteJSON(map[string]int{"reads": 42})
+	assert.Nil(t, err)
+	_, err = os.Stat(ft.GetTempPath())
+	assert.True(t, os.IsNotExist(err), "temp file not atomized")
+	rec := map[string]int{}
+	assert.Nil(t, ft.ReadJSON(&rec))
+	assert.Equal(t, 42, rec["reads"])
+
+	gz := NewFileTarget("/tmp/helpers.txt.gz")
+	gz.compress = true
+	assert.Nil(t, gz.WriteString("a\r\nb\n\nc"))
+	lines := []string{}
+	err = gz.ReadLines(func(line string) error {
+		lines = append(lines, line)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b", "", "c"}, lines)
+
+	s, err := NewInMemoryTarget("value").ReadString()
+	assert.Nil(t, err)
+	assert.Equal(t, "value", s)
+	_, err = NewFileTarget("/tmp/helpers_missing.txt").ReadAll()
+	assert.NotNil(t, err)
+}
+
+func TestFileTargetIsCompressed(t *testing.T) {
+	initTestLogs()
+	defer cleanFiles("/tmp/plain.txt.gz", "/tmp/gzipped.txt.gz")
+
+	// A file named .gz that is not gzipped is read as it is
+	plain := NewFileTarget("/tmp/plain.txt.gz")
+	assert.Nil(t, plain.WriteString("plain\n"))
+	assert.False(t, plain.IsCompressed())
+	assert.Equal(t, "plain\n", string(plain.Read()))
+	s, err := plain.ReadString()
+	assert.Nil(t, err)
+	assert.Equal(t, "plain\n", s)
+
+	gz := NewFileTarget("/tmp/gzipped.txt.gz")
+	gz.compress = true
+	assert.Nil(t, gz.WriteString("gzipped\n"))
+	assert.True(t, NewFileTarget("/tmp/gzipped.txt.gz").IsCompressed())
+	assert.Equal(t, "gzipped\n", string(NewFileTarget("/tmp/gzipped.txt.gz").Read()))
+}
+
+func TestSyncOnAtomize(t *testing.T) {
+	initTestLogs()
+	defer func(sync bool) { SyncOnAtomize = sync }(SyncOnAtomize)
+	defer cleanFiles("/tmp/sync_atomize.txt")
+
+	assert.False(t, SyncOnAtomize, "outputs synced by default")
+	SyncOnAtomize = true
+	ft := NewFileTarget("/tmp/sync_atomize.txt")
+	assert.Nil(t, ft.WriteString("synced"))
+	s, err := ft.ReadString()
+	assert.Nil(t, err)
+	assert.Equal(t, "synced", s)
+}
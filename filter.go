@@ -0,0 +1,42 @@
+package scipipe
+
+// ======= Filter ========
+
+// Filter is a component that passes on the targets received on its In-port
+// for which the function Keep returns true, to its Out-port, and drops the
+// others, so that downstream processes never see them (e.g. samples failing
+// a QC threshold). The route predicates, such as TagEquals, can be used.
+type Filter struct {
+	Process
+	Name string
+	In   *InPort
+	Out  *OutPort
+	Keep func(*FileTarget) bool
+}
+
+// Instantiate a Filter component, keeping the targets for which keep
+// returns true
+func NewFilter(name string, keep func(*FileTarget) bool) *Filter {
+	return &Filter{
+		Name: name,
+		In:   NewInPort(),
+		Out:  NewOutPort(),
+		Keep: keep,
+	}
+}
+
+func (proc *Filter) IsConnected() bool {
+	return proc.In.IsConnected() && proc.Out.IsConnected()
+}
+
+// Execute the Filter component
+func (proc *Filter) Run() {
+	defer proc.Out.Close()
+	for ft := range proc.In.Chan {
+		if proc.Keep(ft) {
+			proc.Out.Chan <- ft
+		} else {
+			Info.Printf("Filter %s: Dropping %s\n", proc.Name, ft.GetPath())
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package scipipe
+
+import (
+	"github.com/stretchr/testify/assert"
+	t "testing"
+)
+
+func TestFilter(t *t.T) {
+	initTestLogs()
+
+	pass := NewFileTarget("/tmp/filter_pass.txt")
+	pass.AddTag("qc", "pass")
+	fail := NewFileTarget("/tmp/filter_fail.txt")
+	fail.AddTag("qc", "fail")
+
+	flt := NewFilter("flt", TagEquals("qc", "pass"))
+	flt.In.Chan = make(chan *FileTarget, 2)
+	flt.In.Chan <- fail
+	flt.In.Chan <- pass
+	close(flt.In.Chan)
+	flt.Out.Chan = make(chan *FileTarget, 2)
+	flt.Run()
+
+	kept := []*FileTarget{}
+	for ft := range flt.Out.Chan {
+		kept = append(kept, ft)
+	}
+	assert.EqualValues(t, []*FileTarget{pass}, kept)
+}
@@ -0,0 +1,136 @@
+package scipipe
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	str "strings"
+	"unicode"
+)
+
+// ======= Params as command line flags ========
+
+// Register the params of the processes of the workflow, whose param ports
+// are not connected, as flags on fs (such as flag.CommandLine), named after
+// the params, so that they can be given when running the workflow program,
+// without changing its code, as in:
+//
+//	./myworkflow -threads 16 -genome hg38
+//
+// A param of the same name in several processes is set for all of them. If
+// envPrefix is not empty, params can also be given as environment
+// variables, named after the params, in upper case, and prefixed with
+// envPrefix, as in MYWF_THREADS, which override default values, but not
+// flags. Values are validated against the types of the params (see
+// SetParamType). Call it after the processes are added to the workflow, and
+// before fs is parsed. Params whose names are already used by flags of fs
+// are skipped. Params without default values are required, so that running
+// (or validating) the workflow fails if they are not given.
+func (wf *Workflow) AddParamFlags(fs *flag.FlagSet, envPrefix string) error {
+	flags := make(map[string]*paramFlag)
+	for _, proc := range flattenProcesses(wf.processes) {
+		p, ok := proc.(*SciProcess)
+		if !ok {
+			continue
+		}
+		for pname, pport := range p.ParamPorts {
+			if pport.IsConnected() {
+				continue
+			}
+			if flags[pname] == nil {
+				flags[pname] = &paramFlag{name: pname}
+			}
+			flags[pname].procs = append(flags[pname].procs, p)
+		}
+	}
+	names := []string{}
+	for name := range flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		pf := flags[name]
+		if fs.Lookup(name) != nil {
+			Warning.Printf("Workflow %s: Not adding flag for param %s, since there already is such a flag\n", wf.Name, name)
+			continue
+		}
+		procNames := []string{}
+		required := true
+		for _, p := range pf.procs {
+			procNames = append(procNames, p.Name)
+			if ps := p.ParamSpecs[name]; ps != nil {
+				if ps.HasDefault && pf.value == "" {
+					pf.value = ps.Default
+				}
+				required = required && !ps.HasDefault && !ps.Optional
+			}
+		}
+		usage := fmt.Sprintf("Param %s, of %s", name, str.Join(procNames, ", "))
+		if ps := pf.procs[0].ParamSpecs[name]; ps != nil && ps.Type != ParamTypeString {
+			usage += fmt.Sprintf(" (%s)", ps.Type)
+		}
+		given := "the flag -" + name
+		if envPrefix != "" {
+			envName := envPrefix + paramEnvName(name)
+			usage += fmt.Sprintf(" (or $%s)", envName)
+			given += " or $" + envName
+			if val, ok := os.LookupEnv(envName); ok {
+				if err := pf.Set(val); err != nil {
+					return fmt.Errorf("Invalid value of environment variable %s: %s", envName, err)
+				}
+				required = false
+			}
+		}
+		// Required params that are not given are reported by Validate
+		for _, p := range pf.procs {
+			p.paramFlags[name] = given
+		}
+		if required {
+			usage += " (required)"
+		}
+		fs.Var(pf, name, usage)
+	}
+	return nil
+}
+
+// Get the name of the environment variable for the param name, without
+// prefix, as in "GENOME_BUILD" for "genome-build"
+func paramEnvName(name string) string {
+	return str.Map(func(r rune) rune {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return '_'
+		}
+		return unicode.ToUpper(r)
+	}, name)
+}
+
+// paramFlag is a flag.Value, setting the default value of the param name
+// of the processes procs
+type paramFlag struct {
+	name  string
+	procs []*SciProcess
+	value string
+}
+
+func (pf *paramFlag) String() string {
+	if pf == nil {
+		return ""
+	}
+	return pf.value
+}
+
+func (pf *paramFlag) Set(val string) error {
+	for _, p := range pf.procs {
+		if ps := p.ParamSpecs[pf.name]; ps != nil {
+			if err := ps.Validate(val); err != nil {
+				return err
+			}
+		}
+	}
+	for _, p := range pf.procs {
+		p.SetParamDefault(pf.name, val)
+	}
+	pf.value = val
+	return nil
+}
@@ -0,0 +1,51 @@
+package scipipe
+
+import (
+	"bytes"
+	"flag"
+	"github.com/stretchr/testify/assert"
+	"os"
+	t "testing"
+)
+
+func TestAddParamFlags(t *t.T) {
+	initTestLogs()
+
+	wf := NewWorkflow("wf")
+	align := NewFromShell("align", "bwa mem -t {p:threads} {p:genome} > {o:out}")
+	align.SetParamType("threads", ParamTypeInt)
+	align.SetParamDefault("threads", "1")
+	sort := NewFromShell("sort", "samtools sort -@ {p:threads} > {o:out}")
+	sort.SetParamType("threads", ParamTypeInt)
+	sort.SetParamDefault("threads", "1")
+	wf.AddProcesses(align, sort)
+
+	os.Setenv("TEST_GENOME", "hg19")
+	defer os.Unsetenv("TEST_GENOME")
+	fs := flag.NewFlagSet("wf", flag.ContinueOnError)
+	fs.SetOutput(new(bytes.Buffer))
+	assert.Nil(t, wf.AddParamFlags(fs, "TEST_"))
+	assert.EqualValues(t, "1", fs.Lookup("threads").DefValue)
+	assert.Contains(t, fs.Lookup("threads").Usage, "align, sort")
+	assert.Contains(t, fs.Lookup("genome").Usage, "$TEST_GENOME")
+	assert.EqualValues(t, "hg19", align.ParamSpecs["genome"].Default)
+
+	assert.Nil(t, fs.Parse([]string{"-threads", "16", "-genome", "hg38"}))
+	assert.EqualValues(t, "16", align.ParamSpecs["threads"].Default)
+	assert.EqualValues(t, "16", sort.ParamSpecs["threads"].Default)
+	assert.EqualValues(t, "hg38", align.ParamSpecs["genome"].Default)
+
+	// Values are validated
+	assert.Error(t, fs.Parse([]string{"-threads", "many"}))
+
+	// Params without default values are required
+	wf = NewWorkflow("wf")
+	wf.AddProcess(NewFromShell("echo", "echo {p:word} > {o:out}"))
+	fs = flag.NewFlagSet("wf", flag.ContinueOnError)
+	assert.Nil(t, wf.AddParamFlags(fs, ""))
+	assert.Contains(t, fs.Lookup("word").Usage, "(required)")
+	assert.Nil(t, fs.Parse([]string{}))
+	err := wf.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Param word of process echo is required, but not given with the flag -word")
+}
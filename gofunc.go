@@ -0,0 +1,57 @@
+package scipipe
+
+import (
+	"sync"
+)
+
+// ======= Go function processes ========
+
+// Create a process running the Go function f for each target received on
+// its in-port "in", writing the content that f returns to a file sent on
+// its out-port "out", as for parsing or converting small files, without a
+// shell command or a custom process. The path of the output is the path of
+// the input with the name of the process added as extension, unless
+// changed with the path formatter methods, such as SetPathExtend. Errors
+// returned by f make the task fail, and outputs are atomized and audited
+// as those of shell commands.
+func NewFromMapFunc(name string, f func(in *FileTarget) ([]byte, error)) *SciProcess {
+	p := NewFromShell(name, "{i:in} {o:out}")
+	p.SetPathExtend("in", "out", "."+name)
+	p.CustomExecute = func(t *SciTask) error {
+		dat, err := f(t.InTargets["in"])
+		if err != nil {
+			return err
+		}
+		return t.WriteOut("out", dat)
+	}
+	return p
+}
+
+// Create a process running the Go function f for each target received on
+// its in-port "in", sending the value that f returns on its param out-port
+// "out" (see SetParamOut), as for computing a threshold from a stats file,
+// to be used as a param by downstream processes. Errors returned by f make
+// the task fail, in which case no value is sent.
+func NewFromExtractFunc(name string, f func(in *FileTarget) (string, error)) *SciProcess {
+	p := NewFromShell(name, "{i:in}")
+	lock := new(sync.Mutex)
+	values := make(map[*SciTask]string)
+	p.CustomExecute = func(t *SciTask) error {
+		val, err := f(t.InTargets["in"])
+		if err != nil {
+			return err
+		}
+		lock.Lock()
+		values[t] = val
+		lock.Unlock()
+		return nil
+	}
+	p.SetParamOut("out", func(t *SciTask) string {
+		lock.Lock()
+		defer lock.Unlock()
+		val := values[t]
+		delete(values, t)
+		return val
+	})
+	return p
+}
@@ -0,0 +1,46 @@
+package scipipe
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"strconv"
+	t "testing"
+)
+
+func TestGoFuncProcesses(t *t.T) {
+	initTestLogs()
+
+	ioutil.WriteFile("/tmp/gofunc_1.txt", []byte("foo\nbar\n"), 0644)
+	ioutil.WriteFile("/tmp/gofunc_2.txt", []byte(""), 0644)
+
+	wf := NewWorkflow("wf")
+	wf.Add("files", NewFileQueue("/tmp/gofunc_1.txt", "/tmp/gofunc_2.txt"))
+	upper := NewFromMapFunc("upper", func(in *FileTarget) ([]byte, error) {
+		return bytes.ToUpper(in.Read()), nil
+	})
+	lines := NewFromExtractFunc("lines", func(in *FileTarget) (string, error) {
+		n := bytes.Count(in.Read(), []byte("\n"))
+		if n == 0 {
+			return "", errors.New("no lines in " + in.GetPath())
+		}
+		return strconv.Itoa(n), nil
+	})
+	report := NewFromShell("report", "echo {p:n} lines > {o:out}")
+	report.SetPathPattern("out", "/tmp/gofunc_{p:n}.lines")
+	wf.AddProcesses(upper, lines, report, NewSink())
+	wf.Connect("files.out", "upper.in")
+	wf.Connect("files.out", "lines.in")
+	wf.Connect("lines.out", "report.n")
+	wf.Connect("upper.out", "sink.in")
+	wf.Connect("report.out", "sink.in")
+	assert.NotNil(t, wf.Run())
+
+	assert.EqualValues(t, "FOO\nBAR\n", string(NewFileTarget("/tmp/gofunc_1.txt.upper").Read()))
+	assert.True(t, NewFileTarget("/tmp/gofunc_2.txt.upper").Exists())
+	// The second file has no lines, so only a value for the first is sent
+	assert.EqualValues(t, "2 lines\n", string(NewFileTarget("/tmp/gofunc_2.lines").Read()))
+	assert.False(t, NewFileTarget("/tmp/gofunc_0.lines").Exists())
+	cleanFiles("/tmp/gofunc_1.txt", "/tmp/gofunc_2.txt", "/tmp/gofunc_1.txt.upper", "/tmp/gofunc_2.txt.upper", "/tmp/gofunc_2.lines")
+}
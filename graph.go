@@ -0,0 +1,241 @@
+package scipipe
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	str "strings"
+)
+
+// ======= Workflow graph ========
+
+// Connection is a connection between two ports of the processes of a
+// workflow, given on the form PROCESSNAME.PORTNAME
+type Connection struct {
+	From string
+	To   string
+}
+
+// Get the connections between the processes of the workflow, sorted. They
+// are found by the channels that the ports share, so connections made
+// directly on the ports, and not with Workflow.Connect, are included too.
+func (wf *Workflow) GetConnections() []Connection {
+	senders := make(map[interface{}][]string)
+	receivers := make(map[interface{}][]string)
+	for _, name := range wf.procNames {
+		inPorts, outPorts := getProcessPorts(wf.procsByName[name])
+		for pname, chs := range outPorts {
+			for _, ch := range chs {
+				senders[ch] = append(senders[ch], name+"."+pname)
+			}
+		}
+		for pname, chs := range inPorts {
+			for _, ch := range chs {
+				receivers[ch] = append(receivers[ch], name+"."+pname)
+			}
+		}
+	}
+	conns := []Connection{}
+	for ch, froms := range senders {
+		for _, from := range froms {
+			for _, to := range receivers[ch] {
+				conns = append(conns, Connection{From: from, To: to})
+			}
+		}
+	}
+	sort.Slice(conns, func(i, j int) bool {
+		if conns[i].From != conns[j].From {
+			return conns[i].From < conns[j].From
+		}
+		return conns[i].To < conns[j].To
+	})
+	return conns
+}
+
+// Get the channels of the connected in- and out-ports of the process proc,
+// by port name. The ports are looked up in the In, Out, ParamPorts and
+// ParamOutPorts fields, where the ParamPorts of a SciProcess are in-ports,
+// and of other components (such as CSVSource) out-ports. The single In and
+// Out ports of components are named "in" and "out", as are the in-ports of
+// a Sink (numbered after the first one, as in "in2"). Ports connected to several
+// other ports have the channels of all of them.
+func getProcessPorts(proc Process) (inPorts map[string][]interface{}, outPorts map[string][]interface{}) {
+	inPorts = make(map[string][]interface{})
+	outPorts = make(map[string][]interface{})
+	if sink, ok := proc.(*Sink); ok {
+		for i, inp := range sink.inPorts {
+			addPortChan(inPorts, portNameWithIndex("in", i), inp)
+		}
+		return
+	}
+	v := reflect.Indirect(reflect.ValueOf(proc))
+	if v.Kind() != reflect.Struct {
+		return
+	}
+	_, isSciProcess := proc.(*SciProcess)
+	fields := map[string]map[string][]interface{}{"In": inPorts, "Out": outPorts, "ParamPorts": outPorts, "ParamOutPorts": outPorts}
+	if isSciProcess {
+		fields["ParamPorts"] = inPorts
+	}
+	for fieldName, ports := range fields {
+		f := v.FieldByName(fieldName)
+		if !f.IsValid() {
+			continue
+		}
+		switch f.Kind() {
+		case reflect.Map:
+			if f.Type().Key().Kind() != reflect.String {
+				continue
+			}
+			for _, k := range f.MapKeys() {
+				addPortChan(ports, k.String(), f.MapIndex(k).Interface())
+			}
+		case reflect.Ptr:
+			if !f.IsNil() {
+				addPortChan(ports, str.ToLower(fieldName), f.Interface())
+			}
+		}
+	}
+	// Ports of Go values can be in fields of any name
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		if !v.Type().Field(i).IsExported() || f.Kind() != reflect.Ptr || f.IsNil() {
+			continue
+		}
+		name := str.ToLower(v.Type().Field(i).Name)
+		switch p := f.Interface().(type) {
+		case valueInPort:
+			if ch := p.getChan(); ch != nil {
+				inPorts[name] = []interface{}{ch}
+			}
+		case valueOutPort:
+			if ch := p.getChan(); ch != nil {
+				outPorts[name] = []interface{}{ch}
+			}
+		}
+	}
+	return
+}
+
+// Add the channel of port to ports, under the name name, if the port is
+// connected
+func addPortChan(ports map[string][]interface{}, name string, port interface{}) {
+	switch p := port.(type) {
+	case *InPort:
+		if p != nil {
+			for _, ch := range p.getRemoteChans() {
+				ports[name] = append(ports[name], ch)
+			}
+		}
+	case *OutPort:
+		if p != nil {
+			for _, ch := range p.getRemoteChans() {
+				ports[name] = append(ports[name], ch)
+			}
+		}
+	case *ParamPort:
+		if p != nil && p.Chan != nil {
+			ports[name] = []interface{}{p.Chan}
+		}
+	}
+}
+
+// Get the name of the i:th of several ports named name, as in "in", "in2"
+func portNameWithIndex(name string, i int) string {
+	if i == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s%d", name, i+1)
+}
+
+// ------- Graphviz DOT export -------
+
+// Write the workflow graph, with processes as nodes, and connections as
+// edges labeled with the port names, in the Graphviz DOT format to w
+func (wf *Workflow) WriteDOT(w io.Writer) error {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "digraph %s {\n", dotQuote(wf.Name))
+	fmt.Fprintf(buf, "  rankdir=LR;\n")
+	fmt.Fprintf(buf, "  node [shape=box, style=rounded, fontname=\"Helvetica\"];\n")
+	fmt.Fprintf(buf, "  edge [fontname=\"Helvetica\", fontsize=10];\n")
+	for _, name := range wf.procNames {
+		fmt.Fprintf(buf, "  %s;\n", dotQuote(name))
+	}
+	for _, c := range wf.GetConnections() {
+		from, to := str.SplitN(c.From, ".", 2), str.SplitN(c.To, ".", 2)
+		fmt.Fprintf(buf, "  %s -> %s [taillabel=%s, headlabel=%s];\n", dotQuote(from[0]), dotQuote(to[0]), dotQuote(from[1]), dotQuote(to[1]))
+	}
+	fmt.Fprintf(buf, "}\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// Write the workflow graph (see WriteDOT) to the file at path. If path has
+// the extension .png, .svg or .pdf, the DOT file is written next to it,
+// with the extension .dot, and rendered to path with the dot command of
+// Graphviz, which must then be installed.
+func (wf *Workflow) PlotGraph(path string) error {
+	ext := filepath.Ext(path)
+	format := str.TrimPrefix(ext, ".")
+	dotPath := path
+	if format == "png" || format == "svg" || format == "pdf" {
+		dotPath = str.TrimSuffix(path, ext) + ".dot"
+	} else {
+		format = ""
+	}
+	f, err := os.Create(dotPath)
+	if err != nil {
+		return err
+	}
+	err = wf.WriteDOT(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil || format == "" {
+		return err
+	}
+	if _, err := exec.LookPath("dot"); err != nil {
+		return fmt.Errorf("Can not render %s, since the dot command of Graphviz is not found: %s", path, err)
+	}
+	out, err := exec.Command("dot", "-T"+format, "-o", path, dotPath).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("Rendering %s with dot failed (%s): %s", path, err, string(out))
+	}
+	return nil
+}
+
+// Quote s as a DOT ID
+func dotQuote(s string) string {
+	return `"` + str.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// ------- Mermaid export -------
+
+// Write the workflow graph as a Mermaid flowchart to w, which can be put in
+// a ```mermaid code block in Markdown documents, for rendering on GitHub or
+// GitLab. As in WriteDOT, edges are labeled with the port names.
+func (wf *Workflow) WriteMermaid(w io.Writer) error {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "flowchart LR\n")
+	ids := make(map[string]string)
+	for i, name := range wf.procNames {
+		ids[name] = fmt.Sprintf("p%d", i)
+		fmt.Fprintf(buf, "    %s[%s]\n", ids[name], mermaidQuote(name))
+	}
+	for _, c := range wf.GetConnections() {
+		from, to := str.SplitN(c.From, ".", 2), str.SplitN(c.To, ".", 2)
+		fmt.Fprintf(buf, "    %s -->|%s| %s\n", ids[from[0]], mermaidQuote(from[1]+" → "+to[1]), ids[to[0]])
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// Quote s as a Mermaid label
+func mermaidQuote(s string) string {
+	return `"` + str.Replace(s, `"`, "#quot;", -1) + `"`
+}
@@ -0,0 +1,50 @@
+package scipipe
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"os/exec"
+	t "testing"
+)
+
+func TestWriteDOT(t *t.T) {
+	initTestLogs()
+
+	buf := new(bytes.Buffer)
+	err := newTestFooBarWorkflow("/tmp/graph_").WriteDOT(buf)
+	assert.Nil(t, err)
+	dot := buf.String()
+	assert.Contains(t, dot, "digraph \"wf\" {\n")
+	assert.Contains(t, dot, "  \"foo\";\n  \"f2b\";\n  \"sink\";\n")
+	assert.Contains(t, dot, "  \"foo\" -> \"f2b\" [taillabel=\"out\", headlabel=\"in\"];\n")
+	assert.Contains(t, dot, "  \"f2b\" -> \"sink\" [taillabel=\"out\", headlabel=\"in\"];\n")
+
+	err = newTestFooBarWorkflow("/tmp/graph_").PlotGraph("/tmp/graph_wf.dot")
+	assert.Nil(t, err)
+	assert.EqualValues(t, dot, string(NewFileTarget("/tmp/graph_wf.dot").Read()))
+	os.Remove("/tmp/graph_wf.dot")
+
+	if _, err := exec.LookPath("dot"); err == nil {
+		err = newTestFooBarWorkflow("/tmp/graph_").PlotGraph("/tmp/graph_wf.svg")
+		assert.Nil(t, err)
+		assert.True(t, NewFileTarget("/tmp/graph_wf.svg").Exists())
+		os.Remove("/tmp/graph_wf.dot")
+		os.Remove("/tmp/graph_wf.svg")
+	}
+}
+
+func TestWriteMermaid(t *t.T) {
+	initTestLogs()
+
+	buf := new(bytes.Buffer)
+	err := newTestFooBarWorkflow("/tmp/graph_").WriteMermaid(buf)
+	assert.Nil(t, err)
+	assert.EqualValues(t, `flowchart LR
+    p0["foo"]
+    p1["f2b"]
+    p2["sink"]
+    p1 -->|"out → in"| p2
+    p0 -->|"out → in"| p1
+`, buf.String())
+}
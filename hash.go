@@ -0,0 +1,249 @@
+package scipipe
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	str "strings"
+	"sync"
+	"time"
+)
+
+// ======= Content hashing ========
+
+// The size of the chunks that files are split into when hashed, so that
+// the chunks of large files can be hashed in parallel
+var HashChunkSize int64 = 64 << 20
+
+// The number of chunks hashed at the same time
+var HashWorkers = runtime.NumCPU()
+
+// Reuse the hash of a file computed earlier, if its size and modification
+// time are unchanged, rather than reading the whole file again. Files
+// changed without changing either are then not detected.
+var HashFastPath = true
+
+// A directory where the hashes used by the fast path are also stored, so
+// that they are reused between runs, or "" to only keep them in memory
+var HashCacheDir = ""
+
+// fileHashInfo is the hash of a file, with the size and modification time
+// the file had when hashed, for the fast path
+type fileHashInfo struct {
+	Size      int64
+	ModTime   time.Time
+	ChunkSize int64
+	Hash      string
+}
+
+var (
+	hashCache     = make(map[string]*fileHashInfo)
+	hashCacheLock sync.Mutex
+)
+
+// Get the content hash of the file at path, as a hex string, computed as the
+// SHA-256 of the SHA-256 hashes of its chunks (see HashChunkSize), which are
+// hashed in parallel (see HashWorkers). The hash only depends on the content
+// of the file (and the chunk size), but is not the same as the SHA-256 of
+// the file, as computed by sha256sum. Hashes are reused when the file is
+// unchanged, by size and modification time (see HashFastPath).
+func HashFile(path string) (string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if fi.IsDir() {
+		return "", errors.New("Can not hash directory: " + path)
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	chunkSize := getHashChunkSize()
+	if HashFastPath {
+		if hi := getCachedHash(absPath); hi != nil && hi.Size == fi.Size() && hi.ModTime.Equal(fi.ModTime()) && hi.ChunkSize == chunkSize {
+			return hi.Hash, nil
+		}
+	}
+	hash, err := hashFileChunks(path, fi.Size(), chunkSize)
+	if err != nil {
+		return "", err
+	}
+	if HashFastPath {
+		setCachedHash(absPath, &fileHashInfo{Size: fi.Size(), ModTime: fi.ModTime(), ChunkSize: chunkSize, Hash: hash})
+	}
+	return hash, nil
+}
+
+// Get the content hash of the target, as for content-based caching: the
+// hash of its file (see HashFile), or for in-memory targets, of their value,
+// and for list targets, of the hashes of their targets
+func (ft *FileTarget) GetHash() (string, error) {
+	if ft.IsInMemory() {
+		sum := sha256.Sum256([]byte(ft.GetValueString()))
+		return hex.EncodeToString(sum[:]), nil
+	}
+	if ft.IsList() {
+		h := sha256.New()
+		for _, tgt := range ft.GetTargets() {
+			hash, err := tgt.GetHash()
+			if err != nil {
+				return "", err
+			}
+			io.WriteString(h, hash)
+		}
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+	return HashFile(ft.GetPath())
+}
+
+// Get the content hashes of the inputs of the task (see GetHash), as
+// name=hash, sorted by in-port name. Streamed inputs, which can only be read
+// once, are given by the content signature of the task streaming them, so
+// that they change when the inputs of that task do, and inputs that can not
+// be hashed by their paths.
+func (t *SciTask) getInputHashes() []string {
+	inNames := []string{}
+	for iname := range t.InTargets {
+		inNames = append(inNames, iname)
+	}
+	sort.Strings(inNames)
+	hashes := []string{}
+	for _, iname := range inNames {
+		itgt := t.InTargets[iname]
+		if itgt.IsStreaming() {
+			if itgt.getStreamSignature != nil {
+				hashes = append(hashes, iname+"=stream:"+itgt.getStreamSignature())
+			} else {
+				hashes = append(hashes, iname+"="+itgt.GetPath())
+			}
+			continue
+		}
+		hash, err := itgt.GetHash()
+		if err != nil {
+			t.logStructured(LevelDebug, "Could not hash input, so using its path", Fields{"in_port": iname, "error": err})
+			hash = str.Join(itgt.GetPaths(), ",")
+		}
+		hashes = append(hashes, iname+"="+hash)
+	}
+	return hashes
+}
+
+func getHashChunkSize() int64 {
+	if HashChunkSize <= 0 {
+		return 64 << 20
+	}
+	return HashChunkSize
+}
+
+// Hash the file at path, of the size size, in chunks of the size
+// chunkSize, in parallel
+func hashFileChunks(path string, size int64, chunkSize int64) (string, error) {
+	numChunks := int((size + chunkSize - 1) / chunkSize)
+	if numChunks == 0 {
+		numChunks = 1
+	}
+	sums := make([][]byte, numChunks)
+	errs := make([]error, numChunks)
+	workers := HashWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	chunks := make(chan int)
+	wg := new(sync.WaitGroup)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range chunks {
+				sums[i], errs[i] = hashFileChunk(path, int64(i)*chunkSize, chunkSize)
+			}
+		}()
+	}
+	for i := 0; i < numChunks; i++ {
+		chunks <- i
+	}
+	close(chunks)
+	wg.Wait()
+
+	h := sha256.New()
+	for i, sum := range sums {
+		if errs[i] != nil {
+			return "", errs[i]
+		}
+		h.Write(sum)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Get the SHA-256 of the chunk of the file at path starting at offset, of
+// (up to) the size size
+func hashFileChunk(path string, offset int64, size int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(f, offset, size)); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// Get the path of the file storing the hash of the file at absPath, in
+// HashCacheDir
+func hashCachePath(absPath string) string {
+	sum := sha1.Sum([]byte(absPath))
+	return filepath.Join(HashCacheDir, hex.EncodeToString(sum[:])+".json")
+}
+
+// Get the hash computed earlier for the file at absPath, if any
+func getCachedHash(absPath string) *fileHashInfo {
+	hashCacheLock.Lock()
+	defer hashCacheLock.Unlock()
+	if hi, ok := hashCache[absPath]; ok {
+		return hi
+	}
+	if HashCacheDir == "" {
+		return nil
+	}
+	dat, err := ioutil.ReadFile(hashCachePath(absPath))
+	if err != nil {
+		return nil
+	}
+	hi := &fileHashInfo{}
+	if err := json.Unmarshal(dat, hi); err != nil {
+		return nil
+	}
+	hashCache[absPath] = hi
+	return hi
+}
+
+// Store the hash of the file at absPath, for the fast path
+func setCachedHash(absPath string, hi *fileHashInfo) {
+	hashCacheLock.Lock()
+	defer hashCacheLock.Unlock()
+	hashCache[absPath] = hi
+	if HashCacheDir == "" {
+		return
+	}
+	dat, err := json.Marshal(hi)
+	if err == nil {
+		err = os.MkdirAll(HashCacheDir, 0777)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(hashCachePath(absPath), dat, 0644)
+	}
+	if err != nil {
+		Warning.Println("Could not store hash of file in hash cache dir:", absPath, err)
+	}
+}
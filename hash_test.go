@@ -0,0 +1,129 @@
+package scipipe
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	t "testing"
+	"time"
+)
+
+func TestHashFile(t *t.T) {
+	initTestLogs()
+	defer func(chunkSize int64, cacheDir string, fastPath bool) {
+		HashChunkSize = chunkSize
+		HashCacheDir = cacheDir
+		HashFastPath = fastPath
+	}(HashChunkSize, HashCacheDir, HashFastPath)
+
+	path := "/tmp/hash_in.txt"
+	ioutil.WriteFile(path, []byte("0123456789"), 0644)
+	defer cleanFiles(path)
+
+	// The hash of the hashes of the chunks 0123, 4567 and 89
+	HashChunkSize = 4
+	h := sha256.New()
+	for _, chunk := range []string{"0123", "4567", "89"} {
+		sum := sha256.Sum256([]byte(chunk))
+		h.Write(sum[:])
+	}
+	exp := hex.EncodeToString(h.Sum(nil))
+	hash, err := HashFile(path)
+	assert.Nil(t, err)
+	assert.EqualValues(t, exp, hash)
+
+	// The fast path reuses the hash of a file with unchanged size and
+	// modification time
+	modTime := time.Now().Add(-time.Hour)
+	os.Chtimes(path, modTime, modTime)
+	hash, _ = HashFile(path)
+	ioutil.WriteFile(path, []byte("9876543210"), 0644)
+	os.Chtimes(path, modTime, modTime)
+	cached, _ := HashFile(path)
+	assert.EqualValues(t, hash, cached)
+	HashFastPath = false
+	changed, _ := HashFile(path)
+	HashFastPath = true
+	assert.NotEqual(t, hash, changed)
+
+	// Hashes are stored between runs in the hash cache dir
+	HashCacheDir = "/tmp/hash_cache"
+	defer os.RemoveAll(HashCacheDir)
+	os.Chtimes(path, time.Now(), time.Now())
+	hash, _ = HashFile(path)
+	hashCache = make(map[string]*fileHashInfo)
+	files, _ := filepath.Glob(filepath.Join(HashCacheDir, "*.json"))
+	assert.EqualValues(t, 1, len(files))
+	cached, _ = HashFile(path)
+	assert.EqualValues(t, hash, cached)
+
+	_, err = HashFile("/tmp/hash_missing.txt")
+	assert.NotNil(t, err)
+	memHash, err := NewInMemoryTarget("0123456789").GetHash()
+	assert.Nil(t, err)
+	sum := sha256.Sum256([]byte("0123456789"))
+	assert.EqualValues(t, hex.EncodeToString(sum[:]), memHash)
+}
+
+func TestInputHashesInContentSignature(t *t.T) {
+	initTestLogs()
+	defer func(fastPath bool) { HashFastPath = fastPath }(HashFastPath)
+	HashFastPath = false
+
+	path := "/tmp/hash_sig_in.txt"
+	ioutil.WriteFile(path, []byte("foo\n"), 0644)
+	defer cleanFiles(path)
+	newTask := func() *SciTask {
+		return NewSciTask("sig", "cat {i:in} > {o:out}", map[string]*FileTarget{"in": NewFileTarget(path)},
+			map[string]func(*SciTask) string{"out": func(*SciTask) string { return "/tmp/hash_sig_out.txt" }}, nil, nil, "")
+	}
+
+	hash, err := HashFile(path)
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{"in=" + hash}, newTask().getInputHashes())
+	contentSig := newTask().getContentSignature()
+	assert.NotEmpty(t, contentSig)
+	assert.EqualValues(t, contentSig, newTask().getContentSignature())
+	sig := newTask().getSignature()
+
+	// Tasks with the same command, but changed input contents, compute
+	// different things, but are the same task when deduplicating, which
+	// does not hash the inputs
+	ioutil.WriteFile(path, []byte("bar\n"), 0644)
+	assert.NotEqual(t, contentSig, newTask().getContentSignature())
+	assert.EqualValues(t, sig, newTask().getSignature())
+
+	// Inputs that can not be hashed are given by their paths
+	os.Remove(path)
+	assert.EqualValues(t, []string{"in=" + path}, newTask().getInputHashes())
+}
+
+func TestInputsHashedLazily(t *t.T) {
+	initTestLogs()
+	path := "/tmp/hash_lazy_in.txt"
+	ioutil.WriteFile(path, []byte("foo\n"), 0644)
+	defer cleanFiles(path)
+	inTargets := map[string]*FileTarget{"in": NewFileTarget(path)}
+
+	// Deduplicating tasks does not hash their inputs
+	cpy := NewFromShell("cpy", "cat {i:in} > {o:out}")
+	cpy.SetPathExtend("in", "out", ".cpy")
+	task := newSciTaskFromProcess(cpy, inTargets, map[string]string{}, 0)
+	assert.Nil(t, task.claimSignature())
+	task.releaseSignature()
+	assert.Empty(t, task.contentSignature)
+
+	// ... and neither does creating tasks with cached streams, until the
+	// path of a cache is needed
+	gen := NewFromShell("gen", "cat {i:in} > {os:out}")
+	gen.SetPathExtend("in", "out", ".gen")
+	gen.SetOutStreamCache("out", "/tmp/hash_lazy_cache")
+	task = newSciTaskFromProcess(gen, inTargets, map[string]string{}, 0)
+	assert.Empty(t, task.contentSignature)
+	cachePath := task.OutTargets["out"].streamCache.getPath()
+	assert.NotEmpty(t, task.contentSignature)
+	assert.Equal(t, "/tmp/hash_lazy_cache/hash_lazy_in.txt.gen.out."+task.contentSignature[:16]+".stream", cachePath)
+}
@@ -0,0 +1,116 @@
+package scipipe
+
+import (
+	"sync"
+)
+
+// ======= Lifecycle hooks ========
+
+// The events in the lifecycle of a task, for which callbacks without an
+// error can be registered
+type taskEvent int
+
+const (
+	taskCreatedEvent taskEvent = iota
+	taskStartEvent
+	taskSuccessEvent
+	taskSkippedEvent
+)
+
+// hooks contains the callbacks registered on a workflow for the events in
+// the lifecycle of its tasks, and of the workflow itself
+type hooks struct {
+	task         map[taskEvent][]func(*SciTask)
+	taskFailure  []func(*SciTask, error)
+	workflowDone []func(*Workflow, error)
+	lock         *sync.RWMutex
+}
+
+func newHooks() *hooks {
+	return &hooks{
+		task: make(map[taskEvent][]func(*SciTask)),
+		lock: new(sync.RWMutex),
+	}
+}
+
+// Register f to be called on the event ev, for tasks
+func (h *hooks) addTask(ev taskEvent, f func(*SciTask)) {
+	h.lock.Lock()
+	h.task[ev] = append(h.task[ev], f)
+	h.lock.Unlock()
+}
+
+// Register f to be called when a task of any SciProcess of the workflow is
+// created, before its inputs are necessarily available. Callbacks for tasks
+// are called from the go-routines of the tasks, so must be safe to call
+// concurrently.
+func (wf *Workflow) OnTaskCreated(f func(*SciTask)) {
+	wf.hooks.addTask(taskCreatedEvent, f)
+}
+
+// Register f to be called when a task starts executing its command
+func (wf *Workflow) OnTaskStart(f func(*SciTask)) {
+	wf.hooks.addTask(taskStartEvent, f)
+}
+
+// Register f to be called when a task has executed successfully, and its
+// outputs are in place
+func (wf *Workflow) OnTaskSuccess(f func(*SciTask)) {
+	wf.hooks.addTask(taskSuccessEvent, f)
+}
+
+// Register f to be called when a task has failed, with the error
+func (wf *Workflow) OnTaskFailure(f func(*SciTask, error)) {
+	wf.hooks.lock.Lock()
+	wf.hooks.taskFailure = append(wf.hooks.taskFailure, f)
+	wf.hooks.lock.Unlock()
+}
+
+// Register f to be called when a task is skipped, since its outputs exist
+func (wf *Workflow) OnTaskSkipped(f func(*SciTask)) {
+	wf.hooks.addTask(taskSkippedEvent, f)
+}
+
+// Register f to be called when a run of the workflow is done, with the
+// error returned by Run (or nil). The run statistics are available with
+// GetStats.
+func (wf *Workflow) OnWorkflowDone(f func(*Workflow, error)) {
+	wf.hooks.lock.Lock()
+	wf.hooks.workflowDone = append(wf.hooks.workflowDone, f)
+	wf.hooks.lock.Unlock()
+}
+
+// Call the callbacks for the event ev, for the task t. The hooks are nil
+// for processes not run by a workflow.
+func (h *hooks) callTask(ev taskEvent, t *SciTask) {
+	if h == nil {
+		return
+	}
+	h.lock.RLock()
+	callbacks := h.task[ev]
+	h.lock.RUnlock()
+	for _, f := range callbacks {
+		f(t)
+	}
+}
+
+func (h *hooks) callTaskFailure(t *SciTask, err error) {
+	if h == nil {
+		return
+	}
+	h.lock.RLock()
+	callbacks := h.taskFailure
+	h.lock.RUnlock()
+	for _, f := range callbacks {
+		f(t, err)
+	}
+}
+
+func (h *hooks) callWorkflowDone(wf *Workflow, err error) {
+	h.lock.RLock()
+	callbacks := h.workflowDone
+	h.lock.RUnlock()
+	for _, f := range callbacks {
+		f(wf, err)
+	}
+}
@@ -0,0 +1,51 @@
+package scipipe
+
+import (
+	"github.com/stretchr/testify/assert"
+	"sync"
+	t "testing"
+)
+
+func TestWorkflowHooks(t *t.T) {
+	initTestLogs()
+
+	wf := NewWorkflow("wf")
+	ok := NewFromShell("ok", "echo ok > {o:out}")
+	ok.SetPathStatic("out", "/tmp/hooks_ok.txt")
+	fail := NewFromShell("fail", "exit 1; echo fail > {o:out}")
+	fail.SetPathStatic("out", "/tmp/hooks_fail.txt")
+	wf.AddProcesses(ok, fail, NewSink())
+	wf.Connect("ok.out", "sink.in")
+	wf.Connect("fail.out", "sink.in")
+
+	events := []string{}
+	lock := new(sync.Mutex)
+	record := func(event string) {
+		lock.Lock()
+		events = append(events, event)
+		lock.Unlock()
+	}
+	wf.OnTaskCreated(func(task *SciTask) { record("created " + task.Name) })
+	wf.OnTaskStart(func(task *SciTask) { record("start " + task.Name) })
+	wf.OnTaskSuccess(func(task *SciTask) { record("success " + task.Name) })
+	wf.OnTaskFailure(func(task *SciTask, err error) {
+		assert.NotNil(t, err)
+		record("failure " + task.Name)
+	})
+	var doneErr error
+	wf.OnWorkflowDone(func(w *Workflow, err error) {
+		doneErr = err
+		record("done " + w.Name)
+	})
+
+	err := wf.Run()
+	assert.NotNil(t, err)
+	assert.Equal(t, err, doneErr)
+	assert.Len(t, events, 7)
+	for _, event := range []string{"created ok", "start ok", "success ok", "created fail", "start fail", "failure fail"} {
+		assert.Contains(t, events, event)
+	}
+	assert.EqualValues(t, "done wf", events[len(events)-1])
+
+	cleanFiles("/tmp/hooks_ok.txt")
+}
@@ -0,0 +1,148 @@
+package scipipe
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// ======= Inspection ========
+
+// Inspection describes the state of the outputs of a workflow, and the
+// failed tasks of its latest recorded run, so that it can be seen what a
+// (resumed) run would do, before doing it
+type Inspection struct {
+	Workflow string
+	Targets  []TargetStatus
+	// The latest run of the workflow recorded in its StateDir, if any, and
+	// the tasks that failed in it
+	LastRun     *RunState
+	FailedTasks []TaskRecord
+}
+
+// TargetStatus describes the state of an output of a task of a workflow
+type TargetStatus struct {
+	Process string
+	Index   int
+	Port    string
+	Path    string
+	Exists  bool
+	ModTime time.Time
+	// Whether the output exists, but is older than any of the inputs of
+	// its task, which are then listed in NewerInputs. Since tasks are
+	// skipped if their outputs exist, stale outputs must be removed for
+	// them to be created again.
+	Stale       bool
+	NewerInputs []string `json:",omitempty"`
+}
+
+// Inspect the outputs of the workflow, finding which exist, and which are
+// stale, and the tasks that failed in the latest run recorded in its
+// StateDir, if set. The paths of the outputs are found as in Clean, so the
+// workflow can not be run afterwards.
+func (wf *Workflow) Inspect() (*Inspection, error) {
+	tasks, err := wf.createAllTasks()
+	if err != nil {
+		return nil, err
+	}
+	ins := &Inspection{Workflow: wf.Name}
+	for _, t := range tasks {
+		inModTimes := make(map[string]time.Time)
+		for _, itgt := range t.InTargets {
+			if itgt.IsInMemory() || itgt.IsStreaming() {
+				continue
+			}
+			for _, ipath := range itgt.GetPaths() {
+				if fi, err := os.Stat(ipath); err == nil {
+					inModTimes[ipath] = fi.ModTime()
+				}
+			}
+		}
+		for oname, otgt := range t.OutTargets {
+			if otgt.IsStreaming() {
+				continue
+			}
+			ts := TargetStatus{Process: t.process.Name, Index: t.Index, Port: oname, Path: otgt.GetPath()}
+			if fi, err := os.Stat(ts.Path); err == nil {
+				ts.Exists = true
+				ts.ModTime = fi.ModTime()
+				for ipath, modTime := range inModTimes {
+					if modTime.After(ts.ModTime) {
+						ts.NewerInputs = append(ts.NewerInputs, ipath)
+					}
+				}
+				sort.Strings(ts.NewerInputs)
+				ts.Stale = len(ts.NewerInputs) > 0
+			}
+			ins.Targets = append(ins.Targets, ts)
+		}
+	}
+	sort.Slice(ins.Targets, func(i, j int) bool {
+		a, b := ins.Targets[i], ins.Targets[j]
+		if a.Process != b.Process {
+			return a.Process < b.Process
+		}
+		if a.Index != b.Index {
+			return a.Index < b.Index
+		}
+		return a.Port < b.Port
+	})
+
+	if wf.StateDir != "" {
+		if ins.LastRun, err = ReadLastRunState(wf.StateDir, wf.Name); err != nil {
+			ins.LastRun = nil
+		}
+	}
+	if ins.LastRun != nil {
+		for _, tr := range ins.LastRun.Tasks {
+			if !tr.Succeeded {
+				ins.FailedTasks = append(ins.FailedTasks, tr)
+			}
+		}
+	}
+	return ins, nil
+}
+
+// Get the number of targets that exist, are missing, and are stale
+func (ins *Inspection) GetCounts() (existing int, missing int, stale int) {
+	for _, ts := range ins.Targets {
+		switch {
+		case ts.Stale:
+			stale++
+			existing++
+		case ts.Exists:
+			existing++
+		default:
+			missing++
+		}
+	}
+	return
+}
+
+// Write the inspection, in a human readable form, to w
+func (ins *Inspection) Write(w io.Writer) error {
+	buf := new(bytes.Buffer)
+	existing, missing, stale := ins.GetCounts()
+	fmt.Fprintf(buf, "Workflow %s: %d outputs, %d existing (%d stale), %d missing\n", ins.Workflow, len(ins.Targets), existing, stale, missing)
+	for _, ts := range ins.Targets {
+		state := "exists"
+		switch {
+		case ts.Stale:
+			state = fmt.Sprintf("STALE (older than %v; remove it to create it again)", ts.NewerInputs)
+		case !ts.Exists:
+			state = "MISSING (will be created)"
+		}
+		fmt.Fprintf(buf, "  %s #%d %s: %s %s\n", ts.Process, ts.Index, ts.Port, ts.Path, state)
+	}
+	if ins.LastRun != nil {
+		fmt.Fprintf(buf, "Latest run, started %s: %s\n", ins.LastRun.StartTime.Format("2006-01-02 15:04:05"), ins.LastRun.State)
+		for _, tr := range ins.FailedTasks {
+			fmt.Fprintf(buf, "  Failed: %s #%d: %s\n", tr.Name, tr.Index, tr.Error)
+		}
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
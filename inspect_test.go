@@ -0,0 +1,57 @@
+package scipipe
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"os"
+	t "testing"
+	"time"
+)
+
+func newTestInspectWorkflow(stateDir string) *Workflow {
+	wf := newTestFooBarWorkflow("/tmp/inspect_")
+	wf.StateDir = stateDir
+	fail := NewFromShell("fail", "echo fail > {o:out}; exit 1")
+	fail.SetPathStatic("out", "/tmp/inspect_fail.txt")
+	wf.AddProcess(fail)
+	wf.Connect("fail.out", "sink.in")
+	return wf
+}
+
+func TestInspect(t *t.T) {
+	initTestLogs()
+	stateDir := "/tmp/inspect_test"
+	os.RemoveAll(stateDir)
+	defer os.RemoveAll(stateDir)
+	defer cleanFiles("/tmp/inspect_foo.txt", "/tmp/inspect_foo.txt.bar")
+
+	assert.Error(t, newTestInspectWorkflow(stateDir).Run())
+	// Make the output of f2b older than its input
+	past := time.Now().Add(-time.Hour)
+	assert.Nil(t, os.Chtimes("/tmp/inspect_foo.txt.bar", past, past))
+
+	ins, err := newTestInspectWorkflow(stateDir).Inspect()
+	assert.Nil(t, err)
+	assert.Len(t, ins.Targets, 3)
+	f2b, fail, foo := ins.Targets[0], ins.Targets[1], ins.Targets[2]
+	assert.EqualValues(t, "f2b", f2b.Process)
+	assert.True(t, f2b.Exists)
+	assert.True(t, f2b.Stale)
+	assert.EqualValues(t, []string{"/tmp/inspect_foo.txt"}, f2b.NewerInputs)
+	assert.EqualValues(t, "/tmp/inspect_fail.txt", fail.Path)
+	assert.False(t, fail.Exists)
+	assert.True(t, foo.Exists)
+	assert.False(t, foo.Stale)
+	existing, missing, stale := ins.GetCounts()
+	assert.EqualValues(t, []int{2, 1, 1}, []int{existing, missing, stale})
+
+	assert.NotNil(t, ins.LastRun)
+	assert.EqualValues(t, RunFailed, ins.LastRun.State)
+	assert.Len(t, ins.FailedTasks, 1)
+	assert.EqualValues(t, "fail", ins.FailedTasks[0].Name)
+
+	buf := new(bytes.Buffer)
+	assert.Nil(t, ins.Write(buf))
+	assert.Contains(t, buf.String(), "/tmp/inspect_fail.txt MISSING")
+	assert.Contains(t, buf.String(), "Failed: fail #0")
+}
@@ -0,0 +1,137 @@
+package scipipe
+
+import (
+	"path/filepath"
+	re "regexp"
+	"sort"
+	"sync"
+)
+
+// ======= Joiner ========
+
+// Joiner is a component that matches targets received on several in-ports
+// by a key, such as a sample ID tag or a part of the file name, rather than
+// by the order in which they arrive. When targets with the same key have
+// been received on all in-ports, they are sent together, one on each of the
+// out-ports with the same names as the in-ports, so that a downstream
+// process with these in-ports gets a matched set of inputs for each task
+// (e.g. tumor and normal samples of the same patient).
+type Joiner struct {
+	Process
+	Name  string
+	In    map[string]*InPort
+	Out   map[string]*OutPort
+	Key   func(*FileTarget) string
+	names []string
+}
+
+// Instantiate a Joiner component, with in- and out-ports named names,
+// matching targets on the key returned by key
+func NewJoiner(name string, key func(*FileTarget) string, names ...string) *Joiner {
+	proc := &Joiner{
+		Name:  name,
+		In:    make(map[string]*InPort),
+		Out:   make(map[string]*OutPort),
+		Key:   key,
+		names: names,
+	}
+	for _, n := range names {
+		proc.In[n] = NewInPort()
+		proc.Out[n] = NewOutPort()
+	}
+	return proc
+}
+
+func (proc *Joiner) IsConnected() bool {
+	isConnected := true
+	for _, n := range proc.names {
+		if !proc.In[n].IsConnected() || !proc.Out[n].IsConnected() {
+			Error.Printf("Port %s of Joiner %s is not connected - check your workflow code!\n", n, proc.Name)
+			isConnected = false
+		}
+	}
+	return isConnected
+}
+
+type joinItem struct {
+	portName string
+	target   *FileTarget
+}
+
+// Execute the Joiner component
+func (proc *Joiner) Run() {
+	defer func() {
+		for _, n := range proc.names {
+			proc.Out[n].Close()
+		}
+	}()
+	// Merge the in-ports into one channel, to receive on all of them
+	items := make(chan *joinItem, BUFSIZE)
+	wg := new(sync.WaitGroup)
+	for _, n := range proc.names {
+		wg.Add(1)
+		go func(n string) {
+			defer wg.Done()
+			for ft := range proc.In[n].Chan {
+				items <- &joinItem{portName: n, target: ft}
+			}
+		}(n)
+	}
+	go func() {
+		wg.Wait()
+		close(items)
+	}()
+
+	pending := make(map[string]map[string]*FileTarget)
+	for item := range items {
+		key := proc.Key(item.target)
+		if pending[key] == nil {
+			pending[key] = make(map[string]*FileTarget)
+		}
+		if _, exists := pending[key][item.portName]; exists {
+			Warning.Printf("Joiner %s: Got more than one target with key '%s' on in-port %s, so using the last one\n", proc.Name, key, item.portName)
+		}
+		pending[key][item.portName] = item.target
+		if len(pending[key]) == len(proc.names) {
+			Debug.Printf("Joiner %s: Sending matched targets for key '%s'\n", proc.Name, key)
+			for _, n := range proc.names {
+				proc.Out[n].Chan <- pending[key][n]
+			}
+			delete(pending, key)
+		}
+	}
+	keys := []string{}
+	for key := range pending {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		Warning.Printf("Joiner %s: No match on all in-ports for key '%s', so dropping its targets\n", proc.Name, key)
+	}
+}
+
+// ------- Join keys -------
+
+// Get a join key function returning the value of the tag tagKey
+func KeyByTag(tagKey string) func(*FileTarget) string {
+	return func(ft *FileTarget) string {
+		return ft.GetTag(tagKey)
+	}
+}
+
+// Get a join key function returning the part of the file name (the last
+// element of the path) matched by the first group of the regular expression
+// pattern, or the whole match if there is no group
+func KeyByPathRegex(pattern string) func(*FileTarget) string {
+	r := re.MustCompile(pattern)
+	return func(ft *FileTarget) string {
+		m := r.FindStringSubmatch(filepath.Base(ft.GetPath()))
+		if len(m) > 1 {
+			return m[1]
+		}
+		if len(m) == 1 {
+			return m[0]
+		}
+		return ""
+	}
+}
@@ -0,0 +1,35 @@
+package scipipe
+
+import (
+	"github.com/stretchr/testify/assert"
+	t "testing"
+)
+
+func TestJoiner(t *t.T) {
+	initTestLogs()
+
+	jnr := NewJoiner("jnr", KeyByPathRegex(`^(p\d+)_`), "tumor", "normal")
+	jnr.In["tumor"].Chan = make(chan *FileTarget, 3)
+	for _, p := range []string{"/tmp/p1_t.bam", "/tmp/p2_t.bam", "/tmp/p3_t.bam"} {
+		jnr.In["tumor"].Chan <- NewFileTarget(p)
+	}
+	close(jnr.In["tumor"].Chan)
+	jnr.In["normal"].Chan = make(chan *FileTarget, 2)
+	for _, p := range []string{"/tmp/p2_n.bam", "/tmp/p1_n.bam"} {
+		jnr.In["normal"].Chan <- NewFileTarget(p)
+	}
+	close(jnr.In["normal"].Chan)
+	jnr.Out["tumor"].Chan = make(chan *FileTarget, 3)
+	jnr.Out["normal"].Chan = make(chan *FileTarget, 3)
+	jnr.Run()
+
+	pairs := map[string]string{}
+	for tft := range jnr.Out["tumor"].Chan {
+		nft := <-jnr.Out["normal"].Chan
+		pairs[tft.GetPath()] = nft.GetPath()
+	}
+	assert.EqualValues(t, map[string]string{
+		"/tmp/p1_t.bam": "/tmp/p1_n.bam",
+		"/tmp/p2_t.bam": "/tmp/p2_n.bam",
+	}, pairs)
+}
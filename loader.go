@@ -0,0 +1,299 @@
+package scipipe
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// ======= Declarative workflows ========
+
+// WorkflowSpec is the declarative definition of a workflow, as read from a
+// JSON or YAML (see RegisterSpecFormat) file, such as:
+//
+//	{
+//	    "name": "foobar",
+//	    "params": {"word": "foo"},
+//	    "processes": [
+//	        {"name": "foo", "command": "echo {p:word} > {o:out}", "outputs": {"out": "{p:word}.txt"}},
+//	        {"name": "f2b", "command": "sed 's/foo/bar/' {i:in} > {o:out}", "outputs": {"out": "{i:in|%.txt}.bar.txt"}}
+//	    ],
+//	    "connections": [{"from": "foo.out", "to": "f2b.in"}]
+//	}
+//
+// Params of the workflow give the values of the params, of the same name, of
+// all its processes, unless given for the process itself.
+type WorkflowSpec struct {
+	Name        string            `json:"name" yaml:"name"`
+	Params      map[string]string `json:"params" yaml:"params"`
+	Processes   []ProcessSpec     `json:"processes" yaml:"processes"`
+	Connections []Connection      `json:"connections" yaml:"connections"`
+}
+
+// ProcessSpec is the declarative definition of a process of a workflow. The
+// type is "shell" (the default) for a SciProcess created from the command
+// pattern, where outputs gives the path patterns (see
+// SciProcess.SetPathPattern) of the out-ports, and params the values of
+// params. Other types of components, configured with options, are "files",
+// a FileQueue sending the files given as the option "paths", "csv", a
+// CSVSource reading the file given as the option "path", and "sink", as
+// well as those added with RegisterComponentType.
+type ProcessSpec struct {
+	Name     string                 `json:"name" yaml:"name"`
+	Type     string                 `json:"type" yaml:"type"`
+	Command  string                 `json:"command" yaml:"command"`
+	Outputs  map[string]string      `json:"outputs" yaml:"outputs"`
+	Params   map[string]string      `json:"params" yaml:"params"`
+	Cores    int                    `json:"cores" yaml:"cores"`
+	MemoryMB int                    `json:"memory_mb" yaml:"memory_mb"`
+	Options  map[string]interface{} `json:"options" yaml:"options"`
+}
+
+// Get the option opt of a process spec as a string, or an error if it is
+// missing or not a string
+func (ps ProcessSpec) GetStringOption(opt string) (string, error) {
+	s, ok := ps.Options[opt].(string)
+	if !ok {
+		return "", fmt.Errorf("Process %s: Option %s must be a string", ps.Name, opt)
+	}
+	return s, nil
+}
+
+// Get the option opt of a process spec as a list of strings, or an error if
+// it is missing or not a list of strings
+func (ps ProcessSpec) GetStringListOption(opt string) ([]string, error) {
+	vals, ok := ps.Options[opt].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Process %s: Option %s must be a list", ps.Name, opt)
+	}
+	strs := []string{}
+	for _, val := range vals {
+		s, ok := val.(string)
+		if !ok {
+			return nil, fmt.Errorf("Process %s: Option %s must be a list of strings", ps.Name, opt)
+		}
+		strs = append(strs, s)
+	}
+	return strs, nil
+}
+
+var (
+	componentTypes = map[string]func(ProcessSpec) (Process, error){
+		"shell": newShellProcessFromSpec,
+		"files": func(ps ProcessSpec) (Process, error) {
+			paths, err := ps.GetStringListOption("paths")
+			if err != nil {
+				return nil, err
+			}
+			return NewFileQueue(paths...), nil
+		},
+		"csv": func(ps ProcessSpec) (Process, error) {
+			path, err := ps.GetStringOption("path")
+			if err != nil {
+				return nil, err
+			}
+			return NewCSVSource(ps.Name, path), nil
+		},
+		"sink": func(ps ProcessSpec) (Process, error) {
+			return NewSink(), nil
+		},
+	}
+	specFormats = map[string]func([]byte, interface{}) error{
+		".json": unmarshalJSON,
+		".yaml": unmarshalYAML,
+		".yml":  unmarshalYAML,
+	}
+	specRegistryLock = new(sync.RWMutex)
+)
+
+// Register the component type typ, for use in workflow specs, so that custom
+// components can be used in declarative workflows. The function create
+// creates the component from its spec, usually configured by its options.
+func RegisterComponentType(typ string, create func(ProcessSpec) (Process, error)) {
+	specRegistryLock.Lock()
+	componentTypes[typ] = create
+	specRegistryLock.Unlock()
+}
+
+// Register the function unmarshal for reading workflow specs (and config
+// files, see ConfigFiles) from files with the extension ext. JSON (.json)
+// and YAML (.yaml and .yml) are supported out of the box. The function
+// should fail on keys that do not match any field of a struct, as those of
+// JSON and YAML do, so that misspelled keys are not silently ignored.
+func RegisterSpecFormat(ext string, unmarshal func([]byte, interface{}) error) {
+	specRegistryLock.Lock()
+	specFormats[ext] = unmarshal
+	specRegistryLock.Unlock()
+}
+
+// Unmarshal the JSON document in data into v, as json.Unmarshal does, but
+// failing on keys that do not match any field of a struct
+func unmarshalJSON(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if dec.More() {
+		return errors.New("Unexpected content after the JSON document")
+	}
+	return nil
+}
+
+// Unmarshal the YAML document in data into v, as yaml.Unmarshal does, but
+// failing on keys that do not match any field of a struct
+func unmarshalYAML(data []byte, v interface{}) error {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(v); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// Read the workflow spec from the file at path, in the format given by its
+// extension (see RegisterSpecFormat)
+func ReadWorkflowSpec(path string) (*WorkflowSpec, error) {
+	specRegistryLock.RLock()
+	unmarshal, ok := specFormats[filepath.Ext(path)]
+	specRegistryLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("Unknown format of workflow spec: %s", path)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	spec := &WorkflowSpec{}
+	if err := unmarshal(data, spec); err != nil {
+		return nil, fmt.Errorf("Could not parse workflow spec %s: %s", path, err)
+	}
+	return spec, nil
+}
+
+// Load the workflow defined by the spec in the file at path (see
+// ReadWorkflowSpec and NewWorkflowFromSpec)
+func LoadWorkflow(path string) (*Workflow, error) {
+	spec, err := ReadWorkflowSpec(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewWorkflowFromSpec(spec)
+}
+
+// Create a runnable workflow from the spec. Out-ports of shell processes
+// that are not connected are connected to a sink, so that their outputs are
+// created.
+func NewWorkflowFromSpec(spec *WorkflowSpec) (*Workflow, error) {
+	if spec.Name == "" {
+		return nil, fmt.Errorf("Workflow spec has no name")
+	}
+	wf := NewWorkflow(spec.Name)
+	wf.spec = spec
+	for _, ps := range spec.Processes {
+		if ps.Name == "" {
+			return nil, fmt.Errorf("Workflow %s: Process spec has no name", spec.Name)
+		}
+		if ps.Type == "" {
+			ps.Type = "shell"
+		}
+		specRegistryLock.RLock()
+		create, ok := componentTypes[ps.Type]
+		specRegistryLock.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("Workflow %s: Process %s has unknown type: %s", spec.Name, ps.Name, ps.Type)
+		}
+		proc, err := create(ps)
+		if err != nil {
+			return nil, err
+		}
+		if p, ok := proc.(*SciProcess); ok {
+			for pname := range p.ParamPorts {
+				if _, ok := ps.Params[pname]; ok {
+					continue
+				}
+				if val, ok := spec.Params[pname]; ok {
+					p.SetParamDefault(pname, val)
+				}
+			}
+		}
+		if _, ok := wf.procsByName[ps.Name]; ok {
+			return nil, fmt.Errorf("Workflow %s: More than one process named %s", spec.Name, ps.Name)
+		}
+		wf.Add(ps.Name, proc)
+	}
+	for _, c := range spec.Connections {
+		wf.Connect(c.From, c.To)
+	}
+	connectUnconnectedOutPorts(wf)
+	if err := wf.Validate(); err != nil {
+		return nil, err
+	}
+	return wf, nil
+}
+
+// Create a SciProcess from the spec of a shell process
+func newShellProcessFromSpec(ps ProcessSpec) (Process, error) {
+	if ps.Command == "" {
+		return nil, fmt.Errorf("Process %s has no command", ps.Name)
+	}
+	p := NewFromShell(ps.Name, ps.Command)
+	for oname, pattern := range ps.Outputs {
+		if _, ok := p.Out[oname]; !ok {
+			return nil, fmt.Errorf("Process %s has no out-port %s, for the output path %s", ps.Name, oname, pattern)
+		}
+		p.SetPathPattern(oname, pattern)
+	}
+	for oname := range p.Out {
+		if _, ok := p.PathFormatters[oname]; !ok {
+			return nil, fmt.Errorf("Process %s has no output path for out-port %s", ps.Name, oname)
+		}
+	}
+	for pname, val := range ps.Params {
+		if _, ok := p.ParamPorts[pname]; !ok {
+			return nil, fmt.Errorf("Process %s has no param %s", ps.Name, pname)
+		}
+		p.SetParamDefault(pname, val)
+	}
+	p.Cores = ps.Cores
+	p.MemoryMB = ps.MemoryMB
+	return p, nil
+}
+
+// Connect the out-ports of the SciProcesses of the workflow, that are not
+// connected, to a sink, added to the workflow if there is none
+func connectUnconnectedOutPorts(wf *Workflow) {
+	var sink *Sink
+	for _, name := range wf.procNames {
+		if s, ok := wf.procsByName[name].(*Sink); ok {
+			sink = s
+		}
+	}
+	for _, name := range append([]string{}, wf.procNames...) {
+		p, ok := wf.procsByName[name].(*SciProcess)
+		if !ok {
+			continue
+		}
+		onames := []string{}
+		for oname, oport := range p.Out {
+			if !oport.IsConnected() {
+				onames = append(onames, oname)
+			}
+		}
+		sort.Strings(onames)
+		for _, oname := range onames {
+			if sink == nil {
+				sink = NewSink()
+				wf.AddProcess(sink)
+			}
+			sink.Connect(p.Out[oname])
+		}
+	}
+}
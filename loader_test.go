@@ -0,0 +1,118 @@
+package scipipe
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	t "testing"
+)
+
+func TestLoadWorkflow(t *t.T) {
+	initTestLogs()
+
+	specPath := "/tmp/loader_test.json"
+	err := ioutil.WriteFile(specPath, []byte(`{
+	"name": "foobar",
+	"params": {"word": "foo"},
+	"processes": [
+		{"name": "foo", "command": "echo {p:word} > {o:out}", "outputs": {"out": "/tmp/loader_{p:word}.txt"}},
+		{"name": "f2b", "command": "`+testF2bCommand+`", "outputs": {"out": "{i:in|%.txt}.bar.txt"}, "cores": 2}
+	],
+	"connections": [{"from": "foo.out", "to": "f2b.in"}]
+}`), 0644)
+	assert.Nil(t, err)
+	defer os.Remove(specPath)
+
+	wf, err := LoadWorkflow(specPath)
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{"foo", "f2b", "sink"}, wf.GetProcessNames())
+	assert.EqualValues(t, 2, wf.GetSciProcess("f2b").Cores)
+
+	err = wf.Run()
+	assert.Nil(t, err)
+	assert.EqualValues(t, "bar\n", string(NewFileTarget("/tmp/loader_foo.bar.txt").Read()))
+	cleanFiles("/tmp/loader_foo.txt", "/tmp/loader_foo.bar.txt")
+}
+
+func TestLoadWorkflowYAML(t *t.T) {
+	initTestLogs()
+
+	specPath := "/tmp/loader_test.yaml"
+	err := ioutil.WriteFile(specPath, []byte(`name: foobar
+params:
+  word: foo
+processes:
+  - name: foo
+    command: echo {p:word} > {o:out}
+    outputs:
+      out: /tmp/loader_yaml_{p:word}.txt
+  - name: f2b
+    command: `+testF2bCommand+`
+    outputs: {out: "{i:in|%.txt}.bar.txt"}
+    cores: 2
+connections:
+  - from: foo.out
+    to: f2b.in
+`), 0644)
+	assert.Nil(t, err)
+	defer os.Remove(specPath)
+
+	wf, err := LoadWorkflow(specPath)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, wf.GetSciProcess("f2b").Cores)
+	assert.Nil(t, wf.Run())
+	assert.EqualValues(t, "bar\n", string(NewFileTarget("/tmp/loader_yaml_foo.bar.txt").Read()))
+	cleanFiles("/tmp/loader_yaml_foo.txt", "/tmp/loader_yaml_foo.bar.txt")
+}
+
+func TestReadWorkflowSpecUnknownKeys(t *t.T) {
+	initTestLogs()
+
+	specs := map[string]string{
+		"/tmp/loader_unknown.json": `{"name": "foobar", "connection": [{"from": "foo.out", "to": "f2b.in"}]}`,
+		"/tmp/loader_unknown.yaml": "name: foobar\nprocesses:\n  - name: foo\n    command: echo foo > {o:out}\n    out_paths: {out: foo.txt}\n",
+	}
+	for specPath, spec := range specs {
+		assert.Nil(t, ioutil.WriteFile(specPath, []byte(spec), 0644))
+		defer os.Remove(specPath)
+		_, err := ReadWorkflowSpec(specPath)
+		assert.Error(t, err, "Misspelled keys should fail: "+specPath)
+	}
+}
+
+func TestNewWorkflowFromSpec(t *t.T) {
+	initTestLogs()
+
+	RegisterComponentType("upper", func(ps ProcessSpec) (Process, error) {
+		p := NewFromShell(ps.Name, "tr a-z A-Z < {i:in} > {o:out}")
+		p.SetPathExtend("in", "out", ".upper")
+		return p, nil
+	})
+	defer delete(componentTypes, "upper")
+
+	spec := &WorkflowSpec{
+		Name: "wf",
+		Processes: []ProcessSpec{
+			{Name: "files", Type: "files", Options: map[string]interface{}{"paths": []interface{}{"/tmp/loader_in.txt"}}},
+			{Name: "upper", Type: "upper"},
+		},
+		Connections: []Connection{{From: "files.out", To: "upper.in"}},
+	}
+	err := ioutil.WriteFile("/tmp/loader_in.txt", []byte("foo\n"), 0644)
+	assert.Nil(t, err)
+	wf, err := NewWorkflowFromSpec(spec)
+	assert.Nil(t, err)
+	err = wf.Run()
+	assert.Nil(t, err)
+	assert.EqualValues(t, "FOO\n", string(NewFileTarget("/tmp/loader_in.txt.upper").Read()))
+	cleanFiles("/tmp/loader_in.txt", "/tmp/loader_in.txt.upper")
+
+	_, err = NewWorkflowFromSpec(&WorkflowSpec{Name: "wf", Processes: []ProcessSpec{{Name: "foo", Type: "nosuchtype"}}})
+	assert.Error(t, err)
+	_, err = NewWorkflowFromSpec(&WorkflowSpec{Name: "wf", Processes: []ProcessSpec{{Name: "foo", Command: "echo foo > {o:out}"}}})
+	assert.Error(t, err, "Missing output path should give an error")
+	_, err = NewWorkflowFromSpec(&WorkflowSpec{Name: "wf", Processes: []ProcessSpec{{Name: "cat", Command: "cat {i:in} > {o:out}", Outputs: map[string]string{"out": "{i:in}.cat"}}}})
+	assert.Error(t, err, "Unconnected in-port should give an error")
+	_, err = ReadWorkflowSpec("/tmp/loader_test.toml")
+	assert.Error(t, err)
+}
@@ -15,6 +15,9 @@ var (
 	Warning   *log.Logger
 	Error     *log.Logger
 	LogExists bool
+	// Whether the logging was initiated by default, rather than by the
+	// user, in which case the log level of the config applies (see Config)
+	logIsDefault bool
 )
 
 // Initiate logging
@@ -53,6 +56,15 @@ func InitLog(
 		log.Ldate|log.Ltime)
 
 	LogExists = true
+	logIsDefault = false
+}
+
+// Initiate logging with level=AUDIT, unless already initiated
+func initDefaultLog() {
+	if !LogExists {
+		InitLogAudit()
+		logIsDefault = true
+	}
 }
 
 // Initiate logging with level=DEBUG
@@ -114,3 +126,88 @@ func InitLogError() {
 		os.Stderr,
 	)
 }
+
+// ======= Per-process and per-task logging ========
+
+// loggers is a set of leveled loggers, like the global ones, for use by a
+// process or task
+type loggers struct {
+	Debug   *log.Logger
+	Info    *log.Logger
+	Audit   *log.Logger
+	Warning *log.Logger
+	Error   *log.Logger
+}
+
+// Get the global loggers, as a set
+func getGlobalLoggers() *loggers {
+	return &loggers{Debug: Debug, Info: Info, Audit: Audit, Warning: Warning, Error: Error}
+}
+
+// Create a set of loggers writing the messages of level and above to w
+// (and errors to errW), and discarding the others
+func newLoggers(level LogLevel, w io.Writer, errW io.Writer) *loggers {
+	writer := func(l LogLevel) io.Writer {
+		if l < level {
+			return ioutil.Discard
+		}
+		return w
+	}
+	return &loggers{
+		Debug:   log.New(writer(LevelDebug), "DEBUG   ", log.Ldate|log.Ltime|log.Lshortfile),
+		Info:    log.New(writer(LevelInfo), "INFO    ", log.Ldate|log.Ltime),
+		Audit:   log.New(writer(LevelAudit), "AUDIT   ", log.Ldate|log.Ltime),
+		Warning: log.New(writer(LevelWarning), "WARNING ", log.Ldate|log.Ltime),
+		Error:   log.New(errW, "ERROR   ", log.Ldate|log.Ltime),
+	}
+}
+
+// Create a set of loggers writing both to the loggers ls, and, for messages
+// of level and above, to w
+func (ls *loggers) tee(level LogLevel, w io.Writer) *loggers {
+	teeWriter := func(l *log.Logger, lvl LogLevel) io.Writer {
+		if lvl < level {
+			return l.Writer()
+		}
+		return io.MultiWriter(l.Writer(), w)
+	}
+	return &loggers{
+		Debug:   log.New(teeWriter(ls.Debug, LevelDebug), ls.Debug.Prefix(), ls.Debug.Flags()),
+		Info:    log.New(teeWriter(ls.Info, LevelInfo), ls.Info.Prefix(), ls.Info.Flags()),
+		Audit:   log.New(teeWriter(ls.Audit, LevelAudit), ls.Audit.Prefix(), ls.Audit.Flags()),
+		Warning: log.New(teeWriter(ls.Warning, LevelWarning), ls.Warning.Prefix(), ls.Warning.Flags()),
+		Error:   log.New(teeWriter(ls.Error, LevelError), ls.Error.Prefix(), ls.Error.Flags()),
+	}
+}
+
+// Set the log level of the process, so that its debug and info messages
+// (and those of its tasks) are shown, or hidden, independently of the
+// global log level, such as for debugging just one misbehaving process.
+// Messages are written where the global loggers write them, as set up with
+// InitLog when SetLogLevel is called (see getGlobalLogWriter), and errors
+// where the global Error logger writes them.
+func (p *SciProcess) SetLogLevel(level LogLevel) {
+	initDefaultLog()
+	p.loggers = newLoggers(level, getGlobalLogWriter(), Error.Writer())
+}
+
+// Get the writer that the global loggers write messages (other than errors)
+// to: that of the lowest level not discarded, or os.Stdout, if all of them
+// are discarded
+func getGlobalLogWriter() io.Writer {
+	for _, l := range []*log.Logger{Debug, Info, Audit, Warning} {
+		if w := l.Writer(); w != ioutil.Discard {
+			return w
+		}
+	}
+	return os.Stdout
+}
+
+// Get the loggers of the process, which are the global ones, unless a log
+// level is set for the process
+func (p *SciProcess) logs() *loggers {
+	if p.loggers != nil {
+		return p.loggers
+	}
+	return getGlobalLoggers()
+}
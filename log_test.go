@@ -0,0 +1,64 @@
+package scipipe
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	t "testing"
+)
+
+func TestProcessLogLevel(t *t.T) {
+	buf := new(bytes.Buffer)
+	ls := newLoggers(LevelInfo, buf, buf)
+	ls.Debug.Println("debug message")
+	ls.Info.Println("info message")
+	ls.Audit.Println("audit message")
+	assert.NotContains(t, buf.String(), "debug message")
+	assert.Contains(t, buf.String(), "info message")
+	assert.Contains(t, buf.String(), "audit message")
+
+	teeBuf := new(bytes.Buffer)
+	tee := ls.tee(LevelWarning, teeBuf)
+	tee.Info.Println("info message 2")
+	tee.Warning.Println("warning message")
+	assert.Contains(t, buf.String(), "info message 2")
+	assert.NotContains(t, teeBuf.String(), "info message 2")
+	assert.Contains(t, teeBuf.String(), "warning message")
+
+	p := NewSciProcess("p", "echo")
+	assert.Equal(t, Debug, p.logs().Debug)
+	p.SetLogLevel(LevelDebug)
+	assert.NotEqual(t, Debug, p.logs().Debug)
+
+	// The writers set up for the global loggers are kept
+	logBuf, errBuf := new(bytes.Buffer), new(bytes.Buffer)
+	InitLog(ioutil.Discard, ioutil.Discard, ioutil.Discard, logBuf, logBuf, errBuf)
+	defer resetTestLogs()
+	p.SetLogLevel(LevelDebug)
+	p.logs().Debug.Println("debug message")
+	p.logs().Error.Println("error message")
+	assert.Contains(t, logBuf.String(), "debug message")
+	assert.Contains(t, errBuf.String(), "error message")
+}
+
+func TestTaskLogFiles(t *t.T) {
+	initTestLogs()
+
+	foo := NewFromShell("foo", "echo 'tool output'; echo foo > {o:out}")
+	foo.SetPathStatic("out", "/tmp/tasklog_foo.txt")
+	foo.TaskLogFiles = true
+	foo.Out["out"].Chan = make(chan *FileTarget, BUFSIZE)
+	foo.Run()
+
+	logFile := NewFileTarget("/tmp/tasklog_foo.txt.log")
+	assert.True(t, logFile.Exists())
+	log := string(logFile.Read())
+	assert.Contains(t, log, `"level":"audit"`)
+	assert.Contains(t, log, `"msg":"Executing command"`)
+	assert.Contains(t, log, `"command":"echo 'tool output'`)
+	assert.Contains(t, log, "tool output\n")
+
+	cleanFiles("/tmp/tasklog_foo.txt")
+	os.Remove("/tmp/tasklog_foo.txt.log")
+}
@@ -0,0 +1,275 @@
+package scipipe
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	str "strings"
+	"sync"
+	"time"
+)
+
+// ======= Structured logging ========
+
+// LogLevel is the level of a structured log entry
+type LogLevel int
+
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	// LevelAudit is for the messages to retain to audit a run, such as the
+	// commands executed, as written by the Audit logger
+	LevelAudit
+	LevelWarning
+	LevelError
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelAudit:
+		return "audit"
+	case LevelWarning:
+		return "warning"
+	case LevelError:
+		return "error"
+	}
+	return fmt.Sprintf("level%d", int(l))
+}
+
+// Fields are the key-value pairs of a structured log entry, such as the
+// names of the process and task it is about
+type Fields map[string]interface{}
+
+// Logger is the interface for structured logging, of events such as tasks
+// being created, started, skipped, finishing and failing, and workflow runs
+// starting and finishing, with the names of the process and the task as
+// fields ("process", "task", "task_index" and "task_id"), rather than
+// embedded in the message. Set it with SetLogger.
+//
+// The default is a JSONLogger writing each entry to where the leveled logger
+// of its level (Debug, Info, Audit, Warning or Error) writes, as set up with
+// InitLog, so that the log level set up there applies. Entries about a
+// process or a task are written to the loggers of the process instead, and
+// to the log file of the task, so that the log level of the process (see
+// SciProcess.SetLogLevel) and the log files of tasks (see
+// SciProcess.TaskLogFiles) apply to them. Loggers set with SetLogger get all
+// entries.
+//
+// Loggers for log/slog, logrus and zap are created with NewSlogLogger,
+// NewLogrusLogger and NewZapLogger, which log audit entries at the info
+// level, and other logging libraries can be plugged in with LoggerFunc.
+type Logger interface {
+	Log(level LogLevel, msg string, fields Fields)
+}
+
+// LoggerFunc lets an ordinary function be used as a Logger
+type LoggerFunc func(level LogLevel, msg string, fields Fields)
+
+func (f LoggerFunc) Log(level LogLevel, msg string, fields Fields) {
+	f(level, msg, fields)
+}
+
+var (
+	// The logger set with SetLogger, or nil, for the default one
+	structuredLogger     Logger
+	structuredLoggerLock = new(sync.RWMutex)
+)
+
+// Set the logger for structured logging, or go back to the default one, if
+// logger is nil
+func SetLogger(logger Logger) {
+	structuredLoggerLock.Lock()
+	structuredLogger = logger
+	structuredLoggerLock.Unlock()
+}
+
+// Get the logger set with SetLogger, or nil, if none is set
+func getLogger() Logger {
+	structuredLoggerLock.RLock()
+	defer structuredLoggerLock.RUnlock()
+	return structuredLogger
+}
+
+// Log msg with the fields to the structured logger
+func logStructured(level LogLevel, msg string, fields Fields) {
+	initDefaultLog()
+	logTo(getGlobalLoggers(), level, msg, fields)
+}
+
+// Log msg about the process p to the structured logger, with the name of
+// the process added to the fields
+func (p *SciProcess) logStructured(level LogLevel, msg string, fields Fields) {
+	all := Fields{"process": p.Name}
+	for k, v := range fields {
+		all[k] = v
+	}
+	logTo(p.logs(), level, msg, all)
+}
+
+// Log msg about the task t to the structured logger, with the names of its
+// process and itself added to the fields
+func (t *SciTask) logStructured(level LogLevel, msg string, fields Fields) {
+	all := Fields{
+		"process":    t.process.Name,
+		"task":       t.Name,
+		"task_index": t.Index,
+		"task_id":    t.GetID(),
+	}
+	for k, v := range fields {
+		all[k] = v
+	}
+	logTo(t.logs(), level, msg, all)
+}
+
+// Log msg with the fields to the logger set with SetLogger, or else, as the
+// default logger does, as JSON to the loggers ls
+func logTo(ls *loggers, level LogLevel, msg string, fields Fields) {
+	logger := getLogger()
+	if logger == nil {
+		logger = ls.jsonLogger()
+	}
+	logger.Log(level, msg, fields)
+}
+
+// ------- Text logger -------
+
+// TextLogger is a Logger which writes entries to the leveled loggers
+// (Debug, Info, Audit, Warning and Error), as the message followed by the
+// fields, as key=value pairs. An error in the field "error" is written
+// after the message instead, as in "Task failed: ...", since errors of
+// commands span several lines.
+type TextLogger struct{}
+
+// Create a new TextLogger
+func NewTextLogger() *TextLogger {
+	return &TextLogger{}
+}
+
+func (l *TextLogger) Log(level LogLevel, msg string, fields Fields) {
+	initDefaultLog()
+	l.write(getGlobalLoggers(), level, msg, fields)
+}
+
+// Write the entry to the loggers ls
+func (l *TextLogger) write(ls *loggers, level LogLevel, msg string, fields Fields) {
+	line := msg
+	for _, k := range sortedFieldKeys(fields) {
+		if k == "error" {
+			continue
+		}
+		v := fmt.Sprint(fields[k])
+		if v == "" || str.ContainsAny(v, " \t\n\"=") {
+			v = strconv.Quote(v)
+		}
+		line += " " + k + "=" + v
+	}
+	if err, ok := fields["error"]; ok {
+		line += ": " + fmt.Sprint(err)
+	}
+	switch level {
+	case LevelDebug:
+		ls.Debug.Println(line)
+	case LevelInfo:
+		ls.Info.Println(line)
+	case LevelAudit:
+		ls.Audit.Println(line)
+	case LevelWarning:
+		ls.Warning.Println(line)
+	default:
+		ls.Error.Println(line)
+	}
+}
+
+// ------- JSON logger -------
+
+// JSONLogger writes structured log entries as JSON objects, one per line,
+// with the time, level and message as the fields "time", "level" and "msg"
+type JSONLogger struct {
+	// Entries below this level are not written
+	MinLevel LogLevel
+	// Get the writer for entries of a level
+	writer func(level LogLevel) io.Writer
+	lock   *sync.Mutex
+}
+
+// Create a new JSONLogger, writing to w
+func NewJSONLogger(w io.Writer) *JSONLogger {
+	return &JSONLogger{
+		MinLevel: LevelInfo,
+		writer:   func(LogLevel) io.Writer { return w },
+		lock:     new(sync.Mutex),
+	}
+}
+
+// Lock for the writers of the loggers that JSONLoggers created by
+// loggers.jsonLogger write to, as these are created for each entry
+var loggersJSONLock = new(sync.Mutex)
+
+// Get a JSONLogger writing the entries of each level to the writer of the
+// logger of the level in ls, so that entries of levels discarded by ls are
+// discarded
+func (ls *loggers) jsonLogger() *JSONLogger {
+	return &JSONLogger{
+		MinLevel: LevelDebug,
+		writer: func(level LogLevel) io.Writer {
+			switch level {
+			case LevelDebug:
+				return ls.Debug.Writer()
+			case LevelInfo:
+				return ls.Info.Writer()
+			case LevelAudit:
+				return ls.Audit.Writer()
+			case LevelWarning:
+				return ls.Warning.Writer()
+			}
+			return ls.Error.Writer()
+		},
+		lock: loggersJSONLock,
+	}
+}
+
+func (l *JSONLogger) Log(level LogLevel, msg string, fields Fields) {
+	w := l.writer(level)
+	if level < l.MinLevel || w == ioutil.Discard {
+		return
+	}
+	entry := make(map[string]interface{})
+	for k, v := range fields {
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		entry[k] = v
+	}
+	entry["time"] = time.Now().Format(time.RFC3339Nano)
+	entry["level"] = level.String()
+	entry["msg"] = msg
+	// Commands are kept readable, as with > rather than \u003e
+	line := new(bytes.Buffer)
+	enc := json.NewEncoder(line)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(entry); err != nil {
+		Warning.Println("JSONLogger: Could not format log entry:", err)
+		return
+	}
+	l.lock.Lock()
+	w.Write(line.Bytes())
+	l.lock.Unlock()
+}
+
+// Get the keys of fields, sorted
+func sortedFieldKeys(fields Fields) []string {
+	keys := []string{}
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
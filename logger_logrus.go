@@ -0,0 +1,54 @@
+package scipipe
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// LogrusEntry is the interface of the *logrus.Entry of
+// github.com/sirupsen/logrus used by a LogrusLogger
+type LogrusEntry interface {
+	Debug(args ...interface{})
+	Info(args ...interface{})
+	Warn(args ...interface{})
+	Error(args ...interface{})
+}
+
+// LogrusLogger is a Logger writing to a logrus logger, as in:
+//
+//	scipipe.SetLogger(scipipe.NewLogrusLogger(logrus.StandardLogger()))
+//
+// Since the WithFields method of logrus loggers takes and returns types of
+// logrus, it is called by reflection, so that logrus does not have to be a
+// dependency of scipipe.
+type LogrusLogger struct {
+	withFields reflect.Value
+}
+
+// Create a new LogrusLogger, writing to logger, which is a *logrus.Logger
+// or *logrus.Entry, or anything else with a WithFields method taking a map
+// of fields, and returning a LogrusEntry
+func NewLogrusLogger(logger interface{}) *LogrusLogger {
+	withFields := reflect.ValueOf(logger).MethodByName("WithFields")
+	if !withFields.IsValid() || withFields.Type().NumIn() != 1 || withFields.Type().NumOut() != 1 ||
+		!reflect.TypeOf(Fields{}).ConvertibleTo(withFields.Type().In(0)) ||
+		!withFields.Type().Out(0).Implements(reflect.TypeOf((*LogrusEntry)(nil)).Elem()) {
+		Check(fmt.Errorf("Logger of type %T has no WithFields method as logrus loggers have", logger))
+	}
+	return &LogrusLogger{withFields: withFields}
+}
+
+func (l *LogrusLogger) Log(level LogLevel, msg string, fields Fields) {
+	arg := reflect.ValueOf(fields).Convert(l.withFields.Type().In(0))
+	entry := l.withFields.Call([]reflect.Value{arg})[0].Interface().(LogrusEntry)
+	switch level {
+	case LevelDebug:
+		entry.Debug(msg)
+	case LevelInfo, LevelAudit:
+		entry.Info(msg)
+	case LevelWarning:
+		entry.Warn(msg)
+	default:
+		entry.Error(msg)
+	}
+}
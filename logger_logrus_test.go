@@ -0,0 +1,43 @@
+package scipipe
+
+import (
+	"github.com/stretchr/testify/assert"
+	t "testing"
+)
+
+// testLogrusFields and testLogrusLogger mimic the Fields and Logger types of
+// logrus, recording the entries logged
+type testLogrusFields map[string]interface{}
+
+type testLogrusLogger struct {
+	entries []string
+	fields  []testLogrusFields
+}
+
+func (l *testLogrusLogger) WithFields(fields testLogrusFields) *testLogrusEntry {
+	l.fields = append(l.fields, fields)
+	return &testLogrusEntry{l}
+}
+
+type testLogrusEntry struct {
+	logger *testLogrusLogger
+}
+
+func (e *testLogrusEntry) log(level string, args []interface{}) {
+	e.logger.entries = append(e.logger.entries, level+" "+args[0].(string))
+}
+
+func (e *testLogrusEntry) Debug(args ...interface{}) { e.log("debug", args) }
+func (e *testLogrusEntry) Info(args ...interface{})  { e.log("info", args) }
+func (e *testLogrusEntry) Warn(args ...interface{})  { e.log("warn", args) }
+func (e *testLogrusEntry) Error(args ...interface{}) { e.log("error", args) }
+
+func TestLogrusLogger(t *t.T) {
+	logrus := &testLogrusLogger{}
+	l := NewLogrusLogger(logrus)
+	l.Log(LevelWarning, "Something", Fields{"a": 1})
+	assert.EqualValues(t, []string{"warn Something"}, logrus.entries)
+	assert.EqualValues(t, []testLogrusFields{{"a": 1}}, logrus.fields)
+
+	assert.Panics(t, func() { NewLogrusLogger(&testSugaredLogger{}) })
+}
@@ -0,0 +1,38 @@
+//go:build go1.21
+
+package scipipe
+
+import (
+	"context"
+	"log/slog"
+)
+
+// SlogLogger is a Logger writing to a log/slog Logger
+type SlogLogger struct {
+	logger *slog.Logger
+}
+
+// Create a new SlogLogger, writing to logger
+func NewSlogLogger(logger *slog.Logger) *SlogLogger {
+	return &SlogLogger{logger: logger}
+}
+
+func (l *SlogLogger) Log(level LogLevel, msg string, fields Fields) {
+	attrs := make([]slog.Attr, 0, len(fields))
+	for _, k := range sortedFieldKeys(fields) {
+		attrs = append(attrs, slog.Any(k, fields[k]))
+	}
+	l.logger.LogAttrs(context.Background(), slogLevel(level), msg, attrs...)
+}
+
+func slogLevel(level LogLevel) slog.Level {
+	switch level {
+	case LevelDebug:
+		return slog.LevelDebug
+	case LevelWarning:
+		return slog.LevelWarn
+	case LevelError:
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
@@ -0,0 +1,18 @@
+//go:build go1.21
+
+package scipipe
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"log/slog"
+	t "testing"
+)
+
+func TestSlogLogger(t *t.T) {
+	buf := new(bytes.Buffer)
+	SetLogger(NewSlogLogger(slog.New(slog.NewTextHandler(buf, nil))))
+	defer SetLogger(nil)
+	logStructured(LevelError, "Task failed", Fields{"process": "foo", "task_index": 3})
+	assert.Contains(t, buf.String(), `level=ERROR msg="Task failed" process=foo task_index=3`)
+}
@@ -0,0 +1,132 @@
+package scipipe
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"log"
+	str "strings"
+	t "testing"
+)
+
+func TestJSONLogger(t *t.T) {
+	initTestLogs()
+
+	buf := new(bytes.Buffer)
+	SetLogger(NewJSONLogger(buf))
+	defer SetLogger(nil)
+
+	foo := NewFromShell("foo", "echo foo > {o:out}")
+	foo.SetPathStatic("out", "/tmp/logger_foo.txt")
+	foo.Out["out"].Chan = make(chan *FileTarget, BUFSIZE)
+	foo.Run()
+
+	entries := []map[string]interface{}{}
+	for _, line := range str.Split(str.TrimSpace(buf.String()), "\n") {
+		entry := map[string]interface{}{}
+		err := json.Unmarshal([]byte(line), &entry)
+		assert.Nil(t, err)
+		entries = append(entries, entry)
+	}
+	// Debug entries, for created tasks, are not written by default
+	assert.Len(t, entries, 3)
+	assert.EqualValues(t, "Task started", entries[0]["msg"])
+	assert.EqualValues(t, "info", entries[0]["level"])
+	assert.EqualValues(t, "foo", entries[0]["process"])
+	assert.EqualValues(t, 0, entries[0]["task_index"])
+	assert.Contains(t, entries[0]["command"], "echo foo >")
+	assert.EqualValues(t, "Executing command", entries[1]["msg"])
+	assert.EqualValues(t, "audit", entries[1]["level"])
+	assert.EqualValues(t, "Task succeeded", entries[2]["msg"])
+	assert.NotNil(t, entries[2]["duration_ms"])
+
+	cleanFiles("/tmp/logger_foo.txt")
+}
+
+func TestLoggerFunc(t *t.T) {
+	var gotLevel LogLevel
+	var gotMsg string
+	var gotFields Fields
+	SetLogger(LoggerFunc(func(level LogLevel, msg string, fields Fields) {
+		gotLevel, gotMsg, gotFields = level, msg, fields
+	}))
+	defer SetLogger(nil)
+	logStructured(LevelWarning, "Something", Fields{"a": 1})
+	assert.EqualValues(t, LevelWarning, gotLevel)
+	assert.EqualValues(t, "Something", gotMsg)
+	assert.EqualValues(t, Fields{"a": 1}, gotFields)
+	assert.EqualValues(t, "warning", gotLevel.String())
+}
+
+func TestTextLogger(t *t.T) {
+	buf := new(bytes.Buffer)
+	ls := &loggers{
+		Debug:   log.New(buf, "DEBUG ", 0),
+		Info:    log.New(buf, "INFO ", 0),
+		Audit:   log.New(buf, "AUDIT ", 0),
+		Warning: log.New(buf, "WARNING ", 0),
+		Error:   log.New(buf, "ERROR ", 0),
+	}
+	l := NewTextLogger()
+	l.write(ls, LevelInfo, "Workflow started", Fields{"workflow": "my wf", "tasks": 2})
+	l.write(ls, LevelError, "Task failed", Fields{"error": errors.New("Command failed")})
+	assert.EqualValues(t, "INFO Workflow started tasks=2 workflow=\"my wf\"\nERROR Task failed: Command failed\n", buf.String())
+}
+
+func TestWorkflowLogEvents(t *t.T) {
+	initTestLogs()
+
+	msgs := []string{}
+	SetLogger(LoggerFunc(func(level LogLevel, msg string, fields Fields) {
+		if level >= LevelInfo {
+			msgs = append(msgs, msg)
+		}
+	}))
+	defer SetLogger(nil)
+
+	wf := NewWorkflow("wf")
+	foo := NewFromShell("foo", "echo foo > {o:out}")
+	foo.SetPathStatic("out", "/tmp/logger_events_foo.txt")
+	wf.AddProcesses(foo, NewSink())
+	wf.Connect("foo.out", "sink.in")
+	assert.Nil(t, wf.Run())
+	assert.EqualValues(t, []string{"Workflow started", "Task started", "Executing command", "Task succeeded", "Workflow finished"}, msgs)
+
+	cleanFiles("/tmp/logger_events_foo.txt")
+}
+
+func TestDefaultLogger(t *t.T) {
+	logBuf, errBuf := new(bytes.Buffer), new(bytes.Buffer)
+	InitLog(ioutil.Discard, ioutil.Discard, ioutil.Discard, logBuf, logBuf, errBuf)
+	defer resetTestLogs()
+
+	foo := NewFromShell("foo", "echo foo > {o:out}")
+	foo.SetPathStatic("out", "/tmp/logger_default_foo.txt")
+	foo.Out["out"].Chan = make(chan *FileTarget, BUFSIZE)
+	foo.Run()
+
+	// Entries are written as JSON, where the loggers of their levels write
+	entry := map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal([]byte(str.TrimSpace(logBuf.String())), &entry))
+	assert.EqualValues(t, "Executing command", entry["msg"])
+	assert.EqualValues(t, "audit", entry["level"])
+	assert.EqualValues(t, "foo", entry["process"])
+	assert.Contains(t, entry["command"], "echo foo > /tmp/logger_default_foo.txt")
+
+	logStructured(LevelError, "Something failed", Fields{"error": errors.New("Some error")})
+	assert.Nil(t, json.Unmarshal(errBuf.Bytes(), &entry))
+	assert.EqualValues(t, "Something failed", entry["msg"])
+	assert.EqualValues(t, "Some error", entry["error"])
+
+	// The log level of the process applies to entries about it
+	logBuf.Reset()
+	foo.SetLogLevel(LevelDebug)
+	foo.logStructured(LevelDebug, "Debugging", nil)
+	logStructured(LevelDebug, "Not debugging", nil)
+	assert.Contains(t, logBuf.String(), `"msg":"Debugging"`)
+	assert.NotContains(t, logBuf.String(), "Not debugging")
+
+	cleanFiles("/tmp/logger_default_foo.txt")
+}
@@ -0,0 +1,40 @@
+package scipipe
+
+// ZapSugaredLogger is the interface of the *zap.SugaredLogger of
+// go.uber.org/zap used by a ZapLogger, so that zap does not have to be a
+// dependency of scipipe
+type ZapSugaredLogger interface {
+	Debugw(msg string, keysAndValues ...interface{})
+	Infow(msg string, keysAndValues ...interface{})
+	Warnw(msg string, keysAndValues ...interface{})
+	Errorw(msg string, keysAndValues ...interface{})
+}
+
+// ZapLogger is a Logger writing to a zap logger, as in:
+//
+//	scipipe.SetLogger(scipipe.NewZapLogger(zapLogger.Sugar()))
+type ZapLogger struct {
+	logger ZapSugaredLogger
+}
+
+// Create a new ZapLogger, writing to the sugared zap logger logger
+func NewZapLogger(logger ZapSugaredLogger) *ZapLogger {
+	return &ZapLogger{logger: logger}
+}
+
+func (l *ZapLogger) Log(level LogLevel, msg string, fields Fields) {
+	kvs := make([]interface{}, 0, 2*len(fields))
+	for _, k := range sortedFieldKeys(fields) {
+		kvs = append(kvs, k, fields[k])
+	}
+	switch level {
+	case LevelDebug:
+		l.logger.Debugw(msg, kvs...)
+	case LevelInfo, LevelAudit:
+		l.logger.Infow(msg, kvs...)
+	case LevelWarning:
+		l.logger.Warnw(msg, kvs...)
+	default:
+		l.logger.Errorw(msg, kvs...)
+	}
+}
@@ -0,0 +1,32 @@
+package scipipe
+
+import (
+	"github.com/stretchr/testify/assert"
+	t "testing"
+)
+
+// testSugaredLogger records the entries logged to it, as a zap
+// SugaredLogger would log them
+type testSugaredLogger struct {
+	entries [][]interface{}
+}
+
+func (l *testSugaredLogger) log(level string, msg string, kvs []interface{}) {
+	l.entries = append(l.entries, append([]interface{}{level, msg}, kvs...))
+}
+
+func (l *testSugaredLogger) Debugw(msg string, kvs ...interface{}) { l.log("debug", msg, kvs) }
+func (l *testSugaredLogger) Infow(msg string, kvs ...interface{})  { l.log("info", msg, kvs) }
+func (l *testSugaredLogger) Warnw(msg string, kvs ...interface{})  { l.log("warn", msg, kvs) }
+func (l *testSugaredLogger) Errorw(msg string, kvs ...interface{}) { l.log("error", msg, kvs) }
+
+func TestZapLogger(t *t.T) {
+	sugared := &testSugaredLogger{}
+	l := NewZapLogger(sugared)
+	l.Log(LevelInfo, "Task started", Fields{"task": "foo", "process": "foo"})
+	l.Log(LevelError, "Task failed", Fields{"task": "foo"})
+	assert.EqualValues(t, [][]interface{}{
+		{"info", "Task started", "process", "foo", "task", "foo"},
+		{"error", "Task failed", "task", "foo"},
+	}, sugared.entries)
+}
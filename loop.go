@@ -0,0 +1,88 @@
+package scipipe
+
+import (
+	"fmt"
+)
+
+// ======= Loop ========
+
+// Loop is a component that runs the process Body repeatedly for each target
+// received on its In-port, feeding the output of each iteration (on the
+// body's out-port BodyOutPort) back as input (on the body's in-port
+// BodyInPort) of the next one, until the function Done returns true for
+// the output of an iteration, or MaxIterations iterations have been run (if
+// set). The output of the last iteration is then sent on the Out-port. If an
+// iteration fails, the loop stops, and sends the output of the iteration
+// before it (or the input) instead.
+//
+// The iteration number, starting from 0, is passed to the body as the param
+// "iteration", and can be used in its command, as {p:iteration}, and in its
+// path formatters, as task.Params["iteration"], to produce a unique path for
+// each iteration. The body is only run by the loop, and should not be added
+// to the pipeline itself.
+type Loop struct {
+	Process
+	Name          string
+	In            *InPort
+	Out           *OutPort
+	Body          *SciProcess
+	BodyInPort    string
+	BodyOutPort   string
+	Done          func(iteration int, out *FileTarget) bool
+	MaxIterations int
+}
+
+// Instantiate a Loop component, running body with its output on the out-port
+// bodyOutPort fed back to its in-port bodyInPort, until done returns true
+func NewLoop(name string, body *SciProcess, bodyInPort string, bodyOutPort string, done func(iteration int, out *FileTarget) bool) *Loop {
+	// The body collects the errors of failed iterations in its stats, rather
+	// than exiting the program, so that the loop can stop at them
+	body.stats = newProcessStats()
+	return &Loop{
+		Name:        name,
+		In:          NewInPort(),
+		Out:         NewOutPort(),
+		Body:        body,
+		BodyInPort:  bodyInPort,
+		BodyOutPort: bodyOutPort,
+		Done:        done,
+	}
+}
+
+func (proc *Loop) IsConnected() bool {
+	return proc.In.IsConnected() && proc.Out.IsConnected()
+}
+
+// Execute the Loop component
+func (proc *Loop) Run() {
+	defer proc.Out.Close()
+	for ft := range proc.In.Chan {
+		proc.Out.Chan <- proc.iterate(ft)
+	}
+}
+
+// Run the iterations of the loop for the input target ft, and return the
+// output of the last iteration
+func (proc *Loop) iterate(ft *FileTarget) *FileTarget {
+	current := ft
+	for i := 0; ; i++ {
+		params := map[string]string{"iteration": fmt.Sprintf("%d", i)}
+		paramErr := proc.Body.applyParamSpecs(params)
+		t := newSciTaskFromProcess(proc.Body, map[string]*FileTarget{proc.BodyInPort: current}, params, i)
+		if paramErr != nil {
+			t.formatErr = paramErr
+		}
+		Debug.Printf("Loop %s: Running iteration %d: %s\n", proc.Name, i, t.Command)
+		go t.Execute()
+		<-t.Done
+		if t.err != nil {
+			Error.Printf("Loop %s: Stopping after iteration %d, which failed: %s\n", proc.Name, i, t.err)
+			return current
+		}
+		current = t.OutTargets[proc.BodyOutPort]
+		if proc.Done(i, current) || (proc.MaxIterations > 0 && i+1 >= proc.MaxIterations) {
+			Debug.Printf("Loop %s: Done after %d iterations\n", proc.Name, i+1)
+			return current
+		}
+	}
+}
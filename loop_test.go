@@ -0,0 +1,63 @@
+package scipipe
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	str "strings"
+	t "testing"
+)
+
+func TestLoop(t *t.T) {
+	initTestLogs()
+
+	ft := NewFileTarget("/tmp/loop_0.txt")
+	ft.WriteTempFile([]byte("1000\n"))
+	ft.Atomize()
+
+	// Halve the number in the file until it is below 100
+	hlv := NewFromShell("hlv", "echo $(( $(cat {i:in}) / 2 )) > {o:out} # iteration {p:iteration}")
+	hlv.PathFormatters["out"] = func(task *SciTask) string {
+		return fmt.Sprintf("/tmp/loop_%s_out.txt", task.Params["iteration"])
+	}
+	lp := NewLoop("lp", hlv, "in", "out", func(iteration int, out *FileTarget) bool {
+		val, err := strconv.Atoi(str.TrimSpace(string(out.Read())))
+		Check(err)
+		return val < 100
+	})
+	lp.In.Chan = make(chan *FileTarget, 1)
+	lp.In.Chan <- ft
+	close(lp.In.Chan)
+	lp.Out.Chan = make(chan *FileTarget, 1)
+	lp.Run()
+
+	out := <-lp.Out.Chan
+	assert.EqualValues(t, "/tmp/loop_3_out.txt", out.GetPath())
+	assert.EqualValues(t, "62\n", string(out.Read()))
+
+	cleanFiles("/tmp/loop_0.txt", "/tmp/loop_0_out.txt", "/tmp/loop_1_out.txt", "/tmp/loop_2_out.txt", "/tmp/loop_3_out.txt")
+}
+
+func TestLoopInvalidParam(t *t.T) {
+	initTestLogs()
+	ft := NewFileTarget("/tmp/loop_invalid_in.txt")
+
+	// The loop stops at the iteration with an invalid param, sending the
+	// output of the iteration before it, rather than panicking
+	hlv := NewFromShell("hlv", "cat {i:in} > {o:out} # {p:iteration} {p:mode}")
+	hlv.SetParamType("mode", ParamTypeInt)
+	hlv.SetParamDefault("mode", "fast")
+	hlv.PathFormatters["out"] = func(task *SciTask) string {
+		return fmt.Sprintf("/tmp/loop_invalid_%s_out.txt", task.Params["iteration"])
+	}
+	lp := NewLoop("lp", hlv, "in", "out", func(iteration int, out *FileTarget) bool { return false })
+	lp.In.Chan = make(chan *FileTarget, 1)
+	lp.In.Chan <- ft
+	close(lp.In.Chan)
+	lp.Out.Chan = make(chan *FileTarget, 1)
+	assert.NotPanics(t, lp.Run)
+
+	out := <-lp.Out.Chan
+	assert.EqualValues(t, "/tmp/loop_invalid_in.txt", out.GetPath())
+	assert.False(t, NewFileTarget("/tmp/loop_invalid_0_out.txt").Exists(), "Command with invalid param executed")
+}
@@ -0,0 +1,137 @@
+package scipipe
+
+import (
+	"strconv"
+)
+
+// ======= Merging ========
+
+// MergeMode says in which order an in-port that is connected to several
+// out-ports receives the targets from them
+type MergeMode int
+
+const (
+	// Targets are received as they are sent, from any of the out-ports
+	MergeInterleaved MergeMode = iota
+	// All targets from the out-port connected first are received before
+	// those from the out-port connected next, and so on, so that the order
+	// does not depend on which producer happens to finish first
+	MergeOrdered
+)
+
+// mergeSource is an out-port that an in-port merges targets from, where ch
+// is the channel the targets from it are received on, origin the name of
+// the out-port, and done is closed when all targets from it are received
+type mergeSource struct {
+	ch     chan *FileTarget
+	origin string
+	done   chan struct{}
+}
+
+// Set in which order the in-port receives the targets from the out-ports
+// it is connected to, when more than one (see MergeMode). The default is
+// MergeInterleaved.
+func (inp *InPort) SetMergeMode(mode MergeMode) {
+	inp.mergeLock.Lock()
+	defer inp.mergeLock.Unlock()
+	inp.mergeMode = mode
+}
+
+// Tag the targets that the in-port receives, when connected to more than
+// one out-port, with the tag tagName, whose value is the name of the
+// out-port the target came from, on the form PROCESSNAME.PORTNAME, if
+// connected with Workflow.Connect, or else the number of the out-port, in
+// the order connected, starting from 1. The tag can be used in the command
+// pattern as {t:tagName}, as with any tag.
+func (inp *InPort) SetMergeTag(tagName string) {
+	inp.mergeLock.Lock()
+	defer inp.mergeLock.Unlock()
+	inp.mergeTag = tagName
+}
+
+// Connect the in-port to another out-port, in addition to the out-port(s)
+// it is already connected to, by merging the targets received on the
+// channel ch of the out-port into the channel of the in-port. On the first
+// such connection, the channel of the in-port is handed over to the
+// out-port it was shared with, and a new one is created for the in-port,
+// which the targets are merged into.
+func (inp *InPort) addMergeChan(ch chan *FileTarget, origin string) {
+	inp.mergeLock.Lock()
+	defer inp.mergeLock.Unlock()
+	if len(inp.mergeSources) == 0 {
+		first := inp.newMergeSource(inp.Chan, inp.origin)
+		inp.Chan = make(chan *FileTarget, getBufferSize(inp.bufSize))
+		inp.mergeSources = []*mergeSource{first}
+		go inp.merge(first, inp.Chan)
+	}
+	src := inp.newMergeSource(ch, origin)
+	inp.mergeSources = append(inp.mergeSources, src)
+	go inp.merge(src, inp.Chan)
+}
+
+// Create a merge source for the channel ch, named origin, or else after
+// its number, and count it as not done. The lock must be held.
+func (inp *InPort) newMergeSource(ch chan *FileTarget, origin string) *mergeSource {
+	if origin == "" {
+		origin = strconv.Itoa(len(inp.mergeSources) + 1)
+	}
+	inp.mergeOpen++
+	return &mergeSource{ch: ch, origin: origin, done: make(chan struct{})}
+}
+
+// Send the targets received from the merge source src on the channel dst,
+// which is closed when all merge sources are done
+func (inp *InPort) merge(src *mergeSource, dst chan *FileTarget) {
+	first := true
+	for ft := range src.ch {
+		inp.mergeLock.Lock()
+		mode, tag := inp.mergeMode, inp.mergeTag
+		earlier := []*mergeSource{}
+		for _, other := range inp.mergeSources {
+			if other == src {
+				break
+			}
+			earlier = append(earlier, other)
+		}
+		inp.mergeLock.Unlock()
+
+		if first && mode == MergeOrdered {
+			for _, other := range earlier {
+				<-other.done
+			}
+		}
+		first = false
+		if tag != "" {
+			// Tag a copy, since the target may be received elsewhere too
+			ft = ft.Copy()
+			ft.AddTag(tag, src.origin)
+		}
+		dst <- ft
+	}
+	close(src.done)
+
+	inp.mergeLock.Lock()
+	inp.mergeOpen--
+	last := inp.mergeOpen == 0
+	inp.mergeLock.Unlock()
+	if last {
+		close(dst)
+	}
+}
+
+// Get the channels that the out-ports connected to the in-port send on
+func (inp *InPort) getRemoteChans() []chan *FileTarget {
+	inp.mergeLock.Lock()
+	defer inp.mergeLock.Unlock()
+	if len(inp.mergeSources) > 0 {
+		chans := []chan *FileTarget{}
+		for _, src := range inp.mergeSources {
+			chans = append(chans, src.ch)
+		}
+		return chans
+	}
+	if inp.Chan != nil {
+		return []chan *FileTarget{inp.Chan}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package scipipe
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	str "strings"
+)
+
+// ======= Metrics ========
+
+// Write metrics for the run of the workflow, in the Prometheus text
+// format, to w. There are counters for the tasks created, started,
+// succeeded, skipped and failed, gauges for the tasks running and queued
+// (created, but not yet started), and a histogram of task durations (with
+// the buckets in TaskDurationBuckets), all per process.
+func (wf *Workflow) WriteMetrics(w io.Writer) {
+	rs := wf.GetStats()
+	names := []string{}
+	for name := range rs.Processes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	writeMetric := func(metric string, typ string, help string, value func(ProcessStats) int) {
+		fmt.Fprintf(w, "# HELP %s %s\n", metric, help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", metric, typ)
+		for _, name := range names {
+			fmt.Fprintf(w, "%s{process=\"%s\"} %d\n", metric, escapeMetricLabel(name), value(rs.Processes[name]))
+		}
+	}
+	writeMetric("scipipe_tasks_created_total", "counter", "Number of tasks created.", func(ps ProcessStats) int {
+		return ps.TasksCreated
+	})
+	writeMetric("scipipe_tasks_started_total", "counter", "Number of tasks started executing.", func(ps ProcessStats) int {
+		return ps.TasksRunning + ps.TasksExecuted + ps.TasksFailed
+	})
+	writeMetric("scipipe_tasks_succeeded_total", "counter", "Number of tasks executed successfully.", func(ps ProcessStats) int {
+		return ps.TasksExecuted
+	})
+	writeMetric("scipipe_tasks_skipped_total", "counter", "Number of tasks skipped, since their outputs existed.", func(ps ProcessStats) int {
+		return ps.TasksSkipped
+	})
+	writeMetric("scipipe_tasks_failed_total", "counter", "Number of tasks failed.", func(ps ProcessStats) int {
+		return ps.TasksFailed
+	})
+	writeMetric("scipipe_tasks_running", "gauge", "Number of tasks executing.", func(ps ProcessStats) int {
+		return ps.TasksRunning
+	})
+	writeMetric("scipipe_tasks_queued", "gauge", "Number of tasks created, but not yet started.", func(ps ProcessStats) int {
+		return ps.TasksCreated - ps.TasksRunning - ps.GetTasksDone()
+	})
+
+	metric := "scipipe_task_duration_seconds"
+	fmt.Fprintf(w, "# HELP %s Duration of successfully executed tasks.\n", metric)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", metric)
+	for _, name := range names {
+		ps := rs.Processes[name]
+		label := escapeMetricLabel(name)
+		for i, bound := range TaskDurationBuckets {
+			fmt.Fprintf(w, "%s_bucket{process=\"%s\",le=\"%g\"} %d\n", metric, label, bound.Seconds(), ps.DurationCounts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{process=\"%s\",le=\"+Inf\"} %d\n", metric, label, ps.TasksExecuted)
+		fmt.Fprintf(w, "%s_sum{process=\"%s\"} %g\n", metric, label, ps.ExecTime.Seconds())
+		fmt.Fprintf(w, "%s_count{process=\"%s\"} %d\n", metric, label, ps.TasksExecuted)
+	}
+}
+
+// Get an http.Handler serving the metrics of the workflow (see
+// WriteMetrics), for scraping by Prometheus
+func (wf *Workflow) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		wf.WriteMetrics(w)
+	})
+}
+
+// Escape a value of a label in the Prometheus text format
+func escapeMetricLabel(value string) string {
+	return str.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// Get a ServeMux serving the metrics of the workflow at /metrics
+func (wf *Workflow) metricsMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", wf.MetricsHandler())
+	return mux
+}
@@ -0,0 +1,44 @@
+package scipipe
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http/httptest"
+	t "testing"
+)
+
+func TestWorkflowMetrics(t *t.T) {
+	initTestLogs()
+
+	wf := NewWorkflow("wf")
+	foo := NewFromShell("foo", "echo foo > {o:out}")
+	foo.SetPathStatic("out", "/tmp/metrics_foo.txt")
+	wf.AddProcesses(foo, NewSink())
+	wf.Connect("foo.out", "sink.in")
+	err := wf.Run()
+	assert.Nil(t, err)
+
+	buf := new(bytes.Buffer)
+	wf.WriteMetrics(buf)
+	metrics := buf.String()
+	assert.Contains(t, metrics, "# TYPE scipipe_tasks_created_total counter\n")
+	assert.Contains(t, metrics, "scipipe_tasks_created_total{process=\"foo\"} 1\n")
+	assert.Contains(t, metrics, "scipipe_tasks_succeeded_total{process=\"foo\"} 1\n")
+	assert.Contains(t, metrics, "scipipe_tasks_queued{process=\"foo\"} 0\n")
+	assert.Contains(t, metrics, "scipipe_task_duration_seconds_bucket{process=\"foo\",le=\"10\"} 1\n")
+	assert.Contains(t, metrics, "scipipe_task_duration_seconds_count{process=\"foo\"} 1\n")
+
+	srv := httptest.NewServer(wf.MetricsHandler())
+	defer srv.Close()
+	resp, err := srv.Client().Get(srv.URL + "/metrics")
+	assert.Nil(t, err)
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Nil(t, err)
+	assert.EqualValues(t, metrics, string(body))
+
+	assert.EqualValues(t, `a\"b\\c`, escapeMetricLabel(`a"b\c`))
+
+	cleanFiles("/tmp/metrics_foo.txt")
+}
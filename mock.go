@@ -0,0 +1,125 @@
+package scipipe
+
+import (
+	"os"
+	"sync"
+)
+
+// ======= Mock executor ========
+
+// MockExecutor executes no commands, but records the formatted commands of
+// tasks, and fabricates their declared outputs, so that the wiring of
+// workflows, and their path functions, can be tested quickly, without the
+// actual tools installed. Outputs are created empty, unless a template is
+// set for them (see SetTemplate). Set it as Mock on a PipelineRunner or
+// Workflow to use it for all SciProcesses.
+type MockExecutor struct {
+	// Templates of the content of fabricated outputs, by out-port name, or
+	// by process and out-port name, as "process.outport". Templates can use
+	// the same placeholders as commands, which are replaced without quoting.
+	Templates map[string]string
+	commands  []MockCommand
+	lock      sync.Mutex
+}
+
+// MockCommand is a command recorded by a MockExecutor
+type MockCommand struct {
+	Process string
+	Task    string
+	Command string
+	// The (final) paths of the fabricated outputs, by out-port name
+	Outputs map[string]string
+}
+
+// Create a new MockExecutor, fabricating empty outputs
+func NewMockExecutor() *MockExecutor {
+	return &MockExecutor{
+		Templates: make(map[string]string),
+	}
+}
+
+// Set the template of the content of the output oname, for all processes,
+// or only the process procName, if not empty
+func (m *MockExecutor) SetTemplate(procName string, oname string, template string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if procName != "" {
+		oname = procName + "." + oname
+	}
+	m.Templates[oname] = template
+}
+
+// Get all commands recorded, in the order they were executed
+func (m *MockExecutor) GetCommands() []MockCommand {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return append([]MockCommand{}, m.commands...)
+}
+
+// Get the formatted commands recorded for the process procName, in the order
+// they were executed
+func (m *MockExecutor) GetCommandsOf(procName string) []string {
+	cmds := []string{}
+	for _, c := range m.GetCommands() {
+		if c.Process == procName {
+			cmds = append(cmds, c.Command)
+		}
+	}
+	return cmds
+}
+
+// Record the command of the task t, and fabricate its outputs, at their
+// temporary paths, so that they are atomized as the outputs of commands are
+func (m *MockExecutor) execute(t *SciTask) error {
+	t.logStructured(LevelAudit, "Mocking command", Fields{"command": t.Command})
+	outputs := make(map[string]string)
+	for oname, otgt := range t.OutTargets {
+		outputs[oname] = otgt.GetPath()
+		if otgt.IsFileSet() {
+			if err := os.MkdirAll(otgt.GetTempPath(), 0777); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := t.WriteOutString(oname, t.formatPlaceHolders(m.getTemplate(t.process.Name, oname), true)); err != nil {
+			return err
+		}
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.commands = append(m.commands, MockCommand{
+		Process: t.process.Name,
+		Task:    t.Name,
+		Command: t.Command,
+		Outputs: outputs,
+	})
+	return nil
+}
+
+// Get the template of the output oname of the process procName, preferring
+// one set for the process only
+func (m *MockExecutor) getTemplate(procName string, oname string) string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if tmpl, ok := m.Templates[procName+"."+oname]; ok {
+		return tmpl
+	}
+	return m.Templates[oname]
+}
+
+// Set up all SciProcesses of the pipeline to have their commands mocked by
+// Mock, if set. Since nothing reads them, outputs are written to files
+// rather than streamed.
+func (pl *PipelineRunner) setUpMock() {
+	if pl.Mock == nil {
+		return
+	}
+	for _, proc := range flattenProcesses(pl.processes) {
+		if sp, ok := proc.(*SciProcess); ok {
+			sp.mock = pl.Mock
+			for oname := range sp.OutPortsDoStream {
+				sp.OutPortsDoStream[oname] = false
+			}
+		}
+	}
+}
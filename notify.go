@@ -0,0 +1,235 @@
+package scipipe
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	str "strings"
+	"sync"
+	"time"
+)
+
+// ======= Notifications ========
+
+// The events that notifications are sent for
+const (
+	// The workflow run is done, successfully or not
+	NotifyOnDone = "done"
+	// The first task of the workflow run failed
+	NotifyOnFirstFailure = "first_failure"
+)
+
+// The time that sending a notification may take, after which it is given
+// up, with a warning
+var NotificationTimeout = 30 * time.Second
+
+// Notification describes a workflow run, at the time of an event
+type Notification struct {
+	Workflow       string        `json:"workflow"`
+	Event          string        `json:"event"`
+	TasksSucceeded int           `json:"tasks_succeeded"`
+	TasksFailed    int           `json:"tasks_failed"`
+	TasksSkipped   int           `json:"tasks_skipped"`
+	Runtime        time.Duration `json:"runtime_ns"`
+	Error          string        `json:"error,omitempty"`
+}
+
+// Get a one-line summary of the notification, as in "Workflow wf finished:
+// 10 tasks succeeded, 0 failed, 2 skipped, in 1m30s"
+func (n Notification) GetSummary() string {
+	what := "finished"
+	switch {
+	case n.Event == NotifyOnFirstFailure:
+		what = "had its first task failure"
+	case n.Error != "":
+		what = "failed"
+	}
+	return fmt.Sprintf("Workflow %s %s: %d tasks succeeded, %d failed, %d skipped, in %s",
+		n.Workflow, what, n.TasksSucceeded, n.TasksFailed, n.TasksSkipped, n.Runtime.Round(time.Second))
+}
+
+// Notifier sends notifications, such as to a chat channel or by email
+type Notifier interface {
+	Notify(n Notification) error
+}
+
+// Add the notifier n, to be notified on the events (NotifyOnDone and
+// NotifyOnFirstFailure, of the first failure of each run), or on both, if
+// none are given. Errors from the notifier are logged as warnings, and do
+// not affect the run. Notifications of failures are sent in the background,
+// so that slow notifiers do not hold up the tasks, while the notification
+// that the run is done is sent after those, before Run returns. Sending a
+// notification is given up after NotificationTimeout.
+func (wf *Workflow) AddNotifier(n Notifier, events ...string) {
+	if len(events) == 0 {
+		events = []string{NotifyOnDone, NotifyOnFirstFailure}
+	}
+	for _, event := range events {
+		switch event {
+		case NotifyOnDone:
+			wf.OnWorkflowDone(func(wf *Workflow, err error) {
+				wf.notifying.Wait()
+				wf.notify(n, NotifyOnDone, err)
+			})
+		case NotifyOnFirstFailure:
+			fn := &failureNotifier{once: new(sync.Once)}
+			wf.lock.Lock()
+			wf.failureNotifiers = append(wf.failureNotifiers, fn)
+			wf.lock.Unlock()
+			wf.OnTaskFailure(func(t *SciTask, err error) {
+				wf.lock.Lock()
+				once := fn.once
+				wf.lock.Unlock()
+				once.Do(func() {
+					wf.notifying.Add(1)
+					go func() {
+						defer wf.notifying.Done()
+						wf.notify(n, NotifyOnFirstFailure, err)
+					}()
+				})
+			})
+		default:
+			Check(fmt.Errorf("Workflow %s: Unknown notification event: %s", wf.Name, event))
+		}
+	}
+}
+
+// failureNotifier keeps track of whether a notifier has been notified of the
+// first failure of the current run
+type failureNotifier struct {
+	once *sync.Once
+}
+
+// Reset the notifiers of first failures, so that they are notified of the
+// first failure of each run
+func (wf *Workflow) setUpNotifiers() {
+	wf.lock.Lock()
+	defer wf.lock.Unlock()
+	for _, fn := range wf.failureNotifiers {
+		fn.once = new(sync.Once)
+	}
+}
+
+// Send a notification for the event to n, with the current run statistics
+func (wf *Workflow) notify(n Notifier, event string, err error) {
+	rs := wf.GetStats()
+	total := rs.GetTotal()
+	finishTime := rs.FinishTime
+	if finishTime.IsZero() {
+		finishTime = time.Now()
+	}
+	notification := Notification{
+		Workflow:       wf.Name,
+		Event:          event,
+		TasksSucceeded: total.TasksExecuted,
+		TasksFailed:    total.TasksFailed,
+		TasksSkipped:   total.TasksSkipped,
+	}
+	if !rs.StartTime.IsZero() {
+		notification.Runtime = finishTime.Sub(rs.StartTime)
+	}
+	if err != nil {
+		notification.Error = err.Error()
+	}
+	sent := make(chan error, 1)
+	go func() {
+		sent <- n.Notify(notification)
+	}()
+	select {
+	case err := <-sent:
+		if err != nil {
+			Warning.Printf("Workflow %s: Could not send notification: %s\n", wf.Name, err)
+		}
+	case <-time.After(NotificationTimeout):
+		Warning.Printf("Workflow %s: Sending notification timed out after %s\n", wf.Name, NotificationTimeout)
+	}
+}
+
+// ------- Notifiers -------
+
+// WebhookNotifier posts notifications as JSON to URL
+type WebhookNotifier struct {
+	URL string
+}
+
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{URL: url}
+}
+
+func (wn *WebhookNotifier) Notify(n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	return postJSON(wn.URL, body)
+}
+
+// SlackNotifier posts the summary of notifications to a Slack incoming
+// webhook URL
+type SlackNotifier struct {
+	WebhookURL string
+}
+
+func NewSlackNotifier(webhookURL string) *SlackNotifier {
+	return &SlackNotifier{WebhookURL: webhookURL}
+}
+
+func (sn *SlackNotifier) Notify(n Notification) error {
+	text := n.GetSummary()
+	if n.Error != "" {
+		text += "\n```" + n.Error + "```"
+	}
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+	return postJSON(sn.WebhookURL, body)
+}
+
+// EmailNotifier sends notifications by email, with the SMTP server at Addr
+// (as in "smtp.example.com:587"), authenticating with Auth, if set
+type EmailNotifier struct {
+	Addr string
+	Auth smtp.Auth
+	From string
+	To   []string
+}
+
+func NewEmailNotifier(addr string, auth smtp.Auth, from string, to ...string) *EmailNotifier {
+	return &EmailNotifier{Addr: addr, Auth: auth, From: from, To: to}
+}
+
+func (en *EmailNotifier) Notify(n Notification) error {
+	return smtp.SendMail(en.Addr, en.Auth, en.From, en.To, en.formatMessage(n))
+}
+
+// Format the email message for the notification n
+func (en *EmailNotifier) formatMessage(n Notification) []byte {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "From: %s\r\n", en.From)
+	fmt.Fprintf(buf, "To: %s\r\n", str.Join(en.To, ", "))
+	fmt.Fprintf(buf, "Subject: %s\r\n", n.GetSummary())
+	fmt.Fprintf(buf, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(buf, "%s\r\n", n.GetSummary())
+	if n.Error != "" {
+		fmt.Fprintf(buf, "\r\n%s\r\n", str.Replace(n.Error, "\n", "\r\n", -1))
+	}
+	return buf.Bytes()
+}
+
+// Post the JSON body to url, returning an error if the response status is
+// not a success
+func postJSON(url string, body []byte) error {
+	client := &http.Client{Timeout: NotificationTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Posting to %s failed: %s", url, resp.Status)
+	}
+	return nil
+}
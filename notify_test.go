@@ -0,0 +1,119 @@
+package scipipe
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	t "testing"
+	"time"
+)
+
+func TestNotifiers(t *t.T) {
+	initTestLogs()
+
+	received := []map[string]interface{}{}
+	lock := new(sync.Mutex)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		msg := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&msg)
+		msg["path"] = r.URL.Path
+		lock.Lock()
+		received = append(received, msg)
+		lock.Unlock()
+	}))
+	defer srv.Close()
+
+	wf := NewWorkflow("wf")
+	fail := NewFromShell("fail", "exit 1; echo > {o:out}")
+	fail.SetPathStatic("out", "/tmp/notify_fail.txt")
+	wf.AddProcesses(fail, NewSink())
+	wf.Connect("fail.out", "sink.in")
+	wf.AddNotifier(NewWebhookNotifier(srv.URL + "/hook"))
+	wf.AddNotifier(NewSlackNotifier(srv.URL+"/slack"), NotifyOnDone)
+	err := wf.Run()
+	assert.NotNil(t, err)
+
+	assert.Len(t, received, 3)
+	events := []interface{}{}
+	for _, msg := range received {
+		if msg["path"] == "/hook" {
+			events = append(events, msg["event"])
+			assert.EqualValues(t, "wf", msg["workflow"])
+			assert.EqualValues(t, 1, msg["tasks_failed"])
+		} else {
+			assert.Contains(t, msg["text"], "Workflow wf failed: 0 tasks succeeded, 1 failed, 0 skipped")
+		}
+	}
+	assert.EqualValues(t, []interface{}{NotifyOnFirstFailure, NotifyOnDone}, events)
+}
+
+func TestSlowNotifier(t *t.T) {
+	initTestLogs()
+
+	notificationTimeout := NotificationTimeout
+	NotificationTimeout = 50 * time.Millisecond
+	defer func() { NotificationTimeout = notificationTimeout }()
+
+	// An endpoint that never answers does not hold up the tasks, or the run
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	wf := NewWorkflow("wf")
+	fail := NewFromShell("fail", "exit 1; echo > {o:out}")
+	fail.SetPathStatic("out", "/tmp/notify_slow_fail.txt")
+	foo := NewFromShell("foo", "echo foo > {o:out}")
+	foo.SetPathStatic("out", "/tmp/notify_slow_foo.txt")
+	wf.AddProcesses(fail, foo, NewSink())
+	wf.Connect("fail.out", "sink.in")
+	wf.Connect("foo.out", "sink.in")
+	wf.AddNotifier(NewWebhookNotifier(srv.URL + "/hook"))
+	err := wf.Run()
+	assert.NotNil(t, err)
+	assert.EqualValues(t, 1, wf.GetStats().Processes["foo"].TasksExecuted)
+
+	cleanFiles("/tmp/notify_slow_foo.txt")
+}
+
+// recordingNotifier records the events it is notified of
+type recordingNotifier struct {
+	events []string
+	lock   sync.Mutex
+}
+
+func (n *recordingNotifier) Notify(notification Notification) error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.events = append(n.events, notification.Event)
+	return nil
+}
+
+func TestNotifyOnFirstFailureEachRun(t *t.T) {
+	initTestLogs()
+
+	wf := NewWorkflow("wf")
+	wf.AddProcesses(NewFromShell("fail", "exit 1"))
+	n := &recordingNotifier{}
+	wf.AddNotifier(n)
+	assert.NotNil(t, wf.Run())
+	assert.NotNil(t, wf.Run())
+	assert.EqualValues(t, []string{NotifyOnFirstFailure, NotifyOnDone, NotifyOnFirstFailure, NotifyOnDone}, n.events)
+}
+
+func TestEmailNotifierMessage(t *t.T) {
+	en := NewEmailNotifier("localhost:25", nil, "wf@example.com", "a@example.com", "b@example.com")
+	msg := string(en.formatMessage(Notification{
+		Workflow:       "wf",
+		Event:          NotifyOnDone,
+		TasksSucceeded: 10,
+		TasksSkipped:   2,
+		Runtime:        90 * time.Second,
+	}))
+	assert.Contains(t, msg, "To: a@example.com, b@example.com\r\n")
+	assert.Contains(t, msg, "Subject: Workflow wf finished: 10 tasks succeeded, 0 failed, 2 skipped, in 1m30s\r\n")
+}
@@ -0,0 +1,95 @@
+package scipipe
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"sync"
+)
+
+// ======= Live output ========
+
+// The ANSI colors used for the prefixes of live output, chosen by process
+// name
+var liveOutputColors = []int{31, 32, 33, 34, 35, 36}
+
+// The writer that live output of commands is written to
+var LiveOutputWriter io.Writer = os.Stdout
+
+// Get the prefix for the lines of live output of the task, with its name
+// and index, colored by process name if w is a terminal
+func (t *SciTask) getLiveOutputPrefix(w io.Writer) string {
+	prefix := fmt.Sprintf("[%s #%d] ", t.Name, t.Index)
+	if !isTerminal(w) {
+		return prefix
+	}
+	h := fnv.New32a()
+	h.Write([]byte(t.Name))
+	color := liveOutputColors[h.Sum32()%uint32(len(liveOutputColors))]
+	return fmt.Sprintf("\x1b[%dm%s\x1b[0m", color, prefix)
+}
+
+// Check whether w is a terminal (a character device)
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// prefixWriter writes complete lines to a writer, with a prefix added to
+// each line. Lines from different prefixWriters on the same writer are not
+// mixed up, since they are written in one piece, under a lock per writer.
+type prefixWriter struct {
+	w      io.Writer
+	prefix string
+	buf    []byte
+	lock   *sync.Mutex
+}
+
+var (
+	writerLocks     = make(map[io.Writer]*sync.Mutex)
+	writerLocksLock = new(sync.Mutex)
+)
+
+func newPrefixWriter(w io.Writer, prefix string) *prefixWriter {
+	writerLocksLock.Lock()
+	lock, ok := writerLocks[w]
+	if !ok {
+		lock = new(sync.Mutex)
+		writerLocks[w] = lock
+	}
+	writerLocksLock.Unlock()
+	return &prefixWriter{w: w, prefix: prefix, lock: lock}
+}
+
+func (pw *prefixWriter) Write(p []byte) (int, error) {
+	pw.buf = append(pw.buf, p...)
+	for {
+		i := bytes.IndexByte(pw.buf, '\n')
+		if i < 0 {
+			break
+		}
+		pw.writeLine(pw.buf[:i+1])
+		pw.buf = pw.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Write any remaining incomplete line
+func (pw *prefixWriter) Flush() {
+	if len(pw.buf) > 0 {
+		pw.writeLine(append(pw.buf, '\n'))
+		pw.buf = nil
+	}
+}
+
+func (pw *prefixWriter) writeLine(line []byte) {
+	pw.lock.Lock()
+	pw.w.Write(append([]byte(pw.prefix), line...))
+	pw.lock.Unlock()
+}
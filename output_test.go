@@ -0,0 +1,40 @@
+package scipipe
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"os"
+	t "testing"
+)
+
+func TestPrefixWriter(t *t.T) {
+	buf := new(bytes.Buffer)
+	pw := newPrefixWriter(buf, "[p] ")
+	pw.Write([]byte("one\ntw"))
+	assert.EqualValues(t, "[p] one\n", buf.String())
+	pw.Write([]byte("o\nthree"))
+	pw.Flush()
+	assert.EqualValues(t, "[p] one\n[p] two\n[p] three\n", buf.String())
+}
+
+func TestLiveOutput(t *t.T) {
+	initTestLogs()
+
+	buf := new(bytes.Buffer)
+	LiveOutputWriter = buf
+	defer func() { LiveOutputWriter = os.Stdout }()
+
+	foo := NewFromShell("foo", "echo out line; echo err line >&2; echo foo > {o:out}")
+	foo.SetPathStatic("out", "/tmp/liveout_foo.txt")
+	foo.LiveOutput = true
+	foo.TaskLogFiles = true
+	foo.Out["out"].Chan = make(chan *FileTarget, BUFSIZE)
+	foo.Run()
+
+	assert.Contains(t, buf.String(), "[foo #0] out line\n")
+	assert.Contains(t, buf.String(), "[foo #0] err line\n")
+	// The output is still captured, for the task log file
+	assert.Contains(t, string(NewFileTarget("/tmp/liveout_foo.txt.log").Read()), "err line\n")
+
+	cleanFiles("/tmp/liveout_foo.txt", "/tmp/liveout_foo.txt.log")
+}
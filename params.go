@@ -0,0 +1,200 @@
+package scipipe
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	str "strings"
+)
+
+// ParamType is the type of the values that a param of a process accepts.
+// Values are still passed around as strings, but are validated according to
+// their type before a task is created.
+type ParamType int
+
+const (
+	// Any string (the default)
+	ParamTypeString ParamType = iota
+	// An integer, as parsed by strconv.ParseInt
+	ParamTypeInt
+	// A floating point number, as parsed by strconv.ParseFloat
+	ParamTypeFloat
+	// A boolean, as parsed by strconv.ParseBool
+	ParamTypeBool
+	// One of a set of allowed values
+	ParamTypeEnum
+)
+
+func (pt ParamType) String() string {
+	switch pt {
+	case ParamTypeInt:
+		return "int"
+	case ParamTypeFloat:
+		return "float"
+	case ParamTypeBool:
+		return "bool"
+	case ParamTypeEnum:
+		return "enum"
+	}
+	return "string"
+}
+
+// ParamSpec declares the type, default value and (for enums) allowed values
+// of a param of a process
+type ParamSpec struct {
+	Type       ParamType
+	Default    string
+	HasDefault bool
+	Optional   bool
+	Choices    []string
+}
+
+// Validate the param value val against the spec
+func (ps *ParamSpec) Validate(val string) error {
+	var err error
+	switch ps.Type {
+	case ParamTypeInt:
+		_, err = strconv.ParseInt(val, 10, 64)
+	case ParamTypeFloat:
+		_, err = strconv.ParseFloat(val, 64)
+	case ParamTypeBool:
+		_, err = strconv.ParseBool(val)
+	case ParamTypeEnum:
+		for _, choice := range ps.Choices {
+			if val == choice {
+				return nil
+			}
+		}
+		return errors.New(fmt.Sprintf("'%s' is not one of: %s", val, str.Join(ps.Choices, ", ")))
+	}
+	if err != nil {
+		return errors.New(fmt.Sprintf("'%s' is not a valid %s", val, ps.Type))
+	}
+	return nil
+}
+
+// Get the spec of the param pname, creating it if it does not exist
+func (p *SciProcess) getParamSpec(pname string) *ParamSpec {
+	if p.ParamSpecs[pname] == nil {
+		p.ParamSpecs[pname] = &ParamSpec{}
+	}
+	return p.ParamSpecs[pname]
+}
+
+// Set the type of the param pname, against which its values are validated
+// before tasks are created. For ParamTypeEnum, the allowed values are given
+// as choices.
+func (p *SciProcess) SetParamType(pname string, typ ParamType, choices ...string) {
+	ps := p.getParamSpec(pname)
+	ps.Type = typ
+	ps.Choices = choices
+}
+
+// Set a default value for the param pname, used when no value is received
+// for it. A param port with a default value does not need to be connected.
+func (p *SciProcess) SetParamDefault(pname string, value string) {
+	ps := p.getParamSpec(pname)
+	ps.Default = value
+	ps.HasDefault = true
+}
+
+// Make the param pname optional, so that its param port does not need to be
+// connected. Placeholders for a missing optional param must be marked
+// optional too, as in {p:pname|optional}, to be left out of the command.
+func (p *SciProcess) SetParamOptional(pname string) {
+	p.getParamSpec(pname).Optional = true
+}
+
+// Check whether the param pname has a declared default value, or is optional
+func (p *SciProcess) isParamOptional(pname string) bool {
+	return p.ParamSpecs[pname] != nil && (p.ParamSpecs[pname].HasDefault || p.ParamSpecs[pname].Optional)
+}
+
+// Get the param ports that values are received on, which excludes ports of
+// optional params (or with default values), that have not been given a
+// channel
+func (p *SciProcess) getActiveParamPorts() map[string]*ParamPort {
+	pports := make(map[string]*ParamPort)
+	for pname, pport := range p.ParamPorts {
+		if pport.Chan == nil && p.isParamOptional(pname) {
+			continue
+		}
+		pports[pname] = pport
+	}
+	return pports
+}
+
+// Add default values for missing params, and validate all params against
+// their specs, returning an error for the first invalid value, by name.
+// Defaults are added for all params, even if some value is invalid.
+func (p *SciProcess) applyParamSpecs(params map[string]string) error {
+	pnames := []string{}
+	for pname := range p.ParamSpecs {
+		pnames = append(pnames, pname)
+	}
+	sort.Strings(pnames)
+	var firstErr error
+	for _, pname := range pnames {
+		ps := p.ParamSpecs[pname]
+		if _, ok := params[pname]; !ok {
+			if !ps.HasDefault {
+				continue
+			}
+			params[pname] = ps.Default
+		}
+		if err := ps.Validate(params[pname]); err != nil && firstErr == nil {
+			firstErr = errors.New(fmt.Sprintf("Process %s: Invalid value for param '%s': %s", p.Name, pname, err))
+		}
+	}
+	return firstErr
+}
+
+// Add a param out-port named pname to the process (in ParamOutPorts),
+// which sends a value for each task of the process that succeeds, computed
+// from the task by f, such as a value read from one of its outputs (see
+// ParamFromOutput). Connecting it to the param ports of downstream
+// processes, as in wf.Connect("count.lines", "filter.minlines"), lets
+// upstream processes compute the params of downstream ones, as for sweeps.
+// Each value is sent to all the param ports that the param out-port is
+// connected to. A param out-port does not need to be connected.
+func (p *SciProcess) SetParamOut(pname string, f func(*SciTask) string) {
+	if p.ParamOutPorts[pname] == nil {
+		p.ParamOutPorts[pname] = NewParamPort()
+	}
+	p.ParamOutFuncs[pname] = f
+}
+
+// Get a function for SetParamOut, which reads the value of the param from
+// the output of the out-port oname of a task, with surrounding white space
+// trimmed
+func ParamFromOutput(oname string) func(*SciTask) string {
+	return func(t *SciTask) string {
+		otgt := t.OutTargets[oname]
+		if otgt == nil || (!otgt.IsInMemory() && !otgt.Exists()) {
+			t.process.logStructured(LevelError, "Can not read param value from output, since it does not exist", Fields{"task": t.Name, "task_index": t.Index, "out_port": oname})
+			return ""
+		}
+		return str.TrimSpace(string(otgt.Read()))
+	}
+}
+
+// Send the values of the param out-ports of the process for the task t. In
+// dry runs, and partial runs where the process is not selected, the outputs
+// of tasks do not exist, so symbolic values, as in "<count.lines>", are
+// sent instead.
+func (p *SciProcess) sendParamOuts(t *SciTask) {
+	for pname, pport := range p.ParamOutPorts {
+		if pport.Chan == nil || p.ParamOutFuncs[pname] == nil {
+			continue
+		}
+		var val string
+		if p.dryRunWriter != nil || p.partialRun != partialRunExecute {
+			val = fmt.Sprintf("<%s.%s>", p.Name, pname)
+		} else {
+			val = p.ParamOutFuncs[pname](t)
+		}
+		p.logStructured(LevelDebug, "Sending value on param out-port", Fields{"task": t.Name, "task_index": t.Index, "param_port": pname, "value": val})
+		pport.Chan <- val
+	}
+}
@@ -0,0 +1,197 @@
+package scipipe
+
+import (
+	"github.com/stretchr/testify/assert"
+	t "testing"
+)
+
+func TestParamSpecValidate(t *t.T) {
+	for _, tc := range []struct {
+		spec  *ParamSpec
+		val   string
+		valid bool
+	}{
+		{&ParamSpec{Type: ParamTypeString}, "", true},
+		{&ParamSpec{Type: ParamTypeInt}, "0", true},
+		{&ParamSpec{Type: ParamTypeInt}, "1.5", false},
+		{&ParamSpec{Type: ParamTypeFloat}, "1.5", true},
+		{&ParamSpec{Type: ParamTypeBool}, "true", true},
+		{&ParamSpec{Type: ParamTypeBool}, "yes", false},
+		{&ParamSpec{Type: ParamTypeEnum, Choices: []string{"fast", "slow"}}, "fast", true},
+		{&ParamSpec{Type: ParamTypeEnum, Choices: []string{"fast", "slow"}}, "medium", false},
+	} {
+		err := tc.spec.Validate(tc.val)
+		assert.EqualValues(t, tc.valid, err == nil, "Wrong validation for %s value '%s'", tc.spec.Type, tc.val)
+	}
+}
+
+func TestParamDefaults(t *t.T) {
+	initTestLogs()
+
+	p := NewFromShell("echo", "echo {p:count} {p:label} > {o:out}")
+	p.SetParamType("count", ParamTypeInt)
+	p.SetParamDefault("count", "0")
+	p.SetPathStatic("out", "/tmp/params_out.txt")
+	p.ParamPorts["label"].Chan = make(chan string, 1)
+	p.ParamPorts["label"].Chan <- ""
+	close(p.ParamPorts["label"].Chan)
+	p.Out["out"].Chan = make(chan *FileTarget, BUFSIZE)
+	go p.Run()
+
+	out := <-p.Out["out"].Chan
+	assert.EqualValues(t, "0 \n", string(out.Read()))
+	_, open := <-p.Out["out"].Chan
+	assert.False(t, open)
+
+	cleanFiles("/tmp/params_out.txt")
+}
+
+func TestOptionalPlaceHolders(t *t.T) {
+	initTestLogs()
+
+	p := NewFromShell("echo", "echo {p:threads|4} {p:extra|optional|flag:-x} {t:sample|default:nosample} > {o:out}")
+	p.SetPathStatic("out", "/tmp/optional_out.txt")
+	p.Out["out"].Chan = make(chan *FileTarget, BUFSIZE)
+	go p.Run()
+
+	out := <-p.Out["out"].Chan
+	assert.EqualValues(t, "4 nosample\n", string(out.Read()))
+
+	cleanFiles("/tmp/optional_out.txt")
+
+	cmd := expandCommandParamsAndPaths("run {p:threads|optional|flag:--threads}", map[string]string{"threads": "2"}, nil, nil)
+	assert.EqualValues(t, "run --threads 2", cmd)
+
+	// Words are not taken for default values, since they may be misspelled
+	// modifiers
+	assert.NotNil(t, checkPlaceHolderModifiers("p", []string{"optinal"}))
+	assert.NotNil(t, checkPlaceHolderModifiers("t", []string{"nosample"}))
+	assert.Nil(t, checkPlaceHolderModifiers("t", []string{"default:nosample"}))
+	assert.Nil(t, checkPlaceHolderModifiers("p", []string{"0.05", "optional", "flag:-p"}))
+}
+
+func TestOptionalInPorts(t *t.T) {
+	initTestLogs()
+
+	newWf := func(setUp func(*SciProcess)) (*Workflow, *SciProcess) {
+		wf := NewWorkflow("wf")
+		foo := NewFromShell("foo", "echo foo > {o:out}")
+		foo.SetPathStatic("out", "/tmp/optinport_foo.txt")
+		cat := NewFromShell("cat", "echo {i:regions|optional|flag:-L} > {o:out}; cat {i:in} >> {o:out}")
+		cat.SetPathExtend("in", "out", ".cat")
+		setUp(cat)
+		wf.AddProcesses(foo, cat, NewSink())
+		wf.Connect("foo.out", "cat.in")
+		wf.Connect("cat.out", "sink.in")
+		return wf, cat
+	}
+	defer cleanFiles("/tmp/optinport_foo.txt", "/tmp/optinport_foo.txt.cat")
+
+	// An unconnected in-port is a problem, unless optional
+	wf, _ := newWf(func(p *SciProcess) {})
+	assert.Error(t, wf.Validate())
+
+	wf, _ = newWf(func(p *SciProcess) { p.SetInPortOptional("regions") })
+	assert.Nil(t, wf.Run())
+	assert.EqualValues(t, "\nfoo\n", string(NewFileTarget("/tmp/optinport_foo.txt.cat").Read()))
+
+	cleanFiles("/tmp/optinport_foo.txt.cat")
+	wf, _ = newWf(func(p *SciProcess) { p.SetInPortDefault("regions", "/tmp/regions.bed") })
+	assert.Nil(t, wf.Run())
+	assert.EqualValues(t, "-L /tmp/regions.bed\nfoo\n", string(NewFileTarget("/tmp/optinport_foo.txt.cat").Read()))
+}
+
+func TestParamOutPorts(t *t.T) {
+	initTestLogs()
+
+	foo := NewFromShell("foo", "echo foo > {o:out}")
+	foo.SetPathStatic("out", "/tmp/paramout_foo.txt")
+	count := NewFromShell("count", "wc -c < {i:in} > {o:out}")
+	count.SetPathExtend("in", "out", ".count")
+	count.SetParamOut("bytes", ParamFromOutput("out"))
+	use := NewFromShell("use", "echo {p:n} bytes > {o:out}")
+	use.PathFormatters["out"] = func(task *SciTask) string {
+		return "/tmp/paramout_" + task.Params["n"] + ".txt"
+	}
+
+	wf := NewWorkflow("wf")
+	wf.AddProcesses(foo, count, use, NewSink())
+	wf.Connect("foo.out", "count.in")
+	wf.Connect("count.bytes", "use.n")
+	wf.Connect("count.out", "sink.in")
+	wf.Connect("use.out", "sink.in")
+	assert.Contains(t, wf.GetConnections(), Connection{From: "count.bytes", To: "use.n"})
+	assert.Nil(t, wf.Run())
+
+	assert.EqualValues(t, "4 bytes\n", string(NewFileTarget("/tmp/paramout_4.txt").Read()))
+	cleanFiles("/tmp/paramout_foo.txt", "/tmp/paramout_foo.txt.count", "/tmp/paramout_4.txt")
+}
+
+func TestParamOutPortSeveralConsumers(t *t.T) {
+	initTestLogs()
+
+	// Every value of a param out-port is sent to every param port that it
+	// is connected to
+	vals := NewParamPort()
+	src := NewFromShell("src", "echo {p:v} > {o:out}")
+	src.SetPathPattern("out", "/tmp/paramout_src_{p:v}.txt")
+	src.SetParamOut("v", func(task *SciTask) string { return task.Params["v"] })
+	src.ParamPorts["v"].Connect(vals)
+	a := NewFromShell("a", "echo {p:v} > {o:out}")
+	a.SetPathPattern("out", "/tmp/paramout_a_{p:v}.txt")
+	b := NewFromShell("b", "echo {p:v} > {o:out}")
+	b.SetPathPattern("out", "/tmp/paramout_b_{p:v}.txt")
+
+	wf := NewWorkflow("wf")
+	wf.AddProcesses(src, a, b, NewSink())
+	wf.Connect("src.v", "a.v")
+	wf.Connect("src.v", "b.v")
+	wf.Connect("src.out", "sink.in")
+	wf.Connect("a.out", "sink.in")
+	wf.Connect("b.out", "sink.in")
+	go func() {
+		defer vals.Close()
+		for _, v := range []string{"1", "2", "3", "4"} {
+			vals.Chan <- v
+		}
+	}()
+	assert.Nil(t, wf.Run())
+
+	for _, v := range []string{"1", "2", "3", "4"} {
+		for _, name := range []string{"src", "a", "b"} {
+			path := "/tmp/paramout_" + name + "_" + v + ".txt"
+			assert.True(t, NewFileTarget(path).Exists(), "Missing output: "+path)
+			cleanFiles(path)
+		}
+	}
+}
+
+func TestInvalidParamFailsTask(t *t.T) {
+	initTestLogs()
+	defer cleanFiles("/tmp/params_invalid_3.txt", "/tmp/params_invalid_3.txt.audit.json", "/tmp/params_invalid_x.txt")
+
+	// The task with an invalid value fails, while the other tasks run, and
+	// the workflow returns the error, rather than panicking
+	counts := NewParamPort()
+	p := NewFromShell("count", "echo {p:count} {p:label} > {o:out}")
+	p.SetParamType("count", ParamTypeInt)
+	p.SetParamDefault("label", "n")
+	p.SetPathPattern("out", "/tmp/params_invalid_{p:count}.txt")
+	p.ParamPorts["count"].Connect(counts)
+	wf := NewWorkflow("invalid_param")
+	wf.AddProcesses(p, NewSink())
+	wf.Connect("count.out", "sink.in")
+	go func() {
+		defer counts.Close()
+		counts.Chan <- "3"
+		counts.Chan <- "x"
+	}()
+	var err error
+	assert.NotPanics(t, func() { err = wf.Run() })
+	assert.NotNil(t, err)
+	if err != nil {
+		assert.Contains(t, err.Error(), "Invalid value for param 'count'")
+	}
+	assert.EqualValues(t, "3 n\n", string(NewFileTarget("/tmp/params_invalid_3.txt").Read()))
+	assert.False(t, NewFileTarget("/tmp/params_invalid_x.txt").Exists(), "Command with invalid param executed")
+}
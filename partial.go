@@ -0,0 +1,145 @@
+package scipipe
+
+import (
+	"fmt"
+	str "strings"
+)
+
+// ======= Partial runs ========
+
+// How the tasks of a process are handled in a partial run of a workflow
+// (see Workflow.RunFrom and Workflow.RunUntil)
+type partialRunMode int
+
+const (
+	// The tasks are executed, as in a full run
+	partialRunExecute partialRunMode = iota
+	// The tasks are not executed, but their outputs, used by selected
+	// processes, are assumed to exist, and the tasks fail if they do not
+	partialRunAssume
+	// The tasks are not executed, and their outputs are not checked, since
+	// no selected process uses them
+	partialRunIgnore
+)
+
+// Skip the task, in a partial run where its process is not selected,
+// failing it if its outputs are needed, but missing
+func (t *SciTask) skipInPartialRun() {
+	if t.process.partialRun == partialRunAssume {
+		for oname, tgt := range t.OutTargets {
+			if !tgt.IsStreaming() && !tgt.Exists() {
+				t.process.recordTaskStarted(t)
+				t.err = fmt.Errorf("Output %s (on out-port %s) is missing, but is not created, since process %s is not selected in the partial run", tgt.GetPath(), oname, t.process.Name)
+				t.process.recordTaskFailed(t, t.err)
+				return
+			}
+		}
+	}
+	t.process.recordTaskSkipped(t, "since its process is not selected to run")
+	for _, tgt := range t.OutTargets {
+		if !tgt.IsStreaming() {
+			tgt.SetAuditInfo(nil)
+		}
+	}
+}
+
+// Set up the processes of the workflow for a partial run, if RunFrom or
+// RunUntil is set, so that only the selected processes execute their tasks,
+// or, when no tasks should be executed (see createAllTasks), so that no
+// process does
+func (wf *Workflow) setUpPartialRun() error {
+	if wf.noExecute {
+		for _, proc := range flattenProcesses(wf.processes) {
+			if sp, ok := proc.(*SciProcess); ok {
+				sp.partialRun = partialRunIgnore
+			}
+		}
+		return nil
+	}
+	if len(wf.RunFrom) == 0 && len(wf.RunUntil) == 0 {
+		return nil
+	}
+	for _, name := range append(append([]string{}, wf.RunFrom...), wf.RunUntil...) {
+		if _, ok := wf.procsByName[name]; !ok {
+			return fmt.Errorf("Workflow %s: No process named %s, to run from or until", wf.Name, name)
+		}
+	}
+	downstream := make(map[string][]string)
+	upstream := make(map[string][]string)
+	for _, conn := range wf.GetConnections() {
+		from := conn.From[:str.LastIndex(conn.From, ".")]
+		to := conn.To[:str.LastIndex(conn.To, ".")]
+		downstream[from] = append(downstream[from], to)
+		upstream[to] = append(upstream[to], from)
+	}
+	selected := make(map[string]bool)
+	for _, name := range wf.procNames {
+		selected[name] = true
+	}
+	if len(wf.RunFrom) > 0 {
+		selected = intersectNames(selected, reachableProcesses(wf.RunFrom, downstream))
+	}
+	if len(wf.RunUntil) > 0 {
+		selected = intersectNames(selected, reachableProcesses(wf.RunUntil, upstream))
+	}
+	selectedNames := []string{}
+	for _, name := range wf.procNames {
+		if selected[name] {
+			selectedNames = append(selectedNames, name)
+		}
+	}
+	// The outputs of the processes directly upstream of the selected ones
+	// must exist, while those further upstream are only needed for the
+	// paths of their outputs, from which the paths of later outputs are
+	// formatted
+	needed := make(map[string]bool)
+	for _, name := range selectedNames {
+		for _, up := range upstream[name] {
+			needed[up] = true
+		}
+	}
+	Audit.Printf("Workflow %s: Partial run, of the processes: %s\n", wf.Name, str.Join(selectedNames, ", "))
+	for _, name := range wf.procNames {
+		mode := partialRunExecute
+		if !selected[name] {
+			mode = partialRunIgnore
+			if needed[name] {
+				mode = partialRunAssume
+			}
+		}
+		for _, proc := range flattenProcesses([]Process{wf.procsByName[name]}) {
+			if sp, ok := proc.(*SciProcess); ok {
+				sp.partialRun = mode
+			}
+		}
+	}
+	return nil
+}
+
+// Get the names of the processes reachable from those named names,
+// including themselves, following the edges
+func reachableProcesses(names []string, edges map[string][]string) map[string]bool {
+	reached := make(map[string]bool)
+	queue := append([]string{}, names...)
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if reached[name] {
+			continue
+		}
+		reached[name] = true
+		queue = append(queue, edges[name]...)
+	}
+	return reached
+}
+
+// Get the names that are in both a and b
+func intersectNames(a map[string]bool, b map[string]bool) map[string]bool {
+	both := make(map[string]bool)
+	for name := range a {
+		if b[name] {
+			both[name] = true
+		}
+	}
+	return both
+}
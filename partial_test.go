@@ -0,0 +1,51 @@
+package scipipe
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	t "testing"
+)
+
+func newTestPartialWorkflow() *Workflow {
+	wf := newTestFooBarWorkflow("/tmp/partial_")
+	b2baz := NewFromShell("b2baz", "sed 's/bar/baz/' {i:in} > {o:out}")
+	b2baz.SetPathExtend("in", "out", ".baz")
+	wf.AddProcess(b2baz)
+	wf.Connect("f2b.out", "b2baz.in")
+	wf.Connect("b2baz.out", "sink.in")
+	return wf
+}
+
+func TestPartialRun(t *t.T) {
+	initTestLogs()
+	defer cleanFiles("/tmp/partial_foo.txt", "/tmp/partial_foo.txt.bar", "/tmp/partial_foo.txt.bar.baz")
+
+	// Until
+	wf := newTestPartialWorkflow()
+	wf.RunUntil = []string{"f2b"}
+	assert.Nil(t, wf.Run())
+	assert.True(t, NewFileTarget("/tmp/partial_foo.txt.bar").Exists())
+	assert.False(t, NewFileTarget("/tmp/partial_foo.txt.bar.baz").Exists())
+	assert.EqualValues(t, 1, wf.GetStats().Processes["b2baz"].TasksSkipped)
+
+	// From, with the outputs of upstream processes existing
+	os.Remove("/tmp/partial_foo.txt")
+	wf = newTestPartialWorkflow()
+	wf.RunFrom = []string{"b2baz"}
+	assert.Nil(t, wf.Run())
+	assert.EqualValues(t, "baz\n", string(NewFileTarget("/tmp/partial_foo.txt.bar.baz").Read()))
+	assert.False(t, NewFileTarget("/tmp/partial_foo.txt").Exists())
+	assert.EqualValues(t, 1, wf.GetStats().Processes["b2baz"].TasksExecuted)
+
+	// From, with the output of an upstream process missing
+	cleanFiles("/tmp/partial_foo.txt.bar", "/tmp/partial_foo.txt.bar.baz")
+	wf = newTestPartialWorkflow()
+	wf.RunFrom = []string{"b2baz"}
+	assert.Error(t, wf.Run())
+	assert.EqualValues(t, 1, wf.GetStats().Processes["f2b"].TasksFailed)
+	assert.False(t, NewFileTarget("/tmp/partial_foo.txt.bar.baz").Exists())
+
+	wf = newTestPartialWorkflow()
+	wf.RunUntil = []string{"nonexisting"}
+	assert.Error(t, wf.Run())
+}
@@ -0,0 +1,96 @@
+package scipipe
+
+import (
+	"errors"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+)
+
+// ======= Output permissions ========
+
+// Set up all SciProcesses of the pipeline to set the mode and group of their
+// outputs, if OutputMode or OutputGroup is set, unless set on the process
+func (pl *PipelineRunner) setUpOutputPermissions() {
+	for _, proc := range flattenProcesses(pl.processes) {
+		if sp, ok := proc.(*SciProcess); ok {
+			if sp.OutputMode == 0 {
+				sp.OutputMode = pl.OutputMode
+			}
+			if sp.OutputGroup == "" {
+				sp.OutputGroup = pl.OutputGroup
+			}
+		}
+	}
+}
+
+// Set the mode and group of the (atomized) output otgt, and its audit file,
+// if set for the process
+func (t *SciTask) setOutputPermissions(otgt *FileTarget) {
+	p := t.process
+	if p.OutputMode == 0 && p.OutputGroup == "" {
+		return
+	}
+	gid := -1
+	if p.OutputGroup != "" {
+		var err error
+		gid, err = lookupGroupID(p.OutputGroup)
+		Check(err)
+	}
+	// For file sets, the path is that of their directory
+	paths := []string{otgt.GetPath()}
+	if _, err := os.Stat(otgt.GetAuditFilePath()); err == nil {
+		paths = append(paths, otgt.GetAuditFilePath())
+	}
+	for _, path := range paths {
+		err := setPermissions(path, p.OutputMode, gid)
+		Check(err)
+	}
+}
+
+// Set the mode (unless 0) and group (unless -1) of the file at path, or of a
+// directory and everything in it. Directories get the mode with the execute
+// bits added for those who can read them, so that they can still be listed.
+// Symlinks are left as they are.
+func setPermissions(path string, mode os.FileMode, gid int) error {
+	return filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return nil
+		}
+		if gid >= 0 {
+			if err := os.Chown(path, -1, gid); err != nil {
+				return err
+			}
+		}
+		if mode != 0 {
+			m := mode.Perm()
+			if info.IsDir() {
+				m |= (m & 0444) >> 2
+			}
+			if err := os.Chmod(path, m); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Get the ID of the group with the name, or ID, group
+func lookupGroupID(group string) (int, error) {
+	if gid, err := strconv.Atoi(group); err == nil {
+		return gid, nil
+	}
+	g, err := user.LookupGroup(group)
+	if err != nil {
+		return -1, err
+	}
+	gid, err := strconv.Atoi(g.Gid)
+	if err != nil {
+		return -1, errors.New("Group " + group + " has no numeric ID: " + g.Gid)
+	}
+	return gid, nil
+}
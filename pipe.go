@@ -0,0 +1,156 @@
+package scipipe
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	str "strings"
+	"sync"
+)
+
+// ======= In-memory pipes between Go processes ========
+
+// targetPipe is an in-memory pipe for a streaming target of a process with
+// a custom execution function, so that data can be streamed to processes
+// with custom execution functions too without FIFO files. Whether the pipe
+// or a FIFO file is used is decided by the producing function: the pipe if
+// it opens the output with SciTask.OpenOut, and a FIFO file if it opens it
+// with SciTask.CreateOut. Consuming tasks wait for the decision, and shell
+// commands read from a FIFO file either way, which the pipe is copied into.
+type targetPipe struct {
+	r       *io.PipeReader
+	w       *io.PipeWriter
+	usePipe bool
+	once    sync.Once
+	decided chan struct{}
+}
+
+func newTargetPipe() *targetPipe {
+	r, w := io.Pipe()
+	return &targetPipe{r: r, w: w, decided: make(chan struct{})}
+}
+
+// Decide whether the pipe is used, unless already decided, returning the
+// decision made
+func (tp *targetPipe) decide(usePipe bool) bool {
+	tp.once.Do(func() {
+		tp.usePipe = usePipe
+		close(tp.decided)
+	})
+	return tp.usePipe
+}
+
+// Wait until it is decided whether the pipe is used, returning the decision
+func (tp *targetPipe) wait() bool {
+	<-tp.decided
+	return tp.usePipe
+}
+
+// Check whether the target is streamed through an in-memory pipe, waiting
+// until that is decided by the producing task, if needed
+func (ft *FileTarget) isPiped() bool {
+	return ft.pipe != nil && ft.pipe.wait()
+}
+
+// Open the output oname of the task for writing, in a custom execution
+// function. Streaming outputs are written to an in-memory pipe, if read
+// by custom execution functions too (see OpenIn), or else to a FIFO file,
+// and other outputs to their temp files, as with CreateOut. The writer must
+// be closed by the caller.
+func (t *SciTask) OpenOut(oname string) (io.WriteCloser, error) {
+	otgt := t.OutTargets[oname]
+	if otgt == nil {
+		return nil, fmt.Errorf("Task %s has no output %s", t.Name, oname)
+	}
+	if otgt.pipe != nil && otgt.pipe.decide(true) {
+		return otgt.pipe.w, nil
+	}
+	f, err := t.CreateOut(oname)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Open the input iname of the task for reading, in a custom execution
+// function, whether it is streamed through an in-memory pipe (see OpenOut)
+// or a FIFO file, is in memory or is a file. The reader must be closed by
+// the caller.
+func (t *SciTask) OpenIn(iname string) (io.ReadCloser, error) {
+	itgt := t.InTargets[iname]
+	if itgt == nil {
+		return nil, fmt.Errorf("Task %s has no input %s", t.Name, iname)
+	}
+	if itgt.isPiped() {
+		return itgt.pipe.r, nil
+	}
+	if itgt.IsInMemory() {
+		return ioutil.NopCloser(str.NewReader(itgt.GetValueString())), nil
+	}
+	path := itgt.GetPath()
+	if itgt.IsStreaming() {
+		path = Streams.GetReadPath(itgt)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Use a FIFO file, rather than the in-memory pipe, for the streaming
+// target ft, creating it, unless the pipe is already used
+func (ft *FileTarget) usePipeFifo() error {
+	if ft.pipe.decide(false) {
+		return errors.New("Output is already opened with OpenOut, streaming through an in-memory pipe: " + ft.GetPath())
+	}
+	if Streams.Exists(ft) {
+		return nil
+	}
+	return Streams.Create(ft)
+}
+
+// Close the in-memory pipes of the outputs of the task, after it has
+// executed, with the error err, if any, so that consuming tasks are not left
+// waiting for outputs that are never written
+func (t *SciTask) closeOutPipes(err error) {
+	for _, otgt := range t.OutTargets {
+		if otgt.pipe == nil || !otgt.pipe.decide(true) {
+			continue
+		}
+		if err != nil {
+			otgt.pipe.w.CloseWithError(err)
+		} else {
+			otgt.pipe.w.Close()
+		}
+	}
+}
+
+// Copy the inputs of the task that are streamed through in-memory pipes to
+// FIFO files, for commands that read them at their FIFO paths
+func (t *SciTask) copyInPipesToFifos() {
+	for _, itgt := range t.InTargets {
+		if !itgt.isPiped() {
+			continue
+		}
+		if !Streams.Exists(itgt) {
+			err := Streams.Create(itgt)
+			Check(err)
+		}
+		go func(itgt *FileTarget) {
+			// Blocks until the command opens the FIFO file for reading
+			f, err := os.OpenFile(Streams.GetWritePath(itgt), os.O_WRONLY, 0)
+			if err != nil {
+				itgt.pipe.r.CloseWithError(err)
+				return
+			}
+			if _, err := io.Copy(f, itgt.pipe.r); err != nil {
+				t.logStructured(LevelWarning, "Could not copy piped input to FIFO file", Fields{"path": Streams.GetWritePath(itgt), "error": err})
+			}
+			f.Close()
+			itgt.pipe.r.Close()
+		}(itgt)
+	}
+}
@@ -2,12 +2,47 @@ package scipipe
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"reflect"
 )
 
 type PipelineRunner struct {
 	processes []Process
+	// The maximum number of tasks executing their commands at the same time,
+	// across all processes of the pipeline (0 means no limit)
+	MaxConcurrentTasks int
+	// The budget of cores and memory (in MB) for concurrently executing
+	// tasks, as declared by their processes (0 means no limit)
+	MaxCores    int
+	MaxMemoryMB int
+	// In dry-run mode, the commands that would be executed are printed to
+	// DryRunWriter (or os.Stdout, if not set), instead of executed
+	DryRun       bool
+	DryRunWriter io.Writer
+	// If set, the commands of all tasks are recorded by the mock executor,
+	// which fabricates their outputs, instead of executed (see
+	// MockExecutor)
+	Mock *MockExecutor
+	// Write the output of the commands of all tasks, as they run (see
+	// SciProcess.LiveOutput)
+	LiveOutput bool
+	// Profile the resources used by the commands of all tasks (see
+	// SciProcess.Profile)
+	Profile bool
+	// Reject values containing shell metacharacters in the commands of all
+	// tasks (see SciProcess.Strict)
+	Strict bool
+	// The mode and group that the outputs of all processes are given,
+	// unless set on the process (see SciProcess.OutputMode)
+	OutputMode  os.FileMode
+	OutputGroup string
+	// Do not read the config files (see Config) when run. By default, they
+	// are read for defaults of the settings not made in the code.
+	NoConfig bool
+	// If set, the commands of all tasks are executed on the workers of the
+	// pool, rather than locally (see WorkerPool)
+	Workers *WorkerPool
 }
 
 func NewPipelineRunner() *PipelineRunner {
@@ -31,23 +66,27 @@ func (pl *PipelineRunner) PrintProcesses() {
 }
 
 func (pl *PipelineRunner) Run() {
-	if !LogExists {
-		InitLogAudit()
+	initDefaultLog()
+	if err := pl.setUpConfig(); err != nil {
+		Error.Println("PipelineRunner: Pipeline shutting down, since the config could not be read:", err)
+		os.Exit(1)
 	}
 	if len(pl.processes) == 0 {
 		Error.Println("PipelineRunner: The PipelineRunner is empty. Did you forget to add the processes to it?")
 		os.Exit(1)
 	}
-	everythingConnected := true
-	for _, proc := range pl.processes {
-		if !proc.IsConnected() {
-			everythingConnected = false
-		}
-	}
-	if !everythingConnected {
-		Error.Println("PipelineRunner: Pipeline shutting down, since not all ports are connected!")
+	if err := pl.Validate(); err != nil {
+		Error.Println("PipelineRunner: Pipeline shutting down, since it is not valid:", err)
 		os.Exit(1)
 	} else {
+		pl.setUpScheduler()
+		pl.setUpDryRun()
+		pl.setUpMock()
+		pl.setUpLiveOutput()
+		pl.setUpProfiling()
+		pl.setUpStrictMode()
+		pl.setUpOutputPermissions()
+		pl.setUpWorkers()
 		for i, proc := range pl.processes {
 			Debug.Printf("PipelineRunner: Looping over process %d: %v ...\n", i, proc)
 			if i < len(pl.processes)-1 {
@@ -60,3 +99,62 @@ func (pl *PipelineRunner) Run() {
 		}
 	}
 }
+
+// Set up a scheduler limiting the number of, and resources used by,
+// concurrently executing tasks, for all SciProcesses of the pipeline
+func (pl *PipelineRunner) setUpScheduler() {
+	if pl.MaxConcurrentTasks <= 0 && pl.MaxCores <= 0 && pl.MaxMemoryMB <= 0 {
+		return
+	}
+	s := newScheduler(pl.MaxConcurrentTasks)
+	s.maxCores = pl.MaxCores
+	s.maxMemoryMB = pl.MaxMemoryMB
+	for _, proc := range flattenProcesses(pl.processes) {
+		if sp, ok := proc.(*SciProcess); ok {
+			sp.scheduler = s
+		}
+	}
+}
+
+// Set up all SciProcesses of the pipeline to print their commands, instead of
+// executing them, in dry-run mode
+func (pl *PipelineRunner) setUpDryRun() {
+	if !pl.DryRun {
+		return
+	}
+	w := pl.DryRunWriter
+	if w == nil {
+		w = os.Stdout
+	}
+	for _, proc := range flattenProcesses(pl.processes) {
+		if sp, ok := proc.(*SciProcess); ok {
+			sp.dryRunWriter = w
+		}
+	}
+}
+
+// Set up all SciProcesses of the pipeline to write the output of their
+// commands as they run, if LiveOutput is set
+func (pl *PipelineRunner) setUpLiveOutput() {
+	if !pl.LiveOutput {
+		return
+	}
+	for _, proc := range flattenProcesses(pl.processes) {
+		if sp, ok := proc.(*SciProcess); ok {
+			sp.LiveOutput = true
+		}
+	}
+}
+
+// Set up all SciProcesses of the pipeline to execute their commands on the
+// workers of the pool, if set
+func (pl *PipelineRunner) setUpWorkers() {
+	if pl.Workers == nil {
+		return
+	}
+	for _, proc := range flattenProcesses(pl.processes) {
+		if sp, ok := proc.(*SciProcess); ok {
+			sp.workers = pl.Workers
+		}
+	}
+}
@@ -6,7 +6,7 @@ import (
 )
 
 func TestAddProcesses(t *t.T) {
-	InitLogError()
+	initTestLogs()
 
 	proc1 := NewBogusProcess()
 	proc2 := NewBogusProcess()
@@ -1,5 +1,10 @@
 package scipipe
 
+import (
+	"errors"
+	"sync"
+)
+
 type Port interface {
 	Connect(Port)
 	IsConnected() bool
@@ -14,34 +19,103 @@ func ConnectFrom(inPort *InPort, outPort *OutPort) {
 	inPort.Connect(outPort)
 }
 
-// InPort
+// InPort is a port receiving targets from the out-ports it is connected
+// to. When connected to more than one out-port, the targets from all of
+// them are merged (see SetMergeMode and SetMergeTag).
 type InPort struct {
 	Port
 	Chan      chan *FileTarget
 	connected bool
+	bufSize   int
+	// The name of the out-port that the in-port was first connected to, if
+	// known
+	origin string
+	// The out-ports that targets are merged from, when connected to more
+	// than one out-port
+	mergeSources []*mergeSource
+	mergeMode    MergeMode
+	mergeTag     string
+	mergeOpen    int
+	mergeLock    sync.Mutex
 }
 
 func NewInPort() *InPort {
 	return &InPort{connected: false}
 }
 
+// Connect the in-port to the out-port outp. Ports that can not be connected
+// are reported as errors, and left unconnected, so that they are reported
+// when the pipeline is validated too.
 func (inp *InPort) Connect(outp *OutPort) {
-	if inp.Chan != nil && outp.Chan != nil {
-		Error.Println("Both in-port and out-port already have initialized channels, so can't choose which to use!")
+	if err := inp.connect(outp, ""); err != nil {
+		Error.Println(err)
+	}
+}
+
+// Connect the in-port to the out-port outp, named origin (which is used to
+// tag the targets from it, when merged), if known, returning an error if
+// the ports can not be connected
+func (inp *InPort) connect(outp *OutPort, origin string) error {
+	if inp == nil || outp == nil {
+		return errors.New("Can not connect a port that does not exist (is nil), as when looking up a misspelled port name in the In or Out map of a process")
+	}
+	if inp.isConnectedTo(outp) {
+		return errors.New("In-port and out-port are already connected to each other")
+	}
+	if inp.Chan != nil && outp.Chan != nil && inp.IsConnected() && outp.IsConnected() {
+		Debug.Println("Both InPort and OutPort already connected to other ports, so broadcasting from OutPort and merging into InPort")
+		ch := make(chan *FileTarget, getBufferSize(inp.bufSize, outp.bufSize))
+		outp.addBroadcastChan(ch)
+		inp.addMergeChan(ch, origin)
+	} else if inp.Chan != nil && outp.Chan != nil {
+		return errors.New("Both in-port and out-port already have initialized channels, so can't choose which to use")
+	} else if inp.Chan != nil && outp.Chan == nil && inp.IsConnected() {
+		Debug.Println("InPort already connected to another OutPort, so merging the targets of this OutPort into it too")
+		outp.Chan = make(chan *FileTarget, getBufferSize(inp.bufSize, outp.bufSize))
+		inp.addMergeChan(outp.Chan, origin)
 	} else if inp.Chan != nil && outp.Chan == nil {
 		Debug.Println("InPort, but not OutPort initialized, so connecting InPort to OutPort")
 		outp.Chan = inp.Chan
+		inp.origin = origin
+	} else if outp.Chan != nil && inp.Chan == nil && outp.IsConnected() {
+		Debug.Println("OutPort already connected to another InPort, so broadcasting its targets to this InPort too")
+		inp.Chan = make(chan *FileTarget, getBufferSize(inp.bufSize, outp.bufSize))
+		outp.addBroadcastChan(inp.Chan)
+		inp.origin = origin
 	} else if outp.Chan != nil && inp.Chan == nil {
 		Debug.Println("OutPort, but not InPort initialized, so connecting OutPort to InPort")
 		inp.Chan = outp.Chan
+		inp.origin = origin
 	} else if inp.Chan == nil && outp.Chan == nil {
 		Debug.Println("Neither InPort nor OutPort initialized, so creating new channel")
-		ch := make(chan *FileTarget, BUFSIZE)
+		ch := make(chan *FileTarget, getBufferSize(inp.bufSize, outp.bufSize))
 		inp.Chan = ch
 		outp.Chan = ch
+		inp.origin = origin
 	}
 	inp.SetConnectedStatus(true)
 	outp.SetConnectedStatus(true)
+	return nil
+}
+
+// Check whether the in-port is connected to the out-port outp, that is,
+// whether they have any channel in common
+func (inp *InPort) isConnectedTo(outp *OutPort) bool {
+	for _, ich := range inp.getRemoteChans() {
+		for _, och := range outp.getRemoteChans() {
+			if ich == och {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Set the buffer size of the channel created when connecting the in-port
+// (see PortBufferSize), which must be done before connecting it. When both
+// connected ports have buffer sizes, the largest is used.
+func (inp *InPort) SetBufferSize(size int) {
+	inp.bufSize = size
 }
 
 func (inp *InPort) SetConnectedStatus(connected bool) {
@@ -52,11 +126,21 @@ func (inp *InPort) IsConnected() bool {
 	return inp.connected
 }
 
-// OutPort
+// OutPort is a port sending targets to the in-ports it is connected to.
+// When connected to more than one in-port, each target sent on it is
+// broadcast to all of them, where all but the first get copies of the
+// target, so that every consumer gets every target. Since the targets are
+// sent to the in-ports in turn, a consumer that does not receive holds back
+// the others, once the buffer of its channel is full.
 type OutPort struct {
 	Port
 	Chan      chan *FileTarget
 	connected bool
+	bufSize   int
+	// The channels of the in-ports that the targets sent on Chan are
+	// broadcast to, when connected to more than one in-port
+	broadcastChans []chan *FileTarget
+	broadcastLock  sync.Mutex
 }
 
 func NewOutPort() *OutPort {
@@ -67,6 +151,12 @@ func (outp *OutPort) Connect(inp *InPort) {
 	inp.Connect(outp)
 }
 
+// Set the buffer size of the channel created when connecting the out-port,
+// as for InPort.SetBufferSize
+func (outp *OutPort) SetBufferSize(size int) {
+	outp.bufSize = size
+}
+
 func (outp *OutPort) IsConnected() bool {
 	return outp.connected
 }
@@ -79,10 +169,81 @@ func (outp *OutPort) Close() {
 	close(outp.Chan)
 }
 
-// ParamPort
+// Get the number of in-ports that the out-port is connected to (as far as
+// can be told, since in-ports that share its channel can not be counted)
+func (outp *OutPort) getConnectionCount() int {
+	outp.broadcastLock.Lock()
+	defer outp.broadcastLock.Unlock()
+	if len(outp.broadcastChans) > 0 {
+		return len(outp.broadcastChans)
+	}
+	if outp.connected {
+		return 1
+	}
+	return 0
+}
+
+// Get the channels that the in-ports connected to the out-port receive on
+func (outp *OutPort) getRemoteChans() []chan *FileTarget {
+	outp.broadcastLock.Lock()
+	defer outp.broadcastLock.Unlock()
+	if len(outp.broadcastChans) > 0 {
+		return append([]chan *FileTarget{}, outp.broadcastChans...)
+	}
+	if outp.Chan != nil {
+		return []chan *FileTarget{outp.Chan}
+	}
+	return nil
+}
+
+// Connect the out-port to another in-port, in addition to the in-port(s) it
+// is already connected to, by broadcasting the targets sent on the out-port
+// to the channel ch of the in-port too. On the first such connection, the
+// channel of the out-port is handed over to the in-port it was shared
+// with, and a new one is created for the out-port, which the targets are
+// broadcast from.
+func (outp *OutPort) addBroadcastChan(ch chan *FileTarget) {
+	outp.broadcastLock.Lock()
+	defer outp.broadcastLock.Unlock()
+	if len(outp.broadcastChans) == 0 {
+		outp.broadcastChans = []chan *FileTarget{outp.Chan}
+		outp.Chan = make(chan *FileTarget, getBufferSize(outp.bufSize))
+		go outp.broadcast(outp.Chan)
+	}
+	outp.broadcastChans = append(outp.broadcastChans, ch)
+}
+
+// Send the targets received on the channel src to all the broadcast
+// channels, closing them when src is closed
+func (outp *OutPort) broadcast(src chan *FileTarget) {
+	for ft := range src {
+		chans := outp.getRemoteChans()
+		// Copy the target before sending it anywhere, since it may be
+		// changed by the receivers
+		fts := []*FileTarget{ft}
+		for range chans[1:] {
+			fts = append(fts, ft.Copy())
+		}
+		for i, ch := range chans {
+			ch <- fts[i]
+		}
+	}
+	for _, ch := range outp.getRemoteChans() {
+		close(ch)
+	}
+}
+
+// ParamPort is a port for param values. When the param port that values
+// are sent on (as the argument of Connect) is connected to more than one
+// param port, each value is broadcast to all of them, as for OutPort.
 type ParamPort struct {
 	Chan      chan string
 	connected bool
+	bufSize   int
+	// The channels of the param ports that the values sent on Chan are
+	// broadcast to, when connected to more than one param port
+	broadcastChans []chan string
+	broadcastLock  sync.Mutex
 }
 
 func NewParamPort() *ParamPort {
@@ -90,17 +251,26 @@ func NewParamPort() *ParamPort {
 }
 
 func (paramp *ParamPort) Connect(otherParamPort *ParamPort) {
+	if paramp == nil || otherParamPort == nil {
+		Error.Println("Can not connect a param port that does not exist (is nil), as when looking up a misspelled param name in the ParamPorts map of a process")
+		return
+	}
 	if paramp.Chan != nil && otherParamPort.Chan != nil {
 		Error.Println("Both paramports already have initialized channels, so can't choose which to use!")
+		return
 	} else if paramp.Chan != nil && otherParamPort.Chan == nil {
 		Debug.Println("Local param port, but not the other one, initialized, so connecting local to other")
 		otherParamPort.Chan = paramp.Chan
+	} else if otherParamPort.Chan != nil && paramp.Chan == nil && otherParamPort.IsConnected() {
+		Debug.Println("The other param port already connected to another param port, so broadcasting its values to the local one too")
+		paramp.Chan = make(chan string, getBufferSize(paramp.bufSize, otherParamPort.bufSize))
+		otherParamPort.addBroadcastChan(paramp.Chan)
 	} else if otherParamPort.Chan != nil && paramp.Chan == nil {
 		Debug.Println("The other, but not the local param port initialized, so connecting other to local")
 		paramp.Chan = otherParamPort.Chan
 	} else if paramp.Chan == nil && otherParamPort.Chan == nil {
 		Debug.Println("Neither local nor other param port initialized, so creating new channel and connecting both")
-		ch := make(chan string, BUFSIZE)
+		ch := make(chan string, getBufferSize(paramp.bufSize, otherParamPort.bufSize))
 		paramp.Chan = ch
 		otherParamPort.Chan = ch
 	}
@@ -108,6 +278,12 @@ func (paramp *ParamPort) Connect(otherParamPort *ParamPort) {
 	otherParamPort.SetConnectedStatus(true)
 }
 
+// Set the buffer size of the channel created when connecting the param
+// port, as for InPort.SetBufferSize
+func (paramp *ParamPort) SetBufferSize(size int) {
+	paramp.bufSize = size
+}
+
 func (paramp *ParamPort) SetConnectedStatus(connected bool) {
 	paramp.connected = connected
 }
@@ -119,3 +295,37 @@ func (paramp *ParamPort) IsConnected() bool {
 func (paramp *ParamPort) Close() {
 	close(paramp.Chan)
 }
+
+// Connect the param port to another param port, in addition to the one(s)
+// it is already connected to, by broadcasting the values sent on it to the
+// channel ch too, as for OutPort.addBroadcastChan
+func (paramp *ParamPort) addBroadcastChan(ch chan string) {
+	paramp.broadcastLock.Lock()
+	defer paramp.broadcastLock.Unlock()
+	if len(paramp.broadcastChans) == 0 {
+		paramp.broadcastChans = []chan string{paramp.Chan}
+		paramp.Chan = make(chan string, getBufferSize(paramp.bufSize))
+		go paramp.broadcast(paramp.Chan)
+	}
+	paramp.broadcastChans = append(paramp.broadcastChans, ch)
+}
+
+// Send the values received on the channel src to all the broadcast
+// channels, closing them when src is closed
+func (paramp *ParamPort) broadcast(src chan string) {
+	for val := range src {
+		for _, ch := range paramp.getBroadcastChans() {
+			ch <- val
+		}
+	}
+	for _, ch := range paramp.getBroadcastChans() {
+		close(ch)
+	}
+}
+
+// Get the channels that the values sent on the param port are broadcast to
+func (paramp *ParamPort) getBroadcastChans() []chan string {
+	paramp.broadcastLock.Lock()
+	defer paramp.broadcastLock.Unlock()
+	return append([]chan string{}, paramp.broadcastChans...)
+}
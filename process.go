@@ -1,7 +1,10 @@
 package scipipe
 
 import (
+	"context"
 	"errors"
+	"io"
+	"os"
 	str "strings"
 )
 
@@ -24,30 +27,190 @@ type SciProcess struct {
 	In               map[string]*InPort
 	Out              map[string]*OutPort
 	OutPortsDoStream map[string]bool
-	PathFormatters   map[string]func(*SciTask) string
-	ParamPorts       map[string]*ParamPort
-	CustomExecute    func(*SciTask)
+	OutPortsGlob     map[string]string
+	OutPortsCompress map[string]bool
+	OutPortsTempDir  map[string]string
+	// The directories that streamed outputs are cached in, by out-port
+	// name (see SetOutStreamCache)
+	OutPortsStreamCache map[string]string
+	InPortsDecompress   map[string]bool
+	InPortsOptional     map[string]bool
+	InPortsDefault      map[string]string
+	PathFormatters      map[string]func(*SciTask) string
+	ParamPorts          map[string]*ParamPort
+	ParamSpecs          map[string]*ParamSpec
+	CustomExecute       func(*SciTask) error
+	InputStaging        StagingMode
+	ScratchDir          string
+	Env                 map[string]string
+	Shell               string
+	CommandArgs         []string
+	// The functions creating the custom targets (see Target) that
+	// out-ports output, by out-port name (see SetOutTargetFunc)
+	OutPortsTargetFunc map[string]func(*SciTask) Target
+	// Execute the command pattern as a Go text/template template (see
+	// NewFromTemplate)
+	TemplateCommand bool
+	// The in-port and out-port wired to the stdin and stdout of the commands
+	// of the process, if any (see SetStdin and SetStdout)
+	StdinPort  string
+	StdoutPort string
+	// Param ports sending values computed by the tasks of the process, with
+	// the functions computing them (see SetParamOut)
+	ParamOutPorts map[string]*ParamPort
+	ParamOutFuncs map[string]func(*SciTask) string
+	// The maximum number of tasks of the process executing their commands
+	// at the same time (0 means no limit), independent of any pipeline-wide
+	// limit
+	MaxConcurrentTasks int
+	// The number of cores and the memory (in MB) used by each task of the
+	// process, for resource-aware scheduling, and for use in commands (e.g.
+	// for cluster job resources) as {task.cores} and {task.memory}
+	Cores    int
+	MemoryMB int
+	// Tasks of processes with higher priority are started first, when tasks
+	// are waiting to execute because of the limits above
+	Priority int
+	// The maximum rate, in tasks per second, at which tasks of the process
+	// start executing (0 means no limit), as for tasks calling web services
+	// that throttle clients, with up to RateBurst tasks (at least 1) started
+	// at once after idle periods (see SetRateLimit)
+	RateLimit float64
+	RateBurst int
+	// Write the log messages of each task (of the info level and above),
+	// and the output of its command, to a log file next to its outputs
+	// (see SciTask.GetLogPath)
+	TaskLogFiles bool
+	// Run the command of each task in its own working directory (the
+	// staging directory of the task, see GetStagingDir), into which its
+	// inputs are linked, so that files written to the working directory by
+	// concurrent tasks do not clobber each other. The paths of inputs and
+	// outputs in commands are then absolute. The directory is removed when
+	// the task succeeds, and kept for inspection when it fails.
+	IsolateWorkDir bool
+	// A function selecting the prepend string of each task, overriding
+	// Prepend, as for submitting tasks with large inputs to a cluster with
+	// more resources, while running the others locally (see PrependBySize)
+	PrependFunc func(*SciTask) string
+	// Execute the commands of up to BatchSize tasks with one shell
+	// invocation (or one cluster job, with Prepend), one after another, to
+	// reduce the overhead of scheduling many short tasks. Each task still
+	// fails, or has its outputs atomized, on its own. Values below 2 mean
+	// no batching. Tasks are not batched when the process is profiled.
+	BatchSize int
+	// The maximum number of tasks of the process that are created before
+	// the outputs of earlier ones are sent, after which the process waits
+	// before receiving more inputs (0 means DefaultMaxInFlightTasks)
+	MaxInFlightTasks int
+	// Write the output of the commands of tasks, as they run, to
+	// LiveOutputWriter (by default os.Stdout), prefixed with the name and
+	// index of the task
+	LiveOutput bool
+	// Record the resources used by the command of each task (CPU time, peak
+	// memory and disk I/O, see ResourceUsage) in its audit info, for the
+	// resource report of the workflow (see Workflow.GetResourceReport).
+	// Commands executed on workers are not profiled. Since the resources
+	// used are reported per task, tasks are not batched (see BatchSize)
+	// while profiling.
+	Profile bool
+	// Reject values of placeholders containing shell metacharacters (see
+	// AllowUnsafeValues), as a guard against command injection through
+	// file names and params. Tasks with such values fail without executing
+	// their commands. Template commands may only insert values with the
+	// placeholder functions, not with fields of the task.
+	Strict bool
+	// The placeholders, as TYPE:NAME (such as p:opts), whose values may
+	// contain shell metacharacters in strict mode
+	UnsafeValuesAllowed map[string]bool
+	// The mode (such as 0664), if not 0, and group (name or ID), if not "",
+	// that outputs are given when atomized, as for results in shared project
+	// directories. Directories get the execute bits matching the read bits
+	// too. Setting the group is not supported on Windows.
+	OutputMode  os.FileMode
+	OutputGroup string
+	// The environment activated before each command, with the tools used
+	// by the process (see UseModules, UseConda and UseVenv), which requires
+	// commands executed with a POSIX shell. The activation comes before the
+	// prepend string, so that it is passed on to cluster jobs by prepends
+	// such as srun, that export the environment.
+	ToolEnv      ToolEnv
+	scheduler    *scheduler
+	dryRunWriter io.Writer
+	mock         *MockExecutor
+	partialRun   partialRunMode
+	ctx          context.Context
+	workers      *WorkerPool
+	stats        *ProcessStats
+	hooks        *hooks
+	loggers      *loggers
+	// How params can be given on the command line, by param name, if
+	// registered as flags (see Workflow.AddParamFlags)
+	paramFlags map[string]string
 }
 
 func NewSciProcess(name string, command string) *SciProcess {
 	return &SciProcess{
-		Name:             name,
-		CommandPattern:   command,
-		In:               make(map[string]*InPort),
-		Out:              make(map[string]*OutPort),
-		OutPortsDoStream: make(map[string]bool),
-		PathFormatters:   make(map[string]func(*SciTask) string),
-		ParamPorts:       make(map[string]*ParamPort),
-		Spawn:            true,
+		Name:                name,
+		CommandPattern:      command,
+		In:                  make(map[string]*InPort),
+		Out:                 make(map[string]*OutPort),
+		OutPortsDoStream:    make(map[string]bool),
+		OutPortsGlob:        make(map[string]string),
+		OutPortsCompress:    make(map[string]bool),
+		OutPortsTempDir:     make(map[string]string),
+		OutPortsStreamCache: make(map[string]string),
+		OutPortsTargetFunc:  make(map[string]func(*SciTask) Target),
+		InPortsDecompress:   make(map[string]bool),
+		InPortsOptional:     make(map[string]bool),
+		InPortsDefault:      make(map[string]string),
+		PathFormatters:      make(map[string]func(*SciTask) string),
+		ParamPorts:          make(map[string]*ParamPort),
+		ParamSpecs:          make(map[string]*ParamSpec),
+		ParamOutPorts:       make(map[string]*ParamPort),
+		ParamOutFuncs:       make(map[string]func(*SciTask) string),
+		Env:                 make(map[string]string),
+		UnsafeValuesAllowed: make(map[string]bool),
+		paramFlags:          make(map[string]string),
+		Spawn:               true,
 	}
 }
 
+// Shell value for executing commands directly, without a shell. Unless
+// CommandArgs is set, the command pattern is split into args on whitespace,
+// where single or double quotes group words into one arg, and are removed,
+// so that 'a b' is now one arg, a b, rather than the two args 'a and b'. A
+// pattern with an unterminated quote is split on whitespace only, as before.
+const ShellNone = "none"
+
+// Shell value for executing simple commands directly, without a shell, and
+// other commands with the shell (see DefaultShell). Commands are simple if
+// they use no shell features, such as pipes, redirection, variables, globs
+// or comments, in which case they are split into args as with ShellNone.
+// This avoids the overhead of starting bash for each of many small tasks.
+// Values are inserted as single args, as with NewFromArgs, so commands with
+// raw or join modifiers, decompressed in-ports or Go text/template patterns
+// are executed with the shell.
+const ShellAuto = "auto"
+
 // ----------- Main API init methods ------------
 
-func NewFromShell(name string, cmd string) *SciProcess {
-	if !LogExists {
-		InitLogAudit()
+// Create a process executing its commands directly, without a shell, given
+// the command as an argv slice, where each arg can contain placeholders.
+// Since no shell is involved, values are inserted as they are (without shell
+// quoting) and shell features such as redirection are not available.
+func NewFromArgs(name string, args ...string) *SciProcess {
+	initDefaultLog()
+	p := NewSciProcess(name, str.Join(args, " "))
+	p.CommandArgs = args
+	p.Shell = ShellNone
+	for _, arg := range args {
+		p.initPortsFromCmdPattern(arg, nil)
 	}
+	return p
+}
+
+func NewFromShell(name string, cmd string) *SciProcess {
+	initDefaultLog()
 	p := NewSciProcess(name, cmd)
 	p.initPortsFromCmdPattern(cmd, nil)
 	return p
@@ -85,11 +248,282 @@ func (p *SciProcess) SetPathReplace(inPortName string, outPortName string, old s
 	}
 }
 
+// Convenience method to create an (output) path formatter from a pattern with
+// placeholders for the paths of inputs, and the values of params and tags, as
+// in "{i:in|%.txt}.{p:word}.txt". Modifiers and defaults work as in command
+// patterns, except that values are not shell quoted.
+func (p *SciProcess) SetPathPattern(outPortName string, pattern string) {
+	p.PathFormatters[outPortName] = func(t *SciTask) string {
+		return t.formatPathPattern(pattern)
+	}
+}
+
+// Make the out-port outPortName output the custom target (see Target) that
+// targetFunc creates for each task, rather than a file at a formatted path.
+// The path formatter of the out-port is set to give the path of the target.
+func (p *SciProcess) SetOutTargetFunc(outPortName string, targetFunc func(*SciTask) Target) {
+	p.OutPortsTargetFunc[outPortName] = targetFunc
+	p.PathFormatters[outPortName] = func(t *SciTask) string {
+		return targetFunc(t).GetPath()
+	}
+}
+
+// Make the out-port outPortName produce a set of files, rather than a single
+// file. The path formatted for the out-port is then a directory, into which
+// the command should write its files, and the files matching the glob pattern
+// pattern in that directory are sent as one target.
+func (p *SciProcess) SetOutGlob(outPortName string, pattern string) {
+	p.OutPortsGlob[outPortName] = pattern
+}
+
+// Make the out-port outPortName gzip its output file when it is atomized.
+// The command writes its output uncompressed, while the final path of the
+// file gets a .gz extension added, if it does not already have one.
+func (p *SciProcess) SetOutCompress(outPortName string) {
+	p.OutPortsCompress[outPortName] = true
+}
+
+// Make the out-port outPortName write its temporary files to the directory
+// dir, rather than next to their final paths (see FileTarget.SetTempDir)
+func (p *SciProcess) SetOutTempDir(outPortName string, dir string) {
+	p.OutPortsTempDir[outPortName] = dir
+}
+
+// Check whether the out-port oname streams its outputs through FIFO files.
+// Since a FIFO file can only be read once, streaming out-ports connected to
+// several in-ports write their outputs to files instead (see NewTee).
+func (p *SciProcess) doesStream(oname string) bool {
+	if !p.OutPortsDoStream[oname] {
+		return false
+	}
+	return p.Out[oname] == nil || p.Out[oname].getConnectionCount() <= 1
+}
+
+// Get a function for PrependFunc, selecting the prepend string large for
+// tasks whose inputs are at least minSize bytes in total (see
+// SciTask.GetInSize), and small for the others, as in:
+//
+//	p.PrependFunc = PrependBySize(10<<30, "srun -c 16 --mem 64G", "")
+func PrependBySize(minSize int64, large string, small string) func(*SciTask) string {
+	return func(t *SciTask) string {
+		if t.GetInSize() >= minSize {
+			return large
+		}
+		return small
+	}
+}
+
+// Change the shell command pattern of the process to cmd, updating its
+// ports to match the placeholders of cmd. Ports are created for new
+// placeholders, and removed for placeholders no longer in the command,
+// unless they are connected, which is warned about, so that the ports of
+// the process can not drift apart from its command, as when setting
+// CommandPattern directly.
+func (p *SciProcess) SetCommand(cmd string) {
+	p.CommandPattern = cmd
+	p.CommandArgs = nil
+	p.updatePortsFromCommand()
+}
+
+// Change the command of the process to the argv slice args, executed
+// without a shell, as with NewFromArgs, updating its ports to match the
+// placeholders of args, as in SetCommand
+func (p *SciProcess) SetCommandArgs(args ...string) {
+	p.CommandPattern = str.Join(args, " ")
+	p.CommandArgs = args
+	p.Shell = ShellNone
+	p.updatePortsFromCommand()
+}
+
+// Create ports for the placeholders of the command of the process that
+// have none, and remove the unconnected ports of the placeholders that are
+// no longer in it
+func (p *SciProcess) updatePortsFromCommand() {
+	patterns := []string{p.CommandPattern}
+	if p.CommandArgs != nil {
+		patterns = p.CommandArgs
+	}
+	for _, pattern := range patterns {
+		p.initPortsFromCmdPattern(pattern, nil)
+	}
+	inNames, outNames, paramNames := make(map[string]bool), make(map[string]bool), make(map[string]bool)
+	streaming := make(map[string]bool)
+	for _, m := range p.findPlaceHolders() {
+		switch m[1] {
+		case "i":
+			inNames[m[2]] = true
+		case "o", "os":
+			outNames[m[2]] = true
+			streaming[m[2]] = streaming[m[2]] || m[1] == "os"
+		case "p":
+			paramNames[m[2]] = true
+		}
+	}
+	for name, inp := range p.In {
+		if inNames[name] {
+			continue
+		}
+		if inp.IsConnected() {
+			p.logStructured(LevelWarning, "Keeping in-port, which is no longer in the command, since it is connected", Fields{"in_port": name})
+			continue
+		}
+		delete(p.In, name)
+	}
+	for name, outp := range p.Out {
+		if outNames[name] {
+			p.OutPortsDoStream[name] = streaming[name]
+			continue
+		}
+		if outp.IsConnected() {
+			p.logStructured(LevelWarning, "Keeping out-port, which is no longer in the command, since it is connected", Fields{"out_port": name})
+			continue
+		}
+		delete(p.Out, name)
+		delete(p.OutPortsDoStream, name)
+	}
+	for name, pport := range p.ParamPorts {
+		if paramNames[name] {
+			continue
+		}
+		if pport.IsConnected() {
+			p.logStructured(LevelWarning, "Keeping param port, which is no longer in the command, since it is connected", Fields{"param_port": name})
+			continue
+		}
+		delete(p.ParamPorts, name)
+	}
+}
+
+// Get the number of cores used by each task of the process, which is 1 if not
+// declared
+func (p *SciProcess) getCores() int {
+	if p.Cores <= 0 {
+		return 1
+	}
+	return p.Cores
+}
+
+// Limit the rate at which tasks of the process start executing to perSecond
+// tasks per second, allowing bursts of up to burst tasks
+func (p *SciProcess) SetRateLimit(perSecond float64, burst int) {
+	p.RateLimit = perSecond
+	p.RateBurst = burst
+}
+
+// Get the shell used to execute the commands of the process, defaulting to
+// DefaultShell
+func (p *SciProcess) getShell() string {
+	if p.Shell == "" || p.Shell == ShellAuto {
+		return DefaultShell
+	}
+	return p.Shell
+}
+
+// Get the function quoting placeholder values for the shell of the process
+func (p *SciProcess) getShellQuoter() func(string) string {
+	return getShellQuoter(p.getShell())
+}
+
+// Get the context that the commands of the process are executed in, which
+// is cancelled when the workflow run is (see Workflow.Cancel)
+func (p *SciProcess) getContext() context.Context {
+	if p.ctx == nil {
+		return context.Background()
+	}
+	return p.ctx
+}
+
+// Get the argv pattern of the process, if its commands are executed without
+// a shell, or nil otherwise. With Shell set to ShellNone, or to ShellAuto
+// for a simple command, but no CommandArgs, the command pattern is split
+// into args (see splitCommandArgs).
+func (p *SciProcess) getCommandArgs() []string {
+	if p.CommandArgs != nil {
+		return p.CommandArgs
+	}
+	if p.Shell == ShellNone || (p.Shell == ShellAuto && p.isSimpleCommand()) {
+		args, err := splitCommandArgs(p.CommandPattern)
+		if err != nil {
+			return str.Fields(p.CommandPattern)
+		}
+		return args
+	}
+	return nil
+}
+
+// Check whether the command of the process can be executed without a shell
+// (see ShellAuto)
+func (p *SciProcess) isSimpleCommand() bool {
+	for _, decompress := range p.InPortsDecompress {
+		if decompress {
+			return false
+		}
+	}
+	if p.isTemplateCommand(p.CommandPattern) {
+		return false
+	}
+	for _, m := range getShellCommandPlaceHolderRegex().FindAllStringSubmatch(p.CommandPattern, -1) {
+		for _, mod := range splitPlaceHolderModifiers(m[3]) {
+			if mod == "raw" || str.HasPrefix(mod, "join:") {
+				return false
+			}
+		}
+	}
+	return isSimpleCommand(p.CommandPattern)
+}
+
+// Set the environment variable name to value for the commands of the
+// process, in addition to the inherited environment. The value can also be
+// inserted in the command with the {env:NAME} placeholder.
+func (p *SciProcess) SetEnv(name string, value string) {
+	p.Env[name] = value
+}
+
+// Make the in-port inPortName transparently decompress gzipped input files,
+// for tools that can not read gzipped files themselves. Without this, the
+// path of the .gz file is passed to the command, as is. Since the files are
+// decompressed with bash process substitution, as in <(gzip -dc in.gz), the
+// command must be executed with bash, which Validate checks.
+func (p *SciProcess) SetInDecompress(inPortName string) {
+	p.InPortsDecompress[inPortName] = true
+}
+
+// Make the in-port inPortName optional, so that it does not need to be
+// connected. Placeholders for a missing optional input must be marked
+// optional too, as in {i:regions|optional|flag:-L}, to be left out of the
+// command, and path formatters must not use it.
+func (p *SciProcess) SetInPortOptional(inPortName string) {
+	p.InPortsOptional[inPortName] = true
+}
+
+// Set a default file, at path, for the in-port inPortName, used by all
+// tasks if the in-port is not connected
+func (p *SciProcess) SetInPortDefault(inPortName string, path string) {
+	p.InPortsDefault[inPortName] = path
+}
+
+// Check whether the in-port inPortName is optional, or has a default file
+func (p *SciProcess) isInPortOptional(inPortName string) bool {
+	_, hasDefault := p.InPortsDefault[inPortName]
+	return p.InPortsOptional[inPortName] || hasDefault
+}
+
+// Get the in-ports that targets are received on, which excludes optional
+// in-ports (or with default files), that have not been given a channel
+func (p *SciProcess) getActiveInPorts() map[string]*InPort {
+	inPorts := make(map[string]*InPort)
+	for iname, inPort := range p.In {
+		if inPort.Chan == nil && p.isInPortOptional(iname) {
+			continue
+		}
+		inPorts[iname] = inPort
+	}
+	return inPorts
+}
+
 // ------- Helper methods for initialization -------
 
 func expandCommandParamsAndPaths(cmd string, params map[string]string, inPaths map[string]string, outPaths map[string]string) (cmdExpr string) {
 	r := getShellCommandPlaceHolderRegex()
-	ms := r.FindAllStringSubmatch(cmd, -1)
 	if params != nil {
 		Debug.Println("Params:", params)
 	}
@@ -99,41 +533,30 @@ func expandCommandParamsAndPaths(cmd string, params map[string]string, inPaths m
 	if outPaths != nil {
 		Debug.Println("outPaths:", outPaths)
 	}
-	cmdExpr = cmd
-	for _, m := range ms {
-		placeHolderStr := m[0]
+	// Replaced in one pass, so that placeholder text in the values is not
+	// replaced in turn
+	cmdExpr = r.ReplaceAllStringFunc(cmd, func(placeHolderStr string) string {
+		m := r.FindStringSubmatch(placeHolderStr)
 		typ := m[1]
 		name := m[2]
-		var filePath string
-		if typ == "p" {
-			if params != nil {
-				if val, ok := params[name]; ok {
-					Debug.Println("Found param:", val)
-					filePath = val
-					Debug.Println("Replacing:", placeHolderStr, "->", filePath)
-					cmdExpr = str.Replace(cmdExpr, placeHolderStr, filePath, -1)
-				}
-			}
-		} else if typ == "i" {
-			if inPaths != nil {
-				if val, ok := inPaths[name]; ok {
-					Debug.Println("Found inPath:", val)
-					filePath = val
-					Debug.Println("Replacing:", placeHolderStr, "->", filePath)
-					cmdExpr = str.Replace(cmdExpr, placeHolderStr, filePath, -1)
-				}
-			}
-		} else if typ == "o" || typ == "os" {
-			if outPaths != nil {
-				if val, ok := outPaths[name]; ok {
-					Debug.Println("Found outPath:", val)
-					filePath = val
-					Debug.Println("Replacing:", placeHolderStr, "->", filePath)
-					cmdExpr = str.Replace(cmdExpr, placeHolderStr, filePath, -1)
-				}
-			}
+		mods := splitPlaceHolderModifiers(m[3])
+		var vals map[string]string
+		switch typ {
+		case "p":
+			vals = params
+		case "i":
+			vals = inPaths
+		case "o", "os":
+			vals = outPaths
 		}
-	}
+		val, ok := vals[name]
+		if !ok {
+			return placeHolderStr
+		}
+		filePath := parsePlaceHolderModifiers(typ, mods).format(newPlaceHolderValue(val))
+		Debug.Println("Replacing:", placeHolderStr, "->", filePath)
+		return filePath
+	})
 	if cmd != cmdExpr {
 		Debug.Printf("Expanded command '%s' into '%s'\n", cmd, cmdExpr)
 	}
@@ -146,11 +569,26 @@ func expandCommandParamsAndPaths(cmd string, params map[string]string, inPaths m
 // `{o:PORTNAME}` specifies an out-port
 // `{os:PORTNAME}` specifies an out-port that streams via a FIFO file
 // `{p:PORTNAME}` a "parameter-port", which means a port where parameters can be "streamed"
+// `{t:TAGNAME}` is not a port, but is replaced by the value of a tag on the inputs
+// `{env:NAME}` is not a port, but is replaced by the value of an environment variable
+// `{task.name}`, `{task.id}`, `{task.index}` and `{task.scratch}` are replaced by the
+// name, ID, index (among the tasks of the process) and scratch directory of the task,
+// and `{task.cores}` and `{task.memory}` by the resources declared for the process
+// Names can be followed by path modifiers, like {i:reads|basename} (see ModifyPath).
+// List targets (see NewFileListTarget) can be joined with a custom separator, like
+// {i:bams|join:" -I "}. Params and tags can have default values, like {p:threads|4}
+// or {t:sample|default:none}, or be optional, like {p:threads|optional|flag:-t}, which leaves out both the flag
+// and the value if missing.
+// Ports are also set up for the corresponding functions ({{in "PORTNAME"}} etc)
+// in Go text/template command patterns.
 func (p *SciProcess) initPortsFromCmdPattern(cmd string, params map[string]string) {
 
 	// Find in/out port names and Params and set up in struct fields
 	r := getShellCommandPlaceHolderRegex()
 	ms := r.FindAllStringSubmatch(cmd, -1)
+	if p.isTemplateCommand(cmd) {
+		ms = append(ms, findTemplatePlaceHolders(cmd)...)
+	}
 
 	for _, m := range ms {
 		if len(m) < 3 {
@@ -159,8 +597,11 @@ func (p *SciProcess) initPortsFromCmdPattern(cmd string, params map[string]strin
 
 		typ := m[1]
 		name := m[2]
+		// Existing ports are kept, since they may be connected
 		if typ == "o" || typ == "os" {
-			p.Out[name] = NewOutPort()
+			if p.Out[name] == nil {
+				p.Out[name] = NewOutPort()
+			}
 			if typ == "os" {
 				p.OutPortsDoStream[name] = true
 			}
@@ -170,10 +611,18 @@ func (p *SciProcess) initPortsFromCmdPattern(cmd string, params map[string]strin
 			// It might be nice to have it init'ed with a channel
 			// anyways, for use cases when we want to send FileTargets
 			// on the inport manually.
-			p.In[name] = NewInPort()
+			if p.In[name] == nil {
+				p.In[name] = NewInPort()
+			}
 		} else if typ == "p" {
-			if params == nil || params[name] == "" {
+			if _, ok := params[name]; !ok && p.ParamPorts[name] == nil {
 				p.ParamPorts[name] = NewParamPort()
+				opts := parsePlaceHolderModifiers(typ, splitPlaceHolderModifiers(m[3]))
+				if opts.hasDefault {
+					p.SetParamDefault(name, opts.defaultVal)
+				} else if opts.optional {
+					p.SetParamOptional(name)
+				}
 			}
 		}
 	}
@@ -184,19 +633,19 @@ func (proc *SciProcess) IsConnected() (isConnected bool) {
 	isConnected = true
 	for portName, port := range proc.In {
 		if !port.IsConnected() {
-			Error.Printf("InPort %s of process %s is not connected - check your workflow code!\n", portName, proc.Name)
+			proc.logStructured(LevelError, "In-port is not connected - check your workflow code!", Fields{"in_port": portName})
 			isConnected = false
 		}
 	}
 	for portName, port := range proc.Out {
 		if !port.IsConnected() {
-			Error.Printf("OutPort %s of process %s is not connected - check your workflow code!\n", portName, proc.Name)
+			proc.logStructured(LevelError, "Out-port is not connected - check your workflow code!", Fields{"out_port": portName})
 			isConnected = false
 		}
 	}
 	for portName, port := range proc.ParamPorts {
-		if !port.IsConnected() {
-			Error.Printf("ParamPort %s of process %s is not connected - check your workflow code!\n", portName, proc.Name)
+		if !port.IsConnected() && !proc.isParamOptional(portName) {
+			proc.logStructured(LevelError, "Param port is not connected - check your workflow code!", Fields{"param_port": portName})
 			isConnected = false
 		}
 	}
@@ -212,57 +661,133 @@ func (proc *SciProcess) IsConnected() (isConnected bool) {
 // SciTask, not SciProcess.
 func (p *SciProcess) Run() {
 	defer p.closeOutPorts()
+	if p.scheduler == nil {
+		// Not run by a PipelineRunner with a limit, so only the limit of
+		// the process applies
+		p.scheduler = newScheduler(0)
+	}
 
-	tasks := []*SciTask{}
-	Debug.Printf("Process %s: Starting to create and schedule tasks\n", p.Name)
+	for _, oname := range sortedKeys(p.Out) {
+		if p.OutPortsDoStream[oname] && !p.doesStream(oname) {
+			p.logStructured(LevelWarning, "Writing the output of streaming out-port to files, since it is connected to several in-ports (use a Tee to stream to all of them)", Fields{"out_port": oname})
+		}
+	}
+
+	// Tasks are sent to the sender as they are created, and it sends their
+	// outputs as they finish, in order. Since the queue is bounded, task
+	// creation, and thereby the receiving of inputs, waits when too many
+	// tasks are in flight, so that memory use stays flat however many
+	// tasks the process has.
+	inFlight := make(chan *SciTask, p.getMaxInFlightTasks())
+	senderDone := make(chan struct{})
+	go p.sendTaskOutputs(inFlight, senderDone)
+
+	batch := []*SciTask{}
+	p.logStructured(LevelDebug, "Starting to create and schedule tasks", nil)
 	for t := range p.createTasks() {
-		// Collect created tasks, for the second round
-		// where tasks are waited for to finish, before
-		// sending their outputs.
-		Debug.Printf("Process %s: Instantiated task [%s] ...", p.Name, t.Command)
-		tasks = append(tasks, t)
-
-		anyPreviousFifosExists := t.anyFifosExist()
-		if !anyPreviousFifosExists {
-			Debug.Printf("Process %s: No FIFOs existed, so creating, for task [%s] ...", p.Name, t.Command)
+		t.logStructured(LevelDebug, "Instantiated task", Fields{"command": t.Command})
+		p.recordTaskCreated(t)
+
+		// In dry-run mode, and in partial runs where the process is not
+		// selected, nothing is done on the file system
+		touchesFiles := p.dryRunWriter == nil && p.partialRun == partialRunExecute
+		// Tasks with cached streams reuse any FIFOs left by earlier runs,
+		// since whether they replay the caches is only known once their
+		// inputs are hashed, when executed (see canReplayStreamCache)
+		anyPreviousFifosExists := touchesFiles && !t.hasStreamCache() && t.anyFifosExist()
+		if !anyPreviousFifosExists && touchesFiles {
+			t.logStructured(LevelDebug, "No FIFOs existed, so creating", nil)
 			t.createFifos()
 		}
 
 		// Sending FIFOs for the task
 		for oname, otgt := range t.OutTargets {
-			if otgt.doStream {
-				Debug.Printf("Process %s: Sending FIFO target on outport '%s' for task [%s] ...\n", p.Name, oname, t.Command)
+			if otgt.IsStreaming() {
+				t.logStructured(LevelDebug, "Sending FIFO target on out-port", Fields{"out_port": oname})
 				p.Out[oname].Chan <- otgt
 			}
 		}
 
-		if !anyPreviousFifosExists {
-			Debug.Printf("Process %s: Go-Executing task in separate go-routine: [%s] ...\n", p.Name, t.Command)
+		// Identical tasks, such as created for the same inputs arriving
+		// along several paths, are only executed once, since they would
+		// write the same outputs
+		var running *runningTask
+		if touchesFiles {
+			running = t.claimSignature()
+		}
+
+		if running != nil {
+			go t.executeDuplicate(running)
+		} else if !anyPreviousFifosExists && p.doesBatch(t) {
+			batch = append(batch, t)
+			if len(batch) == p.BatchSize {
+				go p.executeBatch(batch)
+				batch = []*SciTask{}
+			}
+		} else if !anyPreviousFifosExists {
+			t.logStructured(LevelDebug, "Go-executing task in separate go-routine", nil)
 			// Run the task
 			go t.Execute()
-			Debug.Printf("Process %s: Done go-executing task in go-routine: [%s] ...\n", p.Name, t.Command)
+			p.logStructured(LevelDebug, "Done go-executing task in go-routine", Fields{"task": t.Name, "task_index": t.Index})
 		} else {
 			// Since t.Execute() is not run, that normally sends the Done signal, we
 			// have to send it manually here:
-			go func() {
+			p.recordTaskSkipped(t, "since its outputs exist")
+			go func(t *SciTask) {
 				defer close(t.Done)
+				t.markInStreamsRead()
 				t.Done <- 1
-			}()
+			}(t)
 		}
+		inFlight <- t
+	}
+
+	if len(batch) > 0 {
+		go p.executeBatch(batch)
+	}
+	close(inFlight)
+	<-senderDone
+}
+
+// Get the number of tasks of the process that can be in flight (created,
+// but with outputs not yet sent), which is at least the batch size, since
+// batches are only executed when full
+func (p *SciProcess) getMaxInFlightTasks() int {
+	max := p.MaxInFlightTasks
+	if max <= 0 {
+		max = DefaultMaxInFlightTasks
+	}
+	if max < p.BatchSize {
+		max = p.BatchSize
 	}
+	if max < 1 {
+		max = 1
+	}
+	return max
+}
 
-	Debug.Printf("Process %s: Starting to loop over %d tasks to send out targets ...\n", p.Name, len(tasks))
-	for _, t := range tasks {
-		Debug.Printf("Process %s: Waiting for Done from task: [%s]\n", p.Name, t.Command)
+// Wait for the tasks received on tasks to finish, in order, and send the
+// outputs of those that succeeded, closing done when tasks is closed
+func (p *SciProcess) sendTaskOutputs(tasks chan *SciTask, done chan struct{}) {
+	defer close(done)
+	for t := range tasks {
+		// Logged as about the process, since the task is still executing
+		taskFields := Fields{"task": t.Name, "task_index": t.Index}
+		p.logStructured(LevelDebug, "Waiting for Done from task", taskFields)
 		<-t.Done
-		Debug.Printf("Process %s: Received Done from task: [%s]\n", p.Name, t.Command)
+		p.logStructured(LevelDebug, "Received Done from task", taskFields)
+		if t.err != nil {
+			// The outputs of failed tasks are missing, so are not sent
+			continue
+		}
 		for oname, otgt := range t.OutTargets {
-			if !otgt.doStream {
-				Debug.Printf("Process %s: Sending target on outport %s, for task [%s] ...\n", p.Name, oname, t.Command)
+			if !otgt.IsStreaming() {
+				p.logStructured(LevelDebug, "Sending target on out-port", Fields{"task": t.Name, "task_index": t.Index, "out_port": oname})
 				p.Out[oname].Chan <- otgt
-				Debug.Printf("Process %s: Done sending target on outport %s, for task [%s] ...\n", p.Name, oname, t.Command)
+				p.logStructured(LevelDebug, "Done sending target on out-port", Fields{"task": t.Name, "task_index": t.Index, "out_port": oname})
 			}
 		}
+		p.sendParamOuts(t)
 	}
 }
 
@@ -272,16 +797,22 @@ func (p *SciProcess) receiveInputs() (inTargets map[string]*FileTarget, inPortsO
 	inPortsOpen = true
 	inTargets = make(map[string]*FileTarget)
 	// Read input targets on in-ports and set up path mappings
-	for inpName, inPort := range p.In {
-		Debug.Printf("Process %s: Receieving on inPort %s ...", p.Name, inpName)
+	for inpName, inPort := range p.getActiveInPorts() {
+		p.logStructured(LevelDebug, "Receiving on in-port", Fields{"in_port": inpName})
 		inTarget, open := <-inPort.Chan
 		if !open {
 			inPortsOpen = false
 			continue
 		}
-		Debug.Printf("Process %s: Got inTarget %s ...", p.Name, inTarget.GetPath())
+		p.logStructured(LevelDebug, "Got in-target", Fields{"in_port": inpName, "path": inTarget.GetPath()})
 		inTargets[inpName] = inTarget
 	}
+	// Use default files for in-ports that are not connected
+	for inpName, path := range p.InPortsDefault {
+		if inPort := p.In[inpName]; inPort != nil && inPort.Chan == nil {
+			inTargets[inpName] = NewFileTarget(path)
+		}
+	}
 	return
 }
 
@@ -289,13 +820,13 @@ func (p *SciProcess) receiveParams() (params map[string]string, paramPortsOpen b
 	paramPortsOpen = true
 	params = make(map[string]string)
 	// Read input targets on in-ports and set up path mappings
-	for pname, pport := range p.ParamPorts {
+	for pname, pport := range p.getActiveParamPorts() {
 		pval, open := <-pport.Chan
 		if !open {
 			paramPortsOpen = false
 			continue
 		}
-		Debug.Println("Receiving param:", pname, "with value", pval)
+		p.logStructured(LevelDebug, "Receiving param", Fields{"param_port": pname, "value": pval})
 		params[pname] = pval
 	}
 	return
@@ -305,30 +836,35 @@ func (p *SciProcess) createTasks() (ch chan *SciTask) {
 	ch = make(chan *SciTask)
 	go func() {
 		defer close(ch)
+		taskIndex := 0
 		for {
 			inTargets, inPortsOpen := p.receiveInputs()
-			Debug.Printf("Process.createTasks:%s Got inTargets: %v", p.Name, inTargets)
 			params, paramPortsOpen := p.receiveParams()
-			Debug.Printf("Process.createTasks:%s Got params: %s", p.Name, params)
+			p.logStructured(LevelDebug, "Got params", Fields{"params": params})
 			if !inPortsOpen && !paramPortsOpen {
-				Debug.Printf("Process.createTasks:%s Breaking: Both inPorts and paramPorts closed", p.Name)
+				p.logStructured(LevelDebug, "Done creating tasks, since both in-ports and param ports are closed", nil)
 				break
 			}
-			if len(p.In) == 0 && !paramPortsOpen {
-				Debug.Printf("Process.createTasks:%s Breaking: No inports, and params closed", p.Name)
+			paramPorts := p.getActiveParamPorts()
+			inPorts := p.getActiveInPorts()
+			if len(inPorts) == 0 && !paramPortsOpen {
+				p.logStructured(LevelDebug, "Done creating tasks, since there are no in-ports, and param ports are closed", nil)
 				break
 			}
-			if len(p.ParamPorts) == 0 && !inPortsOpen {
-				Debug.Printf("Process.createTasks:%s Breaking: No params, and inPorts closed", p.Name)
+			if len(paramPorts) == 0 && !inPortsOpen {
+				p.logStructured(LevelDebug, "Done creating tasks, since there are no param ports, and in-ports are closed", nil)
 				break
 			}
-			t := NewSciTask(p.Name, p.CommandPattern, inTargets, p.PathFormatters, p.OutPortsDoStream, params, p.Prepend)
-			if p.CustomExecute != nil {
-				t.CustomExecute = p.CustomExecute
+			paramErr := p.applyParamSpecs(params)
+			t := newSciTaskFromProcess(p, inTargets, params, taskIndex)
+			if paramErr != nil {
+				// Fails the task, rather than the whole program
+				t.formatErr = paramErr
 			}
+			taskIndex++
 			ch <- t
-			if len(p.In) == 0 && len(p.ParamPorts) == 0 {
-				Debug.Printf("Process.createTasks:%s Breaking: No inports nor params", p.Name)
+			if len(inPorts) == 0 && len(paramPorts) == 0 {
+				p.logStructured(LevelDebug, "Done creating tasks, since there are no in-ports nor param ports", nil)
 				break
 			}
 		}
@@ -338,7 +874,13 @@ func (p *SciProcess) createTasks() (ch chan *SciTask) {
 
 func (p *SciProcess) closeOutPorts() {
 	for oname, oport := range p.Out {
-		Debug.Printf("Process %s: Closing port %s ...\n", p.Name, oname)
+		p.logStructured(LevelDebug, "Closing out-port", Fields{"out_port": oname})
 		oport.Close()
 	}
+	for pname, pport := range p.ParamOutPorts {
+		if pport.Chan != nil {
+			p.logStructured(LevelDebug, "Closing param out-port", Fields{"param_port": pname})
+			pport.Close()
+		}
+	}
 }
@@ -1,6 +1,12 @@
 package scipipe
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	str "strings"
+	"sync/atomic"
 	"testing"
 )
 
@@ -65,3 +71,526 @@ func TestSetPathReplace(t *testing.T) {
 		t.Error(`p.PathFormatters["bar"]() != "foo.bar.txt"`)
 	}
 }
+
+func TestSetCommand(t *testing.T) {
+	initTestLogs()
+
+	foo := NewFromShell("foo", "echo foo > {o:out}")
+	p := NewFromShell("p", "cat {i:in} {i:other} > {o:out} # {p:note}")
+	p.In["in"].Connect(foo.Out["out"])
+	inPort := p.In["in"]
+
+	p.SetCommand("gzip -c {i:in} > {os:out} # {p:level}")
+	if p.In["in"] != inPort {
+		t.Error(`p.In["in"] was replaced. want: the connected port kept`)
+	}
+	if p.In["other"] != nil {
+		t.Error(`p.In["other"] != nil. want: nil, since it is no longer in the command`)
+	}
+	if p.ParamPorts["note"] != nil || p.ParamPorts["level"] == nil {
+		t.Error(`param ports not updated. want: "level", not "note"`)
+	}
+	if !p.OutPortsDoStream["out"] {
+		t.Error(`p.OutPortsDoStream["out"] = false. want: true`)
+	}
+
+	// Connected ports are kept
+	p.SetCommandArgs("cp", "{p:level}", "{o:copy}")
+	if p.In["in"] == nil {
+		t.Error(`p.In["in"] = nil. want: not nil, since it is connected`)
+	}
+	if p.Out["out"] != nil || p.Out["copy"] == nil {
+		t.Error(`out-ports not updated. want: "copy", not "out"`)
+	}
+	if p.Shell != ShellNone {
+		t.Errorf(`p.Shell = %s. want: %s`, p.Shell, ShellNone)
+	}
+}
+
+func TestPrependFunc(t *testing.T) {
+	initTestLogs()
+
+	ioutil.WriteFile("/tmp/prepend_small.txt", []byte("foo\n"), 0644)
+	ioutil.WriteFile("/tmp/prepend_large.txt", []byte("foo bar baz foo bar baz\n"), 0644)
+	defer cleanFiles("/tmp/prepend_small.txt", "/tmp/prepend_large.txt")
+
+	p := NewFromShell("p", "cat {i:in} > {o:out}")
+	p.SetPathExtend("in", "out", ".out")
+	p.Cores = 16
+	p.PrependFunc = PrependBySize(10, "srun -c {task.cores}", "")
+
+	small := newSciTaskFromProcess(p, map[string]*FileTarget{"in": NewFileTarget("/tmp/prepend_small.txt")}, map[string]string{}, 0)
+	if small.Command != "cat /tmp/prepend_small.txt > /tmp/prepend_small.txt.out.tmp" {
+		t.Errorf("small.Command = %s. want: no prepend", small.Command)
+	}
+	large := newSciTaskFromProcess(p, map[string]*FileTarget{"in": NewFileTarget("/tmp/prepend_large.txt")}, map[string]string{}, 1)
+	if large.Command != "srun -c 16 cat /tmp/prepend_large.txt > /tmp/prepend_large.txt.out.tmp" {
+		t.Errorf("large.Command = %s. want: srun prepended", large.Command)
+	}
+
+	a := NewFromArgs("a", "cat", "{i:in}")
+	a.PrependFunc = PrependBySize(10, "nice -n 10", "")
+	args := newSciTaskFromProcess(a, map[string]*FileTarget{"in": NewFileTarget("/tmp/prepend_large.txt")}, map[string]string{}, 0).Args
+	if len(args) != 5 || args[0] != "nice" {
+		t.Errorf("args = %v. want: nice prepended", args)
+	}
+}
+
+func TestShellAuto(t *testing.T) {
+	initTestLogs()
+
+	for cmd, exp := range map[string][]string{
+		"cp {i:in} {o:out}":                  {"cp", "{i:in}", "{o:out}"},
+		`grep -c "a b" 'c d' {i:in}`:         {"grep", "-c", "a b", "c d", "{i:in}"},
+		"sort -T {task.scratch} {os:out}":    {"sort", "-T", "{task.scratch}", "{os:out}"},
+		"cat {i:in} > {o:out}":               nil,
+		"cat {i:in} | wc -l":                 nil,
+		"echo $HOME {o:out}":                 nil,
+		"ls *.txt {o:out}":                   nil,
+		"FOO=bar env {o:out}":                nil,
+		`echo "a $b" {o:out}`:                nil,
+		`echo 'a {o:out}`:                    nil,
+		"echo {p:extra|raw} {o:out}":         nil,
+		`merge {i:bams|join:" -I "} {o:out}`: nil,
+	} {
+		p := NewFromShell("p", cmd)
+		p.Shell = ShellAuto
+		args := p.getCommandArgs()
+		if len(args) != len(exp) {
+			t.Errorf("args of %s = %q. want: %q", cmd, args, exp)
+			continue
+		}
+		for i := range args {
+			if args[i] != exp[i] {
+				t.Errorf("args of %s = %q. want: %q", cmd, args, exp)
+			}
+		}
+	}
+
+	p := NewFromShell("p", "gzip -c {i:in} {o:out}")
+	p.Shell = ShellAuto
+	p.SetInDecompress("in")
+	if p.getCommandArgs() != nil {
+		t.Error("args of command with decompressed in-port != nil. want: nil")
+	}
+	if p.getShell() != "bash" {
+		t.Errorf("p.getShell() = %s. want: bash", p.getShell())
+	}
+}
+
+func TestDecompressShells(t *testing.T) {
+	initTestLogs()
+
+	// Inputs are decompressed with bash process substitution, which other
+	// shells, and commands executed without a shell, can not do
+	for shell, ok := range map[string]bool{"bash": true, "/bin/bash": true, "sh": false, "cmd": false, "powershell": false, ShellNone: false} {
+		p := NewFromShell("p", "cat {i:in} > {o:out}")
+		p.Shell = shell
+		p.SetPathStatic("out", "/tmp/decompress_shells.txt")
+		p.SetInDecompress("in")
+		problems := []string{}
+		for _, problem := range p.validate() {
+			if str.Contains(problem, "decompresses") {
+				problems = append(problems, problem)
+			}
+		}
+		if ok && len(problems) > 0 {
+			t.Errorf("Validation problems for decompressed in-port with shell %s: %v", shell, problems)
+		} else if !ok && len(problems) == 0 {
+			t.Errorf("No validation problem for decompressed in-port with shell %s", shell)
+		}
+	}
+
+	src := NewFileQueue("/tmp/decompress_shells.txt.gz")
+	p := NewFromShell("p", "cat {i:in} > {o:out}")
+	p.Shell = "sh"
+	p.SetInDecompress("in")
+	p.SetPathStatic("out", "/tmp/decompress_shells.txt")
+	p.In["in"].Connect(src.Out)
+	snk := NewSink()
+	snk.Connect(p.Out["out"])
+	wf := NewWorkflow("decompress_shells")
+	wf.AddProcesses(src, p, snk)
+	if err := wf.Run(); err == nil || !str.Contains(err.Error(), "decompresses") {
+		t.Errorf("Workflow with decompressed in-port in sh command not rejected: %v", err)
+	}
+}
+
+func TestMaxInFlightTasks(t *testing.T) {
+	initTestLogs()
+
+	// The number of tasks created, counted as their outputs are formatted
+	var created int32
+	p := NewFromShell("p", "echo {i:in} > {o:out}")
+	p.PathFormatters["out"] = func(task *SciTask) string {
+		atomic.AddInt32(&created, 1)
+		return "/tmp/inflight_" + task.InTargets["in"].GetValueString() + ".txt"
+	}
+	p.MaxInFlightTasks = 2
+	in := make(chan *FileTarget)
+	p.In["in"].Chan = in
+	p.Out["out"].Chan = make(chan *FileTarget)
+
+	go func() {
+		for i := 0; i < 20; i++ {
+			in <- NewInMemoryTarget(fmt.Sprintf("%d", i))
+		}
+		close(in)
+	}()
+	go p.Run()
+
+	// Outputs are received slowly, so that tasks would pile up, if not
+	// bounded. Ahead of the outputs received are at most the tasks in
+	// flight, and those held while waiting to be sent, queued and handed
+	// over by createTasks.
+	received := 0
+	maxAhead := int32(0)
+	for otgt := range p.Out["out"].Chan {
+		if otgt.GetPath() != fmt.Sprintf("/tmp/inflight_%d.txt", received) {
+			t.Errorf("Output %d = %s. want: outputs in order of inputs", received, otgt.GetPath())
+		}
+		received++
+		for i := 0; i < 100; i++ {
+			runtime.Gosched()
+		}
+		if ahead := atomic.LoadInt32(&created) - int32(received); ahead > maxAhead {
+			maxAhead = ahead
+		}
+		cleanFiles(otgt.GetPath(), otgt.GetAuditFilePath())
+	}
+	if received != 20 {
+		t.Errorf("received = %d. want: 20", received)
+	}
+	if maxAhead > 5 {
+		t.Errorf("Process created %d tasks ahead of the outputs received. want: at most 5", maxAhead)
+	}
+}
+
+func TestStrictMode(t *testing.T) {
+	p := NewFromShell("strict", "echo {p:msg} {p:opts|raw} > {o:out}")
+	p.Strict = true
+	p.SetPathStatic("out", "/tmp/strict.txt")
+
+	tk := newSciTaskFromProcess(p, map[string]*FileTarget{}, map[string]string{"msg": "hello world", "opts": "-n"}, 0)
+	if tk.Command != "echo 'hello world' -n > /tmp/strict.txt.tmp" {
+		t.Errorf("Wrong command for safe values: %s", tk.Command)
+	}
+
+	tk = newSciTaskFromProcess(p, map[string]*FileTarget{}, map[string]string{"msg": "hi", "opts": "-n; rm -rf ~"}, 0)
+	if tk.formatErr == nil {
+		t.Error("No error for value with shell metacharacters in strict mode")
+	}
+
+	// Values are only allowed for the type of placeholder given
+	p.AllowUnsafeValues("i:opts")
+	tk = newSciTaskFromProcess(p, map[string]*FileTarget{}, map[string]string{"msg": "hi", "opts": "-n -e 'a\\tb'"}, 0)
+	if tk.formatErr == nil {
+		t.Error("No error for unsafe param value allowed for an in-port")
+	}
+	p.AllowUnsafeValues("p:opts")
+	tk = newSciTaskFromProcess(p, map[string]*FileTarget{}, map[string]string{"msg": "hi", "opts": "-n -e 'a\\tb'"}, 0)
+	if tk.formatErr != nil || tk.Command != "echo hi -n -e 'a\\tb' > /tmp/strict.txt.tmp" {
+		t.Errorf("Wrong command for allowed unsafe value: %s (%v)", tk.Command, tk.formatErr)
+	}
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Error("No panic for unsafe value allowed without placeholder type")
+			}
+		}()
+		p.AllowUnsafeValues("opts")
+	}()
+}
+
+func TestStrictModeFailsTask(t *testing.T) {
+	initTestLogs()
+	defer cleanFiles("/tmp/strict_safe.txt", "/tmp/strict_safe.txt.audit.json", "/tmp/strict_pwned.txt")
+
+	// The task with an unsafe value fails, without executing its command,
+	// while the other tasks of the process run
+	msgs := NewParamPort()
+	p := NewFromShell("strict", "echo {p:msg} > {o:out}")
+	p.PathFormatters["out"] = func(task *SciTask) string {
+		if task.Params["msg"] == "safe" {
+			return "/tmp/strict_safe.txt"
+		}
+		return "/tmp/strict_unsafe.txt"
+	}
+	p.ParamPorts["msg"].Connect(msgs)
+	wf := NewWorkflow("strict")
+	wf.Strict = true
+	wf.AddProcesses(p, NewSink())
+	wf.Connect("strict.out", "sink.in")
+	go func() {
+		defer msgs.Close()
+		msgs.Chan <- "safe"
+		msgs.Chan <- "x; touch /tmp/strict_pwned.txt"
+	}()
+	if err := wf.Run(); err == nil {
+		t.Error("No error for workflow with unsafe value in strict mode")
+	}
+	if _, err := os.Stat("/tmp/strict_pwned.txt"); !os.IsNotExist(err) {
+		t.Error("Command with unsafe value executed in strict mode")
+	}
+	if dat, err := ioutil.ReadFile("/tmp/strict_safe.txt"); err != nil || string(dat) != "safe\n" {
+		t.Errorf("Task with safe value not executed: %q (%v)", dat, err)
+	}
+}
+
+func TestStrictModeTemplate(t *testing.T) {
+	initTestLogs()
+
+	p := NewFromTemplate("tpl", `echo {{param "msg"}} {{.Params.msg}} {{$.InTargets.in.GetPath}} > {{out "out"}}`)
+	p.Strict = true
+	problems := p.validateStrictMode()
+	if len(problems) != 2 {
+		t.Errorf("Wrong problems for fields of task in template command in strict mode: %q", problems)
+	}
+
+	// Values inserted with placeholder functions are checked
+	p = NewFromTemplate("tpl", `echo {{param "msg"}} > {{out "out"}}`)
+	p.Strict = true
+	p.SetPathStatic("out", "/tmp/strict_tpl.txt")
+	if problems := p.validateStrictMode(); len(problems) != 0 {
+		t.Errorf("Problems for template command with only placeholder functions: %q", problems)
+	}
+	tk := newSciTaskFromProcess(p, map[string]*FileTarget{}, map[string]string{"msg": "$(id)"}, 0)
+	if tk.formatErr == nil {
+		t.Error("No error for unsafe value of placeholder function in strict mode")
+	}
+}
+
+func TestOutputPermissions(t *testing.T) {
+	initTestLogs()
+	p := NewFromShell("write", "mkdir {o:dir} && echo hi > {o:dir}/a.txt && echo hi > {o:file}")
+	p.SetPathStatic("dir", "/tmp/perms_dir")
+	p.SetPathStatic("file", "/tmp/perms_file.txt")
+	p.OutputMode = 0660
+	snk := NewSink()
+	snk.Connect(p.Out["dir"])
+	snk.Connect(p.Out["file"])
+
+	wf := NewWorkflow("perms")
+	wf.OutputMode = 0640
+	wf.AddProcesses(p, snk)
+	if err := wf.Run(); err != nil {
+		t.Fatal(err)
+	}
+	defer cleanFiles("/tmp/perms_dir", "/tmp/perms_file.txt")
+	defer os.RemoveAll("/tmp/perms_dir")
+
+	for path, want := range map[string]os.FileMode{
+		"/tmp/perms_file.txt":            0660,
+		"/tmp/perms_file.txt.audit.json": 0660,
+		"/tmp/perms_dir":                 0770,
+		"/tmp/perms_dir/a.txt":           0660,
+	} {
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode().Perm() != want {
+			t.Errorf("Mode of %s = %o, want %o", path, fi.Mode().Perm(), want)
+		}
+	}
+}
+
+func TestStdio(t *testing.T) {
+	initTestLogs()
+	ioutil.WriteFile("/tmp/stdio_in.txt", []byte("b\na\n"), 0644)
+	defer cleanFiles("/tmp/stdio_in.txt", "/tmp/stdio_in.txt.shell.sorted", "/tmp/stdio_in.txt.args.sorted")
+
+	shell := NewFromShell("shell", "sort")
+	shell.SetStdin("in")
+	shell.SetStdout("out")
+	shell.SetPathExtend("in", "out", ".shell.sorted")
+	args := NewFromArgs("args", "sort")
+	args.SetStdin("in")
+	args.SetStdout("out")
+	args.SetPathExtend("in", "out", ".args.sorted")
+
+	tk := newSciTaskFromProcess(shell, map[string]*FileTarget{"in": NewFileTarget("/tmp/stdio_in.txt")}, map[string]string{}, 0)
+	if tk.Command != "sort < /tmp/stdio_in.txt > /tmp/stdio_in.txt.shell.sorted.tmp" {
+		t.Errorf("Wrong command with stdin and stdout: %s", tk.Command)
+	}
+
+	shellSrc := NewFileQueue("/tmp/stdio_in.txt")
+	argsSrc := NewFileQueue("/tmp/stdio_in.txt")
+	snk := NewSink()
+	shell.In["in"].Connect(shellSrc.Out)
+	args.In["in"].Connect(argsSrc.Out)
+	snk.Connect(shell.Out["out"])
+	snk.Connect(args.Out["out"])
+	wf := NewWorkflow("stdio")
+	wf.AddProcesses(shellSrc, argsSrc, shell, args, snk)
+	if err := wf.Run(); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/tmp/stdio_in.txt.shell.sorted", "/tmp/stdio_in.txt.args.sorted"} {
+		dat, err := ioutil.ReadFile(path)
+		if err != nil || string(dat) != "a\nb\n" {
+			t.Errorf("Wrong sorted output in %s: %q (%v)", path, dat, err)
+		}
+	}
+}
+
+func TestDuplicateTasks(t *testing.T) {
+	initTestLogs()
+	ioutil.WriteFile("/tmp/dedup_in.txt", []byte("foo\n"), 0644)
+	defer cleanFiles("/tmp/dedup_in.txt", "/tmp/dedup_in.txt.out", "/tmp/dedup_count.txt")
+
+	// The same task is created by two processes, for the same output, and
+	// twice by one of them
+	once := NewFileQueue("/tmp/dedup_in.txt")
+	twice := NewFileQueue("/tmp/dedup_in.txt", "/tmp/dedup_in.txt")
+	snk := NewSink()
+	wf := NewWorkflow("dedup")
+	wf.AddProcesses(once, twice, snk)
+	for i, src := range []*FileQueue{once, twice} {
+		p := NewFromShell(fmt.Sprintf("copy%d", i), "echo x >> /tmp/dedup_count.txt && sleep 0.2 && cat {i:in} > {o:out}")
+		p.SetPathExtend("in", "out", ".out")
+		p.In["in"].Connect(src.Out)
+		snk.Connect(p.Out["out"])
+		wf.AddProcess(p)
+	}
+	if err := wf.Run(); err != nil {
+		t.Fatal(err)
+	}
+	dat, err := ioutil.ReadFile("/tmp/dedup_count.txt")
+	if err != nil || string(dat) != "x\n" {
+		t.Errorf("Command of identical tasks not executed once: %q (%v)", dat, err)
+	}
+	if total := wf.GetStats().GetTotal(); total.TasksExecuted != 1 || total.TasksSkipped != 2 {
+		t.Errorf("Wrong number of executed (%d) and skipped (%d) tasks", total.TasksExecuted, total.TasksSkipped)
+	}
+}
+
+func TestMockExecutor(t *testing.T) {
+	initTestLogs()
+	ioutil.WriteFile("/tmp/mock_in.txt", []byte("reads\n"), 0644)
+	defer cleanFiles("/tmp/mock_in.txt", "/tmp/mock_in.txt.bam", "/tmp/mock_in.txt.bam.vcf")
+
+	src := NewFileQueue("/tmp/mock_in.txt")
+	align := NewFromShell("align", "no-such-aligner {i:reads} > {os:bam}")
+	align.SetPathExtend("reads", "bam", ".bam")
+	call := NewFromShell("call", "no-such-caller {i:bam} > {o:vcf}")
+	call.SetPathExtend("bam", "vcf", ".vcf")
+	snk := NewSink()
+	align.In["reads"].Connect(src.Out)
+	call.In["bam"].Connect(align.Out["bam"])
+	snk.Connect(call.Out["vcf"])
+
+	mock := NewMockExecutor()
+	mock.SetTemplate("call", "vcf", "variants of {i:bam|basename}")
+	wf := NewWorkflow("mock")
+	wf.Mock = mock
+	wf.AddProcesses(src, align, call, snk)
+	if err := wf.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if cmds := mock.GetCommandsOf("align"); len(cmds) != 1 || cmds[0] != "no-such-aligner /tmp/mock_in.txt > /tmp/mock_in.txt.bam.tmp" {
+		t.Errorf("Wrong commands recorded for align: %v", cmds)
+	}
+	if cmds := mock.GetCommands(); len(cmds) != 2 || cmds[1].Outputs["vcf"] != "/tmp/mock_in.txt.bam.vcf" {
+		t.Errorf("Wrong commands recorded: %v", cmds)
+	}
+	if dat, err := ioutil.ReadFile("/tmp/mock_in.txt.bam"); err != nil || len(dat) != 0 {
+		t.Errorf("Streamed output not fabricated as an empty file: %q (%v)", dat, err)
+	}
+	if dat, err := ioutil.ReadFile("/tmp/mock_in.txt.bam.vcf"); err != nil || string(dat) != "variants of mock_in.txt.bam" {
+		t.Errorf("Wrong templated output: %q (%v)", dat, err)
+	}
+}
+
+func TestToolEnv(t *testing.T) {
+	initTestLogs()
+	os.MkdirAll("/tmp/toolenv_venv/bin", 0777)
+	ioutil.WriteFile("/tmp/toolenv_venv/bin/activate", []byte("export TOOLENV_GREETING=activated\n"), 0644)
+	defer os.RemoveAll("/tmp/toolenv_venv")
+	defer cleanFiles("/tmp/toolenv_out.txt")
+
+	p := NewFromShell("greet", "echo $TOOLENV_GREETING > {o:out}")
+	p.SetPathStatic("out", "/tmp/toolenv_out.txt")
+	p.Prepend = "nice"
+	p.UseModules("samtools/1.9")
+	p.UseConda("my env")
+	tk := newSciTaskFromProcess(p, map[string]*FileTarget{}, map[string]string{}, 0)
+	want := "module load samtools/1.9 && eval \"$(conda shell.posix hook)\" && conda activate 'my env' || exit 1\nnice echo $TOOLENV_GREETING > /tmp/toolenv_out.txt.tmp"
+	if tk.Command != want {
+		t.Errorf("Wrong command with tool environment:\n%s\nwant:\n%s", tk.Command, want)
+	}
+	if tk.AuditInfo.ToolEnv == nil || tk.AuditInfo.ToolEnv.Conda != "my env" {
+		t.Errorf("Tool environment not recorded in audit info: %v", tk.AuditInfo.ToolEnv)
+	}
+
+	p.ToolEnv = ToolEnv{}
+	p.UseVenv("/tmp/toolenv_venv")
+	snk := NewSink()
+	snk.Connect(p.Out["out"])
+	wf := NewWorkflow("toolenv")
+	wf.AddProcesses(p, snk)
+	if err := wf.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if dat, err := ioutil.ReadFile("/tmp/toolenv_out.txt"); err != nil || string(dat) != "activated\n" {
+		t.Errorf("Command not run in the activated environment: %q (%v)", dat, err)
+	}
+	ai, err := NewAuditInfoFromFile("/tmp/toolenv_out.txt.audit.json")
+	if err != nil || ai.ToolEnv == nil || ai.ToolEnv.Venv != "/tmp/toolenv_venv" {
+		t.Errorf("Tool environment not recorded in audit file: %v (%v)", ai, err)
+	}
+
+	args := NewFromArgs("args", "echo", "hi")
+	args.UseVenv("/tmp/toolenv_venv")
+	if len(args.validate()) == 0 {
+		t.Error("No validation problem for tool environment of command without shell")
+	}
+}
+
+func TestToolEnvActivationFails(t *testing.T) {
+	initTestLogs()
+	defer cleanFiles("/tmp/toolenv_fail_a.txt", "/tmp/toolenv_fail_b.txt", "/tmp/toolenv_fail_b.txt.tmp")
+
+	// No part of a compound command is executed if the activation fails
+	p := NewFromShell("compound", "echo a > /tmp/toolenv_fail_a.txt; echo b > {o:out}")
+	p.SetPathStatic("out", "/tmp/toolenv_fail_b.txt")
+	p.UseVenv("/tmp/toolenv_missing_venv")
+	wf := NewWorkflow("toolenv_fail")
+	wf.AddProcesses(p, NewSink())
+	wf.Connect("compound.out", "sink.in")
+	if err := wf.Run(); err == nil {
+		t.Error("No error for failing activation of tool environment")
+	}
+	for _, path := range []string{"/tmp/toolenv_fail_a.txt", "/tmp/toolenv_fail_b.txt"} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Command executed without its tool environment, writing %s", path)
+		}
+	}
+}
+
+func TestShellNoneQuotes(t *testing.T) {
+	initTestLogs()
+
+	for cmd, exp := range map[string][]string{
+		"cp {i:in} {o:out}":             {"cp", "{i:in}", "{o:out}"},
+		`grep -c 'a b' "c d" {o:out}`:   {"grep", "-c", "a b", "c d", "{o:out}"},
+		`echo x'y z' {o:out}`:           {"echo", "xy z", "{o:out}"},
+		`echo '' {o:out}`:               {"echo", "", "{o:out}"},
+		`echo 'a b {o:out}`:             {"echo", "'a", "b", "{o:out}"},
+		`cat {i:bams|join:" "} {o:out}`: {"cat", `{i:bams|join:" "}`, "{o:out}"},
+	} {
+		p := NewFromShell("p", cmd)
+		p.Shell = ShellNone
+		args := p.getCommandArgs()
+		if len(args) != len(exp) {
+			t.Errorf("args of %s = %q. want: %q", cmd, args, exp)
+			continue
+		}
+		for i := range args {
+			if args[i] != exp[i] {
+				t.Errorf("args of %s = %q. want: %q", cmd, args, exp)
+			}
+		}
+	}
+}
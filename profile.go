@@ -0,0 +1,123 @@
+package scipipe
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// ======= Resource profiling ========
+
+// ResourceUsage is the resources used by the command of a task, as reported
+// by the operating system when the command exits, as with time -v. It
+// includes the resources used by the processes started by the command, such
+// as those of a shell pipeline, that the command waited for. The peak
+// memory is that of the largest of these processes. Only CPU times are
+// available on Windows.
+type ResourceUsage struct {
+	UserCPUTime   time.Duration
+	SystemCPUTime time.Duration
+	// The peak resident set size, in kilobytes
+	MaxRSSKB int64
+	// The bytes read from, and written to, disk (not counting data read
+	// from, or written to, the page cache)
+	ReadBytes    int64
+	WrittenBytes int64
+}
+
+// Get the total CPU time used
+func (ru *ResourceUsage) GetCPUTime() time.Duration {
+	return ru.UserCPUTime + ru.SystemCPUTime
+}
+
+// Set up all SciProcesses of the pipeline to profile the resources used by
+// their commands, if Profile is set
+func (pl *PipelineRunner) setUpProfiling() {
+	if !pl.Profile {
+		return
+	}
+	for _, proc := range flattenProcesses(pl.processes) {
+		if sp, ok := proc.(*SciProcess); ok {
+			sp.Profile = true
+		}
+	}
+}
+
+// ProcessResources is the resources used by the profiled tasks of a
+// process, in a run of a workflow (see Workflow.GetResourceReport), for
+// choosing the resources to declare, or request from a cluster, for it
+type ProcessResources struct {
+	Name  string
+	Tasks int
+	// The peak and mean of the peak memory of the tasks, in kilobytes
+	MaxRSSKB  int64
+	MeanRSSKB int64
+	// The peak and mean of the number of cores used by the tasks, on
+	// average over their lifetime, as the CPU time per wall time
+	MaxCores  float64
+	MeanCores float64
+	// The total CPU and wall time of the tasks
+	CPUTime  time.Duration
+	WallTime time.Duration
+	// The total bytes read from, and written to, disk by the tasks
+	ReadBytes    int64
+	WrittenBytes int64
+}
+
+// Get the resources used by the tasks of each process, sorted by process
+// name, for the tasks executed with Profile set, in the run of the workflow
+func (wf *Workflow) GetResourceReport() []ProcessResources {
+	byName := make(map[string]*ProcessResources)
+	for _, tr := range wf.GetTaskRecords() {
+		ru := tr.Resources
+		if ru == nil || !tr.Succeeded {
+			continue
+		}
+		pr := byName[tr.Name]
+		if pr == nil {
+			pr = &ProcessResources{Name: tr.Name}
+			byName[tr.Name] = pr
+		}
+		wall := tr.FinishTime.Sub(tr.StartTime)
+		pr.Tasks++
+		pr.CPUTime += ru.GetCPUTime()
+		pr.WallTime += wall
+		pr.ReadBytes += ru.ReadBytes
+		pr.WrittenBytes += ru.WrittenBytes
+		pr.MeanRSSKB += ru.MaxRSSKB
+		if ru.MaxRSSKB > pr.MaxRSSKB {
+			pr.MaxRSSKB = ru.MaxRSSKB
+		}
+		if wall > 0 {
+			if cores := ru.GetCPUTime().Seconds() / wall.Seconds(); cores > pr.MaxCores {
+				pr.MaxCores = cores
+			}
+		}
+	}
+	report := []ProcessResources{}
+	for _, pr := range byName {
+		pr.MeanRSSKB /= int64(pr.Tasks)
+		if pr.WallTime > 0 {
+			pr.MeanCores = pr.CPUTime.Seconds() / pr.WallTime.Seconds()
+		}
+		report = append(report, *pr)
+	}
+	sort.Slice(report, func(i, j int) bool { return report[i].Name < report[j].Name })
+	return report
+}
+
+// Write the resources used by the tasks of each process (see
+// GetResourceReport) to w, as a table
+func (wf *Workflow) WriteResourceReport(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROCESS\tTASKS\tMAX MEM (MB)\tMEAN MEM (MB)\tMAX CORES\tMEAN CORES\tCPU TIME\tREAD (MB)\tWRITTEN (MB)")
+	for _, pr := range wf.GetResourceReport() {
+		fmt.Fprintf(tw, "%s\t%d\t%.1f\t%.1f\t%.2f\t%.2f\t%s\t%.1f\t%.1f\n",
+			pr.Name, pr.Tasks, float64(pr.MaxRSSKB)/1024, float64(pr.MeanRSSKB)/1024,
+			pr.MaxCores, pr.MeanCores, pr.CPUTime.Round(time.Millisecond),
+			float64(pr.ReadBytes)/(1<<20), float64(pr.WrittenBytes)/(1<<20))
+	}
+	return tw.Flush()
+}
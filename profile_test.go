@@ -0,0 +1,69 @@
+package scipipe
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	t "testing"
+)
+
+func TestProfile(t *t.T) {
+	initTestLogs()
+
+	wf := NewWorkflow("wf")
+	wf.Profile = true
+	// Keep about 50 MB in a shell variable
+	mem := NewFromShell("mem", "x=$(head -c 50000000 /dev/zero | tr '\\0' a); echo done > {o:out}")
+	mem.SetPathStatic("out", "/tmp/profile_mem.txt")
+	wf.AddProcesses(mem, NewSink())
+	wf.Connect("mem.out", "sink.in")
+	assert.Nil(t, wf.Run())
+
+	ru := NewFileTarget("/tmp/profile_mem.txt").GetAuditInfo().Resources
+	assert.NotNil(t, ru)
+	assert.True(t, ru.MaxRSSKB >= 50<<10, "MaxRSSKB = %d. want: at least 50 MB", ru.MaxRSSKB)
+
+	report := wf.GetResourceReport()
+	assert.Len(t, report, 1)
+	assert.EqualValues(t, "mem", report[0].Name)
+	assert.EqualValues(t, 1, report[0].Tasks)
+	assert.EqualValues(t, ru.MaxRSSKB, report[0].MaxRSSKB)
+	buf := new(bytes.Buffer)
+	assert.Nil(t, wf.WriteResourceReport(buf))
+	assert.Contains(t, buf.String(), "PROCESS")
+	assert.Contains(t, buf.String(), "mem ")
+
+	cleanFiles("/tmp/profile_mem.txt", "/tmp/profile_mem.txt.audit.json")
+}
+
+func TestProfileBatch(t *t.T) {
+	initTestLogs()
+
+	wf := NewWorkflow("wf")
+	wf.Profile = true
+	paths := []string{"/tmp/profile_batch_1.txt", "/tmp/profile_batch_2.txt", "/tmp/profile_batch_3.txt"}
+	fq := NewFileQueue(paths...)
+	bat := NewFromShell("bat", "echo $$ {i:in} > {o:out}")
+	bat.SetPathExtend("in", "out", ".pid")
+	bat.BatchSize = 3
+	bat.In["in"].Connect(fq.Out)
+	snk := NewSink()
+	snk.Connect(bat.Out["out"])
+	wf.AddProcesses(fq, bat, snk)
+	assert.Nil(t, wf.Run())
+
+	// Profiled tasks are executed on their own, each with its resources
+	pids := map[string]bool{}
+	for _, path := range paths {
+		tgt := NewFileTarget(path + ".pid")
+		pids[string(tgt.Read())] = true
+		assert.NotNil(t, tgt.GetAuditInfo().Resources)
+	}
+	assert.Len(t, pids, 3)
+	report := wf.GetResourceReport()
+	assert.Len(t, report, 1)
+	assert.EqualValues(t, 3, report[0].Tasks)
+
+	for _, path := range paths {
+		cleanFiles(path+".pid", path+".pid.audit.json")
+	}
+}
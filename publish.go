@@ -0,0 +1,295 @@
+package scipipe
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	re "regexp"
+	"sort"
+	str "strings"
+	"time"
+)
+
+// ======= Publisher ========
+
+// PublishMode decides how the Publisher puts results in place
+type PublishMode int
+
+const (
+	// Results are copied, so that the outputs of the workflow stay in place
+	// (the default)
+	PublishCopy PublishMode = iota
+	// Results are moved, separating them from intermediate outputs. Since
+	// the outputs are then gone, the tasks producing them are run again on
+	// reruns, and their new outputs replace the published results.
+	PublishMove
+	// Results are hardlinked, falling back to copying when hardlinking is not
+	// possible (e.g. across file systems)
+	PublishHardlink
+)
+
+// Publisher is a component that publishes the targets received on its
+// In-port, as the final results of the workflow, into the results directory
+// Dir, at paths formatted from PathPattern, so that deliverables are kept
+// apart from intermediate outputs. The audit file of each result is
+// published along with it. Results that are already published are left as
+// they are, unless the outputs they were published from have changed since,
+// in size or modification time, when they are replaced. If Manifest is set,
+// an index of the published results (see PublishedResult) is written, as
+// JSON, to the file with that name in Dir. Results that can not be
+// published, such as two results formatted to the same path, make the
+// workflow run fail.
+type Publisher struct {
+	Process
+	Name string
+	In   *InPort
+	Dir  string
+	// The pattern of the paths of the results, relative to Dir, with the
+	// placeholders {t:TAG} and {p:PARAM} for the tags and params of a result
+	// (as set for the task producing it), {date} for the date of the run
+	// (as 2006-01-02), and {base} for the file name of the result, such as
+	// "{t:sample}/{date}/{base}"
+	PathPattern string
+	Mode        PublishMode
+	Manifest    string
+	// If set, only the targets for which Select returns true are published,
+	// and the others dropped (the route predicates, such as TagEquals, can
+	// be used)
+	Select func(*FileTarget) bool
+	// The errors of the latest run
+	errs []error
+}
+
+// PublishedResult is an entry in the manifest of a Publisher
+type PublishedResult struct {
+	// The path of the result, relative to the results directory
+	Path string
+	// The path of the output that the result was published from
+	Source string
+	Size   int64
+	Tags   map[string]string `json:",omitempty"`
+	Params map[string]string `json:",omitempty"`
+}
+
+// Instantiate a Publisher component, copying its inputs into the directory
+// dir, at paths formatted from pathPattern (or with their file names, if
+// empty)
+func NewPublisher(name string, dir string, pathPattern string) *Publisher {
+	if pathPattern == "" {
+		pathPattern = "{base}"
+	}
+	return &Publisher{
+		Name:        name,
+		In:          NewInPort(),
+		Dir:         dir,
+		PathPattern: pathPattern,
+	}
+}
+
+func (proc *Publisher) IsConnected() bool {
+	return proc.In.IsConnected()
+}
+
+// Execute the Publisher component
+func (proc *Publisher) Run() {
+	proc.errs = nil
+	date := time.Now().Format("2006-01-02")
+	published := []PublishedResult{}
+	// The sources of the results published in this run, by their paths
+	sources := map[string]string{}
+	for ft := range proc.In.Chan {
+		targets := []*FileTarget{ft}
+		if ft.IsList() {
+			targets = ft.GetTargets()
+		}
+		for _, tgt := range targets {
+			if proc.Select != nil && !proc.Select(tgt) {
+				Debug.Printf("Publisher %s: Not publishing %s\n", proc.Name, tgt.GetPath())
+				continue
+			}
+			res, err := proc.publish(tgt, date, sources)
+			if err != nil {
+				proc.fail(fmt.Errorf("Publisher %s: Could not publish %s: %s", proc.Name, tgt.GetPath(), err))
+				continue
+			}
+			published = append(published, res)
+		}
+	}
+	if proc.Manifest == "" {
+		return
+	}
+	sort.SliceStable(published, func(i, j int) bool {
+		return published[i].Path < published[j].Path
+	})
+	if err := NewFileTarget(filepath.Join(proc.Dir, proc.Manifest)).WriteJSON(published); err != nil {
+		proc.fail(fmt.Errorf("Publisher %s: Could not write manifest: %s", proc.Name, err))
+	}
+}
+
+// Log the error err, and record it, to be returned from the workflow run
+func (proc *Publisher) fail(err error) {
+	Error.Println(err)
+	proc.errs = append(proc.errs, err)
+}
+
+// Get the errors of the latest run of the publisher
+func (proc *Publisher) getRunErrors() []error {
+	return proc.errs
+}
+
+// Publish the target ft, returning its entry in the manifest. The paths of
+// the results published so far in the run, mapped to their sources, are
+// kept in sources, so that results are not published over each other.
+func (proc *Publisher) publish(ft *FileTarget, date string, sources map[string]string) (PublishedResult, error) {
+	res := PublishedResult{Source: ft.GetPath()}
+	if ft.IsInMemory() || ft.IsStreaming() {
+		return res, fmt.Errorf("In-memory and streamed targets can not be published")
+	}
+	relPath, err := proc.formatPath(ft, date)
+	if err != nil {
+		return res, err
+	}
+	if src, ok := sources[relPath]; ok && src != ft.GetPath() {
+		return res, fmt.Errorf("Path %s is the same as for %s, published before", relPath, src)
+	}
+	res.Path = relPath
+	res.Tags = ft.GetTags()
+	res.Params = ft.GetAuditInfo().Params
+	dstPath := filepath.Join(proc.Dir, relPath)
+	fi, err := os.Stat(ft.GetPath())
+	if err != nil {
+		return res, err
+	}
+	res.Size = fi.Size()
+	sources[relPath] = ft.GetPath()
+	if _, err := os.Stat(dstPath); err == nil {
+		if isUpToDateCopy(ft.GetPath(), dstPath) {
+			Info.Printf("Publisher %s: Already published, so skipping: %s\n", proc.Name, dstPath)
+			return res, nil
+		}
+		Info.Printf("Publisher %s: Output changed since published, so replacing: %s\n", proc.Name, dstPath)
+	}
+	if err := os.MkdirAll(filepath.Dir(dstPath), 0777); err != nil {
+		return res, err
+	}
+	if _, err := os.Stat(ft.GetAuditFilePath()); err == nil {
+		if err := proc.putInPlace(ft.GetAuditFilePath(), dstPath+".audit.json"); err != nil {
+			return res, err
+		}
+	} else if err := os.Remove(dstPath + ".audit.json"); err != nil && !os.IsNotExist(err) {
+		return res, err
+	}
+	if err := proc.putInPlace(ft.GetPath(), dstPath); err != nil {
+		return res, err
+	}
+	Audit.Printf("Publisher %s: Published %s -> %s\n", proc.Name, ft.GetPath(), dstPath)
+	return res, nil
+}
+
+// Put the file or directory at srcPath in place at dstPath, according to the
+// mode of the publisher, replacing anything already there. Copies and links
+// are made next to dstPath first, and then renamed, so that results are never
+// seen half-written.
+func (proc *Publisher) putInPlace(srcPath string, dstPath string) error {
+	fi, err := os.Stat(srcPath)
+	if err != nil {
+		return err
+	}
+	// Directories can not be renamed over
+	if dfi, err := os.Stat(dstPath); err == nil && dfi.IsDir() {
+		if err := os.RemoveAll(dstPath); err != nil {
+			return err
+		}
+	}
+	switch proc.Mode {
+	case PublishMove:
+		return moveFile(srcPath, dstPath)
+	case PublishHardlink:
+		if !fi.IsDir() {
+			linkPath := filepath.Join(filepath.Dir(dstPath), "."+filepath.Base(dstPath)+".linking")
+			os.Remove(linkPath)
+			if os.Link(srcPath, linkPath) == nil {
+				return renameFile(linkPath, dstPath)
+			}
+		}
+	}
+	copyPath := filepath.Join(filepath.Dir(dstPath), "."+filepath.Base(dstPath)+".copying")
+	if err := os.RemoveAll(copyPath); err != nil {
+		return err
+	}
+	if err := copyTree(srcPath, copyPath, fi); err != nil {
+		return err
+	}
+	return renameFile(copyPath, dstPath)
+}
+
+// errStaleCopy stops the walk of isUpToDateCopy at the first changed file
+var errStaleCopy = errors.New("Stale copy")
+
+// Check whether the file or directory at dstPath is an up-to-date copy of
+// the one at srcPath, in that all files in srcPath are in dstPath too, with
+// the same sizes, and are not newer in srcPath. Moved files keep their
+// modification times, and copies are newer than their sources, so files
+// written again after being published are found to have changed.
+func isUpToDateCopy(srcPath string, dstPath string) bool {
+	err := filepath.Walk(srcPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(srcPath, path)
+		if err != nil {
+			return err
+		}
+		dfi, err := os.Stat(filepath.Join(dstPath, relPath))
+		if err != nil {
+			return err
+		}
+		if info.IsDir() != dfi.IsDir() {
+			return errStaleCopy
+		}
+		if !info.IsDir() && (info.Size() != dfi.Size() || dfi.ModTime().Before(info.ModTime())) {
+			return errStaleCopy
+		}
+		return nil
+	})
+	return err == nil
+}
+
+// Return the regular expression used to parse the placeholders in the path
+// patterns of publishers: {t:TAG}, {p:PARAM}, {date} and {base}
+func getPublishPathPlaceHolderRegex() *re.Regexp {
+	r, err := re.Compile(`{(t|p):([^{}]+)}|{(date|base)}`)
+	Check(err)
+	return r
+}
+
+// Format the path of the target ft, relative to the results directory, from
+// the path pattern of the publisher
+func (proc *Publisher) formatPath(ft *FileTarget, date string) (string, error) {
+	var err error
+	r := getPublishPathPlaceHolderRegex()
+	path := r.ReplaceAllStringFunc(proc.PathPattern, func(placeHolder string) string {
+		m := r.FindStringSubmatch(placeHolder)
+		switch {
+		case m[3] == "date":
+			return date
+		case m[3] == "base":
+			return filepath.Base(ft.GetPath())
+		case m[1] == "t" && ft.GetTag(m[2]) != "":
+			return ft.GetTag(m[2])
+		case m[1] == "p" && ft.GetAuditInfo().Params[m[2]] != "":
+			return ft.GetAuditInfo().Params[m[2]]
+		}
+		err = fmt.Errorf("No value for placeholder %s in path pattern %s", placeHolder, proc.PathPattern)
+		return ""
+	})
+	if err != nil {
+		return "", err
+	}
+	path = filepath.Clean(filepath.FromSlash(path))
+	if filepath.IsAbs(path) || path == ".." || str.HasPrefix(path, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("Path %s is outside the results directory", path)
+	}
+	return path, nil
+}
@@ -0,0 +1,162 @@
+package scipipe
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	t "testing"
+	"time"
+)
+
+func TestPublisher(t *t.T) {
+	initTestLogs()
+	os.RemoveAll("/tmp/pub_results")
+	defer os.RemoveAll("/tmp/pub_results")
+	defer cleanFiles("/tmp/pub_s1.txt", "/tmp/pub_s1.txt.vcf", "/tmp/pub_s2.txt", "/tmp/pub_s2.txt.vcf")
+
+	for _, s := range []string{"s1", "s2"} {
+		ioutil.WriteFile("/tmp/pub_"+s+".txt", []byte(s+"\n"), 0644)
+	}
+	src := NewFileQueue("/tmp/pub_s1.txt", "/tmp/pub_s2.txt")
+	call := NewFromShell("call", "cat {i:in} > {o:vcf} # {p:caller}")
+	call.SetPathExtend("in", "vcf", ".vcf")
+	call.SetParamDefault("caller", "gatk")
+	call.In["in"].Connect(src.Out)
+	pub := NewPublisher("pub", "/tmp/pub_results", "{p:caller}/{date}/{base}")
+	pub.Manifest = "manifest.json"
+	pub.Select = func(ft *FileTarget) bool { return ft.GetPath() != "/tmp/pub_s2.txt.vcf" }
+	pub.In.Connect(call.Out["vcf"])
+
+	wf := NewWorkflow("publish")
+	wf.AddProcesses(src, call, pub)
+	assert.Nil(t, wf.Run())
+
+	pubPath := "/tmp/pub_results/gatk/" + time.Now().Format("2006-01-02") + "/pub_s1.txt.vcf"
+	dat, err := ioutil.ReadFile(pubPath)
+	assert.Nil(t, err)
+	assert.Equal(t, "s1\n", string(dat))
+	_, err = os.Stat(pubPath + ".audit.json")
+	assert.Nil(t, err, "Audit file not published")
+	_, err = os.Stat("/tmp/pub_s1.txt.vcf")
+	assert.Nil(t, err, "Copied output should be left in place")
+
+	manifest := []PublishedResult{}
+	dat, err = ioutil.ReadFile("/tmp/pub_results/manifest.json")
+	assert.Nil(t, err)
+	assert.Nil(t, json.Unmarshal(dat, &manifest))
+	assert.Len(t, manifest, 1)
+	assert.Equal(t, "/tmp/pub_s1.txt.vcf", manifest[0].Source)
+	assert.Equal(t, "gatk", manifest[0].Params["caller"])
+	assert.EqualValues(t, 3, manifest[0].Size)
+
+	_, err = pub.formatPath(NewFileTarget("/tmp/x.txt"), "2020-01-01")
+	assert.NotNil(t, err, "Missing param not reported")
+	pub.PathPattern = "../{base}"
+	_, err = pub.formatPath(NewFileTarget("/tmp/x.txt"), "2020-01-01")
+	assert.NotNil(t, err, "Path outside results directory not reported")
+}
+
+func TestPublisherReplacesStale(t *t.T) {
+	initTestLogs()
+	os.RemoveAll("/tmp/pub_stale_results")
+	defer os.RemoveAll("/tmp/pub_stale_results")
+	defer cleanFiles("/tmp/pub_stale.txt", "/tmp/pub_stale.txt.out")
+
+	run := func(content string, mode PublishMode) {
+		ioutil.WriteFile("/tmp/pub_stale.txt", []byte(content), 0644)
+		src := NewFileQueue("/tmp/pub_stale.txt")
+		cp := NewFromShell("cp", "cat {i:in} > {o:out}")
+		cp.SetPathExtend("in", "out", ".out")
+		cp.In["in"].Connect(src.Out)
+		pub := NewPublisher("pub", "/tmp/pub_stale_results", "")
+		pub.Mode = mode
+		pub.In.Connect(cp.Out["out"])
+		wf := NewWorkflow("publish_stale")
+		wf.AddProcesses(src, cp, pub)
+		assert.Nil(t, wf.Run())
+	}
+	pubPath := "/tmp/pub_stale_results/pub_stale.txt.out"
+	published := func() string {
+		dat, err := ioutil.ReadFile(pubPath)
+		assert.Nil(t, err)
+		return string(dat)
+	}
+
+	run("one\n", PublishCopy)
+	assert.Equal(t, "one\n", published())
+	// Make the output older than the published result, and than any
+	// output written later
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes("/tmp/pub_stale.txt.out", old, old)
+	before, err := os.Stat(pubPath)
+	assert.Nil(t, err)
+
+	// Results of unchanged outputs are left as they are
+	run("two\n", PublishCopy)
+	assert.Equal(t, "one\n", published())
+	after, err := os.Stat(pubPath)
+	assert.Nil(t, err)
+	assert.True(t, os.SameFile(before, after), "Up-to-date result was replaced")
+
+	// ... but replaced when the output has changed since
+	cleanFiles("/tmp/pub_stale.txt.out")
+	run("three\n", PublishCopy)
+	assert.Equal(t, "three\n", published())
+
+	// Moved results are replaced by the outputs of the rerun tasks
+	cleanFiles("/tmp/pub_stale.txt.out")
+	run("four\n", PublishMove)
+	assert.Equal(t, "four\n", published())
+	run("five\n", PublishMove)
+	assert.Equal(t, "five\n", published())
+	_, err = os.Stat("/tmp/pub_stale.txt.out")
+	assert.NotNil(t, err, "Moved output should not be left in place")
+}
+
+func TestPublisherPutInPlaceError(t *t.T) {
+	initTestLogs()
+	pub := NewPublisher("pub", "/tmp/pub_err_results", "")
+	err := pub.putInPlace("/tmp/pub_err_missing.txt", "/tmp/pub_err_results/pub_err_missing.txt")
+	assert.NotNil(t, err, "Missing source not reported")
+	_, err = pub.publish(NewFileTarget("/tmp/pub_err_missing.txt"), "2020-01-01", map[string]string{})
+	assert.NotNil(t, err, "Missing output not reported")
+}
+
+func TestPublisherErrors(t *t.T) {
+	initTestLogs()
+	os.RemoveAll("/tmp/pub_coll_results")
+	defer os.RemoveAll("/tmp/pub_coll_results")
+	defer cleanFiles("/tmp/pub_coll_a.txt", "/tmp/pub_coll_a.txt.out", "/tmp/pub_coll_b.txt", "/tmp/pub_coll_b.txt.out")
+
+	for _, s := range []string{"a", "b"} {
+		ioutil.WriteFile("/tmp/pub_coll_"+s+".txt", []byte(s+"\n"), 0644)
+	}
+	src := NewFileQueue("/tmp/pub_coll_a.txt", "/tmp/pub_coll_b.txt")
+	cp := NewFromShell("cp", "cat {i:in} > {o:out}")
+	cp.SetPathExtend("in", "out", ".out")
+	cp.In["in"].Connect(src.Out)
+	// Both results are formatted to the same path
+	pub := NewPublisher("pub", "/tmp/pub_coll_results", "result.txt")
+	pub.Manifest = "manifest.json"
+	pub.In.Connect(cp.Out["out"])
+
+	wf := NewWorkflow("publish_collision")
+	wf.AddProcesses(src, cp, pub)
+	err := wf.Run()
+	assert.IsType(t, &RunError{}, err, "Path collision not reported")
+	if runErr, ok := err.(*RunError); ok {
+		assert.Len(t, runErr.Errors, 1)
+	}
+
+	manifest := []PublishedResult{}
+	dat, err := ioutil.ReadFile("/tmp/pub_coll_results/manifest.json")
+	assert.Nil(t, err)
+	assert.Nil(t, json.Unmarshal(dat, &manifest))
+	assert.Len(t, manifest, 1)
+	dat, err = ioutil.ReadFile("/tmp/pub_coll_results/result.txt")
+	assert.Nil(t, err)
+	src1, err := ioutil.ReadFile(manifest[0].Source)
+	assert.Nil(t, err)
+	assert.Equal(t, string(src1), string(dat), "Published result overwritten")
+}
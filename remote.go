@@ -0,0 +1,241 @@
+package scipipe
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"path"
+	"path/filepath"
+	str "strings"
+	"sync"
+)
+
+// Directory under which remote files are staged locally while being used by
+// tasks. Can be changed before the workflow is run.
+var RemoteStagingDir = ".scipipe/remote"
+
+// ======= RemoteHandler ========
+
+// RemoteHandler moves files between a remote storage system, identified by a
+// URL scheme (such as gs://, s3:// or az://), and the local file system.
+//
+// Uploads are expected to be atomic, in the sense that the remote file does
+// not become visible at its URL until it is completely written, which is the
+// case for object stores such as Google Cloud Storage, Amazon S3 and Azure
+// Blob Storage.
+type RemoteHandler interface {
+	Download(url string, localPath string) error
+	Upload(localPath string, url string) error
+	Exists(url string) bool
+}
+
+// CachingRemoteHandler is a RemoteHandler that can check whether a file
+// already downloaded to a local path is still up to date with the remote
+// file, so that it does not need to be downloaded again.
+type CachingRemoteHandler interface {
+	RemoteHandler
+	IsUpToDate(url string, localPath string) bool
+}
+
+// MetadataRemoteHandler is a RemoteHandler for storage systems that can store
+// metadata about files, and which get the audit info of uploaded files
+// registered as metadata.
+type MetadataRemoteHandler interface {
+	RemoteHandler
+	SetMetadata(url string, ai *AuditInfo) error
+}
+
+var (
+	remoteHandlers     = make(map[string]RemoteHandler)
+	remoteHandlersLock = new(sync.Mutex)
+)
+
+// Register a RemoteHandler to use for FileTargets with paths starting with
+// the URL scheme scheme, such as "gs"
+func RegisterRemoteHandler(scheme string, handler RemoteHandler) {
+	remoteHandlersLock.Lock()
+	remoteHandlers[scheme] = handler
+	remoteHandlersLock.Unlock()
+}
+
+func init() {
+	RegisterRemoteHandler("gs", newGcsRemoteHandler())
+	RegisterRemoteHandler("s3", newS3RemoteHandler())
+	RegisterRemoteHandler("az", newAzureRemoteHandler())
+	RegisterRemoteHandler("ftp", newCurlRemoteHandler())
+	RegisterRemoteHandler("sftp", newCurlRemoteHandler())
+}
+
+// Get the remote handler registered for the scheme of rawUrl, if any
+func getRemoteHandler(rawUrl string) (RemoteHandler, bool) {
+	if !str.Contains(rawUrl, "://") {
+		return nil, false
+	}
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, false
+	}
+	remoteHandlersLock.Lock()
+	handler, ok := remoteHandlers[u.Scheme]
+	remoteHandlersLock.Unlock()
+	return handler, ok
+}
+
+// Get the local path under RemoteStagingDir, where a remote file is staged
+func remoteLocalPath(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	Check(err)
+	return filepath.Join(RemoteStagingDir, u.Scheme, u.Host, filepath.FromSlash(u.Path))
+}
+
+// ======= Command line tool based handlers ========
+
+// cmdRemoteHandler implements RemoteHandler by executing command line tools,
+// such as gsutil or az, with the command arguments returned from its
+// functions, which return errors for URLs that the tools can not handle
+type cmdRemoteHandler struct {
+	downloadArgs func(url string, localPath string) ([]string, error)
+	uploadArgs   func(localPath string, url string) ([]string, error)
+	existsArgs   func(url string) ([]string, error)
+}
+
+func (h *cmdRemoteHandler) Download(url string, localPath string) error {
+	args, err := h.downloadArgs(url, localPath)
+	if err != nil {
+		return err
+	}
+	return runRemoteCommand(args)
+}
+
+func (h *cmdRemoteHandler) Upload(localPath string, url string) error {
+	args, err := h.uploadArgs(localPath, url)
+	if err != nil {
+		return err
+	}
+	return runRemoteCommand(args)
+}
+
+func (h *cmdRemoteHandler) Exists(url string) bool {
+	args, err := h.existsArgs(url)
+	return err == nil && runRemoteCommand(args) == nil
+}
+
+func runRemoteCommand(args []string) error {
+	Debug.Println("Executing remote command:", str.Join(args, " "))
+	out, err := exec.Command(args[0], args[1:]...).CombinedOutput()
+	if err != nil {
+		return errors.New(fmt.Sprint("Remote command failed: ", str.Join(args, " "), ": ", string(out)))
+	}
+	return nil
+}
+
+// Handler for Google Cloud Storage URLs (gs://bucket/path), using gsutil
+func newGcsRemoteHandler() *cmdRemoteHandler {
+	return &cmdRemoteHandler{
+		downloadArgs: func(url string, localPath string) ([]string, error) {
+			return []string{"gsutil", "-q", "cp", url, localPath}, nil
+		},
+		uploadArgs: func(localPath string, url string) ([]string, error) {
+			return []string{"gsutil", "-q", "cp", localPath, url}, nil
+		},
+		existsArgs: func(url string) ([]string, error) {
+			return []string{"gsutil", "-q", "stat", url}, nil
+		},
+	}
+}
+
+// Handler for Amazon S3 URLs (s3://bucket/key), using the aws command line
+// tool. Credentials are picked up by aws in the usual way, e.g. via the
+// AWS_PROFILE environment variable.
+func newS3RemoteHandler() *cmdRemoteHandler {
+	bucketAndKey := func(rawUrl string) (string, string, error) {
+		u, err := url.Parse(rawUrl)
+		if err != nil {
+			return "", "", err
+		}
+		key := str.TrimPrefix(u.Path, "/")
+		if u.Host == "" || key == "" {
+			return "", "", errors.New("S3 URL must be on the form s3://bucket/key: " + rawUrl)
+		}
+		return u.Host, key, nil
+	}
+	return &cmdRemoteHandler{
+		downloadArgs: func(url string, localPath string) ([]string, error) {
+			_, _, err := bucketAndKey(url)
+			return []string{"aws", "s3", "cp", "--only-show-errors", url, localPath}, err
+		},
+		uploadArgs: func(localPath string, url string) ([]string, error) {
+			_, _, err := bucketAndKey(url)
+			return []string{"aws", "s3", "cp", "--only-show-errors", localPath, url}, err
+		},
+		existsArgs: func(url string) ([]string, error) {
+			// Unlike aws s3 ls, head-object does not match keys by prefix
+			bucket, key, err := bucketAndKey(url)
+			return []string{"aws", "s3api", "head-object", "--bucket", bucket, "--key", key}, err
+		},
+	}
+}
+
+// Handler for Azure Blob Storage URLs (az://account/container/blob/path),
+// using the az command line tool. Credentials are picked up by az in the
+// usual way, e.g. via the AZURE_STORAGE_KEY environment variable.
+func newAzureRemoteHandler() *cmdRemoteHandler {
+	blobArgs := func(rawUrl string, cmd string, extraArgs ...string) ([]string, error) {
+		u, err := url.Parse(rawUrl)
+		if err != nil {
+			return nil, err
+		}
+		parts := str.SplitN(str.TrimPrefix(u.Path, "/"), "/", 2)
+		if len(parts) < 2 || parts[1] == "" {
+			return nil, errors.New("Azure URL must be on the form az://account/container/blob: " + rawUrl)
+		}
+		args := []string{"az", "storage", "blob", cmd, "--account-name", u.Host, "--container-name", parts[0], "--name", parts[1]}
+		return append(args, extraArgs...), nil
+	}
+	return &cmdRemoteHandler{
+		downloadArgs: func(url string, localPath string) ([]string, error) {
+			return blobArgs(url, "download", "--file", localPath, "--output", "none")
+		},
+		uploadArgs: func(localPath string, url string) ([]string, error) {
+			return blobArgs(url, "upload", "--file", localPath, "--overwrite", "--output", "none")
+		},
+		existsArgs: func(url string) ([]string, error) {
+			return blobArgs(url, "show", "--output", "none")
+		},
+	}
+}
+
+// Handler for FTP and SFTP URLs (ftp://host/path, sftp://host/path), using
+// curl. Transfers are resumed with curl's -C option, so that an interrupted
+// transfer of a large file continues where it stopped, if the partially
+// transferred file is still there. Uploads go to a temporary file on the
+// server, which is renamed to its final name when complete. Credentials can
+// be given in the URL, or in a ~/.netrc file.
+func newCurlRemoteHandler() *cmdRemoteHandler {
+	return &cmdRemoteHandler{
+		downloadArgs: func(url string, localPath string) ([]string, error) {
+			return []string{"curl", "-sSf", "--netrc-optional", "-C", "-", "-o", localPath, url}, nil
+		},
+		uploadArgs: func(localPath string, rawUrl string) ([]string, error) {
+			u, err := url.Parse(rawUrl)
+			if err != nil {
+				return nil, err
+			}
+			var renameArgs []string
+			if u.Scheme == "sftp" {
+				renameArgs = []string{"-Q", fmt.Sprintf("-rename \"%s.tmp\" \"%s\"", u.Path, u.Path)}
+			} else {
+				// curl changes into the file's directory on FTP servers,
+				// so the file name is enough
+				base := path.Base(u.Path)
+				renameArgs = []string{"-Q", "-RNFR " + base + ".tmp", "-Q", "-RNTO " + base}
+			}
+			args := []string{"curl", "-sSf", "--netrc-optional", "--ftp-create-dirs", "-C", "-", "-T", localPath, rawUrl + ".tmp"}
+			return append(args, renameArgs...), nil
+		},
+		existsArgs: func(url string) ([]string, error) {
+			return []string{"curl", "-sSf", "--netrc-optional", "-I", "-o", "/dev/null", url}, nil
+		},
+	}
+}
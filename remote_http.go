@@ -0,0 +1,131 @@
+package scipipe
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+func init() {
+	RegisterRemoteHandler("http", newHttpRemoteHandler())
+	RegisterRemoteHandler("https", newHttpRemoteHandler())
+}
+
+// ======= HttpRemoteHandler ========
+
+// httpRemoteHandler downloads input files over HTTP(S). Downloaded files are
+// cached locally, and revalidated against the server using the ETag and
+// Last-Modified headers, so that they are only downloaded again when changed.
+// Uploads are not supported.
+type httpRemoteHandler struct {
+	client *http.Client
+}
+
+func newHttpRemoteHandler() *httpRemoteHandler {
+	return &httpRemoteHandler{client: http.DefaultClient}
+}
+
+// Cache validation info, as returned by the server for a downloaded file
+type httpCacheInfo struct {
+	ETag         string
+	LastModified string
+}
+
+func (h *httpRemoteHandler) Download(url string, localPath string) error {
+	resp, err := h.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(fmt.Sprintf("Could not download %s: %s", url, resp.Status))
+	}
+	f, err := os.Create(localPath)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, resp.Body)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	return h.writeCacheInfo(url, &httpCacheInfo{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	})
+}
+
+func (h *httpRemoteHandler) Upload(localPath string, url string) error {
+	return errors.New("Uploading files over HTTP is not supported: " + url)
+}
+
+func (h *httpRemoteHandler) Exists(url string) bool {
+	resp, err := h.client.Head(url)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+// Check with the server, using a conditional request, whether a previously
+// downloaded file is still up to date
+func (h *httpRemoteHandler) IsUpToDate(url string, localPath string) bool {
+	ci, err := h.readCacheInfo(url)
+	if err != nil || (ci.ETag == "" && ci.LastModified == "") {
+		return false
+	}
+	req, err := http.NewRequest("HEAD", url, nil)
+	if err != nil {
+		return false
+	}
+	if ci.ETag != "" {
+		req.Header.Set("If-None-Match", ci.ETag)
+	}
+	if ci.LastModified != "" {
+		req.Header.Set("If-Modified-Since", ci.LastModified)
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		// Use the cached file if the server can not be reached
+		Warning.Println("Could not revalidate cached download, so using cached file:", url, err)
+		return true
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusNotModified
+}
+
+// Get the path of the file storing cache validation info for url
+func (h *httpRemoteHandler) cacheInfoPath(url string) string {
+	sum := sha1.Sum([]byte(url))
+	return filepath.Join(RemoteStagingDir, "http-cache", hex.EncodeToString(sum[:])+".json")
+}
+
+func (h *httpRemoteHandler) readCacheInfo(url string) (*httpCacheInfo, error) {
+	dat, err := ioutil.ReadFile(h.cacheInfoPath(url))
+	if err != nil {
+		return nil, err
+	}
+	ci := &httpCacheInfo{}
+	err = json.Unmarshal(dat, ci)
+	return ci, err
+}
+
+func (h *httpRemoteHandler) writeCacheInfo(url string, ci *httpCacheInfo) error {
+	err := os.MkdirAll(filepath.Dir(h.cacheInfoPath(url)), 0777)
+	if err != nil {
+		return err
+	}
+	dat, err := json.Marshal(ci)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(h.cacheInfoPath(url), dat, 0644)
+}
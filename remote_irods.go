@@ -0,0 +1,102 @@
+package scipipe
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+)
+
+func init() {
+	RegisterRemoteHandler("irods", newIrodsRemoteHandler())
+}
+
+// ======= IrodsRemoteHandler ========
+
+// irodsRemoteHandler handles iRODS data objects, with URLs on the form
+// irods://zone/path/to/object (for the logical path /zone/path/to/object),
+// using the iRODS i-commands, which need to be set up (with iinit) in
+// advance. Uploaded objects are registered with metadata from their audit
+// info.
+type irodsRemoteHandler struct{}
+
+func newIrodsRemoteHandler() *irodsRemoteHandler {
+	return &irodsRemoteHandler{}
+}
+
+// Get the iRODS logical path for an irods:// URL
+func irodsLogicalPath(rawUrl string) (string, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return "", err
+	}
+	return "/" + u.Host + u.Path, nil
+}
+
+func (h *irodsRemoteHandler) Download(url string, localPath string) error {
+	objPath, err := irodsLogicalPath(url)
+	if err != nil {
+		return err
+	}
+	return runRemoteCommand([]string{"iget", "-f", objPath, localPath})
+}
+
+// Upload to a temporary data object, which is then renamed, so that the data
+// object does not show up at its final path until completely uploaded
+func (h *irodsRemoteHandler) Upload(localPath string, url string) error {
+	objPath, err := irodsLogicalPath(url)
+	if err != nil {
+		return err
+	}
+	err = runRemoteCommand([]string{"iput", "-f", localPath, objPath + ".tmp"})
+	if err != nil {
+		return err
+	}
+	if h.Exists(url) {
+		err = runRemoteCommand([]string{"irm", "-f", objPath})
+		if err != nil {
+			return err
+		}
+	}
+	return runRemoteCommand([]string{"imv", objPath + ".tmp", objPath})
+}
+
+func (h *irodsRemoteHandler) Exists(url string) bool {
+	objPath, err := irodsLogicalPath(url)
+	return err == nil && runRemoteCommand([]string{"ils", objPath}) == nil
+}
+
+// Register the audit info of an uploaded data object as iRODS metadata
+// (AVUs) in the catalog
+func (h *irodsRemoteHandler) SetMetadata(url string, ai *AuditInfo) error {
+	objPath, err := irodsLogicalPath(url)
+	if err != nil {
+		return err
+	}
+	avus := map[string]string{
+		"scipipe.command":      ai.Command,
+		"scipipe.start_time":   ai.StartTime.Format("2006-01-02T15:04:05.000Z07:00"),
+		"scipipe.finish_time":  ai.FinishTime.Format("2006-01-02T15:04:05.000Z07:00"),
+		"scipipe.exec_time_ms": fmt.Sprintf("%d", ai.ExecTimeMS),
+	}
+	for k, v := range ai.Params {
+		avus["scipipe.param."+k] = v
+	}
+	for k, v := range ai.Tags {
+		avus["scipipe.tag."+k] = v
+	}
+	attrs := []string{}
+	for attr := range avus {
+		attrs = append(attrs, attr)
+	}
+	sort.Strings(attrs)
+	for _, attr := range attrs {
+		if avus[attr] == "" {
+			continue
+		}
+		err := runRemoteCommand([]string{"imeta", "set", "-d", objPath, attr, avus[attr]})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package scipipe
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	t "testing"
+)
+
+func TestRemoteFileTargetPaths(t *t.T) {
+	gsFt := NewFileTarget("gs://bucket/dir/file.txt")
+	assert.True(t, gsFt.IsRemote())
+	assert.EqualValues(t, "gs://bucket/dir/file.txt", gsFt.GetURL())
+	assertPathsEqual(t, gsFt.GetPath(), RemoteStagingDir+"/gs/bucket/dir/file.txt")
+	assertPathsEqual(t, gsFt.GetTempPath(), RemoteStagingDir+"/gs/bucket/dir/file.txt.tmp")
+
+	azFt := NewFileTarget("az://account/container/file.txt")
+	assert.True(t, azFt.IsRemote())
+	assertPathsEqual(t, azFt.GetPath(), RemoteStagingDir+"/az/account/container/file.txt")
+
+	sftpFt := NewFileTarget("sftp://host/data/ref.fa")
+	assert.True(t, sftpFt.IsRemote())
+	assertPathsEqual(t, sftpFt.GetPath(), RemoteStagingDir+"/sftp/host/data/ref.fa")
+
+	irodsFt := NewFileTarget("irods://tempZone/home/rods/file.txt")
+	assert.True(t, irodsFt.IsRemote())
+	objPath, err := irodsLogicalPath(irodsFt.GetURL())
+	assert.Nil(t, err)
+	assert.EqualValues(t, "/tempZone/home/rods/file.txt", objPath)
+
+	s3Ft := NewFileTarget("s3://bucket/dir/file.txt")
+	assert.True(t, s3Ft.IsRemote())
+	assertPathsEqual(t, s3Ft.GetPath(), RemoteStagingDir+"/s3/bucket/dir/file.txt")
+
+	localFt := NewFileTarget("dir/file.txt")
+	assert.False(t, localFt.IsRemote())
+	assert.EqualValues(t, "", localFt.GetURL())
+}
+
+func TestHttpRemoteStageIn(t *t.T) {
+	initTestLogs()
+
+	downloads := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/data/hello.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if r.Method == "GET" {
+			downloads++
+		}
+		w.Write([]byte("hello\n"))
+	}))
+	defer srv.Close()
+
+	stagingDir := RemoteStagingDir
+	RemoteStagingDir = "/tmp/scipipe_test_staging"
+	defer func() { RemoteStagingDir = stagingDir }()
+
+	ft := NewFileTarget(srv.URL + "/data/hello.txt")
+	assert.True(t, ft.IsRemote())
+	assert.Nil(t, ft.StageIn())
+	assert.EqualValues(t, "hello\n", string(ft.Read()))
+
+	// Staging in a second time should revalidate, but not download again
+	assert.Nil(t, NewFileTarget(srv.URL+"/data/hello.txt").StageIn())
+	assert.EqualValues(t, 1, downloads)
+
+	os.RemoveAll(RemoteStagingDir)
+}
+
+func TestCurlRemoteHandler(t *t.T) {
+	initTestLogs()
+
+	dir := "/tmp/scipipe_test_curl"
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+	os.MkdirAll(dir, 0777)
+	srcPath := dir + "/src.txt"
+	err := ioutil.WriteFile(srcPath, []byte("hello world\n"), 0644)
+	assert.Nil(t, err)
+
+	h := newCurlRemoteHandler()
+	assert.True(t, h.Exists("file://"+srcPath))
+	assert.False(t, h.Exists("file://"+dir+"/missing.txt"))
+
+	// A missing object fails the download, rather than giving an empty file
+	err = h.Download("file://"+dir+"/missing.txt", dir+"/missing.local.txt")
+	assert.NotNil(t, err)
+	if err != nil {
+		assert.Contains(t, err.Error(), "Remote command failed")
+	}
+
+	// A partially transferred file is resumed, and completed
+	partialPath := dir + "/partial.txt"
+	err = ioutil.WriteFile(partialPath, []byte("hello "), 0644)
+	assert.Nil(t, err)
+	err = h.Download("file://"+srcPath, partialPath)
+	assert.Nil(t, err)
+	dat, err := ioutil.ReadFile(partialPath)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "hello world\n", string(dat))
+}
+
+func TestHttpRemoteStageInMissing(t *t.T) {
+	initTestLogs()
+
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	stagingDir := RemoteStagingDir
+	RemoteStagingDir = "/tmp/scipipe_test_staging"
+	defer func() { RemoteStagingDir = stagingDir }()
+	defer os.RemoveAll(RemoteStagingDir)
+
+	ft := NewFileTarget(srv.URL + "/data/missing.txt")
+	assert.False(t, ft.remote.Exists(ft.GetURL()))
+	assert.Error(t, ft.StageIn())
+	// No partial file should be left behind, to be taken for a staged one
+	assert.False(t, ft.Exists())
+	_, err := os.Stat(ft.GetPath())
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRemoteURLErrors(t *t.T) {
+	initTestLogs()
+
+	for _, rawUrl := range []string{"az://account/container", "s3://bucket"} {
+		handler, ok := getRemoteHandler(rawUrl)
+		assert.True(t, ok)
+		err := handler.Download(rawUrl, "/tmp/scipipe_test_remote_url.txt")
+		assert.Error(t, err, "Invalid URL should fail: "+rawUrl)
+		assert.Contains(t, err.Error(), "must be on the form")
+		assert.False(t, handler.Exists(rawUrl))
+	}
+}
+
+// failingRemoteHandler is a RemoteHandler whose uploads and downloads fail
+// with uploadErr and downloadErr, if set, and which never finds local files
+// up to date, so that they are always downloaded
+type failingRemoteHandler struct {
+	uploadErr   error
+	downloadErr error
+}
+
+func (h *failingRemoteHandler) Download(url string, localPath string) error {
+	return h.downloadErr
+}
+
+func (h *failingRemoteHandler) Upload(localPath string, url string) error {
+	return h.uploadErr
+}
+
+func (h *failingRemoteHandler) Exists(url string) bool {
+	return false
+}
+
+func (h *failingRemoteHandler) IsUpToDate(url string, localPath string) bool {
+	return false
+}
+
+// Run a workflow writing the remote file failing://host/foo.txt, and then
+// reading it, returning the error of the run
+func runTestFailingRemoteWorkflow() error {
+	wf := newTestFooBarWorkflow("failing://host/")
+	wf.GetSciProcess("f2b").SetPathStatic("out", "/tmp/scipipe_test_failing_bar.txt")
+	defer cleanFiles("/tmp/scipipe_test_failing_bar.txt")
+	return wf.Run()
+}
+
+func TestRemoteStagingErrorsFailTasks(t *t.T) {
+	initTestLogs()
+
+	stagingDir := RemoteStagingDir
+	RemoteStagingDir = "/tmp/scipipe_test_failing_staging"
+	defer func() { RemoteStagingDir = stagingDir }()
+
+	// Staging out fails the task writing the remote file
+	RegisterRemoteHandler("failing", &failingRemoteHandler{uploadErr: errors.New("upload failed")})
+	err := runTestFailingRemoteWorkflow()
+	assert.IsType(t, &RunError{}, err)
+	assert.Contains(t, err.Error(), "upload failed")
+	os.RemoveAll(RemoteStagingDir)
+
+	// Staging in fails the task reading the remote file
+	RegisterRemoteHandler("failing", &failingRemoteHandler{downloadErr: errors.New("download failed")})
+	err = runTestFailingRemoteWorkflow()
+	assert.IsType(t, &RunError{}, err)
+	assert.Contains(t, err.Error(), "download failed")
+	assert.False(t, NewFileTarget("/tmp/scipipe_test_failing_bar.txt").Exists())
+	os.RemoveAll(RemoteStagingDir)
+}
@@ -0,0 +1,254 @@
+package scipipe
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// ======= Timing report ========
+
+// Check whether the records of all tasks executed in the run of the
+// workflow are kept, which they are only if something needs them, since
+// they would otherwise take up memory for each task of long runs
+func (wf *Workflow) keepsTaskRecords() bool {
+	if wf.KeepTaskRecords || wf.ReportPath != "" || wf.StateDir != "" {
+		return true
+	}
+	for _, proc := range flattenProcesses(wf.processes) {
+		if sp, ok := proc.(*SciProcess); ok && sp.Profile {
+			return true
+		}
+	}
+	return false
+}
+
+// Set up the recording of the records of all tasks executed in the run of
+// the workflow, if they are kept (see KeepTaskRecords)
+func (wf *Workflow) setUpTaskRecords() {
+	if !wf.keepsTaskRecords() || wf.recordHooksAdded {
+		return
+	}
+	wf.recordHooksAdded = true
+	wf.OnTaskSuccess(wf.addTaskRecord)
+	wf.OnTaskFailure(func(t *SciTask, err error) {
+		wf.addTaskRecord(t)
+	})
+}
+
+// Add the record of the task t to the records of all tasks executed in the
+// run of the workflow
+func (wf *Workflow) addTaskRecord(t *SciTask) {
+	wf.lock.Lock()
+	wf.taskRecords = append(wf.taskRecords, newTaskRecord(t))
+	wf.lock.Unlock()
+}
+
+// Get the records of all tasks executed (or failed) in the run of the
+// workflow, in the order they finished. The records are only kept if
+// KeepTaskRecords, ReportPath or StateDir is set, or if tasks are profiled,
+// and are empty otherwise.
+func (wf *Workflow) GetTaskRecords() []TaskRecord {
+	wf.lock.Lock()
+	defer wf.lock.Unlock()
+	return append([]TaskRecord{}, wf.taskRecords...)
+}
+
+// Write the timing report of the run of the workflow to the file at
+// ReportPath, if set
+func (wf *Workflow) writeReportFile() {
+	if wf.ReportPath == "" {
+		return
+	}
+	f, err := os.Create(wf.ReportPath)
+	if err != nil {
+		Warning.Printf("Workflow %s: Could not create report: %s\n", wf.Name, err)
+		return
+	}
+	defer f.Close()
+	if err := wf.WriteReport(f); err != nil {
+		Warning.Printf("Workflow %s: Could not write report: %s\n", wf.Name, err)
+		return
+	}
+	Audit.Printf("Workflow %s: Wrote report to %s\n", wf.Name, wf.ReportPath)
+}
+
+// Write a self-contained HTML report of the run of the workflow to w, with
+// a Gantt chart of the start and finish times of all executed tasks, a
+// summary of the tasks of each process, and a table of the slowest tasks
+func (wf *Workflow) WriteReport(w io.Writer) error {
+	return reportTemplate.Execute(w, newReport(wf.Name, wf.GetStats(), wf.GetTaskRecords()))
+}
+
+// The layout of the Gantt chart, and the number of slowest tasks shown
+const (
+	reportChartWidth = 900
+	reportLabelWidth = 160
+	reportRowHeight  = 14
+	reportNumSlowest = 10
+)
+
+var reportColors = []string{"#4e79a7", "#f28e2b", "#59a14f", "#b07aa1", "#76b7b2", "#edc948", "#ff9da7", "#9c755f"}
+
+type report struct {
+	Name          string
+	StartTime     time.Time
+	Duration      time.Duration
+	Total         ProcessStats
+	Width         int
+	Height        int
+	Bars          []reportBar
+	Processes     []reportProcess
+	SlowestTasks  []TaskRecord
+	ChartDuration time.Duration
+}
+
+type reportBar struct {
+	Label  string
+	Title  string
+	Color  string
+	Failed bool
+	X, Y   int
+	Width  int
+}
+
+type reportProcess struct {
+	Name         string
+	Color        string
+	Tasks        int
+	Failed       int
+	TotalTime    time.Duration
+	MeanTime     time.Duration
+	MaxTime      time.Duration
+	FirstStarted time.Time
+}
+
+// Create the report of a run, with the run statistics rs, and the records
+// of the tasks
+func newReport(name string, rs RunStats, records []TaskRecord) *report {
+	r := &report{
+		Name:      name,
+		StartTime: rs.StartTime,
+		Duration:  rs.FinishTime.Sub(rs.StartTime),
+		Total:     rs.GetTotal(),
+	}
+	sorted := append([]TaskRecord{}, records...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Name != sorted[j].Name {
+			return sorted[i].Name < sorted[j].Name
+		}
+		return sorted[i].StartTime.Before(sorted[j].StartTime)
+	})
+
+	procs := make(map[string]*reportProcess)
+	procNames := []string{}
+	var start, end time.Time
+	for _, tr := range sorted {
+		p, ok := procs[tr.Name]
+		if !ok {
+			p = &reportProcess{Name: tr.Name, FirstStarted: tr.StartTime}
+			procs[tr.Name] = p
+			procNames = append(procNames, tr.Name)
+		}
+		p.Tasks++
+		if !tr.Succeeded {
+			p.Failed++
+		}
+		p.TotalTime += tr.GetDuration()
+		if tr.GetDuration() > p.MaxTime {
+			p.MaxTime = tr.GetDuration()
+		}
+		if start.IsZero() || tr.StartTime.Before(start) {
+			start = tr.StartTime
+		}
+		if end.IsZero() || tr.FinishTime.After(end) {
+			end = tr.FinishTime
+		}
+	}
+	// Order processes by when their first task started
+	sort.SliceStable(procNames, func(i, j int) bool {
+		return procs[procNames[i]].FirstStarted.Before(procs[procNames[j]].FirstStarted)
+	})
+	for i, pname := range procNames {
+		p := procs[pname]
+		p.Color = reportColors[i%len(reportColors)]
+		p.MeanTime = p.TotalTime / time.Duration(p.Tasks)
+		r.Processes = append(r.Processes, *p)
+	}
+
+	r.ChartDuration = end.Sub(start)
+	scale := float64(reportChartWidth) / float64(r.ChartDuration+1)
+	row := 0
+	for _, pname := range procNames {
+		for _, tr := range sorted {
+			if tr.Name != pname {
+				continue
+			}
+			width := int(float64(tr.GetDuration()) * scale)
+			if width < 1 {
+				width = 1
+			}
+			r.Bars = append(r.Bars, reportBar{
+				Label:  fmt.Sprintf("%s #%d", tr.Name, tr.Index),
+				Title:  tr.Command + " (" + tr.GetDuration().String() + ")",
+				Color:  procs[pname].Color,
+				Failed: !tr.Succeeded,
+				X:      reportLabelWidth + int(float64(tr.StartTime.Sub(start))*scale),
+				Y:      row * reportRowHeight,
+				Width:  width,
+			})
+			row++
+		}
+	}
+	r.Width = reportLabelWidth + reportChartWidth + 10
+	r.Height = row*reportRowHeight + 4
+
+	slowest := append([]TaskRecord{}, records...)
+	sort.SliceStable(slowest, func(i, j int) bool {
+		return slowest[i].GetDuration() > slowest[j].GetDuration()
+	})
+	if len(slowest) > reportNumSlowest {
+		slowest = slowest[:reportNumSlowest]
+	}
+	r.SlowestTasks = slowest
+	return r
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Name}} - SciPipe execution report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin: 1em 0; }
+td, th { border: 1px solid #ccc; padding: 4px 8px; text-align: left; font-size: 0.9em; }
+td.num { text-align: right; }
+svg text { font-size: 10px; }
+</style>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+<p>Started {{.StartTime.Format "2006-01-02 15:04:05"}}, ran for {{.Duration}}.
+{{.Total.TasksExecuted}} tasks executed, {{.Total.TasksFailed}} failed, {{.Total.TasksSkipped}} skipped.</p>
+<h2>Timeline</h2>
+<p>The tasks of each process, over the {{.ChartDuration}} from the first task started to the last one finished.</p>
+<svg width="{{.Width}}" height="{{.Height}}">
+{{range .Bars}}<text x="0" y="{{.Y}}" dy="10">{{.Label}}</text><rect x="{{.X}}" y="{{.Y}}" width="{{.Width}}" height="12" fill="{{.Color}}"{{if .Failed}} stroke="red" stroke-width="2"{{end}}><title>{{.Title}}</title></rect>
+{{end}}</svg>
+<h2>Processes</h2>
+<table>
+<tr><th>Process</th><th>Tasks</th><th>Failed</th><th>Total time</th><th>Mean time</th><th>Max time</th></tr>
+{{range .Processes}}<tr><td><span style="color: {{.Color}}">&#9632;</span> {{.Name}}</td><td class="num">{{.Tasks}}</td><td class="num">{{.Failed}}</td><td class="num">{{.TotalTime}}</td><td class="num">{{.MeanTime}}</td><td class="num">{{.MaxTime}}</td></tr>
+{{end}}</table>
+<h2>Slowest tasks</h2>
+<table>
+<tr><th>Task</th><th>Duration</th><th>Command</th></tr>
+{{range .SlowestTasks}}<tr><td>{{.Name}} #{{.Index}}</td><td class="num">{{.GetDuration}}</td><td><code>{{.Command}}</code></td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
@@ -0,0 +1,64 @@
+package scipipe
+
+import (
+	"github.com/stretchr/testify/assert"
+	t "testing"
+)
+
+func TestWorkflowReport(t *t.T) {
+	initTestLogs()
+
+	wf := NewWorkflow("wf")
+	wf.ReportPath = "/tmp/report_wf.html"
+	foo := NewFromShell("foo", "sleep 0.05; echo {p:x} > {o:out}")
+	foo.PathFormatters["out"] = func(task *SciTask) string {
+		return "/tmp/report_" + task.Params["x"] + ".txt"
+	}
+	xs := NewParamPort()
+	foo.ParamPorts["x"].Connect(xs)
+	wf.AddProcesses(foo, NewSink())
+	wf.Connect("foo.out", "sink.in")
+	go func() {
+		defer xs.Close()
+		xs.Chan <- "a"
+		xs.Chan <- "b"
+	}()
+	err := wf.Run()
+	assert.Nil(t, err)
+
+	records := wf.GetTaskRecords()
+	assert.Len(t, records, 2)
+
+	report := string(NewFileTarget("/tmp/report_wf.html").Read())
+	assert.Contains(t, report, "<h1>wf</h1>")
+	assert.Contains(t, report, "2 tasks executed, 0 failed, 0 skipped.")
+	assert.Contains(t, report, ">foo #0</text><rect")
+	assert.Contains(t, report, ">foo #1</text><rect")
+	assert.Contains(t, report, `<span style="color: #4e79a7">`)
+	assert.Contains(t, report, "<code>sleep 0.05; echo a &gt; /tmp/report_a.txt.tmp</code>")
+
+	cleanFiles("/tmp/report_wf.html", "/tmp/report_a.txt", "/tmp/report_b.txt")
+}
+
+func TestTaskRecordsOnlyKeptWhenNeeded(t *t.T) {
+	initTestLogs()
+
+	wf := NewWorkflow("wf")
+	foo := NewFromShell("foo", "echo foo > {o:out}")
+	foo.SetPathStatic("out", "/tmp/records_foo.txt")
+	wf.AddProcesses(foo, NewSink())
+	wf.Connect("foo.out", "sink.in")
+	assert.Nil(t, wf.Run())
+	assert.Empty(t, wf.GetTaskRecords())
+	cleanFiles("/tmp/records_foo.txt")
+
+	foo = NewFromShell("foo", "echo foo > {o:out}")
+	foo.SetPathStatic("out", "/tmp/records_foo.txt")
+	wf = NewWorkflow("wf")
+	wf.KeepTaskRecords = true
+	wf.AddProcesses(foo, NewSink())
+	wf.Connect("foo.out", "sink.in")
+	assert.Nil(t, wf.Run())
+	assert.Len(t, wf.GetTaskRecords(), 1)
+	cleanFiles("/tmp/records_foo.txt")
+}
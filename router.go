@@ -0,0 +1,111 @@
+package scipipe
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// ======= Router ========
+
+// Router is a component that routes each target received on its In-port to
+// the out-port of the first route whose predicate returns true for the
+// target. Targets matching no route are dropped, with a warning, so add a
+// default route (with AddDefaultRoute) to catch all remaining targets.
+type Router struct {
+	Process
+	Name   string
+	In     *InPort
+	Out    map[string]*OutPort
+	routes []*route
+}
+
+type route struct {
+	outPortName string
+	predicate   func(*FileTarget) bool
+}
+
+// Instantiate a Router component without routes
+func NewRouter(name string) *Router {
+	return &Router{
+		Name: name,
+		In:   NewInPort(),
+		Out:  make(map[string]*OutPort),
+	}
+}
+
+// Add a route sending targets for which predicate returns true, to the
+// out-port outPortName, which is created. Routes are tried in the order
+// they were added.
+func (proc *Router) AddRoute(outPortName string, predicate func(*FileTarget) bool) {
+	if _, ok := proc.Out[outPortName]; !ok {
+		proc.Out[outPortName] = NewOutPort()
+	}
+	proc.routes = append(proc.routes, &route{outPortName: outPortName, predicate: predicate})
+}
+
+// Add a route sending all targets not matched by previous routes to the
+// out-port outPortName
+func (proc *Router) AddDefaultRoute(outPortName string) {
+	proc.AddRoute(outPortName, func(ft *FileTarget) bool { return true })
+}
+
+func (proc *Router) IsConnected() bool {
+	isConnected := proc.In.IsConnected()
+	for oname, oport := range proc.Out {
+		if !oport.IsConnected() {
+			Error.Printf("OutPort %s of router %s is not connected - check your workflow code!\n", oname, proc.Name)
+			isConnected = false
+		}
+	}
+	return isConnected
+}
+
+// Execute the Router component
+func (proc *Router) Run() {
+	defer func() {
+		for _, oport := range proc.Out {
+			oport.Close()
+		}
+	}()
+	for ft := range proc.In.Chan {
+		routed := false
+		for _, r := range proc.routes {
+			if r.predicate(ft) {
+				Debug.Printf("Router %s: Routing %s to out-port %s\n", proc.Name, ft.GetPath(), r.outPortName)
+				proc.Out[r.outPortName].Chan <- ft
+				routed = true
+				break
+			}
+		}
+		if !routed {
+			Warning.Printf("Router %s: No route matched %s, so dropping it\n", proc.Name, ft.GetPath())
+		}
+	}
+}
+
+// ------- Route predicates -------
+
+// Get a predicate matching targets with the tag key set to value
+func TagEquals(key string, value string) func(*FileTarget) bool {
+	return func(ft *FileTarget) bool {
+		return ft.GetTag(key) == value
+	}
+}
+
+// Get a predicate matching targets whose file name (the last element of the
+// path) matches the shell file name pattern (see filepath.Match)
+func PathMatches(pattern string) func(*FileTarget) bool {
+	return func(ft *FileTarget) bool {
+		matched, err := filepath.Match(pattern, filepath.Base(ft.GetPath()))
+		Check(err)
+		return matched
+	}
+}
+
+// Get a predicate matching targets whose file is at least minBytes in size
+func SizeAtLeast(minBytes int64) func(*FileTarget) bool {
+	return func(ft *FileTarget) bool {
+		fi, err := os.Stat(ft.GetPath())
+		return err == nil && fi.Size() >= minBytes
+	}
+}
@@ -0,0 +1,34 @@
+package scipipe
+
+import (
+	"github.com/stretchr/testify/assert"
+	t "testing"
+)
+
+func TestRouter(t *t.T) {
+	initTestLogs()
+
+	a := NewFileTarget("/tmp/router_a.fastq")
+	a.AddTag("type", "control")
+	b := NewFileTarget("/tmp/router_b.bam")
+	c := NewFileTarget("/tmp/router_c.fastq")
+
+	rtr := NewRouter("rtr")
+	rtr.AddRoute("controls", TagEquals("type", "control"))
+	rtr.AddRoute("fastqs", PathMatches("*.fastq"))
+	rtr.AddDefaultRoute("other")
+
+	rtr.In.Chan = make(chan *FileTarget, 3)
+	for _, ft := range []*FileTarget{a, b, c} {
+		rtr.In.Chan <- ft
+	}
+	close(rtr.In.Chan)
+	for _, oport := range rtr.Out {
+		oport.Chan = make(chan *FileTarget, 3)
+	}
+	rtr.Run()
+
+	assert.EqualValues(t, a, <-rtr.Out["controls"].Chan)
+	assert.EqualValues(t, c, <-rtr.Out["fastqs"].Chan)
+	assert.EqualValues(t, b, <-rtr.Out["other"].Chan)
+}
@@ -0,0 +1,193 @@
+package scipipe
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	str "strings"
+	"time"
+)
+
+// ======= Run state ========
+
+// RunState is the recorded state of a run of a workflow, written to the
+// StateDir of the workflow when the run starts, when it is done, and every
+// CheckpointInterval, if set, in between, so that past runs can be
+// inspected, and resumed, later, such as with the scipipe command (see also
+// Workflow.Restart). A run that is still in the state RunRunning after the
+// program exited was interrupted.
+type RunState struct {
+	Workflow   string
+	State      string
+	Errors     []string `json:",omitempty"`
+	StartTime  time.Time
+	FinishTime time.Time
+	// The spec of the workflow, if it was created from one (see
+	// NewWorkflowFromSpec), so that the run can be resumed
+	Spec *WorkflowSpec `json:",omitempty"`
+	// The records of all tasks executed (or failed) in the run
+	Tasks []TaskRecord
+	// The records of the tasks that were running, and of the tasks created
+	// but not yet started, when the state was written as a checkpoint
+	Running []TaskRecord `json:",omitempty"`
+	Queued  []TaskRecord `json:",omitempty"`
+	// The path of the file the state was read from
+	Path string `json:"-"`
+}
+
+// The time format of the names of run state files
+const runStateTimeFormat = "20060102-150405.000"
+
+// Get the path of the run state file of the current run of the workflow
+func (wf *Workflow) getRunStatePath() string {
+	wf.lock.Lock()
+	defer wf.lock.Unlock()
+	name := fmt.Sprintf("%s-%s.json", wf.Name, wf.startTime.Format(runStateTimeFormat))
+	return filepath.Join(wf.StateDir, str.Replace(name, string(filepath.Separator), "_", -1))
+}
+
+// Write the state of the run of the workflow, ended with the error err if
+// it is done, to its StateDir, if set, and if tasks are executed
+func (wf *Workflow) writeRunState(done bool, err error) {
+	if wf.StateDir == "" || wf.noExecute {
+		return
+	}
+	rs := wf.GetStats()
+	if rs.StartTime.IsZero() {
+		// The run never started, such as since the workflow is not valid
+		return
+	}
+	state := &RunState{
+		Workflow:   wf.Name,
+		State:      RunRunning,
+		StartTime:  rs.StartTime,
+		FinishTime: rs.FinishTime,
+		Spec:       wf.spec,
+		Tasks:      wf.GetTaskRecords(),
+	}
+	if !done {
+		state.Running, state.Queued = wf.getPendingTaskRecords()
+	}
+	if done {
+		state.State = RunSucceeded
+		if wf.IsCancelled() {
+			state.State = RunCancelled
+		} else if err != nil {
+			state.State = RunFailed
+		}
+	}
+	if runErr, ok := err.(*RunError); ok {
+		for _, e := range runErr.Errors {
+			state.Errors = append(state.Errors, e.Error())
+		}
+	} else if err != nil {
+		state.Errors = []string{err.Error()}
+	}
+	if err := os.MkdirAll(wf.StateDir, 0777); err != nil {
+		Warning.Printf("Workflow %s: Could not create state dir: %s\n", wf.Name, err)
+		return
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	Check(err)
+	path := wf.getRunStatePath()
+	if err := ioutil.WriteFile(path+".tmp", data, 0644); err != nil {
+		Warning.Printf("Workflow %s: Could not write run state: %s\n", wf.Name, err)
+		return
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		Warning.Printf("Workflow %s: Could not write run state: %s\n", wf.Name, err)
+	}
+}
+
+// Read the states of all runs recorded in the state dir dir, oldest first
+func ReadRunStates(dir string) ([]*RunState, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	states := []*RunState{}
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		state := &RunState{}
+		if err := json.Unmarshal(data, state); err != nil {
+			return nil, fmt.Errorf("Could not parse run state %s: %s", path, err)
+		}
+		state.Path = path
+		states = append(states, state)
+	}
+	sort.SliceStable(states, func(i, j int) bool {
+		return states[i].StartTime.Before(states[j].StartTime)
+	})
+	return states, nil
+}
+
+// Read the state of the latest run recorded in the state dir dir, or of
+// the latest run of the workflow named wfName, if not empty
+func ReadLastRunState(dir string, wfName string) (*RunState, error) {
+	states, err := ReadRunStates(dir)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(states) - 1; i >= 0; i-- {
+		if wfName == "" || states[i].Workflow == wfName {
+			return states[i], nil
+		}
+	}
+	if wfName != "" {
+		return nil, fmt.Errorf("No runs of workflow %s recorded in %s", wfName, dir)
+	}
+	return nil, fmt.Errorf("No runs recorded in %s", dir)
+}
+
+// Get the paths of the temporary files of the outputs of the tasks of the
+// run, including those that were running, that exist, such as those left by
+// commands that were killed
+func (state *RunState) GetLeftoverTempPaths() []string {
+	paths := []string{}
+	for _, tr := range append(append([]TaskRecord{}, state.Tasks...), state.Running...) {
+		for oname, opath := range tr.Outputs {
+			tmpPath := opath + ".tmp"
+			if tr.TempPaths[oname] != "" {
+				tmpPath = tr.TempPaths[oname]
+			}
+			if _, err := os.Stat(tmpPath); err == nil {
+				paths = append(paths, tmpPath)
+			}
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Get the paths of the outputs, and audit files, that exist, of the tasks
+// that were running or queued, but did not finish, in that some of their
+// outputs, or audit files, are missing, such as when a crash interrupted
+// the finalizing of the outputs. Tasks that finished after the state was
+// written, with all outputs and audit files in place, are left out.
+func (state *RunState) GetUnfinishedPaths() []string {
+	paths := []string{}
+	for _, tr := range append(append([]TaskRecord{}, state.Running...), state.Queued...) {
+		existing := []string{}
+		finished := true
+		for _, opath := range tr.Outputs {
+			for _, path := range []string{opath, NewFileTarget(opath).GetAuditFilePath()} {
+				if _, err := os.Stat(path); err == nil {
+					existing = append(existing, path)
+				} else {
+					finished = false
+				}
+			}
+		}
+		if !finished {
+			paths = append(paths, existing...)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
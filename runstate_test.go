@@ -0,0 +1,223 @@
+package scipipe
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	t "testing"
+	"time"
+)
+
+func TestRunState(t *t.T) {
+	initTestLogs()
+
+	stateDir := "/tmp/runstate_test"
+	os.RemoveAll(stateDir)
+	defer os.RemoveAll(stateDir)
+
+	newWf := func() *Workflow {
+		spec := &WorkflowSpec{
+			Name:   "foobar",
+			Params: map[string]string{"word": "foo"},
+			Processes: []ProcessSpec{
+				{Name: "foo", Command: "echo {p:word} > {o:out}", Outputs: map[string]string{"out": "/tmp/runstate_{p:word}.txt"}},
+				{Name: "fail", Command: "cat {i:in} > {o:out}; exit 1", Outputs: map[string]string{"out": "{i:in}.fail"}},
+			},
+			Connections: []Connection{{From: "foo.out", To: "fail.in"}},
+		}
+		wf, err := NewWorkflowFromSpec(spec)
+		assert.Nil(t, err)
+		wf.StateDir = stateDir
+		return wf
+	}
+	defer cleanFiles("/tmp/runstate_foo.txt")
+
+	assert.Error(t, newWf().Run())
+	states, err := ReadRunStates(stateDir)
+	assert.Nil(t, err)
+	assert.Len(t, states, 1)
+	state := states[0]
+	assert.EqualValues(t, "foobar", state.Workflow)
+	assert.EqualValues(t, RunFailed, state.State)
+	assert.Len(t, state.Errors, 1)
+	assert.Len(t, state.Tasks, 2)
+	assert.EqualValues(t, "foo", state.Spec.Params["word"])
+	assert.False(t, state.FinishTime.IsZero())
+
+	// A leftover temporary file, as of a killed command
+	err = ioutil.WriteFile("/tmp/runstate_foo.txt.fail.tmp", []byte("foo\n"), 0644)
+	assert.Nil(t, err)
+	defer os.Remove("/tmp/runstate_foo.txt.fail.tmp")
+	assert.EqualValues(t, []string{"/tmp/runstate_foo.txt.fail.tmp"}, state.GetLeftoverTempPaths())
+
+	// A second run, from the recorded spec, is the latest
+	os.Remove("/tmp/runstate_foo.txt.fail.tmp")
+	wf, err := NewWorkflowFromSpec(state.Spec)
+	assert.Nil(t, err)
+	wf.StateDir = stateDir
+	assert.Error(t, wf.Run())
+	last, err := ReadLastRunState(stateDir, "foobar")
+	assert.Nil(t, err)
+	assert.NotEqual(t, state.Path, last.Path)
+	assert.Len(t, last.Tasks, 1)
+
+	_, err = ReadLastRunState(stateDir, "other")
+	assert.Error(t, err)
+}
+
+func TestCheckpointRestart(t *t.T) {
+	initTestLogs()
+
+	stateDir := "/tmp/checkpoint_test"
+	os.RemoveAll(stateDir)
+	defer os.RemoveAll(stateDir)
+	defer cleanFiles("/tmp/checkpoint_out.txt")
+
+	newWf := func(cmd string) *Workflow {
+		p := NewFromShell("write", cmd)
+		p.SetPathStatic("out", "/tmp/checkpoint_out.txt")
+		snk := NewSink()
+		snk.Connect(p.Out["out"])
+		wf := NewWorkflow("checkpoint")
+		wf.AddProcesses(p, snk)
+		wf.StateDir = stateDir
+		wf.CheckpointInterval = 20 * time.Millisecond
+		return wf
+	}
+
+	// While the task runs, checkpoints record it as running
+	wf := newWf("sleep 0.3 && echo foo > {o:out}")
+	running := make(chan []TaskRecord, 1)
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		state, err := ReadLastRunState(stateDir, "checkpoint")
+		if !assert.Nil(t, err) {
+			running <- nil
+			return
+		}
+		running <- state.Running
+	}()
+	assert.Nil(t, wf.Run())
+	assert.Len(t, <-running, 1)
+	state, err := ReadLastRunState(stateDir, "checkpoint")
+	assert.Nil(t, err)
+	assert.Len(t, state.Tasks, 1)
+	assert.Len(t, state.Running, 0)
+
+	// Simulate a crash while the task was running, leaving its temp file
+	cleanFiles("/tmp/checkpoint_out.txt")
+	state.State = RunRunning
+	state.Running, state.Tasks = state.Tasks, nil
+	state.StartTime = time.Now()
+	dat, err := json.Marshal(state)
+	assert.Nil(t, err)
+	assert.Nil(t, ioutil.WriteFile(stateDir+"/crashed.json", dat, 0644))
+	assert.Nil(t, ioutil.WriteFile("/tmp/checkpoint_out.txt.tmp", []byte("fo"), 0644))
+	defer os.Remove("/tmp/checkpoint_out.txt.tmp")
+
+	wf = newWf("echo bar > {o:out}")
+	wf.Restart = true
+	assert.Nil(t, wf.Run())
+	dat, err = ioutil.ReadFile("/tmp/checkpoint_out.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "bar\n", string(dat))
+}
+
+func TestCheckpointQueuedTasks(t *t.T) {
+	initTestLogs()
+
+	stateDir := "/tmp/checkpoint_queued_test"
+	os.RemoveAll(stateDir)
+	defer os.RemoveAll(stateDir)
+	defer cleanFiles("/tmp/checkpoint_queued_a.txt.out", "/tmp/checkpoint_queued_b.txt.out", "/tmp/checkpoint_queued_go")
+
+	// The tasks wait for the test to let them finish, and only one can run
+	// at a time, so that the other is queued
+	src := NewFileQueue("/tmp/checkpoint_queued_a.txt", "/tmp/checkpoint_queued_b.txt")
+	p := NewFromShell("wait", "while [ ! -f /tmp/checkpoint_queued_go ]; do sleep 0.01; done; echo {i:in} > {o:out}")
+	p.SetPathExtend("in", "out", ".out")
+	p.In["in"].Connect(src.Out)
+	snk := NewSink()
+	snk.Connect(p.Out["out"])
+	wf := NewWorkflow("queued")
+	wf.AddProcesses(src, p, snk)
+	wf.StateDir = stateDir
+	wf.CheckpointInterval = 10 * time.Millisecond
+	wf.MaxConcurrentTasks = 1
+
+	pending := make(chan *RunState, 1)
+	go func() {
+		defer ioutil.WriteFile("/tmp/checkpoint_queued_go", []byte{}, 0644)
+		for i := 0; i < 500; i++ {
+			state, err := ReadLastRunState(stateDir, "queued")
+			if err == nil && len(state.Running) == 1 && len(state.Queued) == 1 {
+				pending <- state
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		pending <- nil
+	}()
+	assert.Nil(t, wf.Run())
+	state := <-pending
+	if assert.NotNil(t, state, "no checkpoint with one task running and one queued") {
+		paths := []string{state.Running[0].Outputs["out"], state.Queued[0].Outputs["out"]}
+		assert.Contains(t, paths, "/tmp/checkpoint_queued_a.txt.out")
+		assert.Contains(t, paths, "/tmp/checkpoint_queued_b.txt.out")
+	}
+	state, err := ReadLastRunState(stateDir, "queued")
+	assert.Nil(t, err)
+	assert.Empty(t, state.Running)
+	assert.Empty(t, state.Queued)
+}
+
+func TestCheckpointHooksOnlyWhenCheckpointing(t *t.T) {
+	initTestLogs()
+
+	stateDir := "/tmp/checkpoint_hooks_test"
+	os.RemoveAll(stateDir)
+	defer os.RemoveAll(stateDir)
+	defer cleanFiles("/tmp/checkpoint_hooks.txt")
+
+	p := NewFromShell("write", "echo foo > {o:out}")
+	p.SetPathStatic("out", "/tmp/checkpoint_hooks.txt")
+	wf := NewWorkflow("hooks")
+	wf.AddProcesses(p, NewSink())
+	wf.Connect("write.out", "sink.in")
+	wf.StateDir = stateDir
+	assert.Nil(t, wf.Run())
+	assert.Len(t, wf.hooks.task[taskStartEvent], 0)
+	assert.Len(t, wf.hooks.task[taskCreatedEvent], 0)
+}
+
+func TestGetUnfinishedPaths(t *t.T) {
+	initTestLogs()
+
+	files := []string{
+		"/tmp/unfinished_done.txt", "/tmp/unfinished_done.txt.audit.json",
+		"/tmp/unfinished_partial_a.txt", "/tmp/unfinished_partial_a.txt.audit.json",
+		"/tmp/unfinished_partial_b.txt",
+	}
+	for _, path := range files {
+		assert.Nil(t, ioutil.WriteFile(path, []byte("x"), 0644))
+	}
+	defer cleanFiles(files...)
+
+	state := &RunState{
+		Running: []TaskRecord{
+			// Finished after the checkpoint, with its output and audit file
+			{Name: "done", Outputs: map[string]string{"out": "/tmp/unfinished_done.txt"}},
+			// Interrupted while finalizing its outputs
+			{Name: "partial", Outputs: map[string]string{"a": "/tmp/unfinished_partial_a.txt", "b": "/tmp/unfinished_partial_b.txt"}},
+		},
+		Queued: []TaskRecord{
+			{Name: "queued", Outputs: map[string]string{"out": "/tmp/unfinished_queued.txt"}},
+		},
+	}
+	assert.EqualValues(t, []string{
+		"/tmp/unfinished_partial_a.txt",
+		"/tmp/unfinished_partial_a.txt.audit.json",
+		"/tmp/unfinished_partial_b.txt",
+	}, state.GetUnfinishedPaths())
+}
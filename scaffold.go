@@ -0,0 +1,150 @@
+package scipipe
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"io"
+	"sort"
+	"strconv"
+	str "strings"
+	"text/template"
+	"unicode"
+)
+
+// ======= Component scaffolding ========
+
+// Write the source code of a typed component, in the Go package pkg, to w,
+// for the shell command pattern cmd. The component is a struct type named
+// typeName, embedding the SciProcess created from cmd, with fields for its
+// ports, named after them, with In, Out and Param prefixes, as in:
+//
+//	type Align struct {
+//		*scipipe.SciProcess
+//		InReads  *scipipe.InPort
+//		OutSam   *scipipe.OutPort
+//		ParamRef *scipipe.ParamPort
+//	}
+//
+// and a constructor, NewAlign(name string). Connecting the fields of
+// components, as in align.InReads.Connect(trim.OutFastq), rather than
+// looking up the ports by name, means that connections are checked when
+// the workflow is compiled. It is used by the component command of the
+// scipipe tool, which is suitable for go:generate.
+func WriteComponent(w io.Writer, pkg string, typeName string, cmd string) error {
+	if !token.IsIdentifier(pkg) {
+		return fmt.Errorf("Invalid package name: %s", pkg)
+	}
+	if !token.IsIdentifier(typeName) || !token.IsExported(typeName) {
+		return fmt.Errorf("Invalid type name: %s (must be an exported Go identifier)", typeName)
+	}
+	p := NewFromShell(typeName, cmd)
+	data := &componentData{
+		Package: pkg,
+		Type:    typeName,
+		Command: strconv.Quote(cmd),
+		Comment: str.Replace(cmd, "\n", " ", -1),
+	}
+	fieldNames := make(map[string]string)
+	addFields := func(prefix string, typ string, portMap string, names []string) error {
+		sort.Strings(names)
+		for _, name := range names {
+			if camelCase(name) == "" {
+				return fmt.Errorf("Port %s of command %s has no letters or digits, for a field name", name, cmd)
+			}
+			field := prefix + camelCase(name)
+			if other, ok := fieldNames[field]; ok {
+				return fmt.Errorf("Ports %s and %s of command %s would get the same field name %s", other, name, cmd, field)
+			}
+			fieldNames[field] = name
+			data.Fields = append(data.Fields, componentField{Name: field, Type: typ, Map: portMap, Port: strconv.Quote(name)})
+		}
+		return nil
+	}
+	inNames, outNames, paramNames := []string{}, []string{}, []string{}
+	for name := range p.In {
+		inNames = append(inNames, name)
+	}
+	for name := range p.Out {
+		outNames = append(outNames, name)
+	}
+	for name := range p.ParamPorts {
+		paramNames = append(paramNames, name)
+	}
+	if err := addFields("In", "InPort", "In", inNames); err != nil {
+		return err
+	}
+	if err := addFields("Out", "OutPort", "Out", outNames); err != nil {
+		return err
+	}
+	if err := addFields("Param", "ParamPort", "ParamPorts", paramNames); err != nil {
+		return err
+	}
+	buf := new(bytes.Buffer)
+	if err := componentTemplate.Execute(buf, data); err != nil {
+		return err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+// Convert a port name, such as "reads_1", to camel case, as in "Reads1"
+func camelCase(name string) string {
+	parts := str.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	s := ""
+	for _, part := range parts {
+		runes := []rune(part)
+		s += string(unicode.ToUpper(runes[0])) + string(runes[1:])
+	}
+	return s
+}
+
+type componentData struct {
+	Package string
+	Type    string
+	Command string
+	Comment string
+	Fields  []componentField
+}
+
+// componentField is a port field of a generated component, where Map is
+// the field of the SciProcess with the port, as in "In"
+type componentField struct {
+	Name string
+	Type string
+	Map  string
+	Port string
+}
+
+var componentTemplate = template.Must(template.New("component").Parse(`// Code generated by scipipe. DO NOT EDIT.
+
+package {{.Package}}
+
+import "github.com/scipipe/scipipe"
+
+// {{.Type}} is a component running the command:
+//
+//	{{.Comment}}
+type {{.Type}} struct {
+	*scipipe.SciProcess
+	{{range .Fields}}{{.Name}} *scipipe.{{.Type}}
+	{{end}}
+}
+
+// New{{.Type}} creates a new {{.Type}}, named name
+func New{{.Type}}(name string) *{{.Type}} {
+	p := scipipe.NewFromShell(name, {{.Command}})
+	return &{{.Type}}{
+		SciProcess: p,
+		{{range .Fields}}{{.Name}}: p.{{.Map}}[{{.Port}}],
+		{{end}}
+	}
+}
+`))
@@ -0,0 +1,24 @@
+package scipipe
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	t "testing"
+)
+
+func TestWriteComponent(t *t.T) {
+	initTestLogs()
+
+	buf := new(bytes.Buffer)
+	err := WriteComponent(buf, "main", "Align", "bwa mem -t {p:threads} {i:ref} {i:reads_1} > {o:sam}")
+	assert.Nil(t, err)
+	src := buf.String()
+	assert.Contains(t, src, "package main\n")
+	assert.Contains(t, src, "type Align struct {\n\t*scipipe.SciProcess\n\tInReads1     *scipipe.InPort\n\tInRef        *scipipe.InPort\n\tOutSam       *scipipe.OutPort\n\tParamThreads *scipipe.ParamPort\n}")
+	assert.Contains(t, src, "func NewAlign(name string) *Align {")
+	assert.Contains(t, src, `InReads1:     p.In["reads_1"],`)
+	assert.Contains(t, src, `ParamThreads: p.ParamPorts["threads"],`)
+
+	assert.Error(t, WriteComponent(buf, "main", "align", "echo > {o:out}"))
+	assert.Error(t, WriteComponent(buf, "main", "Foo", "cat {i:a_b} {i:aB} > {o:out}"))
+}
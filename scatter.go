@@ -0,0 +1,145 @@
+package scipipe
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// ======= Scatter ========
+
+// Scatter is a component that splits each target received on its In-port
+// into many targets, sent on its Out-port, so that a downstream process runs
+// one task for each of them, in parallel. How targets are split is decided
+// by the Split function, which by default splits list targets (see
+// NewFileListTarget) into their targets, and passes other targets on as is.
+// Each target sent is a copy (see FileTarget.Copy), tagged with its index
+// among the targets split from the same input, as "scatter_index", and
+// their number, as "scatter_count". These tags are inherited by the outputs
+// of downstream tasks, and are used by Gather to restore the order.
+type Scatter struct {
+	Process
+	Name  string
+	In    *InPort
+	Out   *OutPort
+	Split func(*FileTarget) []*FileTarget
+}
+
+// Instantiate a Scatter component, splitting list targets into their
+// targets
+func NewScatter(name string) *Scatter {
+	return &Scatter{
+		Name:  name,
+		In:    NewInPort(),
+		Out:   NewOutPort(),
+		Split: splitList,
+	}
+}
+
+// Instantiate a Scatter component, sending each target once for each of
+// values, tagged with the value as tagKey (e.g. for scattering over
+// chromosomes, used in commands as {t:TAGKEY})
+func NewScatterByValues(name string, tagKey string, values ...string) *Scatter {
+	s := NewScatter(name)
+	s.Split = func(ft *FileTarget) []*FileTarget {
+		fts := []*FileTarget{}
+		for _, val := range values {
+			cp := ft.Copy()
+			cp.AddTag(tagKey, val)
+			fts = append(fts, cp)
+		}
+		return fts
+	}
+	return s
+}
+
+// Split list targets into their targets, and leave other targets as is
+func splitList(ft *FileTarget) []*FileTarget {
+	if ft.IsList() {
+		return ft.GetTargets()
+	}
+	return []*FileTarget{ft}
+}
+
+func (proc *Scatter) IsConnected() bool {
+	return proc.In.IsConnected() && proc.Out.IsConnected()
+}
+
+// Execute the Scatter component
+func (proc *Scatter) Run() {
+	defer proc.Out.Close()
+	for ft := range proc.In.Chan {
+		parts := proc.Split(ft)
+		Debug.Printf("Scatter %s: Scattering %s into %d targets\n", proc.Name, ft.GetPath(), len(parts))
+		for i, part := range parts {
+			cp := part.Copy()
+			cp.AddTag("scatter_index", fmt.Sprintf("%d", i))
+			cp.AddTag("scatter_count", fmt.Sprintf("%d", len(parts)))
+			proc.Out.Chan <- cp
+		}
+	}
+}
+
+// ======= Gather ========
+
+// Gather is a component that collects all targets received on its In-port,
+// and sends them as a single list target (see NewFileListTarget) on its
+// Out-port, when the In-port is closed. Targets are ordered by their
+// "scatter_index" tag (as set by Scatter), if set, and otherwise in the
+// order received. If GroupByTag is set, one list target is sent for each
+// value of that tag (e.g. one per sample), in the order the values are
+// first seen.
+type Gather struct {
+	Process
+	Name       string
+	In         *InPort
+	Out        *OutPort
+	GroupByTag string
+}
+
+// Instantiate a Gather component
+func NewGather(name string) *Gather {
+	return &Gather{
+		Name: name,
+		In:   NewInPort(),
+		Out:  NewOutPort(),
+	}
+}
+
+func (proc *Gather) IsConnected() bool {
+	return proc.In.IsConnected() && proc.Out.IsConnected()
+}
+
+// Execute the Gather component
+func (proc *Gather) Run() {
+	defer proc.Out.Close()
+	groups := make(map[string][]*FileTarget)
+	groupNames := []string{}
+	for ft := range proc.In.Chan {
+		group := ""
+		if proc.GroupByTag != "" {
+			group = ft.GetTag(proc.GroupByTag)
+		}
+		if _, ok := groups[group]; !ok {
+			groupNames = append(groupNames, group)
+		}
+		groups[group] = append(groups[group], ft)
+	}
+	for _, group := range groupNames {
+		fts := groups[group]
+		sort.SliceStable(fts, func(i, j int) bool {
+			return scatterIndex(fts[i]) < scatterIndex(fts[j])
+		})
+		Debug.Printf("Gather %s: Sending list of %d targets\n", proc.Name, len(fts))
+		proc.Out.Chan <- NewFileListTarget(fts...)
+	}
+}
+
+// Get the scatter index of the target, or -1 if it is not set
+func scatterIndex(ft *FileTarget) int {
+	idx, err := strconv.Atoi(ft.GetTag("scatter_index"))
+	if err != nil {
+		return -1
+	}
+	return idx
+}
@@ -0,0 +1,43 @@
+package scipipe
+
+import (
+	"github.com/stretchr/testify/assert"
+	t "testing"
+)
+
+func TestScatterGather(t *t.T) {
+	initTestLogs()
+
+	ft := NewFileTarget("/tmp/sg_in.txt")
+	ft.WriteTempFile([]byte("in\n"))
+	ft.Atomize()
+
+	sct := NewScatterByValues("sct", "chrom", "chr1", "chr2", "chr3")
+	prc := NewFromShell("prc", "sleep 0.0$((3 - {t:scatter_index})); cat {i:in} > /dev/null; echo {t:chrom} > {o:out}")
+	prc.PathFormatters["out"] = func(task *SciTask) string {
+		return "/tmp/sg_" + task.GetTag("chrom") + ".txt"
+	}
+	gth := NewGather("gth")
+	mrg := NewFromShell("mrg", "cat {i:parts} > {o:merged}")
+	mrg.SetPathStatic("merged", "/tmp/sg_merged.txt")
+
+	sct.In.Chan = make(chan *FileTarget, 1)
+	sct.In.Chan <- ft
+	close(sct.In.Chan)
+	prc.In["in"].Connect(sct.Out)
+	gth.In.Connect(prc.Out["out"])
+	mrg.In["parts"].Connect(gth.Out)
+	mrg.Out["merged"].Chan = make(chan *FileTarget, BUFSIZE)
+
+	go sct.Run()
+	go prc.Run()
+	go gth.Run()
+	go mrg.Run()
+
+	out := <-mrg.Out["merged"].Chan
+	assert.EqualValues(t, "chr1\nchr2\nchr3\n", string(out.Read()))
+	// The tags of the original target are not affected
+	assert.EqualValues(t, "", ft.GetTag("chrom"))
+
+	cleanFiles("/tmp/sg_in.txt", "/tmp/sg_chr1.txt", "/tmp/sg_chr2.txt", "/tmp/sg_chr3.txt", "/tmp/sg_merged.txt")
+}
@@ -0,0 +1,215 @@
+package scipipe
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ======= Scheduler ========
+
+// scheduler limits the number of tasks that execute their commands at the
+// same time, across all processes of a pipeline, as well as per process
+// (see SciProcess.MaxConcurrentTasks), and makes sure that the cores and
+// memory declared by the processes of running tasks stay within a budget.
+// Tasks acquire a slot before executing, and release it when done. When
+// tasks are waiting for slots, the tasks of processes with higher priority
+// (see SciProcess.Priority) get them first. Tasks of rate limited processes
+// (see SciProcess.RateLimit) wait for their turn to start before they wait
+// for a slot, so that they do not hold slots that other tasks could use.
+type scheduler struct {
+	maxTasks       int
+	maxCores       int
+	maxMemoryMB    int
+	running        int
+	usedCores      int
+	usedMemoryMB   int
+	runningPerProc map[*SciProcess]int
+	waiting        map[*SciTask]bool
+	rateLimiters   map[*SciProcess]*rateLimiter
+	lock           *sync.Mutex
+	cond           *sync.Cond
+}
+
+// Create a new scheduler, allowing maxTasks tasks to execute at the same
+// time (or any number of tasks, if maxTasks is 0)
+func newScheduler(maxTasks int) *scheduler {
+	lock := new(sync.Mutex)
+	return &scheduler{
+		maxTasks:       maxTasks,
+		runningPerProc: make(map[*SciProcess]int),
+		waiting:        make(map[*SciTask]bool),
+		rateLimiters:   make(map[*SciProcess]*rateLimiter),
+		lock:           lock,
+		cond:           sync.NewCond(lock),
+	}
+}
+
+// Check whether the task t is exempt from the limit. Tasks reading from
+// streams are, since the task writing to the stream blocks until the stream
+// is read, and would otherwise be able to occupy all slots.
+func (s *scheduler) isExempt(t *SciTask) bool {
+	for _, itgt := range t.InTargets {
+		if itgt.IsStreaming() {
+			return true
+		}
+	}
+	return false
+}
+
+// Wait until the task t can execute, and occupy a slot for it, returning
+// ErrCancelled, without occupying a slot, if the run is cancelled while
+// waiting for its turn to start (see SciProcess.RateLimit)
+func (s *scheduler) acquire(t *SciTask) error {
+	if t.process.RateLimit > 0 {
+		if err := s.getRateLimiter(t.process).wait(t.process.getContext()); err != nil {
+			return ErrCancelled
+		}
+	}
+	if !s.isExempt(t) {
+		s.acquireSlot(t)
+	}
+	return nil
+}
+
+// Wait until there is a free slot for the task t, and occupy it
+func (s *scheduler) acquireSlot(t *SciTask) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.waiting[t] = true
+	for !s.hasFreeSlot(t) || s.isHigherPriorityTaskWaiting(t) {
+		s.cond.Wait()
+	}
+	delete(s.waiting, t)
+	s.running++
+	s.runningPerProc[t.process]++
+	s.usedCores += t.process.getCores()
+	s.usedMemoryMB += t.process.MemoryMB
+}
+
+// Check whether there is a free slot for the task t, both globally and for
+// its process. Must be called with the lock held.
+func (s *scheduler) hasFreeSlot(t *SciTask) bool {
+	if s.maxTasks > 0 && s.running >= s.maxTasks {
+		return false
+	}
+	maxProcTasks := t.process.MaxConcurrentTasks
+	if maxProcTasks > 0 && s.runningPerProc[t.process] >= maxProcTasks {
+		return false
+	}
+	// A task requesting more than the budget is still run, when nothing else
+	// runs, so that it does not wait forever
+	if s.running == 0 {
+		return true
+	}
+	if s.maxCores > 0 && s.usedCores+t.process.getCores() > s.maxCores {
+		return false
+	}
+	if s.maxMemoryMB > 0 && s.usedMemoryMB+t.process.MemoryMB > s.maxMemoryMB {
+		return false
+	}
+	return true
+}
+
+// Check whether a task with higher priority than t is waiting, and could
+// take a free slot. Must be called with the lock held.
+func (s *scheduler) isHigherPriorityTaskWaiting(t *SciTask) bool {
+	for w := range s.waiting {
+		if w.process.Priority > t.process.Priority && s.hasFreeSlot(w) {
+			return true
+		}
+	}
+	return false
+}
+
+// Release the slot occupied by the task t
+func (s *scheduler) release(t *SciTask) {
+	if s.isExempt(t) {
+		return
+	}
+	s.lock.Lock()
+	s.running--
+	s.runningPerProc[t.process]--
+	s.usedCores -= t.process.getCores()
+	s.usedMemoryMB -= t.process.MemoryMB
+	s.lock.Unlock()
+	s.cond.Broadcast()
+}
+
+// Get the rate limiter of the process p, creating it on first use
+func (s *scheduler) getRateLimiter(p *SciProcess) *rateLimiter {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	rl, ok := s.rateLimiters[p]
+	if !ok {
+		rl = newRateLimiter(p.RateLimit, p.RateBurst)
+		s.rateLimiters[p] = rl
+	}
+	return rl
+}
+
+// rateLimiter is a token bucket, filled with rate tokens per second, up to
+// burst tokens, from which each task starting takes one
+type rateLimiter struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	// The clock, which is time.Now, except in tests
+	now  func() time.Time
+	lock *sync.Mutex
+}
+
+// Create a new rate limiter, with a full bucket
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+		now:    time.Now,
+		lock:   new(sync.Mutex),
+	}
+}
+
+// Take a token, returning how long to wait before it is available. Tokens
+// are reserved in order, so that waiting tasks start one after another, at
+// the rate of the limiter.
+func (rl *rateLimiter) reserve() time.Duration {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+	now := rl.now()
+	rl.tokens += now.Sub(rl.last).Seconds() * rl.rate
+	if rl.tokens > rl.burst {
+		rl.tokens = rl.burst
+	}
+	rl.last = now
+	rl.tokens--
+	if rl.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-rl.tokens / rl.rate * float64(time.Second))
+}
+
+// Wait until a token is available, or ctx is cancelled, returning the
+// error of ctx in that case
+func (rl *rateLimiter) wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	delay := rl.reserve()
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,163 @@
+package scipipe
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	t "testing"
+	"time"
+)
+
+func TestMaxConcurrentTasks(t *t.T) {
+	initTestLogs()
+
+	assert.EqualValues(t, 2, runConcurrencyTest(func(pl *PipelineRunner, prc *SciProcess) {
+		pl.MaxConcurrentTasks = 2
+	}))
+	assert.EqualValues(t, 1, runConcurrencyTest(func(pl *PipelineRunner, prc *SciProcess) {
+		pl.MaxConcurrentTasks = 3
+		prc.MaxConcurrentTasks = 1
+	}))
+}
+
+func TestResourceBudget(t *t.T) {
+	initTestLogs()
+
+	assert.EqualValues(t, 2, runConcurrencyTest(func(pl *PipelineRunner, prc *SciProcess) {
+		pl.MaxCores = 5
+		prc.Cores = 2
+	}))
+	assert.EqualValues(t, 3, runConcurrencyTest(func(pl *PipelineRunner, prc *SciProcess) {
+		pl.MaxMemoryMB = 3000
+		prc.MemoryMB = 1000
+	}))
+	// Tasks requesting more than the budget still run, one at a time
+	assert.EqualValues(t, 1, runConcurrencyTest(func(pl *PipelineRunner, prc *SciProcess) {
+		pl.MaxCores = 2
+		prc.Cores = 4
+	}))
+}
+
+// Run four tasks with the pipeline and process settings done by configure,
+// and return the maximum number of tasks running at once
+func runConcurrencyTest(configure func(pl *PipelineRunner, prc *SciProcess)) int {
+	lock := new(sync.Mutex)
+	running := 0
+	maxRunning := 0
+
+	fq := NewFileQueue("/tmp/s1.txt", "/tmp/s2.txt", "/tmp/s3.txt", "/tmp/s4.txt")
+	prc := NewFromShell("prc", "echo {i:in}")
+	prc.CustomExecute = func(task *SciTask) error {
+		lock.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		lock.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		lock.Lock()
+		running--
+		lock.Unlock()
+		return nil
+	}
+	prc.In["in"].Connect(fq.Out)
+
+	pl := NewPipelineRunner()
+	configure(pl, prc)
+	pl.AddProcesses(fq, prc)
+	pl.Run()
+
+	return maxRunning
+}
+
+func TestTaskPriority(t *t.T) {
+	initTestLogs()
+
+	lo := NewSciProcess("lo", "")
+	hi := NewSciProcess("hi", "")
+	hi.Priority = 10
+	newTask := func(p *SciProcess) *SciTask {
+		return &SciTask{Name: p.Name, InTargets: map[string]*FileTarget{}, process: p}
+	}
+
+	s := newScheduler(1)
+	first := newTask(lo)
+	s.acquire(first)
+
+	started := make(chan string, 2)
+	for _, p := range []*SciProcess{lo, hi} {
+		task := newTask(p)
+		go func() {
+			s.acquire(task)
+			started <- task.Name
+			s.release(task)
+		}()
+		// Wait for the task to be waiting for a slot
+		for {
+			s.lock.Lock()
+			isWaiting := s.waiting[task]
+			s.lock.Unlock()
+			if isWaiting {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	s.release(first)
+
+	assert.EqualValues(t, "hi", <-started)
+	assert.EqualValues(t, "lo", <-started)
+}
+
+func TestRateLimit(t *t.T) {
+	initTestLogs()
+
+	// The bucket is filled by a fake clock, so that the tokens taken do not
+	// depend on how fast the test runs
+	rl := newRateLimiter(20, 2)
+	clock := time.Unix(0, 0)
+	rl.now = func() time.Time { return clock }
+	rl.last = clock
+
+	// The first two tasks start at once, as a burst, and the rest wait in
+	// turn, one per 50 ms
+	delays := []time.Duration{}
+	for i := 0; i < 5; i++ {
+		delays = append(delays, rl.reserve())
+	}
+	assert.EqualValues(t, []time.Duration{0, 0, 50 * time.Millisecond, 100 * time.Millisecond, 150 * time.Millisecond}, delays)
+
+	// After the reserved tokens are used up, the bucket fills up again, up
+	// to the burst
+	clock = clock.Add(time.Second)
+	assert.EqualValues(t, time.Duration(0), rl.reserve())
+	assert.EqualValues(t, time.Duration(0), rl.reserve())
+	assert.True(t, rl.reserve() > 0, "more tokens than the burst after idle period")
+}
+
+func TestRateLimitBeforeSlot(t *t.T) {
+	initTestLogs()
+
+	// A task waiting for its turn to start does not hold the only slot
+	api := NewSciProcess("api", "")
+	api.SetRateLimit(0.001, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	api.ctx = ctx
+	other := NewSciProcess("other", "")
+	s := newScheduler(1)
+	first := &SciTask{Name: api.Name, InTargets: map[string]*FileTarget{}, process: api}
+	assert.Nil(t, s.acquire(first))
+	s.release(first)
+
+	waiting := &SciTask{Name: api.Name, InTargets: map[string]*FileTarget{}, process: api}
+	acquired := make(chan error)
+	go func() { acquired <- s.acquire(waiting) }()
+	task := &SciTask{Name: other.Name, InTargets: map[string]*FileTarget{}, process: other}
+	assert.Nil(t, s.acquire(task))
+	s.release(task)
+
+	// Cancelling the run stops the wait, without occupying a slot
+	cancel()
+	assert.EqualValues(t, ErrCancelled, <-acquired)
+	assert.EqualValues(t, 0, s.running)
+}
@@ -1,15 +1,38 @@
 package scipipe
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
 	//"os"
 	"os"
+	"path/filepath"
+	str "strings"
+	"sync"
 	t "testing"
 	"time"
 )
 
+func TestMain(m *t.M) {
+	// Workflows in the tests are not to pick up the config of the user
+	// running them
+	ConfigFiles = nil
+	os.Exit(m.Run())
+}
+
+// Initiate logging for the tests, once, since goroutines of earlier tests
+// may still be logging
 func initTestLogs() {
+	testLogsOnce.Do(resetTestLogs)
+}
+
+var testLogsOnce sync.Once
+
+// Initiate logging for the tests again, after a test has replaced the
+// loggers
+func resetTestLogs() {
 	//InitLogDebug()
 	InitLogWarning()
 }
@@ -61,7 +84,7 @@ func TestParameterCommand(t *t.T) {
 	}
 
 	// A printer process
-	prt := NewFromShell("prt", "cat {i:in} >> /tmp/log.txt; rm {i:in}")
+	prt := NewFromShell("prt", "cat {i:in} >> /tmp/log.txt; rm {i:in} {i:in}.audit.json")
 
 	// Connection info
 	abc.ParamPorts["a"].Connect(cmb.A)
@@ -93,7 +116,7 @@ func TestProcessWithoutInputsOutputs(t *t.T) {
 }
 
 func TestDontOverWriteExistingOutputs(t *t.T) {
-	InitLogError()
+	initTestLogs()
 	Debug.Println("Starting test TestDontOverWriteExistingOutputs")
 
 	f := "/tmp/hej.txt"
@@ -193,7 +216,7 @@ func TestSendsOrderedOutputs(t *t.T) {
 
 // Test that streaming works
 func TestStreaming(t *t.T) {
-	InitLogWarning()
+	initTestLogs()
 
 	// Init processes
 	ls := NewFromShell("ls", "ls -l / > {os:lsl}")
@@ -230,6 +253,210 @@ func TestStreaming(t *t.T) {
 	cleanFiles("/tmp/lsl.txt.fifo")
 }
 
+func TestStreamingToSeveralProcesses(t *t.T) {
+	initTestLogs()
+
+	// With a Tee, both consumers read their own FIFO file
+	ls := NewFromShell("ls", "ls -l / > {os:out}")
+	ls.SetPathStatic("out", "/tmp/tee_ls.txt")
+	tee := NewTee("tee", 2)
+	grp := NewFromShell("grp", "grep etc {i:in} > {o:out}")
+	grp.SetPathExtend("in", "out", ".grp")
+	cnt := NewFromShell("cnt", "wc -l < {i:in} > {o:out}")
+	cnt.SetPathExtend("in", "out", ".cnt")
+	snk := NewSink()
+	tee.In["in"].Connect(ls.Out["out"])
+	grp.In["in"].Connect(tee.Out["out1"])
+	cnt.In["in"].Connect(tee.Out["out2"])
+	snk.Connect(grp.Out["out"])
+	snk.Connect(cnt.Out["out"])
+	pl := NewPipelineRunner()
+	pl.AddProcesses(ls, tee, grp, cnt, snk)
+	assert.Nil(t, pl.Validate())
+	pl.Run()
+
+	assert.Contains(t, string(NewFileTarget("/tmp/tee_ls.txt.tee1.grp").Read()), "etc")
+	assert.NotEqual(t, "0", str.TrimSpace(string(NewFileTarget("/tmp/tee_ls.txt.tee2.cnt").Read())))
+	_, err := os.Stat("/tmp/tee_ls.txt")
+	assert.True(t, os.IsNotExist(err), "Streamed output should not be written to a file")
+	cleanFiles("/tmp/tee_ls.txt.fifo", "/tmp/tee_ls.txt.tee1.fifo", "/tmp/tee_ls.txt.tee2.fifo", "/tmp/tee_ls.txt.tee1.grp", "/tmp/tee_ls.txt.tee2.cnt")
+
+	// Without a Tee, the output is written to a file instead
+	ls = NewFromShell("ls", "ls -l / > {os:out}")
+	ls.SetPathStatic("out", "/tmp/tee_ls.txt")
+	grp = NewFromShell("grp", "grep etc {i:in} > {o:out}")
+	grp.SetPathExtend("in", "out", ".grp")
+	cnt = NewFromShell("cnt", "wc -l < {i:in} > {o:out}")
+	cnt.SetPathExtend("in", "out", ".cnt")
+	snk = NewSink()
+	grp.In["in"].Connect(ls.Out["out"])
+	cnt.In["in"].Connect(ls.Out["out"])
+	snk.Connect(grp.Out["out"])
+	snk.Connect(cnt.Out["out"])
+	pl = NewPipelineRunner()
+	pl.AddProcesses(ls, grp, cnt, snk)
+	assert.Nil(t, pl.Validate())
+	pl.Run()
+
+	assert.True(t, NewFileTarget("/tmp/tee_ls.txt").Exists())
+	assert.Contains(t, string(NewFileTarget("/tmp/tee_ls.txt.grp").Read()), "etc")
+	assert.NotEqual(t, "0", str.TrimSpace(string(NewFileTarget("/tmp/tee_ls.txt.cnt").Read())))
+	cleanFiles("/tmp/tee_ls.txt", "/tmp/tee_ls.txt.grp", "/tmp/tee_ls.txt.cnt")
+}
+
+func TestFanOut(t *t.T) {
+	initTestLogs()
+
+	inPaths := []string{"/tmp/fanout_1.txt", "/tmp/fanout_2.txt", "/tmp/fanout_3.txt"}
+	for _, path := range inPaths {
+		ioutil.WriteFile(path, []byte("foo\n"), 0644)
+	}
+	fq := NewFileQueue(inPaths...)
+	upper := NewFromShell("upper", "tr a-z A-Z < {i:in} > {o:out}")
+	upper.SetPathExtend("in", "out", ".upper")
+	count := NewFromShell("count", "wc -c < {i:in} > {o:out}")
+	count.SetPathExtend("in", "out", ".count")
+	snk := NewSink()
+
+	upper.In["in"].Connect(fq.Out)
+	count.In["in"].Connect(fq.Out)
+	snk.Connect(fq.Out)
+	snk.Connect(upper.Out["out"])
+	snk.Connect(count.Out["out"])
+	assert.Equal(t, 3, fq.Out.getConnectionCount())
+
+	pl := NewPipelineRunner()
+	pl.AddProcesses(fq, upper, count, snk)
+	pl.Run()
+
+	// Every consumer gets every target
+	for _, path := range inPaths {
+		assert.EqualValues(t, "FOO\n", string(NewFileTarget(path+".upper").Read()))
+		assert.EqualValues(t, "4", str.TrimSpace(string(NewFileTarget(path+".count").Read())))
+		cleanFiles(path, path+".upper", path+".count")
+	}
+}
+
+func TestPortBufferSize(t *t.T) {
+	initTestLogs()
+
+	paths := []string{}
+	for i := 0; i < 40; i++ {
+		paths = append(paths, fmt.Sprintf("/tmp/buf_%d.txt", i))
+	}
+	fq := NewFileQueue(paths...)
+	fq.Out.SetBufferSize(32)
+	inp := NewInPort()
+	inp.SetBufferSize(64)
+	inp.Connect(fq.Out)
+	assert.Equal(t, 64, cap(inp.Chan))
+
+	// The producer can run ahead of the consumer, as far as the buffer allows
+	fq.Run()
+	received := 0
+	for range inp.Chan {
+		received++
+	}
+	assert.Equal(t, 40, received)
+
+	other := NewInPort()
+	other.Connect(NewOutPort())
+	assert.Equal(t, PortBufferSize, cap(other.Chan))
+}
+
+func TestMerge(t *t.T) {
+	initTestLogs()
+
+	pathsA := []string{"/tmp/merge_a1.txt", "/tmp/merge_a2.txt"}
+	pathsB := []string{"/tmp/merge_b1.txt"}
+	for _, path := range append(pathsA, pathsB...) {
+		ioutil.WriteFile(path, []byte("foo\n"), 0644)
+	}
+	wf := NewWorkflow("merge")
+	wf.Add("dira", NewFileQueue(pathsA...))
+	wf.Add("dirb", NewFileQueue(pathsB...))
+	qc := NewFromShell("qc", "cat {i:in} > /dev/null; echo {t:origin} > {o:out}")
+	qc.SetPathExtend("in", "out", ".qc")
+	qc.In["in"].SetMergeMode(MergeOrdered)
+	qc.In["in"].SetMergeTag("origin")
+	wf.AddProcesses(qc, NewSink())
+	wf.Connect("dirb.out", "qc.in")
+	wf.Connect("dira.out", "qc.in")
+	wf.Connect("qc.out", "sink.in")
+	assert.EqualValues(t, []Connection{
+		{From: "dira.out", To: "qc.in"},
+		{From: "dirb.out", To: "qc.in"},
+		{From: "qc.out", To: "sink.in"},
+	}, wf.GetConnections())
+
+	lock := new(sync.Mutex)
+	indexes := make(map[string]int)
+	wf.OnTaskCreated(func(task *SciTask) {
+		lock.Lock()
+		indexes[task.GetInPath("in")] = task.Index
+		lock.Unlock()
+	})
+	assert.Nil(t, wf.Run())
+
+	// The targets of dirb, connected first, come first
+	assert.True(t, indexes["/tmp/merge_b1.txt"] < indexes["/tmp/merge_a1.txt"])
+	assert.True(t, indexes["/tmp/merge_a1.txt"] < indexes["/tmp/merge_a2.txt"])
+	for _, path := range pathsA {
+		assert.EqualValues(t, "dira.out\n", string(NewFileTarget(path+".qc").Read()))
+		cleanFiles(path, path+".qc")
+	}
+	assert.EqualValues(t, "dirb.out\n", string(NewFileTarget(pathsB[0]+".qc").Read()))
+	cleanFiles(pathsB[0], pathsB[0]+".qc")
+}
+
+func TestCustomExecute(t *t.T) {
+	initTestLogs()
+
+	foo := NewFromShell("foo", "{o:out}")
+	foo.SetPathStatic("out", "/tmp/custom_foo.txt")
+	foo.CustomExecute = func(task *SciTask) error {
+		return task.WriteOutString("out", "foo\n")
+	}
+	fail := NewFromShell("fail", "{i:in} {o:out}")
+	fail.SetPathExtend("in", "out", ".fail")
+	fail.CustomExecute = func(task *SciTask) error {
+		if err := task.WriteOutString("out", "partial"); err != nil {
+			return err
+		}
+		return errors.New("failed on purpose")
+	}
+	lazy := NewFromShell("lazy", "{i:in} {o:out}")
+	lazy.SetPathExtend("in", "out", ".lazy")
+	lazy.CustomExecute = func(task *SciTask) error {
+		return nil
+	}
+
+	wf := NewWorkflow("wf")
+	wf.AddProcesses(foo, fail, lazy, NewSink())
+	wf.Connect("foo.out", "fail.in")
+	wf.Connect("foo.out", "lazy.in")
+	wf.Connect("fail.out", "sink.in")
+	wf.Connect("lazy.out", "sink.in")
+	lock := new(sync.Mutex)
+	errs := make(map[string]string)
+	wf.OnTaskFailure(func(task *SciTask, err error) {
+		lock.Lock()
+		errs[task.Name] = err.Error()
+		lock.Unlock()
+	})
+	assert.NotNil(t, wf.Run())
+
+	assert.EqualValues(t, "foo\n", string(NewFileTarget("/tmp/custom_foo.txt").Read()))
+	assert.EqualValues(t, "failed on purpose", errs["fail"])
+	assert.Contains(t, errs["lazy"], "did not write output out")
+	// The outputs of failed tasks are removed, rather than atomized
+	for _, path := range []string{"/tmp/custom_foo.txt.fail", "/tmp/custom_foo.txt.fail.tmp"} {
+		_, err := os.Stat(path)
+		assert.True(t, os.IsNotExist(err))
+	}
+	cleanFiles("/tmp/custom_foo.txt")
+}
+
 // Helper processes
 
 type CombinatoricsProcess struct {
@@ -269,9 +496,695 @@ func (proc *CombinatoricsProcess) IsConnected() bool { return true }
 func cleanFiles(fileNames ...string) {
 	Debug.Println("Starting to remove files:", fileNames)
 	for _, fileName := range fileNames {
-		if _, err := os.Stat(fileName); err == nil {
-			os.Remove(fileName)
-			Debug.Println("Successfully removed file", fileName)
+		for _, fn := range []string{fileName, fileName + ".audit.json"} {
+			if _, err := os.Stat(fn); err == nil {
+				os.Remove(fn)
+				Debug.Println("Successfully removed file", fn)
+			}
+		}
+	}
+}
+
+// The command of the process f2b of the workflows of newTestFooBarWorkflow
+const testF2bCommand = "sed 's/foo/bar/' {i:in} > {o:out}"
+
+// Create a workflow named wf, of the process foo, writing "foo" to the file
+// pathPrefix + "foo.txt", and the process f2b, replacing it with "bar", in
+// a file with ".bar" added to the path, which is connected to a sink
+func newTestFooBarWorkflow(pathPrefix string) *Workflow {
+	wf := NewWorkflow("wf")
+	foo := NewFromShell("foo", "echo foo > {o:out}")
+	foo.SetPathStatic("out", pathPrefix+"foo.txt")
+	f2b := NewFromShell("f2b", testF2bCommand)
+	f2b.SetPathExtend("in", "out", ".bar")
+	wf.AddProcesses(foo, f2b, NewSink())
+	wf.Connect("foo.out", "f2b.in")
+	wf.Connect("f2b.out", "sink.in")
+	return wf
+}
+
+func TestFileSetTargets(t *t.T) {
+	initTestLogs()
+
+	spl := NewFromShell("spl", "echo a > {o:parts}/a.txt; echo b > {o:parts}/b.txt; echo c > {o:parts}/c.log")
+	spl.SetPathStatic("parts", "/tmp/fileset_parts")
+	spl.SetOutGlob("parts", "*.txt")
+
+	cat := NewFromShell("cat", "cat {i:parts} > {o:merged}")
+	cat.SetPathStatic("merged", "/tmp/fileset_merged.txt")
+	snk := NewSink()
+
+	cat.In["parts"].Connect(spl.Out["parts"])
+	snk.Connect(cat.Out["merged"])
+
+	pl := NewPipelineRunner()
+	pl.AddProcesses(spl, cat, snk)
+	pl.Run()
+
+	merged := NewFileTarget("/tmp/fileset_merged.txt")
+	assert.EqualValues(t, "a\nb\n", string(merged.Read()))
+
+	cleanFiles("/tmp/fileset_merged.txt", "/tmp/fileset_parts")
+	os.RemoveAll("/tmp/fileset_parts")
+}
+
+func TestFileListTargets(t *t.T) {
+	initTestLogs()
+
+	a := NewFileTarget("/tmp/list_a.bam")
+	a.AddTags(map[string]string{"sample": "s1", "lane": "1"})
+	b := NewFileTarget("/tmp/list b.bam")
+	b.AddTags(map[string]string{"sample": "s1", "lane": "2"})
+	lst := NewFileListTarget(a, b)
+	assert.True(t, lst.IsList())
+	assert.EqualValues(t, map[string]string{"sample": "s1"}, lst.GetTags())
+
+	mrg := NewFromShell("mrg", "echo -I {i:bams|join:\" -I \"} > {o:out}")
+	mrg.SetPathStatic("out", "/tmp/list_out.txt")
+	mrg.In["bams"].Chan = make(chan *FileTarget, 1)
+	mrg.In["bams"].Chan <- lst
+	close(mrg.In["bams"].Chan)
+	mrg.Out["out"].Chan = make(chan *FileTarget, BUFSIZE)
+	go mrg.Run()
+
+	out := <-mrg.Out["out"].Chan
+	assert.EqualValues(t, "-I /tmp/list_a.bam -I /tmp/list b.bam\n", string(out.Read()))
+
+	cleanFiles("/tmp/list_out.txt")
+}
+
+func TestInMemoryTargets(t *t.T) {
+	initTestLogs()
+
+	val := NewInMemoryTarget("hello")
+	assert.True(t, val.IsInMemory())
+	assert.True(t, val.Exists())
+	assert.EqualValues(t, "hello", string(val.Read()))
+
+	ech := NewFromShell("ech", "echo {i:greeting} > {o:out}")
+	ech.SetPathStatic("out", "/tmp/inmemory_out.txt")
+	ech.In["greeting"].Chan = make(chan *FileTarget, 1)
+	ech.In["greeting"].Chan <- val
+	close(ech.In["greeting"].Chan)
+	ech.Out["out"].Chan = make(chan *FileTarget, BUFSIZE)
+	ech.Run()
+
+	assert.EqualValues(t, "hello\n", string(NewFileTarget("/tmp/inmemory_out.txt").Read()))
+	cleanFiles("/tmp/inmemory_out.txt")
+}
+
+func TestCompressedTargets(t *t.T) {
+	initTestLogs()
+
+	foo := NewFromShell("foo", "echo foo > {o:foo}")
+	foo.SetPathStatic("foo", "/tmp/compressed_foo.txt")
+	foo.SetOutCompress("foo")
+
+	f2b := NewFromShell("f2b", "sed 's/foo/bar/g' {i:foo} > {o:bar}")
+	f2b.SetPathStatic("bar", "/tmp/compressed_bar.txt")
+	f2b.SetInDecompress("foo")
+	f2b.Out["bar"].Chan = make(chan *FileTarget, BUFSIZE)
+
+	f2b.In["foo"].Connect(foo.Out["foo"])
+
+	go foo.Run()
+	f2b.Run()
+
+	fooFt := NewFileTarget("/tmp/compressed_foo.txt.gz")
+	assert.True(t, fooFt.Exists())
+	assert.EqualValues(t, "foo\n", string(fooFt.Read()))
+	assert.EqualValues(t, "bar\n", string(NewFileTarget("/tmp/compressed_bar.txt").Read()))
+
+	cleanFiles("/tmp/compressed_foo.txt.gz", "/tmp/compressed_bar.txt")
+}
+
+func TestTags(t *t.T) {
+	initTestLogs()
+
+	ft := NewFileTarget("/tmp/tags_in.txt")
+	ft.AddTag("sample", "s1")
+	ft.AddTags(map[string]string{"condition": "treated"})
+	ft.WriteTempFile([]byte("foo\n"))
+	ft.Atomize()
+
+	cpy := NewFromShell("cpy", "echo {t:condition} > {o:out}; cat {i:in} >> {o:out}")
+	cpy.PathFormatters["out"] = func(task *SciTask) string {
+		return "/tmp/tags_" + task.GetTag("sample") + ".txt"
+	}
+	cpy.In["in"].Chan = make(chan *FileTarget, 1)
+	cpy.In["in"].Chan <- ft
+	close(cpy.In["in"].Chan)
+	cpy.Out["out"].Chan = make(chan *FileTarget, BUFSIZE)
+	go cpy.Run()
+
+	out := <-cpy.Out["out"].Chan
+	assert.EqualValues(t, "/tmp/tags_s1.txt", out.GetPath())
+	assert.EqualValues(t, "treated\nfoo\n", string(out.Read()))
+
+	// Tags should survive via the audit file
+	reread := NewFileTarget("/tmp/tags_s1.txt")
+	assert.EqualValues(t, "s1", reread.GetTag("sample"))
+
+	cleanFiles("/tmp/tags_in.txt", "/tmp/tags_s1.txt")
+}
+
+func TestTemplateCommand(t *t.T) {
+	initTestLogs()
+
+	ft := NewFileTarget("/tmp/template_in.txt")
+	ft.AddTag("sample", "s1")
+	ft.WriteTempFile([]byte("foo\n"))
+	ft.Atomize()
+
+	cpy := NewFromTemplate("cpy", `{{if eq (param "upper") "yes"}}tr a-z A-Z < {{in "in"}}{{else}}cat {i:in}{{end}} > {{out "out"}}; echo {{.Name}} {{tag "sample"}} >> {o:out}`)
+	assert.NotNil(t, cpy.In["in"])
+	assert.NotNil(t, cpy.Out["out"])
+	assert.NotNil(t, cpy.ParamPorts["upper"])
+	cpy.SetPathStatic("out", "/tmp/template_out.txt")
+
+	cpy.In["in"].Chan = make(chan *FileTarget, 1)
+	cpy.In["in"].Chan <- ft
+	close(cpy.In["in"].Chan)
+	cpy.ParamPorts["upper"].Chan = make(chan string, 1)
+	cpy.ParamPorts["upper"].Chan <- "yes"
+	close(cpy.ParamPorts["upper"].Chan)
+	cpy.Out["out"].Chan = make(chan *FileTarget, BUFSIZE)
+	go cpy.Run()
+
+	out := <-cpy.Out["out"].Chan
+	assert.EqualValues(t, "FOO\ncpy s1\n", string(out.Read()))
+
+	cleanFiles("/tmp/template_in.txt", "/tmp/template_out.txt")
+}
+
+func TestProcessEnv(t *t.T) {
+	initTestLogs()
+
+	p := NewFromShell("echo", "echo {env:GREETING} $GREETING {env:SCIPIPE_UNSET_VAR|default:none} > {o:out}")
+	p.SetEnv("GREETING", "hello")
+	p.SetPathStatic("out", "/tmp/env_out.txt")
+	p.Out["out"].Chan = make(chan *FileTarget, BUFSIZE)
+	go p.Run()
+
+	out := <-p.Out["out"].Chan
+	assert.EqualValues(t, "hello hello none\n", string(out.Read()))
+
+	cleanFiles("/tmp/env_out.txt")
+}
+
+func TestProcessEnvMissing(t *t.T) {
+	initTestLogs()
+
+	// Missing environment variables are found when validating
+	wf := NewWorkflow("wf")
+	p := NewFromShell("echo", "echo {env:SCIPIPE_UNSET_VAR} > {o:out}")
+	p.SetPathStatic("out", "/tmp/env_missing_out.txt")
+	wf.AddProcesses(p, NewSink())
+	wf.Connect("echo.out", "sink.in")
+	err := wf.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "SCIPIPE_UNSET_VAR")
+
+	// and fail only the task, if missing when formatting the command
+	tk := newSciTaskFromProcess(p, map[string]*FileTarget{}, map[string]string{}, 0)
+	assert.Error(t, tk.formatErr)
+	assert.Contains(t, tk.formatErr.Error(), "SCIPIPE_UNSET_VAR")
+}
+
+func TestTaskPlaceHolders(t *t.T) {
+	initTestLogs()
+
+	p := NewFromShell("side", "echo x > {task.scratch}/side.txt; cat {task.scratch}/side.txt > {o:out}; echo {task.name} {task.id} >> {o:out}")
+	p.SetPathStatic("out", "/tmp/task_placeholders_out.txt")
+	p.Out["out"].Chan = make(chan *FileTarget, BUFSIZE)
+	go p.Run()
+
+	out := <-p.Out["out"].Chan
+	lines := str.Split(string(out.Read()), "\n")
+	assert.EqualValues(t, "x", lines[0])
+	assert.EqualValues(t, 2, len(str.Fields(lines[1])))
+	assert.EqualValues(t, "side", str.Fields(lines[1])[0])
+	assert.EqualValues(t, 12, len(str.Fields(lines[1])[1]))
+	_, err := os.Stat(TaskStagingDir + "/side." + str.Fields(lines[1])[1])
+	assert.True(t, os.IsNotExist(err), "Scratch dir should be removed after execution")
+
+	// Tasks of processes with the same inputs and params get different IDs
+	other := NewFromShell("other", "cat {i:in} > {o:out}")
+	other.SetPathExtend("in", "out", ".other")
+	side := NewFromShell("side", "cat {i:in} > {o:out}")
+	side.SetPathExtend("in", "out", ".side")
+	inTargets := map[string]*FileTarget{"in": NewFileTarget("/tmp/task_id_in.txt")}
+	otherTask := newSciTaskFromProcess(other, inTargets, map[string]string{}, 0)
+	sideTask := newSciTaskFromProcess(side, inTargets, map[string]string{}, 0)
+	assert.NotEqual(t, otherTask.GetID(), sideTask.GetID())
+
+	cleanFiles("/tmp/task_placeholders_out.txt")
+}
+
+func TestPlaceHolderInValue(t *t.T) {
+	initTestLogs()
+	inPath := "/tmp/ph_in{p:msg}.txt"
+	defer cleanFiles(inPath, "/tmp/ph_in_shell.txt", "/tmp/ph_in_template.txt", "/tmp/ph_in_pwned")
+	ioutil.WriteFile(inPath, []byte("foo\n"), 0644)
+
+	// Placeholder text in a path is not replaced by the value of the param,
+	// which would break out of the quoting of the path
+	for name, proc := range map[string]*SciProcess{
+		"shell":    NewFromShell("cat", "cat {i:in} > {o:out} # {p:msg}"),
+		"template": NewFromTemplate("cat", `cat {{in "in"}} > {o:out} # {{param "msg"}}`),
+	} {
+		proc.SetParamDefault("msg", "x'; touch /tmp/ph_in_pwned; echo '")
+		proc.SetPathStatic("out", "/tmp/ph_in_"+name+".txt")
+		src := NewFileQueue(inPath)
+		proc.In["in"].Connect(src.Out)
+		snk := NewSink()
+		snk.Connect(proc.Out["out"])
+		wf := NewWorkflow("placeholder_in_value")
+		wf.AddProcesses(src, proc, snk)
+		assert.Nil(t, wf.Run())
+		assert.Equal(t, "foo\n", string(NewFileTarget("/tmp/ph_in_"+name+".txt").Read()))
+		_, err := os.Stat("/tmp/ph_in_pwned")
+		assert.True(t, os.IsNotExist(err), "Param value in path was executed, for a "+name+" command")
+	}
+}
+
+func TestShellFreeArgs(t *t.T) {
+	initTestLogs()
+
+	ft := NewFileTarget("/tmp/args in.txt")
+	ft.WriteTempFile([]byte("foo\n"))
+	ft.Atomize()
+
+	cpy := NewFromArgs("cpy", "cp", "{i:in}", "{o:out}")
+	cpy.SetPathExtend("in", "out", ".copy")
+	cpy.In["in"].Chan = make(chan *FileTarget, 1)
+	cpy.In["in"].Chan <- ft
+	close(cpy.In["in"].Chan)
+	cpy.Out["out"].Chan = make(chan *FileTarget, BUFSIZE)
+	go cpy.Run()
+
+	out := <-cpy.Out["out"].Chan
+	assert.EqualValues(t, "/tmp/args in.txt.copy", out.GetPath())
+	assert.EqualValues(t, "foo\n", string(out.Read()))
+
+	sh := NewFromShell("sh", "echo $0 > {o:out}")
+	sh.Shell = "sh"
+	sh.SetPathStatic("out", "/tmp/shell_out.txt")
+	sh.Out["out"].Chan = make(chan *FileTarget, BUFSIZE)
+	go sh.Run()
+
+	out = <-sh.Out["out"].Chan
+	assert.EqualValues(t, "sh\n", string(out.Read()))
+
+	cleanFiles("/tmp/args in.txt", "/tmp/args in.txt.copy", "/tmp/shell_out.txt")
+}
+
+func TestSymlinkStaging(t *t.T) {
+	initTestLogs()
+
+	ft := NewFileTarget("/tmp/staging_in.txt")
+	ft.WriteTempFile([]byte("foo\n"))
+	ft.Atomize()
+
+	for _, mode := range []StagingMode{StagingModeSymlink, StagingModeHardlink} {
+		cpy := NewFromShell("cpy", "echo {i:in} > {o:out}; cat {i:in} >> {o:out}")
+		cpy.SetPathStatic("out", "/tmp/staging_out.txt")
+		cpy.InputStaging = mode
+		cpy.In["in"].Chan = make(chan *FileTarget, 1)
+		cpy.In["in"].Chan <- ft
+		close(cpy.In["in"].Chan)
+		cpy.Out["out"].Chan = make(chan *FileTarget, BUFSIZE)
+		cpy.Run()
+
+		lines := str.Split(string(NewFileTarget("/tmp/staging_out.txt").Read()), "\n")
+		assert.True(t, str.HasPrefix(lines[0], TaskStagingDir+"/cpy."), "Input was not staged: "+lines[0])
+		assert.True(t, str.HasSuffix(lines[0], "/in/staging_in.txt"), "Input was not staged: "+lines[0])
+		assert.EqualValues(t, "foo", lines[1])
+		cleanFiles("/tmp/staging_out.txt")
+	}
+	cleanFiles("/tmp/staging_in.txt")
+	os.RemoveAll(".scipipe")
+}
+
+func TestScratchDirStaging(t *t.T) {
+	initTestLogs()
+
+	ft := NewFileTarget("/tmp/scratch_in.txt")
+	ft.WriteTempFile([]byte("foo\n"))
+	ft.Atomize()
+
+	f2b := NewFromShell("f2b", "sed 's/foo/bar/g' {i:in} > {o:out}; echo {i:in} {o:out} > /tmp/scratch_cmd.txt")
+	f2b.SetPathStatic("out", "/tmp/scratch_out.txt")
+	f2b.ScratchDir = "/tmp/scipipe_scratch"
+	f2b.In["in"].Chan = make(chan *FileTarget, 1)
+	f2b.In["in"].Chan <- ft
+	close(f2b.In["in"].Chan)
+	f2b.Out["out"].Chan = make(chan *FileTarget, BUFSIZE)
+	f2b.Run()
+
+	assert.EqualValues(t, "bar\n", string(NewFileTarget("/tmp/scratch_out.txt").Read()))
+	cmdPaths := str.Fields(string(NewFileTarget("/tmp/scratch_cmd.txt").Read()))
+	assert.True(t, str.HasPrefix(cmdPaths[0], "/tmp/scipipe_scratch/f2b."), "Input not staged to scratch: "+cmdPaths[0])
+	assert.True(t, str.HasPrefix(cmdPaths[1], "/tmp/scipipe_scratch/f2b."), "Output not written to scratch: "+cmdPaths[1])
+
+	// The task's scratch directory should be removed after success
+	entries, _ := ioutil.ReadDir("/tmp/scipipe_scratch")
+	assert.Empty(t, entries)
+
+	cleanFiles("/tmp/scratch_in.txt", "/tmp/scratch_out.txt", "/tmp/scratch_cmd.txt")
+	os.RemoveAll("/tmp/scipipe_scratch")
+}
+
+func TestIsolateWorkDir(t *t.T) {
+	initTestLogs()
+
+	inPaths := []string{"/tmp/isolate_1.txt", "/tmp/isolate_2.txt"}
+	for i, path := range inPaths {
+		err := ioutil.WriteFile(path, []byte(fmt.Sprintf("in%d\n", i+1)), 0644)
+		assert.Nil(t, err)
+	}
+	fq := NewFileQueue(inPaths...)
+	iso := NewFromShell("iso", "cat {i:in} > side.txt; sleep 0.2; cat side.txt > {o:out}")
+	iso.SetPathExtend("in", "out", ".out")
+	iso.IsolateWorkDir = true
+	snk := NewSink()
+	iso.In["in"].Connect(fq.Out)
+	snk.Connect(iso.Out["out"])
+
+	pl := NewPipelineRunner()
+	pl.AddProcesses(fq, iso, snk)
+	pl.Run()
+
+	// Each task wrote its own side file, in its own working directory
+	for i, path := range inPaths {
+		assert.EqualValues(t, fmt.Sprintf("in%d\n", i+1), string(NewFileTarget(path+".out").Read()))
+		cleanFiles(path, path+".out")
+	}
+	_, err := os.Stat("side.txt")
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat("/tmp/side.txt")
+	assert.True(t, os.IsNotExist(err))
+	// The working directories are removed after success
+	workDirs, _ := filepath.Glob(filepath.Join(TaskStagingDir, "iso.*"))
+	assert.Empty(t, workDirs)
+}
+
+func TestBatchSize(t *t.T) {
+	initTestLogs()
+
+	inPaths := []string{}
+	for i := 1; i <= 5; i++ {
+		path := fmt.Sprintf("/tmp/batch_%d.txt", i)
+		content := "foo\n"
+		if i == 2 {
+			content = "bar\n"
+		}
+		ioutil.WriteFile(path, []byte(content), 0644)
+		inPaths = append(inPaths, path)
+	}
+	fq := NewFileQueue(inPaths...)
+	// $$ is the PID of the shell, also in the subshells of a batch
+	bat := NewFromShell("bat", "grep -q foo {i:in} && echo $$ > {o:out}")
+	bat.SetPathExtend("in", "out", ".pid")
+	bat.BatchSize = 3
+	snk := NewSink()
+	bat.In["in"].Connect(fq.Out)
+	snk.Connect(bat.Out["out"])
+
+	wf := NewWorkflow("wf")
+	wf.AddProcesses(fq, bat, snk)
+	err := wf.Run()
+	assert.NotNil(t, err)
+
+	pids := []string{}
+	for i, path := range inPaths {
+		if i == 1 {
+			// The failing task does not stop the others in its batch
+			assert.False(t, NewFileTarget(path+".pid").Exists())
+			_, err = os.Stat(path + ".pid.tmp")
+			assert.True(t, os.IsNotExist(err))
+			continue
 		}
+		pids = append(pids, string(NewFileTarget(path+".pid").Read()))
 	}
+	// Tasks 1-3 in the first batch, and 4-5 in the second
+	assert.EqualValues(t, pids[0], pids[1])
+	assert.NotEqual(t, pids[1], pids[2])
+	assert.EqualValues(t, pids[2], pids[3])
+
+	statusFiles, _ := filepath.Glob(".scipipe-batch.*")
+	assert.Empty(t, statusFiles)
+	for _, path := range inPaths {
+		cleanFiles(path, path+".pid", path+".pid.audit.json")
+	}
+}
+
+func TestFinalizeTargets(t *t.T) {
+	initTestLogs()
+
+	wf := NewWorkflow("wf")
+	two := NewFromShell("two", "echo a > {o:a}; echo b > {o:b}")
+	two.SetPathStatic("a", "/tmp/finalize_a.txt")
+	two.SetPathStatic("b", "/tmp/finalize_b.txt")
+	two.SetOutCompress("b")
+	snk := NewSink()
+	wf.AddProcesses(two, snk)
+	snk.Connect(two.Out["a"])
+	snk.Connect(two.Out["b"])
+	assert.Nil(t, wf.Run())
+
+	assert.EqualValues(t, "a\n", string(NewFileTarget("/tmp/finalize_a.txt").Read()))
+	assert.True(t, NewFileTarget("/tmp/finalize_b.txt.gz").Exists())
+	_, err := os.Stat("/tmp/finalize_b.txt.gz.audit.json")
+	assert.Nil(t, err)
+	cleanFiles("/tmp/finalize_a.txt", "/tmp/finalize_a.txt.audit.json", "/tmp/finalize_b.txt.gz", "/tmp/finalize_b.txt.gz.audit.json")
+
+	// An output that can not be finalized, since the command did not write
+	// it, fails the task, rather than the whole program
+	wf = NewWorkflow("wf")
+	none := NewFromShell("none", "echo {o:out} > /dev/null")
+	none.SetPathStatic("out", "/tmp/finalize_none.txt")
+	snk = NewSink()
+	wf.AddProcesses(none, snk)
+	snk.Connect(none.Out["out"])
+	err = wf.Run()
+	assert.NotNil(t, err)
+	assert.False(t, NewFileTarget("/tmp/finalize_none.txt").Exists())
+}
+
+func TestInProcessPipes(t *t.T) {
+	initTestLogs()
+
+	gen := NewFromShell("gen", "{os:out}")
+	gen.SetPathStatic("out", "/tmp/pipes_gen.txt")
+	gen.CustomExecute = func(task *SciTask) error {
+		w, err := task.OpenOut("out")
+		if err != nil {
+			return err
+		}
+		for i := 1; i <= 3; i++ {
+			fmt.Fprintf(w, "line %d\n", i)
+		}
+		return w.Close()
+	}
+	upper := NewFromShell("upper", "{i:in} {o:out}")
+	upper.SetPathExtend("in", "out", ".upper")
+	upper.CustomExecute = func(task *SciTask) error {
+		r, err := task.OpenIn("in")
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		dat, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		return task.WriteOut("out", bytes.ToUpper(dat))
+	}
+
+	// A shell command reads the piped data from a FIFO file
+	gen2 := NewFromShell("gen2", "{os:out}")
+	gen2.SetPathStatic("out", "/tmp/pipes_gen2.txt")
+	gen2.CustomExecute = gen.CustomExecute
+	wc := NewFromShell("wc", "wc -l < {i:in} | tr -d ' ' > {o:out}")
+	wc.SetPathExtend("in", "out", ".wc")
+
+	wf := NewWorkflow("wf")
+	wf.AddProcesses(gen, upper, gen2, wc, NewSink())
+	wf.Connect("gen.out", "upper.in")
+	wf.Connect("upper.out", "sink.in")
+	wf.Connect("gen2.out", "wc.in")
+	wf.Connect("wc.out", "sink.in")
+	assert.Nil(t, wf.Run())
+
+	assert.EqualValues(t, "LINE 1\nLINE 2\nLINE 3\n", string(NewFileTarget("/tmp/pipes_gen.txt.upper").Read()))
+	assert.EqualValues(t, "3\n", string(NewFileTarget("/tmp/pipes_gen2.txt.wc").Read()))
+	// No FIFO file is needed between the Go processes
+	_, err := os.Stat("/tmp/pipes_gen.txt.fifo")
+	assert.True(t, os.IsNotExist(err))
+
+	cleanFiles("/tmp/pipes_gen.txt.upper", "/tmp/pipes_gen.txt.upper.audit.json", "/tmp/pipes_gen2.txt.fifo", "/tmp/pipes_gen2.txt.wc", "/tmp/pipes_gen2.txt.wc.audit.json")
+}
+
+func TestOutTempDirOnOtherFileSystem(t *t.T) {
+	initTestLogs()
+	// /dev/shm is normally a tmpfs, and so another file system than /tmp
+	if _, err := os.Stat("/dev/shm"); err != nil {
+		t.Skip("No /dev/shm to use as temp dir")
+	}
+	tempDir := "/dev/shm/scipipe_tempdir_test"
+	defer os.RemoveAll(tempDir)
+
+	p := NewFromShell("write", "echo hi > {o:out}; mkdir {o:dir} && echo hi > {o:dir}/a.txt")
+	p.SetPathStatic("out", "/tmp/tempdir_out.txt")
+	p.SetPathStatic("dir", "/tmp/tempdir_dir")
+	p.SetOutTempDir("out", tempDir)
+	p.SetOutTempDir("dir", tempDir)
+	snk := NewSink()
+	snk.Connect(p.Out["out"])
+	snk.Connect(p.Out["dir"])
+	defer cleanFiles("/tmp/tempdir_out.txt", "/tmp/tempdir_dir")
+	defer os.RemoveAll("/tmp/tempdir_dir")
+
+	tk := newSciTaskFromProcess(p, map[string]*FileTarget{}, map[string]string{}, 0)
+	assert.True(t, str.HasPrefix(tk.OutTargets["out"].GetTempPath(), tempDir+"/tempdir_out.txt."))
+
+	wf := NewWorkflow("wf")
+	wf.AddProcesses(p, snk)
+	assert.Nil(t, wf.Run())
+
+	dat, err := ioutil.ReadFile("/tmp/tempdir_out.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "hi\n", string(dat))
+	dat, err = ioutil.ReadFile("/tmp/tempdir_dir/a.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "hi\n", string(dat))
+	// Neither temp files nor partial copies are left behind
+	left, _ := filepath.Glob(tempDir + "/*")
+	assert.Empty(t, left)
+	left, _ = filepath.Glob("/tmp/.tempdir_*.copying")
+	assert.Empty(t, left)
+}
+
+func TestStreamCache(t *t.T) {
+	initTestLogs()
+	os.RemoveAll("/tmp/stream_cache")
+	defer os.RemoveAll("/tmp/stream_cache")
+	defer cleanFiles("/tmp/sc_count.txt", "/tmp/sc_gen.txt.fifo", "/tmp/sc_gen.txt.tee.fifo", "/tmp/sc_gen.txt.upper")
+
+	run := func() {
+		gen := NewFromShell("gen", "echo run >> /tmp/sc_count.txt; echo hello > {os:out}")
+		gen.SetPathStatic("out", "/tmp/sc_gen.txt")
+		gen.SetOutStreamCache("out", "/tmp/stream_cache")
+		upper := NewFromShell("upper", "tr a-z A-Z < {i:in} > {o:out}")
+		upper.SetPathExtend("in", "out", ".upper")
+		snk := NewSink()
+		upper.In["in"].Connect(gen.Out["out"])
+		snk.Connect(upper.Out["out"])
+		wf := NewWorkflow("streamcache")
+		wf.AddProcesses(gen, upper, snk)
+		assert.Nil(t, wf.Run())
+	}
+
+	// The stream is cached when first computed
+	run()
+	assert.Equal(t, "HELLO\n", string(NewFileTarget("/tmp/sc_gen.txt.upper").Read()))
+	caches, _ := filepath.Glob("/tmp/stream_cache/sc_gen.txt.*.stream")
+	assert.Len(t, caches, 1)
+
+	// ... and replayed, rather than recomputed, when needed again
+	cleanFiles("/tmp/sc_gen.txt.upper")
+	run()
+	assert.Equal(t, "HELLO\n", string(NewFileTarget("/tmp/sc_gen.txt.upper").Read()))
+	assert.Equal(t, "run\n", string(NewFileTarget("/tmp/sc_count.txt").Read()))
+
+	// ... and not waited for, when the consuming task is skipped
+	run()
+	assert.Equal(t, "run\n", string(NewFileTarget("/tmp/sc_count.txt").Read()))
+}
+
+func TestStreamCacheInputChanged(t *t.T) {
+	initTestLogs()
+	os.RemoveAll("/tmp/stream_cache_in")
+	defer os.RemoveAll("/tmp/stream_cache_in")
+	defer cleanFiles("/tmp/sci_in.txt", "/tmp/sci_in.txt.gen.fifo", "/tmp/sci_in.txt.gen.tee.fifo", "/tmp/sci_in.txt.gen.upper")
+
+	run := func(content string) string {
+		ioutil.WriteFile("/tmp/sci_in.txt", []byte(content), 0644)
+		cleanFiles("/tmp/sci_in.txt.gen.fifo", "/tmp/sci_in.txt.gen.tee.fifo", "/tmp/sci_in.txt.gen.upper")
+		src := NewFileQueue("/tmp/sci_in.txt")
+		gen := NewFromShell("gen", "cat {i:in} > {os:out}")
+		gen.SetPathExtend("in", "out", ".gen")
+		gen.SetOutStreamCache("out", "/tmp/stream_cache_in")
+		upper := NewFromShell("upper", "tr a-z A-Z < {i:in} > {o:out}")
+		upper.SetPathExtend("in", "out", ".upper")
+		gen.In["in"].Connect(src.Out)
+		upper.In["in"].Connect(gen.Out["out"])
+		snk := NewSink()
+		snk.Connect(upper.Out["out"])
+		wf := NewWorkflow("streamcache_in")
+		wf.AddProcesses(src, gen, upper, snk)
+		assert.Nil(t, wf.Run())
+		return string(NewFileTarget("/tmp/sci_in.txt.gen.upper").Read())
+	}
+
+	assert.Equal(t, "HELLO\n", run("hello\n"))
+	// The cached stream of the old input is not replayed for a new input at
+	// the same path
+	assert.Equal(t, "WORLD\n", run("world\n"))
+	caches, _ := filepath.Glob("/tmp/stream_cache_in/sci_in.txt.gen.out.*.stream")
+	assert.Len(t, caches, 2)
+}
+
+func TestStreamCacheUpstreamInputChanged(t *t.T) {
+	initTestLogs()
+	os.RemoveAll("/tmp/stream_cache_up")
+	defer os.RemoveAll("/tmp/stream_cache_up")
+	outs := []string{"/tmp/scu_in.txt.a.fifo", "/tmp/scu_in.txt.a.b.fifo", "/tmp/scu_in.txt.a.b.tee.fifo", "/tmp/scu_in.txt.a.b.upper"}
+	defer cleanFiles(append(outs, "/tmp/scu_in.txt")...)
+
+	// The stream of a cached task, reading the stream of a task that is not
+	// cached, changes when the inputs of the upstream task do
+	run := func(content string) string {
+		ioutil.WriteFile("/tmp/scu_in.txt", []byte(content), 0644)
+		cleanFiles(outs...)
+		src := NewFileQueue("/tmp/scu_in.txt")
+		a := NewFromShell("a", "cat {i:in} > {os:out}")
+		a.SetPathExtend("in", "out", ".a")
+		b := NewFromShell("b", "cat {i:in} > {os:out}")
+		b.SetPathExtend("in", "out", ".b")
+		b.SetOutStreamCache("out", "/tmp/stream_cache_up")
+		upper := NewFromShell("upper", "tr a-z A-Z < {i:in} > {o:out}")
+		upper.SetPathExtend("in", "out", ".upper")
+		a.In["in"].Connect(src.Out)
+		b.In["in"].Connect(a.Out["out"])
+		upper.In["in"].Connect(b.Out["out"])
+		snk := NewSink()
+		snk.Connect(upper.Out["out"])
+		wf := NewWorkflow("streamcache_up")
+		wf.AddProcesses(src, a, b, upper, snk)
+		assert.Nil(t, wf.Run())
+		return string(NewFileTarget("/tmp/scu_in.txt.a.b.upper").Read())
+	}
+
+	assert.Equal(t, "HELLO\n", run("hello\n"))
+	assert.Equal(t, "WORLD\n", run("world\n"))
+	caches, _ := filepath.Glob("/tmp/stream_cache_up/scu_in.txt.a.b.out.*.stream")
+	assert.Len(t, caches, 2)
+}
+
+func TestBracesWithoutTemplateCommand(t *t.T) {
+	initTestLogs()
+
+	// Without opting in to templates, braces are left to the shell and awk
+	awk := NewFromShell("awk", `echo a b | awk '{{print $2}}' > {o:out}; echo {x,y} >> {o:out}`)
+	awk.SetPathStatic("out", "/tmp/braces_out.txt")
+	snk := NewSink()
+	snk.Connect(awk.Out["out"])
+	wf := NewWorkflow("braces")
+	wf.AddProcesses(awk, snk)
+	wf.Run()
+
+	assert.EqualValues(t, "b\nx y\n", string(NewFileTarget("/tmp/braces_out.txt").Read()))
+	cleanFiles("/tmp/braces_out.txt")
 }
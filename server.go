@@ -0,0 +1,369 @@
+package scipipe
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	str "strings"
+	"sync"
+	"time"
+)
+
+// ======= REST API server ========
+
+// The states of runs, in RunInfo
+const (
+	RunRunning   = "running"
+	RunSucceeded = "succeeded"
+	RunFailed    = "failed"
+	RunCancelled = "cancelled"
+)
+
+// Server serves a REST API, as JSON, for starting runs of a workflow,
+// following their progress, fetching the logs of their tasks, and
+// cancelling them, so that a compiled workflow can be integrated with
+// systems such as LIMSs and web portals. Since a Workflow can only be run
+// once, each run gets a new one, created with the function given to
+// NewServer, from the params of the run. The endpoints are:
+//
+//	POST   /runs                             start a run, with the params given as {"Params": {"name": "value"}}
+//	GET    /runs                             list all runs (see RunInfo)
+//	GET    /runs/ID                          get a run, with the status of its workflow (see WorkflowStatus)
+//	GET    /runs/ID/tasks/PROCESS/INDEX/log  get the log file of a finished task (with TaskLogFiles set)
+//	POST   /runs/ID/cancel                   cancel a run (as does DELETE /runs/ID)
+//
+// Runs are run concurrently, so the workflow must make sure, such as by
+// including a run-specific param in its paths, that the outputs of
+// different runs do not clash.
+//
+// Since the params of runs are given by clients, the workflows of runs are
+// run in strict mode (see SciProcess.Strict), and, as for workers (see
+// Worker), servers on TCP addresses, loopback ones included, must
+// authenticate clients, by a Token, or by client certificates, with mutual
+// TLS (see TLSConfig), while servers on unix sockets rely on the file
+// permissions of the socket instead.
+type Server struct {
+	// If set, clients must send this token, as in the header
+	// "Authorization: Bearer TOKEN"
+	Token string
+	// If set, requests are served over TLS, with this config, which gives
+	// the certificate of the server. For mutual TLS, it should also require
+	// client certificates, signed by ClientCAs, with ClientAuth set to
+	// tls.RequireAndVerifyClientCert.
+	TLSConfig *tls.Config
+	// The number of finished runs that are kept, for their info and task
+	// logs to be served, after which the oldest ones are forgotten
+	MaxFinishedRuns int
+	create          func(params map[string]string) (*Workflow, error)
+	runs            map[string]*serverRun
+	nextID          int
+	lock            *sync.Mutex
+}
+
+// The number of finished runs kept by servers created with NewServer
+const DefaultMaxFinishedRuns = 100
+
+// RunInfo describes a run started by a Server, with the status of its
+// workflow, if requested
+type RunInfo struct {
+	ID         string
+	State      string
+	Params     map[string]string
+	Error      string `json:",omitempty"`
+	StartTime  time.Time
+	FinishTime time.Time
+	Progress   string
+	Status     *WorkflowStatus `json:",omitempty"`
+}
+
+type serverRun struct {
+	id         string
+	params     map[string]string
+	wf         *Workflow
+	state      string
+	err        error
+	startTime  time.Time
+	finishTime time.Time
+}
+
+// Create a new Server, creating the workflow for each run, given its
+// params, with create
+func NewServer(create func(params map[string]string) (*Workflow, error)) *Server {
+	return &Server{
+		MaxFinishedRuns: DefaultMaxFinishedRuns,
+		create:          create,
+		runs:            make(map[string]*serverRun),
+		nextID:          1,
+		lock:            new(sync.Mutex),
+	}
+}
+
+// Serve the API on the address addr, which is either a TCP address (such as
+// "localhost:8080"), requiring authentication (see Server), or the path of
+// a unix socket, prefixed with "unix:" (such as "unix:/run/scipipe.sock"),
+// that only the user running the server can connect to
+func (s *Server) ListenAndServe(addr string) error {
+	var ln net.Listener
+	var err error
+	if path, isUnix := str.CutPrefix(addr, "unix:"); isUnix {
+		ln, err = listenUnix(path)
+	} else {
+		ln, err = net.Listen("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Serve the API on the listener ln, which must be on a unix socket, unless
+// the server authenticates clients (see Server). The permissions of sockets
+// not created by ListenAndServe are left to the caller.
+func (s *Server) Serve(ln net.Listener) error {
+	if _, isUnix := ln.Addr().(*net.UnixAddr); !isUnix && !s.authenticates() {
+		ln.Close()
+		return fmt.Errorf("Server: Not serving on %s, which is not a unix socket, without authenticating clients, by a Token or client certificates", ln.Addr())
+	}
+	srv := &http.Server{Handler: s}
+	if s.TLSConfig != nil {
+		Info.Printf("Serving workflow API on %s, over TLS\n", ln.Addr())
+		srv.TLSConfig = s.TLSConfig.Clone()
+		return srv.ServeTLS(ln, "", "")
+	}
+	Info.Printf("Serving workflow API on %s\n", ln.Addr())
+	return srv.Serve(ln)
+}
+
+// Check whether the server authenticates clients
+func (s *Server) authenticates() bool {
+	return s.Token != "" || (s.TLSConfig != nil && s.TLSConfig.ClientAuth == tls.RequireAndVerifyClientCert)
+}
+
+// Start a run with the params, returning its ID
+func (s *Server) StartRun(params map[string]string) (string, error) {
+	if params == nil {
+		params = make(map[string]string)
+	}
+	wf, err := s.create(params)
+	if err != nil {
+		return "", err
+	}
+	s.lock.Lock()
+	run := &serverRun{
+		id:        strconv.Itoa(s.nextID),
+		params:    params,
+		wf:        wf,
+		state:     RunRunning,
+		startTime: time.Now(),
+	}
+	s.nextID++
+	s.runs[run.id] = run
+	s.lock.Unlock()
+	Audit.Printf("Server: Starting run %s, of workflow %s\n", run.id, wf.Name)
+	// The task records are needed for serving the log files of tasks
+	wf.KeepTaskRecords = true
+	// The params are given by clients, so their values must not be able to
+	// inject commands
+	wf.Strict = true
+	go func() {
+		err := wf.Run()
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		run.err = err
+		run.finishTime = time.Now()
+		switch {
+		case wf.IsCancelled():
+			run.state = RunCancelled
+		case err != nil:
+			run.state = RunFailed
+		default:
+			run.state = RunSucceeded
+		}
+		Audit.Printf("Server: Run %s is %s\n", run.id, run.state)
+		s.pruneRuns()
+	}()
+	return run.id, nil
+}
+
+// Forget the oldest finished runs, beyond MaxFinishedRuns. The lock must be
+// held.
+func (s *Server) pruneRuns() {
+	finished := []*serverRun{}
+	for _, run := range s.runs {
+		if run.state != RunRunning {
+			finished = append(finished, run)
+		}
+	}
+	if len(finished) <= s.MaxFinishedRuns {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].finishTime.Before(finished[j].finishTime)
+	})
+	for _, run := range finished[:len(finished)-s.MaxFinishedRuns] {
+		delete(s.runs, run.id)
+	}
+}
+
+// Cancel the run with the ID id, returning false if there is no such run
+func (s *Server) CancelRun(id string) bool {
+	s.lock.Lock()
+	run, ok := s.runs[id]
+	s.lock.Unlock()
+	if ok {
+		run.wf.Cancel()
+	}
+	return ok
+}
+
+// Get information about the run with the ID id, including the status of
+// its workflow if withStatus is true, and whether there is such a run
+func (s *Server) GetRun(id string, withStatus bool) (RunInfo, bool) {
+	s.lock.Lock()
+	run, ok := s.runs[id]
+	if !ok {
+		s.lock.Unlock()
+		return RunInfo{}, false
+	}
+	info := RunInfo{
+		ID:         run.id,
+		State:      run.state,
+		Params:     run.params,
+		StartTime:  run.startTime,
+		FinishTime: run.finishTime,
+	}
+	if run.err != nil {
+		info.Error = run.err.Error()
+	}
+	s.lock.Unlock()
+	info.Progress = run.wf.GetProgress().String()
+	if withStatus {
+		status := run.wf.GetStatus()
+		info.Status = &status
+	}
+	return info, true
+}
+
+// Get information about all runs, in the order they were started
+func (s *Server) GetRuns() []RunInfo {
+	s.lock.Lock()
+	ids := []string{}
+	for id := range s.runs {
+		ids = append(ids, id)
+	}
+	s.lock.Unlock()
+	sort.Slice(ids, func(i, j int) bool {
+		a, _ := strconv.Atoi(ids[i])
+		b, _ := strconv.Atoi(ids[j])
+		return a < b
+	})
+	infos := []RunInfo{}
+	for _, id := range ids {
+		info, _ := s.GetRun(id, false)
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// Serve a request to the API, which must send the token of the server, if
+// set
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.Token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+s.Token)) != 1 {
+		Warning.Printf("Server: Refused request from %s, with a missing or invalid token\n", r.RemoteAddr)
+		writeJSONError(w, http.StatusUnauthorized, "Missing or invalid token")
+		return
+	}
+	parts := str.Split(str.Trim(r.URL.Path, "/"), "/")
+	if parts[0] != "runs" {
+		http.NotFound(w, r)
+		return
+	}
+	switch {
+	case len(parts) == 1 && r.Method == "GET":
+		writeJSON(w, http.StatusOK, s.GetRuns())
+	case len(parts) == 1 && r.Method == "POST":
+		req := struct{ Params map[string]string }{}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeJSONError(w, http.StatusBadRequest, "Could not parse request: "+err.Error())
+				return
+			}
+		}
+		id, err := s.StartRun(req.Params)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		info, _ := s.GetRun(id, false)
+		writeJSON(w, http.StatusCreated, info)
+	case len(parts) == 2 && r.Method == "GET":
+		info, ok := s.GetRun(parts[1], true)
+		if !ok {
+			writeJSONError(w, http.StatusNotFound, "No such run: "+parts[1])
+			return
+		}
+		writeJSON(w, http.StatusOK, info)
+	case (len(parts) == 2 && r.Method == "DELETE") || (len(parts) == 3 && parts[2] == "cancel" && r.Method == "POST"):
+		if !s.CancelRun(parts[1]) {
+			writeJSONError(w, http.StatusNotFound, "No such run: "+parts[1])
+			return
+		}
+		info, _ := s.GetRun(parts[1], false)
+		writeJSON(w, http.StatusAccepted, info)
+	case len(parts) == 6 && parts[2] == "tasks" && parts[5] == "log" && r.Method == "GET":
+		s.serveTaskLog(w, r, parts[1], parts[3], parts[4])
+	default:
+		writeJSONError(w, http.StatusNotFound, "No such endpoint: "+r.Method+" "+r.URL.Path)
+	}
+}
+
+// Serve the log file of task number index of the process procName, in the
+// run with the ID id
+func (s *Server) serveTaskLog(w http.ResponseWriter, r *http.Request, id string, procName string, index string) {
+	s.lock.Lock()
+	run, ok := s.runs[id]
+	s.lock.Unlock()
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "No such run: "+id)
+		return
+	}
+	for _, tr := range run.wf.GetTaskRecords() {
+		if tr.Name != procName || strconv.Itoa(tr.Index) != index {
+			continue
+		}
+		if tr.LogPath == "" {
+			writeJSONError(w, http.StatusNotFound, fmt.Sprintf("Task %s #%s has no log file (is TaskLogFiles set for the process?)", procName, index))
+			return
+		}
+		f, err := os.Open(tr.LogPath)
+		if err != nil {
+			writeJSONError(w, http.StatusNotFound, "Could not open log file: "+err.Error())
+			return
+		}
+		defer f.Close()
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		http.ServeContent(w, r, tr.LogPath, tr.FinishTime, f)
+		return
+	}
+	writeJSONError(w, http.StatusNotFound, fmt.Sprintf("No finished task %s #%s in run %s", procName, index, id))
+}
+
+// Write v as indented JSON to w, with the status code
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// Write an error message as JSON to w, with the status code
+func writeJSONError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"Error": msg})
+}
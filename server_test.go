@@ -0,0 +1,210 @@
+package scipipe
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	t "testing"
+	"time"
+)
+
+func newTestServer() *Server {
+	return NewServer(func(params map[string]string) (*Workflow, error) {
+		wf := NewWorkflow("server")
+		p := NewFromShell("cmd", "{p:cmd|raw} > {o:out}")
+		p.SetPathPattern("out", "/tmp/server_{p:name}.txt")
+		p.TaskLogFiles = true
+		wf.AddProcesses(p, NewSink())
+		for pname, val := range params {
+			p.SetParamDefault(pname, val)
+		}
+		wf.Connect("cmd.out", "sink.in")
+		return wf, nil
+	})
+}
+
+func waitForRun(t *t.T, url string) RunInfo {
+	info := RunInfo{}
+	for i := 0; i < 100; i++ {
+		resp, err := http.Get(url)
+		assert.Nil(t, err)
+		assert.Nil(t, json.NewDecoder(resp.Body).Decode(&info))
+		resp.Body.Close()
+		if info.State != RunRunning {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return info
+}
+
+func TestServer(t *t.T) {
+	initTestLogs()
+
+	ts := httptest.NewServer(newTestServer())
+	defer ts.Close()
+
+	body := []byte(`{"Params": {"cmd": "echo foo", "name": "foo"}}`)
+	resp, err := http.Post(ts.URL+"/runs", "application/json", bytes.NewReader(body))
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusCreated, resp.StatusCode)
+	info := RunInfo{}
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&info))
+	resp.Body.Close()
+	assert.EqualValues(t, "1", info.ID)
+
+	info = waitForRun(t, ts.URL+"/runs/1")
+	assert.EqualValues(t, RunSucceeded, info.State)
+	assert.EqualValues(t, "foo", info.Params["name"])
+	assert.NotNil(t, info.Status)
+	assert.EqualValues(t, "foo\n", string(NewFileTarget("/tmp/server_foo.txt").Read()))
+
+	resp, err = http.Get(ts.URL + "/runs/1/tasks/cmd/0/log")
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusOK, resp.StatusCode)
+	log, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Contains(t, string(log), "foo")
+
+	resp, err = http.Get(ts.URL + "/runs")
+	assert.Nil(t, err)
+	infos := []RunInfo{}
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&infos))
+	resp.Body.Close()
+	assert.Len(t, infos, 1)
+
+	resp, err = http.Get(ts.URL + "/runs/2")
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusNotFound, resp.StatusCode)
+	resp.Body.Close()
+	cleanFiles("/tmp/server_foo.txt", "/tmp/server_foo.txt.log")
+}
+
+func TestServerCancel(t *t.T) {
+	initTestLogs()
+
+	cleanFiles("/tmp/server_sleep.txt.tmp")
+	ts := httptest.NewServer(newTestServer())
+	defer ts.Close()
+
+	body := []byte(`{"Params": {"cmd": "sleep 10", "name": "sleep"}}`)
+	resp, err := http.Post(ts.URL+"/runs", "application/json", bytes.NewReader(body))
+	assert.Nil(t, err)
+	resp.Body.Close()
+	time.Sleep(200 * time.Millisecond)
+
+	started := time.Now()
+	resp, err = http.Post(ts.URL+"/runs/1/cancel", "application/json", nil)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusAccepted, resp.StatusCode)
+	resp.Body.Close()
+	info := waitForRun(t, ts.URL+"/runs/1")
+	assert.EqualValues(t, RunCancelled, info.State)
+	assert.Contains(t, info.Error, ErrCancelled.Error())
+	assert.True(t, time.Since(started) < 5*time.Second, "Cancelled run should finish quickly")
+	assert.False(t, NewFileTarget("/tmp/server_sleep.txt").Exists())
+	cleanFiles("/tmp/server_sleep.txt", "/tmp/server_sleep.txt.log")
+}
+
+func TestServerStrict(t *t.T) {
+	initTestLogs()
+
+	ts := httptest.NewServer(newTestServer())
+	defer ts.Close()
+
+	// Params can not inject commands
+	body := []byte(`{"Params": {"cmd": "echo foo; touch /tmp/server_pwned.txt", "name": "pwned"}}`)
+	resp, err := http.Post(ts.URL+"/runs", "application/json", bytes.NewReader(body))
+	assert.Nil(t, err)
+	resp.Body.Close()
+	info := waitForRun(t, ts.URL+"/runs/1")
+	assert.EqualValues(t, RunFailed, info.State)
+	assert.Contains(t, info.Error, "strict mode")
+	assert.False(t, NewFileTarget("/tmp/server_pwned.txt").Exists())
+	cleanFiles("/tmp/server_pwned.txt", "/tmp/server_pwned.txt.log")
+}
+
+func TestServerAuth(t *t.T) {
+	initTestLogs()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	assert.Error(t, newTestServer().Serve(ln), "Loopback addresses should require authentication too")
+
+	s := newTestServer()
+	s.Token = "secret"
+	ln, err = net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer ln.Close()
+	go s.Serve(ln)
+	url := "http://" + ln.Addr().String() + "/runs"
+
+	resp, err := http.Get(url)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusUnauthorized, resp.StatusCode)
+	resp.Body.Close()
+
+	req, err := http.NewRequest("GET", url, nil)
+	assert.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err = http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+}
+
+func TestServerPrunesFinishedRuns(t *t.T) {
+	initTestLogs()
+
+	s := newTestServer()
+	s.MaxFinishedRuns = 1
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	for _, name := range []string{"prune1", "prune2"} {
+		body := []byte(`{"Params": {"cmd": "echo foo", "name": "` + name + `"}}`)
+		resp, err := http.Post(ts.URL+"/runs", "application/json", bytes.NewReader(body))
+		assert.Nil(t, err)
+		info := RunInfo{}
+		assert.Nil(t, json.NewDecoder(resp.Body).Decode(&info))
+		resp.Body.Close()
+		waitForRun(t, ts.URL+"/runs/"+info.ID)
+	}
+	infos := s.GetRuns()
+	assert.Len(t, infos, 1)
+	assert.EqualValues(t, "2", infos[0].ID)
+	cleanFiles("/tmp/server_prune1.txt", "/tmp/server_prune1.txt.log", "/tmp/server_prune2.txt", "/tmp/server_prune2.txt.log")
+}
+
+func TestServerTaskPanic(t *t.T) {
+	initTestLogs()
+
+	s := NewServer(func(params map[string]string) (*Workflow, error) {
+		wf := NewWorkflow("server")
+		p := NewFromShell("panic", "{o:out}")
+		p.SetPathStatic("out", "/tmp/server_panic.txt")
+		p.CustomExecute = func(task *SciTask) error {
+			Check(errors.New("panicked"))
+			return nil
+		}
+		wf.AddProcesses(p, NewSink())
+		wf.Connect("panic.out", "sink.in")
+		return wf, nil
+	})
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	// Only the task fails, rather than the whole program
+	resp, err := http.Post(ts.URL+"/runs", "application/json", nil)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	info := waitForRun(t, ts.URL+"/runs/1")
+	assert.EqualValues(t, RunFailed, info.State)
+	assert.Contains(t, info.Error, "panicked")
+	assert.False(t, NewFileTarget("/tmp/server_panic.txt").Exists())
+}
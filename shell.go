@@ -0,0 +1,83 @@
+package scipipe
+
+import (
+	"os/exec"
+	"path/filepath"
+	str "strings"
+)
+
+// ======= Shells ========
+
+// The shell that commands are executed with, unless set on the process (see
+// SciProcess.Shell): bash on POSIX systems, and cmd on Windows. Besides
+// POSIX shells, such as bash and sh, cmd and PowerShell (powershell or pwsh)
+// are supported, with their own quoting of placeholder values.
+var DefaultShell = defaultPlatformShell
+
+// Get the name of the shell, without directory and .exe extension, in
+// lower case, as in "cmd" for C:\Windows\System32\cmd.exe
+func getShellName(shell string) string {
+	name := str.ToLower(filepath.Base(filepath.FromSlash(shell)))
+	if i := str.LastIndex(name, `\`); i >= 0 {
+		name = name[i+1:]
+	}
+	return str.TrimSuffix(name, ".exe")
+}
+
+// Check whether the shell is a POSIX shell, such as bash, as opposed to cmd
+// or PowerShell
+func isPosixShell(shell string) bool {
+	switch getShellName(shell) {
+	case "cmd", "powershell", "pwsh":
+		return false
+	}
+	return true
+}
+
+// Create the command executing the command line cmd with the shell
+func newShellCommand(shell string, cmd string) *exec.Cmd {
+	switch getShellName(shell) {
+	case "cmd":
+		command := exec.Command(shell, "/S", "/C", cmd)
+		// cmd does not parse its command line as other programs do, so it
+		// is passed as is, rather than quoted as an argument
+		setRawCommandLine(command, shell, `/S /C "`+cmd+`"`)
+		return command
+	case "powershell", "pwsh":
+		return exec.Command(shell, "-NoProfile", "-NonInteractive", "-Command", cmd)
+	}
+	return exec.Command(shell, "-c", cmd)
+}
+
+// Get the function quoting values for safe use as single words in commands
+// executed with the shell
+func getShellQuoter(shell string) func(string) string {
+	switch getShellName(shell) {
+	case "cmd":
+		return cmdQuote
+	case "powershell", "pwsh":
+		return powerShellQuote
+	}
+	return shellQuote
+}
+
+// Quote a string for use as a single word in a cmd command, by putting it
+// inside double quotes, unless it contains only safe characters. Since cmd
+// expands environment variables (%NAME%) also inside double quotes, each %
+// is escaped as ^% outside of the quotes, as in "50"^%" done".
+func cmdQuote(s string) string {
+	if s != "" && !getShellUnsafeCharsRegex().MatchString(s) && !str.Contains(s, "%") {
+		return s
+	}
+	s = str.Replace(s, `"`, `""`, -1)
+	return `"` + str.Replace(s, "%", `"^%"`, -1) + `"`
+}
+
+// Quote a string for use as a single word in a PowerShell command, by
+// putting it inside single quotes, unless it contains only safe characters
+func powerShellQuote(s string) string {
+	if s != "" && !getShellUnsafeCharsRegex().MatchString(s) {
+		return s
+	}
+	return "'" + str.Replace(s, "'", "''", -1) + "'"
+}
@@ -0,0 +1,56 @@
+package scipipe
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestShellQuoters(t *testing.T) {
+	tests := []struct {
+		shell string
+		in    string
+		want  string
+	}{
+		{"bash", "in.txt", "in.txt"},
+		{"bash", "it's.txt", `'it'"'"'s.txt'`},
+		{"cmd", `C:\data\in file.txt`, `"C:\data\in file.txt"`},
+		{"cmd", `say "hi"`, `"say ""hi"""`},
+		{"cmd", "%PATH%", `""^%"PATH"^%""`},
+		{"cmd", "50% done", `"50"^%" done"`},
+		{`C:\Windows\System32\WindowsPowerShell\v1.0\powershell.exe`, "it's.txt", "'it''s.txt'"},
+		{"pwsh", "in.txt", "in.txt"},
+	}
+	for _, tt := range tests {
+		if got := getShellQuoter(tt.shell)(tt.in); got != tt.want {
+			t.Errorf("quoting %q for %s = %q, want %q", tt.in, tt.shell, got, tt.want)
+		}
+	}
+}
+
+func TestNewShellCommand(t *testing.T) {
+	cmd := newShellCommand("bash", "echo hi")
+	if len(cmd.Args) != 3 || cmd.Args[1] != "-c" || cmd.Args[2] != "echo hi" {
+		t.Errorf("bash args = %v", cmd.Args)
+	}
+	cmd = newShellCommand("pwsh.exe", "echo hi")
+	if cmd.Args[len(cmd.Args)-2] != "-Command" || cmd.Args[len(cmd.Args)-1] != "echo hi" {
+		t.Errorf("pwsh args = %v", cmd.Args)
+	}
+	if !isPosixShell("/bin/sh") || isPosixShell("CMD.EXE") || isPosixShell("powershell") {
+		t.Error("isPosixShell did not tell POSIX shells from cmd and PowerShell")
+	}
+	if runtime.GOOS != "windows" && DefaultShell != "bash" {
+		t.Errorf("DefaultShell = %s, want bash", DefaultShell)
+	}
+}
+
+func TestShellQuoterInCommand(t *testing.T) {
+	p := NewFromShell("quote", "echo {p:msg} > {o:out}")
+	p.Shell = "pwsh"
+	p.SetPathStatic("out", "quote.txt")
+	tk := newSciTaskFromProcess(p, map[string]*FileTarget{}, map[string]string{"msg": "it's"}, 0)
+	want := "echo 'it''s' > quote.txt.tmp"
+	if tk.Command != want {
+		t.Errorf("command = %s, want %s", tk.Command, want)
+	}
+}
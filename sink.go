@@ -28,20 +28,28 @@ func (proc *Sink) IsConnected() bool {
 
 func (proc *Sink) Connect(outPort *OutPort) {
 	newInPort := NewInPort()
-	newInPort.Connect(outPort)
+	if err := newInPort.connect(outPort, ""); err != nil {
+		Error.Println(err)
+		return
+	}
 	proc.inPorts = append(proc.inPorts, newInPort)
 }
 
-// Execute the Sink component
+// Execute the Sink component. The in-ports are kept as they are, so that
+// they can be inspected while it runs (as by GetStatus), while the open ones
+// are tracked separately.
 func (proc *Sink) Run() {
 	ok := true
 	var ft *FileTarget
-	for len(proc.inPorts) > 0 {
-		for i, inp := range proc.inPorts {
+	open := append([]*InPort{}, proc.inPorts...)
+	for len(open) > 0 {
+		// Going backwards, so that closed in-ports can be deleted on the way
+		for i := len(open) - 1; i >= 0; i-- {
+			inp := open[i]
 			select {
 			case ft, ok = <-inp.Chan:
 				if !ok {
-					proc.deleteInPortAtKey(i)
+					open = append(open[:i], open[i+1:]...)
 					continue
 				}
 				Debug.Println("Received file in sink: ", ft.GetPath())
@@ -0,0 +1,294 @@
+// Package sptest provides a golden-file testing harness for scipipe
+// components, so that libraries of processes can have regression tests:
+// a process (or small workflow) is run on fixture inputs in a temporary
+// directory, and its outputs are compared to golden files, as in:
+//
+//	func TestSortProcess(t *testing.T) {
+//		h := sptest.New(t)
+//		p := scipipe.NewFromShell("sort", "sort {i:in} > {o:out}")
+//		p.SetPathExtend("in", "out", ".sorted")
+//		outs := h.RunProcess(p, map[string]string{"in": "testdata/words.txt"}, nil)
+//		h.AssertGolden(outs["out"], "testdata/words.sorted.golden")
+//	}
+//
+// Run the tests with the environment variable SCIPIPE_UPDATE_GOLDEN set to
+// write the outputs to the golden files, rather than comparing them.
+package sptest
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/scipipe/scipipe"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Harness runs processes and workflows in a temporary directory, which is
+// the working directory while they run, and compares their outputs to
+// golden files. Since the working directory is changed, tests using it can
+// not run in parallel. The directory is removed when the test is done,
+// unless the test failed, or KeepDir is set.
+type Harness struct {
+	// The temporary directory
+	Dir string
+	// The normalizers applied to outputs, and golden files, before they are
+	// compared, in order. By default, the path of the temporary directory
+	// is replaced with $DIR, and Windows line endings with Unix ones.
+	Normalizers []Normalizer
+	// Keep the temporary directory when the test is done
+	KeepDir bool
+	t       testing.TB
+	srcDir  string
+}
+
+// Normalizer normalizes the content of an output, or golden file, such as
+// to remove timestamps, before they are compared
+type Normalizer func([]byte) []byte
+
+// Create a harness for the test t, with a new temporary directory
+func New(t testing.TB) *Harness {
+	t.Helper()
+	srcDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "sptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Symlinks, as of /tmp on macOS, are resolved, so that paths in outputs
+	// match the directory
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		t.Fatal(err)
+	}
+	h := &Harness{Dir: dir, t: t, srcDir: srcDir}
+	h.Normalizers = []Normalizer{ReplaceString(dir, "$DIR"), NormalizeLineEndings}
+	t.Cleanup(h.cleanUp)
+	return h
+}
+
+// Copy the fixture file at path (relative to the working directory of the
+// test, as for files in testdata) into the temporary directory, returning
+// the path of the copy, relative to the temporary directory
+func (h *Harness) Fixture(path string) string {
+	h.t.Helper()
+	data, err := ioutil.ReadFile(h.srcPath(path))
+	if err != nil {
+		h.t.Fatalf("Could not read fixture: %s", err)
+	}
+	name := filepath.Base(path)
+	if err := ioutil.WriteFile(filepath.Join(h.Dir, name), data, 0644); err != nil {
+		h.t.Fatalf("Could not copy fixture: %s", err)
+	}
+	return name
+}
+
+// Run the process p once, in the temporary directory, with the fixture
+// files inputs (see Fixture) on its in-ports, and the values params on its
+// param ports, by name, returning the paths of its outputs, relative to the
+// temporary directory, by out-port name. The test fails if the process
+// fails.
+func (h *Harness) RunProcess(p *scipipe.SciProcess, inputs map[string]string, params map[string]string) map[string]string {
+	h.t.Helper()
+	wf := scipipe.NewWorkflow("sptest")
+	wf.AddProcess(p)
+	for iname, path := range inputs {
+		inp := p.In[iname]
+		if inp == nil {
+			h.t.Fatalf("Process %s has no in-port %s", p.Name, iname)
+		}
+		src := scipipe.NewFileQueue(h.Fixture(path))
+		inp.Connect(src.Out)
+		wf.Add("in_"+iname, src)
+	}
+	for pname, val := range params {
+		pport := p.ParamPorts[pname]
+		if pport == nil {
+			h.t.Fatalf("Process %s has no param %s", p.Name, pname)
+		}
+		src := newParamSource(val)
+		pport.Connect(src.Out)
+		wf.Add("param_"+pname, src)
+	}
+	collectors := make(map[string]*collector)
+	for oname, outp := range p.Out {
+		c := newCollector()
+		c.In.Connect(outp)
+		collectors[oname] = c
+		wf.Add("out_"+oname, c)
+	}
+	h.RunWorkflow(wf)
+	outputs := make(map[string]string)
+	for oname, c := range collectors {
+		if len(c.paths) > 0 {
+			outputs[oname] = c.paths[0]
+		}
+	}
+	return outputs
+}
+
+// Run the workflow wf in the temporary directory, failing the test if it
+// fails
+func (h *Harness) RunWorkflow(wf *scipipe.Workflow) {
+	h.t.Helper()
+	if err := os.Chdir(h.Dir); err != nil {
+		h.t.Fatal(err)
+	}
+	err := wf.Run()
+	if err := os.Chdir(h.srcDir); err != nil {
+		h.t.Fatal(err)
+	}
+	if err != nil {
+		h.t.Fatalf("Workflow %s failed: %s", wf.Name, err)
+	}
+}
+
+// Check that the output at path (relative to the temporary directory)
+// matches the golden file at golden (relative to the working directory of
+// the test), after normalization. With SCIPIPE_UPDATE_GOLDEN set, the
+// golden file is written instead.
+func (h *Harness) AssertGolden(path string, golden string) {
+	h.t.Helper()
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(h.Dir, path)
+	}
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		h.t.Errorf("Could not read output: %s", err)
+		return
+	}
+	got = h.normalize(got)
+	if os.Getenv("SCIPIPE_UPDATE_GOLDEN") != "" {
+		if err := ioutil.WriteFile(h.srcPath(golden), got, 0644); err != nil {
+			h.t.Errorf("Could not update golden file: %s", err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(h.srcPath(golden))
+	if err != nil {
+		h.t.Errorf("Could not read golden file (set SCIPIPE_UPDATE_GOLDEN to create it): %s", err)
+		return
+	}
+	want = h.normalize(want)
+	if !bytes.Equal(got, want) {
+		h.t.Errorf("Output %s does not match golden file %s:\n%s", path, golden, diffLines(string(want), string(got)))
+	}
+}
+
+func (h *Harness) normalize(data []byte) []byte {
+	for _, n := range h.Normalizers {
+		data = n(data)
+	}
+	return data
+}
+
+// Get the path of the file at path, relative to the working directory of
+// the test
+func (h *Harness) srcPath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(h.srcDir, path)
+}
+
+// Remove the temporary directory, unless the test failed, or KeepDir is set
+func (h *Harness) cleanUp() {
+	if h.KeepDir || h.t.Failed() {
+		h.t.Logf("Keeping temporary directory: %s", h.Dir)
+		return
+	}
+	os.RemoveAll(h.Dir)
+}
+
+// ------- Normalizers -------
+
+// Normalize Windows line endings to Unix ones
+func NormalizeLineEndings(data []byte) []byte {
+	return bytes.Replace(data, []byte("\r\n"), []byte("\n"), -1)
+}
+
+// Get a normalizer replacing all occurrences of old with new
+func ReplaceString(old string, new string) Normalizer {
+	return func(data []byte) []byte {
+		return bytes.Replace(data, []byte(old), []byte(new), -1)
+	}
+}
+
+// Get a normalizer replacing all matches of the regular expression pattern
+// with repl, which can refer to submatches, as in regexp.ReplaceAll, such
+// as for replacing timestamps
+func ReplaceRegexp(pattern string, repl string) Normalizer {
+	r := regexp.MustCompile(pattern)
+	return func(data []byte) []byte {
+		return r.ReplaceAll(data, []byte(repl))
+	}
+}
+
+// Sort the lines, for outputs whose order of lines is not deterministic
+func SortLines(data []byte) []byte {
+	text := strings.TrimSuffix(string(data), "\n")
+	lines := strings.Split(text, "\n")
+	sort.Strings(lines)
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+// Describe the first line that differs between want and got
+func diffLines(want string, got string) string {
+	wantLines := strings.Split(want, "\n")
+	gotLines := strings.Split(got, "\n")
+	for i := 0; i < len(wantLines) || i < len(gotLines); i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w != g || i >= len(wantLines) || i >= len(gotLines) {
+			return fmt.Sprintf("line %d:\n  want: %q\n  got:  %q", i+1, w, g)
+		}
+	}
+	return ""
+}
+
+// ------- Helper processes -------
+
+// paramSource sends a param value
+type paramSource struct {
+	Out   *scipipe.ParamPort
+	value string
+}
+
+func newParamSource(value string) *paramSource {
+	return &paramSource{Out: scipipe.NewParamPort(), value: value}
+}
+
+func (p *paramSource) IsConnected() bool { return p.Out.IsConnected() }
+
+func (p *paramSource) Run() {
+	defer p.Out.Close()
+	p.Out.Chan <- p.value
+}
+
+// collector records the paths of the targets it receives
+type collector struct {
+	In    *scipipe.InPort
+	paths []string
+}
+
+func newCollector() *collector {
+	return &collector{In: scipipe.NewInPort()}
+}
+
+func (c *collector) IsConnected() bool { return c.In.IsConnected() }
+
+func (c *collector) Run() {
+	for ft := range c.In.Chan {
+		c.paths = append(c.paths, ft.GetPath())
+	}
+}
@@ -0,0 +1,47 @@
+package sptest
+
+import (
+	"github.com/scipipe/scipipe"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunProcess(t *testing.T) {
+	scipipe.InitLogError()
+	h := New(t)
+	p := scipipe.NewFromShell("sort", "sort {i:in} > {o:sorted}; echo {p:label}: $(pwd)/{i:in} > {o:header}")
+	p.SetPathExtend("in", "sorted", ".sorted")
+	p.SetPathExtend("in", "header", ".header")
+	outs := h.RunProcess(p, map[string]string{"in": "testdata/fruits.txt"}, map[string]string{"label": "fruits"})
+	if outs["sorted"] != "fruits.txt.sorted" {
+		t.Errorf("Wrong output path: %s", outs["sorted"])
+	}
+	h.AssertGolden(outs["sorted"], "testdata/fruits.sorted.golden")
+	// The temporary directory in the output is normalized
+	h.AssertGolden(outs["header"], "testdata/fruits.header.golden")
+
+	if _, err := os.Stat(filepath.Join(h.Dir, "fruits.txt.sorted")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNormalizers(t *testing.T) {
+	data := []byte("b 2020-01-01\r\na 2021-12-31\r\n")
+	for _, n := range []Normalizer{NormalizeLineEndings, ReplaceRegexp(`\d{4}-\d\d-\d\d`, "DATE"), SortLines} {
+		data = n(data)
+	}
+	if string(data) != "a DATE\nb DATE\n" {
+		t.Errorf("Wrong normalized data: %q", data)
+	}
+}
+
+func TestCleanUp(t *testing.T) {
+	var dir string
+	t.Run("harness", func(t *testing.T) {
+		dir = New(t).Dir
+	})
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("Temporary directory %s not removed", dir)
+	}
+}
@@ -0,0 +1,308 @@
+package scipipe
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	str "strings"
+)
+
+// Directory under which per-task staging directories are created
+var TaskStagingDir = ".scipipe/tasks"
+
+// StagingMode decides how input files are made available to a task's command
+type StagingMode int
+
+const (
+	// Input files are used in place (the default)
+	StagingModeNone StagingMode = iota
+	// Input files are symlinked into the task's staging directory
+	StagingModeSymlink
+	// Input files are hardlinked into the task's staging directory, falling
+	// back to symlinks when hardlinking is not possible (e.g. across file
+	// systems)
+	StagingModeHardlink
+	// Input files are copied into the task's staging directory
+	StagingModeCopy
+)
+
+// Get the ID of the task, which is unique for the process and the task's
+// inputs and params (a hash of the process name, input paths and param
+// values), so that tasks of different processes with the same inputs get
+// different IDs
+func (t *SciTask) GetID() string {
+	h := sha1.New()
+	h.Write([]byte(t.process.Name + "\n"))
+	inNames := []string{}
+	for iname := range t.InTargets {
+		inNames = append(inNames, iname)
+	}
+	sort.Strings(inNames)
+	for _, iname := range inNames {
+		h.Write([]byte(iname + "=" + str.Join(t.InTargets[iname].GetPaths(), ",") + "\n"))
+	}
+	pNames := []string{}
+	for pname := range t.Params {
+		pNames = append(pNames, pname)
+	}
+	sort.Strings(pNames)
+	for _, pname := range pNames {
+		h.Write([]byte(pname + "=" + t.Params[pname] + "\n"))
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+// Get the staging directory of the task, which is unique for the process and
+// the task's inputs and params. It is placed in the scratch directory of the
+// process, if one is set, or otherwise in TaskStagingDir.
+func (t *SciTask) GetStagingDir() string {
+	baseDir := TaskStagingDir
+	if t.process.ScratchDir != "" {
+		baseDir = t.process.ScratchDir
+	}
+	return filepath.Join(baseDir, t.Name+"."+t.GetID())
+}
+
+// Get the scratch directory of the task (its staging directory), for side
+// files that the command needs to write. When used, the directory is
+// created before the command is executed, and removed afterwards. It is
+// available in commands as {task.scratch}.
+func (t *SciTask) GetScratchDir() string {
+	t.usesScratchDir = true
+	return t.GetStagingDir()
+}
+
+// Get the staging mode for inputs of the task, which defaults to copying when
+// a scratch directory is used, and to symlinking when the task has its own
+// working directory
+func (t *SciTask) getStagingMode() StagingMode {
+	if t.process.ScratchDir != "" && t.process.InputStaging == StagingModeNone {
+		return StagingModeCopy
+	}
+	if t.process.IsolateWorkDir && t.process.InputStaging == StagingModeNone {
+		return StagingModeSymlink
+	}
+	return t.process.InputStaging
+}
+
+// Check whether the input on in-port inPortName is staged into the task's
+// staging directory, rather than used in place
+func (t *SciTask) isStagedInPort(inPortName string) bool {
+	itgt := t.InTargets[inPortName]
+	return t.getStagingMode() != StagingModeNone &&
+		!itgt.IsStreaming() && !itgt.IsInMemory() && !itgt.IsFileSet() && !itgt.IsList()
+}
+
+// Get the path at which the input on in-port inPortName is staged
+func (t *SciTask) getStagedInPath(inPortName string) string {
+	return filepath.Join(t.GetStagingDir(), inPortName, filepath.Base(t.InTargets[inPortName].GetPath()))
+}
+
+// Check whether the output on out-port outPortName is written to the scratch
+// directory, before being moved to its final location
+func (t *SciTask) isScratchOutPort(outPortName string) bool {
+	return t.process.ScratchDir != "" && !t.OutTargets[outPortName].IsStreaming()
+}
+
+// Get the path in the scratch directory, to which the output on out-port
+// outPortName is written
+func (t *SciTask) getScratchOutPath(outPortName string) string {
+	return filepath.Join(t.GetStagingDir(), "out", outPortName, filepath.Base(t.OutTargets[outPortName].GetTempPath()))
+}
+
+// Link (or copy) the inputs of the task into its staging directory, according
+// to the staging mode of the process, and create directories for outputs
+// written to the scratch directory, as well as the scratch directory itself,
+// if used by the command, or as the working directory of the task
+func (t *SciTask) linkStagedInputs() error {
+	if t.usesScratchDir || t.process.IsolateWorkDir {
+		if err := os.MkdirAll(t.GetStagingDir(), 0777); err != nil {
+			return err
+		}
+	}
+	for oname, otgt := range t.OutTargets {
+		if !t.isScratchOutPort(oname) {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(t.getScratchOutPath(oname)), 0777); err != nil {
+			return err
+		}
+		if otgt.IsFileSet() {
+			if err := os.MkdirAll(t.getScratchOutPath(oname), 0777); err != nil {
+				return err
+			}
+		}
+	}
+	for iname, itgt := range t.InTargets {
+		if !t.isStagedInPort(iname) {
+			continue
+		}
+		stagedPath := t.getStagedInPath(iname)
+		if err := os.MkdirAll(filepath.Dir(stagedPath), 0777); err != nil {
+			return err
+		}
+		if _, err := os.Lstat(stagedPath); err == nil {
+			continue
+		}
+		absPath, err := filepath.Abs(itgt.GetPath())
+		if err != nil {
+			return err
+		}
+		if t.getStagingMode() == StagingModeCopy {
+			if err := copyFile(absPath, stagedPath); err != nil {
+				return err
+			}
+			continue
+		}
+		if t.getStagingMode() == StagingModeHardlink {
+			err = os.Link(absPath, stagedPath)
+			if err == nil {
+				continue
+			}
+			t.logStructured(LevelDebug, "Could not hardlink input, so symlinking instead", Fields{"path": absPath, "error": err})
+		}
+		if err := os.Symlink(absPath, stagedPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Move outputs written to the scratch directory back to their temporary
+// paths, to be atomized from there
+func (t *SciTask) moveScratchOutputs() {
+	for oname, otgt := range t.OutTargets {
+		if !t.isScratchOutPort(oname) {
+			continue
+		}
+		scratchPath := t.getScratchOutPath(oname)
+		if _, err := os.Stat(scratchPath); err != nil {
+			// Output written in place, e.g. by a custom execute function
+			continue
+		}
+		t.logStructured(LevelDebug, "Moving output from scratch", Fields{"from": scratchPath, "to": otgt.GetTempPath()})
+		if otgt.IsFileSet() {
+			os.RemoveAll(otgt.GetTempPath())
+		}
+		err := moveFile(scratchPath, otgt.GetTempPath())
+		Check(err)
+	}
+}
+
+// Remove the task's staging directory, if it exists
+func (t *SciTask) removeStagingDir() {
+	if t.getStagingMode() != StagingModeNone || t.process.ScratchDir != "" || t.usesScratchDir || t.process.IsolateWorkDir {
+		err := os.RemoveAll(t.GetStagingDir())
+		Check(err)
+	}
+}
+
+// Move the file or directory at srcPath to dstPath, copying it if it can not
+// be renamed, e.g. since the paths are on different file systems. It is then
+// copied to a hidden path next to dstPath, synced to disk, and renamed, so
+// that dstPath still appears atomically, and complete.
+func moveFile(srcPath string, dstPath string) error {
+	if err := renameFile(srcPath, dstPath); err == nil {
+		return nil
+	}
+	fi, err := os.Stat(srcPath)
+	if err != nil {
+		return err
+	}
+	copyPath := filepath.Join(filepath.Dir(dstPath), "."+filepath.Base(dstPath)+".copying")
+	if err := os.RemoveAll(copyPath); err != nil {
+		return err
+	}
+	if err := copyTree(srcPath, copyPath, fi); err != nil {
+		return err
+	}
+	if err := syncPath(copyPath); err != nil {
+		return err
+	}
+	if err := renameFile(copyPath, dstPath); err != nil {
+		return err
+	}
+	return os.RemoveAll(srcPath)
+}
+
+// Copy the file or directory at srcPath, with the info fi, to dstPath
+func copyTree(srcPath string, dstPath string, fi os.FileInfo) error {
+	if !fi.IsDir() {
+		return copyFile(srcPath, dstPath)
+	}
+	return filepath.Walk(srcPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(srcPath, path)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return os.MkdirAll(filepath.Join(dstPath, relPath), 0777)
+		}
+		return copyFile(path, filepath.Join(dstPath, relPath))
+	})
+}
+
+// Copy the file at srcPath to dstPath, keeping its file mode
+func copyFile(srcPath string, dstPath string) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	dst, err := os.OpenFile(dstPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fi.Mode())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// Sync the file at path, or a directory and everything in it, to disk
+func syncPath(path string) error {
+	return filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return syncDir(path)
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return f.Sync()
+	})
+}
+
+// Sync the directory at path to disk, so that files created in, or renamed
+// into, it are not lost on a system crash. Directories can not be synced on
+// Windows, where this does nothing.
+func syncDir(path string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
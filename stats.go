@@ -0,0 +1,281 @@
+package scipipe
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// ======= Run statistics ========
+
+// RunStats contains statistics for a run of a Workflow, per process
+type RunStats struct {
+	StartTime  time.Time
+	FinishTime time.Time
+	Processes  map[string]ProcessStats
+}
+
+// Get the total number of tasks, over all processes, in the run statistics
+func (rs RunStats) GetTotal() ProcessStats {
+	total := ProcessStats{DurationCounts: make([]int, len(TaskDurationBuckets))}
+	for _, ps := range rs.Processes {
+		for i, c := range ps.DurationCounts {
+			total.DurationCounts[i] += c
+		}
+		total.TasksCreated += ps.TasksCreated
+		total.TasksRunning += ps.TasksRunning
+		total.TasksExecuted += ps.TasksExecuted
+		total.TasksSkipped += ps.TasksSkipped
+		total.TasksFailed += ps.TasksFailed
+		total.ExecTime += ps.ExecTime
+	}
+	return total
+}
+
+// ProcessStats contains the number of tasks of a process that were created,
+// are running, were executed, skipped (since their outputs existed), and
+// failed, as well as the total time spent executing them
+type ProcessStats struct {
+	TasksCreated  int
+	TasksRunning  int
+	TasksExecuted int
+	TasksSkipped  int
+	TasksFailed   int
+	ExecTime      time.Duration
+	// The number of executed tasks with a duration of at most the
+	// corresponding bound in TaskDurationBuckets
+	DurationCounts []int
+	// The last few tasks executed or failed, most recent last
+	RecentTasks []TaskRecord
+	errors      []error
+	lock        *sync.Mutex
+}
+
+// The upper bounds of the buckets for task durations, in ProcessStats
+var TaskDurationBuckets = []time.Duration{
+	time.Second,
+	10 * time.Second,
+	time.Minute,
+	10 * time.Minute,
+	time.Hour,
+	4 * time.Hour,
+	24 * time.Hour,
+}
+
+// The number of recent tasks kept in ProcessStats
+const numRecentTasks = 10
+
+// TaskRecord describes an executed (or failed) task
+type TaskRecord struct {
+	Name       string
+	Index      int
+	Command    string
+	Succeeded  bool
+	Error      string
+	StartTime  time.Time
+	FinishTime time.Time
+	// The path of the log file of the task, if TaskLogFiles is set for its
+	// process
+	LogPath string
+	// The paths of the (non-streaming) outputs of the task, by out-port
+	// name, and the values of its params
+	Outputs map[string]string
+	Params  map[string]string
+	// The temporary paths of the outputs that are not their paths with
+	// .tmp added (see FileTarget.SetTempDir)
+	TempPaths map[string]string `json:",omitempty"`
+	// The resources used by the command of the task, if profiled (see
+	// SciProcess.Profile)
+	Resources *ResourceUsage
+}
+
+func newTaskRecord(t *SciTask) TaskRecord {
+	tr := TaskRecord{
+		Name:       t.Name,
+		Index:      t.Index,
+		Command:    t.Command,
+		Succeeded:  t.err == nil,
+		StartTime:  t.AuditInfo.StartTime,
+		FinishTime: t.AuditInfo.FinishTime,
+		Outputs:    make(map[string]string),
+		Params:     make(map[string]string),
+		Resources:  t.AuditInfo.Resources,
+	}
+	for oname, otgt := range t.OutTargets {
+		if !otgt.IsStreaming() {
+			tr.Outputs[oname] = otgt.GetPath()
+			if tmpPath := otgt.GetTempPath(); tmpPath != otgt.GetPath()+".tmp" {
+				if tr.TempPaths == nil {
+					tr.TempPaths = make(map[string]string)
+				}
+				tr.TempPaths[oname] = tmpPath
+			}
+		}
+	}
+	for pname, pval := range t.Params {
+		tr.Params[pname] = pval
+	}
+	if t.err != nil {
+		tr.Error = t.err.Error()
+	}
+	if t.process.TaskLogFiles {
+		tr.LogPath = t.GetLogPath()
+	}
+	return tr
+}
+
+// Add the record of task t to the recent tasks. Must be called with the
+// lock held.
+func (ps *ProcessStats) addRecentTask(t *SciTask) {
+	ps.RecentTasks = append(ps.RecentTasks, newTaskRecord(t))
+	if len(ps.RecentTasks) > numRecentTasks {
+		ps.RecentTasks = ps.RecentTasks[len(ps.RecentTasks)-numRecentTasks:]
+	}
+}
+
+func newProcessStats() *ProcessStats {
+	return &ProcessStats{
+		DurationCounts: make([]int, len(TaskDurationBuckets)),
+		lock:           new(sync.Mutex),
+	}
+}
+
+// Update the stats with the function update, while holding the lock
+func (ps *ProcessStats) update(update func(*ProcessStats)) {
+	ps.lock.Lock()
+	update(ps)
+	ps.lock.Unlock()
+}
+
+// Get a copy of the stats, safe to read while tasks are running
+func (ps *ProcessStats) get() ProcessStats {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+	cp := *ps
+	cp.DurationCounts = append([]int{}, ps.DurationCounts...)
+	cp.RecentTasks = append([]TaskRecord{}, ps.RecentTasks...)
+	cp.errors = append([]error{}, ps.errors...)
+	cp.lock = nil
+	return cp
+}
+
+// Get the number of tasks that are done, that is, executed, skipped or
+// failed
+func (ps ProcessStats) GetTasksDone() int {
+	return ps.TasksExecuted + ps.TasksSkipped + ps.TasksFailed
+}
+
+// ------- Recording of task events, in SciProcess -------
+
+func (p *SciProcess) recordTaskCreated(t *SciTask) {
+	if p.stats != nil {
+		p.stats.update(func(ps *ProcessStats) { ps.TasksCreated++ })
+	}
+	t.logStructured(LevelDebug, "Task created", nil)
+	p.hooks.callTask(taskCreatedEvent, t)
+}
+
+// Record that the task t was skipped, for the reason given, as in "since its
+// outputs exist"
+func (p *SciProcess) recordTaskSkipped(t *SciTask, reason string) {
+	if p.stats != nil {
+		p.stats.update(func(ps *ProcessStats) { ps.TasksSkipped++ })
+	}
+	t.logStructured(LevelInfo, "Task skipped, "+reason, nil)
+	p.hooks.callTask(taskSkippedEvent, t)
+}
+
+func (p *SciProcess) recordTaskStarted(t *SciTask) {
+	if p.stats != nil {
+		p.stats.update(func(ps *ProcessStats) { ps.TasksRunning++ })
+	}
+	t.logStructured(LevelInfo, "Task started", Fields{"command": t.Command})
+	p.hooks.callTask(taskStartEvent, t)
+}
+
+func (p *SciProcess) recordTaskExecuted(t *SciTask) {
+	if p.stats != nil {
+		p.stats.update(func(ps *ProcessStats) {
+			duration := t.AuditInfo.FinishTime.Sub(t.AuditInfo.StartTime)
+			ps.TasksRunning--
+			ps.TasksExecuted++
+			ps.ExecTime += duration
+			for i, bound := range TaskDurationBuckets {
+				if duration <= bound {
+					ps.DurationCounts[i]++
+				}
+			}
+			ps.addRecentTask(t)
+		})
+	}
+	t.logStructured(LevelInfo, "Task succeeded", Fields{"duration_ms": t.AuditInfo.ExecTimeMS})
+	p.hooks.callTask(taskSuccessEvent, t)
+}
+
+// Record that the task t failed with err. Unless the process is run by a
+// Workflow, which collects the errors of failed tasks, the whole program
+// exits, since the outputs of the task are missing.
+func (p *SciProcess) recordTaskFailed(t *SciTask, err error) {
+	t.logStructured(LevelError, "Task failed", Fields{"error": err})
+	if p.stats == nil {
+		os.Exit(126)
+	}
+	p.stats.update(func(ps *ProcessStats) {
+		ps.TasksRunning--
+		ps.TasksFailed++
+		ps.errors = append(ps.errors, err)
+		ps.addRecentTask(t)
+	})
+	p.hooks.callTaskFailure(t, err)
+}
+
+// ======= Progress ========
+
+// Progress describes how far a workflow run has come, as the number of
+// tasks created, done (executed, skipped or failed) and running, over all
+// processes, with an estimate of the remaining time
+type Progress struct {
+	TasksCreated int
+	TasksDone    int
+	TasksRunning int
+	TasksFailed  int
+	Elapsed      time.Duration
+	// The estimated time until the tasks created so far are done, based on
+	// the rate at which tasks have been done, or 0 if no task is done yet.
+	// Since tasks are created as their inputs become available, the
+	// estimate grows as more tasks are created.
+	ETA       time.Duration
+	Processes map[string]ProcessStats
+}
+
+// Get the progress of a run with the run statistics rs, at the time now
+func newProgress(rs RunStats, now time.Time) Progress {
+	total := rs.GetTotal()
+	p := Progress{
+		TasksCreated: total.TasksCreated,
+		TasksDone:    total.GetTasksDone(),
+		TasksRunning: total.TasksRunning,
+		TasksFailed:  total.TasksFailed,
+		Processes:    rs.Processes,
+	}
+	if !rs.StartTime.IsZero() {
+		p.Elapsed = now.Sub(rs.StartTime)
+	}
+	if p.TasksDone > 0 {
+		p.ETA = p.Elapsed / time.Duration(p.TasksDone) * time.Duration(p.TasksCreated-p.TasksDone)
+	}
+	return p
+}
+
+// Format the progress as in "42/310 tasks done, 3 running, ETA 12m0s"
+func (p Progress) String() string {
+	s := fmt.Sprintf("%d/%d tasks done, %d running", p.TasksDone, p.TasksCreated, p.TasksRunning)
+	if p.TasksFailed > 0 {
+		s += fmt.Sprintf(", %d failed", p.TasksFailed)
+	}
+	if p.TasksDone > 0 && p.TasksDone < p.TasksCreated {
+		s += fmt.Sprintf(", ETA %s", p.ETA.Round(time.Second))
+	}
+	return s
+}
@@ -0,0 +1,82 @@
+package scipipe
+
+import (
+	"sort"
+	"time"
+)
+
+// ======= Workflow status ========
+
+// The states of the processes of a workflow, in WorkflowStatus
+const (
+	ProcessWaiting = "waiting"
+	ProcessRunning = "running"
+	ProcessDone    = "done"
+	ProcessFailed  = "failed"
+)
+
+// WorkflowStatus is a snapshot of the state of a workflow run, with the
+// state of each process, the connections between them, the most recently
+// finished tasks, and the overall progress and throughput
+type WorkflowStatus struct {
+	Name           string
+	Progress       Progress
+	TasksPerMinute float64
+	Processes      []ProcessStatus
+	Connections    []Connection
+	RecentTasks    []TaskRecord
+}
+
+// ProcessStatus is the state of a process, in WorkflowStatus. The stats are
+// only available for SciProcesses.
+type ProcessStatus struct {
+	Name  string
+	State string
+	Stats ProcessStats
+}
+
+// Get the status of the workflow. It can be called while the workflow is
+// running.
+func (wf *Workflow) GetStatus() WorkflowStatus {
+	rs := wf.GetStats()
+	progress := wf.GetProgress()
+	ws := WorkflowStatus{
+		Name:        wf.Name,
+		Progress:    progress,
+		Connections: wf.GetConnections(),
+	}
+	if minutes := progress.Elapsed.Minutes(); minutes > 0 {
+		ws.TasksPerMinute = float64(progress.TasksDone) / minutes
+	}
+	wf.lock.Lock()
+	started := !wf.startTime.IsZero()
+	for _, name := range wf.procNames {
+		ps, isSciProcess := rs.Processes[name]
+		state := ProcessWaiting
+		switch {
+		case wf.procsDone[name] && ps.TasksFailed > 0:
+			state = ProcessFailed
+		case wf.procsDone[name]:
+			state = ProcessDone
+		case isSciProcess && ps.TasksRunning+ps.GetTasksDone() > 0:
+			state = ProcessRunning
+		case !isSciProcess && started:
+			state = ProcessRunning
+		}
+		ws.Processes = append(ws.Processes, ProcessStatus{Name: name, State: state, Stats: ps})
+		ws.RecentTasks = append(ws.RecentTasks, ps.RecentTasks...)
+	}
+	wf.lock.Unlock()
+	sort.SliceStable(ws.RecentTasks, func(i, j int) bool {
+		return ws.RecentTasks[i].FinishTime.Before(ws.RecentTasks[j].FinishTime)
+	})
+	if len(ws.RecentTasks) > numRecentTasks {
+		ws.RecentTasks = ws.RecentTasks[len(ws.RecentTasks)-numRecentTasks:]
+	}
+	return ws
+}
+
+// Get the duration of the task described by the record
+func (tr TaskRecord) GetDuration() time.Duration {
+	return tr.FinishTime.Sub(tr.StartTime)
+}
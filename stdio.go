@@ -0,0 +1,93 @@
+package scipipe
+
+import (
+	"os"
+	"os/exec"
+)
+
+// ======= Stdin and stdout wiring ========
+
+// Make the in-port inPortName the stdin of the commands of the process,
+// creating the in-port if needed, so that the command pattern does not
+// need a redirect, as for tools reading their input from stdin. The
+// redirect is added to shell commands, while commands executed without a
+// shell (see ShellNone) get the file opened as their stdin. Note that
+// PowerShell does not support redirecting stdin.
+func (p *SciProcess) SetStdin(inPortName string) {
+	p.StdinPort = inPortName
+	p.initPortsFromCmdPattern("{i:"+inPortName+"}", nil)
+}
+
+// Make the stdout of the commands of the process be written to the output
+// of the out-port outPortName, creating the out-port if needed, as for
+// tools writing their output to stdout (see SetStdin). The output is
+// streamed if the out-port is set to stream.
+func (p *SciProcess) SetStdout(outPortName string) {
+	p.StdoutPort = outPortName
+	p.initPortsFromCmdPattern("{o:"+outPortName+"}", nil)
+}
+
+// Get the redirects of the stdin and stdout of the commands of the process,
+// with placeholders for their ports, or "" if neither is set
+func (p *SciProcess) getStdioPattern() string {
+	pattern := ""
+	if p.StdinPort != "" {
+		pattern += " < {i:" + p.StdinPort + "}"
+	}
+	if p.StdoutPort != "" {
+		typ := "o"
+		if p.OutPortsDoStream[p.StdoutPort] {
+			typ = "os"
+		}
+		pattern += " > {" + typ + ":" + p.StdoutPort + "}"
+	}
+	return pattern
+}
+
+// Get the shell command pattern of the process, with the redirects of its
+// stdin and stdout, if set
+func (p *SciProcess) getShellCommandPattern() string {
+	return p.CommandPattern + p.getStdioPattern()
+}
+
+// Get the paths of the files that the stdin and stdout of the command of
+// the task are redirected from and to, or "" for those not redirected
+func (t *SciTask) getStdioPaths() (stdinPath string, stdoutPath string) {
+	if p := t.process; p.StdinPort != "" {
+		stdinPath = t.formatPlaceHolder("i", p.StdinPort, []string{"raw"}, p.getStdioPattern())
+	}
+	if p := t.process; p.StdoutPort != "" {
+		stdoutPath = t.formatPlaceHolder("os", p.StdoutPort, []string{"raw"}, p.getStdioPattern())
+	}
+	return stdinPath, stdoutPath
+}
+
+// Open the files of the stdin and stdout of the command, executed without
+// a shell, returning a function closing them, to call after it has run
+func (t *SciTask) openStdio(command *exec.Cmd) (func(), error) {
+	var files []*os.File
+	closeFiles := func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}
+	stdinPath, stdoutPath := t.getStdioPaths()
+	if stdinPath != "" {
+		f, err := os.Open(stdinPath)
+		if err != nil {
+			return closeFiles, err
+		}
+		files = append(files, f)
+		command.Stdin = f
+	}
+	if stdoutPath != "" {
+		// Blocks until a streamed output is opened by its reader
+		f, err := os.OpenFile(stdoutPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return closeFiles, err
+		}
+		files = append(files, f)
+		command.Stdout = f
+	}
+	return closeFiles, nil
+}
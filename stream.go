@@ -0,0 +1,27 @@
+package scipipe
+
+// ======= StreamTransport ========
+
+// StreamTransport is the mechanism used to stream data between the commands
+// of two tasks, for out-ports set to stream (with the {os:PORTNAME}
+// placeholder). The producing command writes to the write path of the
+// stream, while the consuming command reads from its read path.
+//
+// The transport used is selected automatically based on the platform: named
+// FIFO files on POSIX systems, and named pipes on Windows.
+type StreamTransport interface {
+	// Create the stream for the target, before the producing task is started
+	Create(ft *FileTarget) error
+	// Check whether the stream for the target exists
+	Exists(ft *FileTarget) bool
+	// Remove the stream for the target
+	Remove(ft *FileTarget) error
+	// Get the path that the producing command writes to
+	GetWritePath(ft *FileTarget) string
+	// Get the path that the consuming command reads from
+	GetReadPath(ft *FileTarget) string
+}
+
+// The StreamTransport used for streaming targets. Defaults to the one for the
+// current platform, but can be replaced before the workflow is run.
+var Streams StreamTransport = newPlatformStreamTransport()
@@ -0,0 +1,39 @@
+//go:build !windows
+// +build !windows
+
+package scipipe
+
+import (
+	"os"
+	"syscall"
+)
+
+func newPlatformStreamTransport() StreamTransport {
+	return &fifoStreamTransport{}
+}
+
+// fifoStreamTransport streams data via POSIX named FIFO files, which are
+// written and read at the FIFO path of the target
+type fifoStreamTransport struct{}
+
+func (st *fifoStreamTransport) Create(ft *FileTarget) error {
+	Debug.Println("Now creating FIFO:", ft.GetFifoPath())
+	return syscall.Mkfifo(ft.GetFifoPath(), 0644)
+}
+
+func (st *fifoStreamTransport) Exists(ft *FileTarget) bool {
+	_, err := os.Stat(ft.GetFifoPath())
+	return err == nil
+}
+
+func (st *fifoStreamTransport) Remove(ft *FileTarget) error {
+	return os.Remove(ft.GetFifoPath())
+}
+
+func (st *fifoStreamTransport) GetWritePath(ft *FileTarget) string {
+	return ft.GetFifoPath()
+}
+
+func (st *fifoStreamTransport) GetReadPath(ft *FileTarget) string {
+	return ft.GetFifoPath()
+}
@@ -0,0 +1,50 @@
+package scipipe
+
+import (
+	"github.com/stretchr/testify/assert"
+	"sync"
+	t "testing"
+)
+
+// recordingStreamTransport records the streams created through the platform
+// stream transport that it wraps
+type recordingStreamTransport struct {
+	StreamTransport
+	created []string
+	lock    sync.Mutex
+}
+
+func (st *recordingStreamTransport) Create(ft *FileTarget) error {
+	st.lock.Lock()
+	st.created = append(st.created, ft.GetPath())
+	st.lock.Unlock()
+	return st.StreamTransport.Create(ft)
+}
+
+func TestStreamTransport(t *t.T) {
+	initTestLogs()
+
+	rec := &recordingStreamTransport{StreamTransport: Streams}
+	Streams = rec
+	defer func() { Streams = rec.StreamTransport }()
+
+	ls := NewFromShell("ls", "echo hej > {os:out}")
+	ls.SetPathStatic("out", "/tmp/stream_transport.txt")
+	cat := NewFromShell("cat", "cat {i:in} > {o:out}")
+	cat.SetPathExtend("in", "out", ".cat")
+	snk := NewSink()
+	cat.In["in"].Connect(ls.Out["out"])
+	snk.Connect(cat.Out["out"])
+
+	pl := NewPipelineRunner()
+	pl.AddProcesses(ls, cat, snk)
+	pl.Run()
+	defer cleanFiles("/tmp/stream_transport.txt", "/tmp/stream_transport.txt.fifo", "/tmp/stream_transport.txt.cat")
+
+	// The stream is created through the transport in use, and the consuming
+	// command reads what was streamed through it
+	assert.Equal(t, []string{"/tmp/stream_transport.txt"}, rec.created)
+	assert.Equal(t, "hej\n", string(NewFileTarget("/tmp/stream_transport.txt.cat").Read()))
+
+	assert.True(t, rec.Exists(NewFileTarget("/tmp/stream_transport.txt")))
+}
@@ -0,0 +1,152 @@
+//go:build windows
+// +build windows
+
+package scipipe
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32             = syscall.NewLazyDLL("kernel32.dll")
+	procCreateNamedPipeW = kernel32.NewProc("CreateNamedPipeW")
+	procConnectNamedPipe = kernel32.NewProc("ConnectNamedPipe")
+)
+
+const (
+	pipeAccessInbound    = 0x1
+	pipeAccessOutbound   = 0x2
+	pipeTypeByte         = 0x0
+	pipeWait             = 0x0
+	pipeBufSize          = 64 * 1024
+	errorPipeConnected   = syscall.Errno(535)
+	namedPipePathPrefix  = `\\.\pipe\scipipe-`
+	namedPipeWriteSuffix = "-w"
+	namedPipeReadSuffix  = "-r"
+)
+
+func newPlatformStreamTransport() StreamTransport {
+	return &namedPipeStreamTransport{
+		pipes: make(map[string]bool),
+		lock:  new(sync.Mutex),
+	}
+}
+
+// namedPipeStreamTransport streams data via Windows named pipes. Since a
+// named pipe connects a server with a single client, two pipes are created
+// for each stream: One that the producing command writes to, and one that the
+// consuming command reads from, while scipipe relays the data in between.
+type namedPipeStreamTransport struct {
+	pipes map[string]bool
+	lock  *sync.Mutex
+}
+
+// Get the base name of the pipes for a target, unique for its FIFO path
+func (st *namedPipeStreamTransport) pipeBasePath(ft *FileTarget) string {
+	absPath, err := filepath.Abs(ft.GetFifoPath())
+	Check(err)
+	sum := sha1.Sum([]byte(absPath))
+	return namedPipePathPrefix + hex.EncodeToString(sum[:])[:16]
+}
+
+func (st *namedPipeStreamTransport) Create(ft *FileTarget) error {
+	basePath := st.pipeBasePath(ft)
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	if st.pipes[basePath] {
+		return errors.New("Named pipe already exists: " + basePath)
+	}
+	wh, err := createNamedPipe(basePath+namedPipeWriteSuffix, pipeAccessInbound)
+	if err != nil {
+		return err
+	}
+	rh, err := createNamedPipe(basePath+namedPipeReadSuffix, pipeAccessOutbound)
+	if err != nil {
+		syscall.CloseHandle(wh)
+		return err
+	}
+	st.pipes[basePath] = true
+	Debug.Println("Created named pipes:", basePath+namedPipeWriteSuffix, basePath+namedPipeReadSuffix)
+	go st.relay(basePath, wh, rh)
+	return nil
+}
+
+// Relay data written by the producer to the consumer, when both have
+// connected to their respective pipe
+func (st *namedPipeStreamTransport) relay(basePath string, wh syscall.Handle, rh syscall.Handle) {
+	defer func() {
+		st.lock.Lock()
+		delete(st.pipes, basePath)
+		st.lock.Unlock()
+	}()
+	wf := os.NewFile(uintptr(wh), basePath+namedPipeWriteSuffix)
+	rf := os.NewFile(uintptr(rh), basePath+namedPipeReadSuffix)
+	defer wf.Close()
+	defer rf.Close()
+	if err := connectNamedPipe(wh); err != nil {
+		Error.Println("Could not connect producer to named pipe:", basePath, err)
+		return
+	}
+	if err := connectNamedPipe(rh); err != nil {
+		Error.Println("Could not connect consumer to named pipe:", basePath, err)
+		return
+	}
+	if _, err := io.Copy(rf, wf); err != nil && err != io.EOF {
+		Warning.Println("Streaming via named pipe stopped:", basePath, err)
+	}
+}
+
+func (st *namedPipeStreamTransport) Exists(ft *FileTarget) bool {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	return st.pipes[st.pipeBasePath(ft)]
+}
+
+// Named pipes are removed automatically when the relay has finished
+func (st *namedPipeStreamTransport) Remove(ft *FileTarget) error {
+	return nil
+}
+
+func (st *namedPipeStreamTransport) GetWritePath(ft *FileTarget) string {
+	return st.pipeBasePath(ft) + namedPipeWriteSuffix
+}
+
+func (st *namedPipeStreamTransport) GetReadPath(ft *FileTarget) string {
+	return st.pipeBasePath(ft) + namedPipeReadSuffix
+}
+
+func createNamedPipe(name string, openMode uint32) (syscall.Handle, error) {
+	namep, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return syscall.InvalidHandle, err
+	}
+	r, _, e := procCreateNamedPipeW.Call(
+		uintptr(unsafe.Pointer(namep)),
+		uintptr(openMode),
+		uintptr(pipeTypeByte|pipeWait),
+		1,
+		pipeBufSize,
+		pipeBufSize,
+		0,
+		0)
+	if syscall.Handle(r) == syscall.InvalidHandle {
+		return syscall.InvalidHandle, e
+	}
+	return syscall.Handle(r), nil
+}
+
+func connectNamedPipe(h syscall.Handle) error {
+	r, _, e := procConnectNamedPipe.Call(uintptr(h), 0)
+	if r == 0 && e != errorPipeConnected {
+		return e
+	}
+	return nil
+}
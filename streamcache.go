@@ -0,0 +1,315 @@
+package scipipe
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// ======= Caching of streamed outputs ========
+
+// Make the streaming out-port outPortName also write what it streams to a
+// cache file in the directory dir, named by the content signature of the
+// task (its command, output paths and input contents, where streamed inputs
+// are given by the content signatures of the tasks streaming them), so that
+// the cache is not replayed when the inputs change, also further upstream
+// in chains of streaming tasks. The inputs are hashed when the task is
+// executed. When a task is run again, and all of its streamed outputs are
+// cached (and its other outputs exist), the cached streams are replayed to
+// the consuming tasks, instead of executing its command, so that chains of
+// streaming tasks do not have to be recomputed.
+// Only outputs of commands are cached, not those of custom execution
+// functions.
+func (p *SciProcess) SetOutStreamCache(outPortName string, dir string) {
+	p.OutPortsStreamCache[outPortName] = dir
+}
+
+// Get the content signature of the task, as a hex string, identifying
+// tasks that compute the same thing, in that they have the same command,
+// output paths and input contents (see getInputHashes), for naming the
+// caches of its streamed outputs. It is computed once per task, since
+// hashing the inputs may take a while.
+func (t *SciTask) getContentSignature() string {
+	t.contentSignatureOnce.Do(func() {
+		paths := []string{}
+		for _, otgt := range t.OutTargets {
+			paths = append(paths, otgt.GetPath())
+		}
+		sort.Strings(paths)
+		h := sha256.New()
+		for _, s := range append(append([]string{t.Command}, paths...), t.getInputHashes()...) {
+			io.WriteString(h, s+"\x00")
+		}
+		t.contentSignature = hex.EncodeToString(h.Sum(nil))
+	})
+	return t.contentSignature
+}
+
+// streamCache is the cache file of a streamed output
+type streamCache struct {
+	// The directory and name of the cache file, and the function getting
+	// the key that it is also named by, which hashes the inputs of the task,
+	// and so is only called once the path is needed (see getPath)
+	dir      string
+	name     string
+	getKey   func() string
+	path     string
+	pathOnce sync.Once
+	// The stream that the command writes to, which is teed to the stream of
+	// the output, and to the cache file
+	tee *FileTarget
+	// Closed when the consuming task is done with the stream
+	read     chan struct{}
+	readOnce sync.Once
+}
+
+// Create the cache of the streamed output ft, of the out-port oname, in the
+// directory dir, named by the key returned by getKey
+func newStreamCache(ft *FileTarget, oname string, dir string, getKey func() string) *streamCache {
+	tee := NewFileTarget(ft.GetPath() + ".tee")
+	tee.doStream = true
+	return &streamCache{
+		dir:    dir,
+		name:   filepath.Base(ft.GetPath()) + "." + oname,
+		getKey: getKey,
+		tee:    tee,
+		read:   make(chan struct{}),
+	}
+}
+
+// Get the path of the cache file, named by the streamed output, and the key
+// of the cache, which is computed on the first call
+func (sc *streamCache) getPath() string {
+	sc.pathOnce.Do(func() {
+		sc.path = filepath.Join(sc.dir, sc.name+"."+sc.getKey()[:16]+".stream")
+	})
+	return sc.path
+}
+
+// Get the target whose stream the command writes the streamed output ft to:
+// the stream teeing it to the cache file, if cached, or else its own
+func (ft *FileTarget) getStreamWriteTarget() *FileTarget {
+	if ft.streamCache != nil {
+		return ft.streamCache.tee
+	}
+	return ft
+}
+
+// Mark the streaming inputs of the task as done with, whether they have been
+// read or not (as when the task is skipped), so that tasks replaying cached
+// streams to it do not wait for them to be read
+func (t *SciTask) markInStreamsRead() {
+	for _, itgt := range t.InTargets {
+		if sc := itgt.streamCache; sc != nil {
+			sc.readOnce.Do(func() { close(sc.read) })
+		}
+	}
+}
+
+// Open the stream of the streamed output ft for writing, which waits for
+// the consuming task to open it, returning nil if the consuming task is
+// done without opening it
+func (ft *FileTarget) openStreamForWrite() (*os.File, error) {
+	type result struct {
+		f   *os.File
+		err error
+	}
+	opened := make(chan result, 1)
+	go func() {
+		f, err := os.OpenFile(Streams.GetWritePath(ft), os.O_WRONLY, 0)
+		opened <- result{f, err}
+	}()
+	var read chan struct{}
+	if ft.streamCache != nil {
+		read = ft.streamCache.read
+	}
+	select {
+	case res := <-opened:
+		return res.f, res.err
+	case <-read:
+	}
+	// Unblock the opening, by opening the stream for reading, unless it was
+	// opened by the consuming task after all
+	select {
+	case res := <-opened:
+		return res.f, res.err
+	default:
+	}
+	if r, err := os.Open(Streams.GetReadPath(ft)); err == nil {
+		r.Close()
+	}
+	res := <-opened
+	if res.f != nil {
+		res.f.Close()
+	}
+	return nil, res.err
+}
+
+// Check whether any of the streamed outputs of the task are cached
+func (t *SciTask) hasStreamCache() bool {
+	for _, otgt := range t.OutTargets {
+		if otgt.streamCache != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Check whether all streamed outputs of the task are cached, and its other
+// outputs exist, so that the task can replay the cached streams, rather than
+// execute its command
+func (t *SciTask) canReplayStreamCache() bool {
+	anyStreamed := false
+	for _, otgt := range t.OutTargets {
+		if !otgt.IsStreaming() {
+			if !otgt.Exists() {
+				return false
+			}
+			continue
+		}
+		if otgt.streamCache == nil {
+			return false
+		}
+		if _, err := os.Stat(otgt.streamCache.getPath()); err != nil {
+			return false
+		}
+		anyStreamed = true
+	}
+	return anyStreamed
+}
+
+// Replay the cached streams of the streamed outputs of the task to the
+// consuming tasks, returning when they are done with them
+func (t *SciTask) replayStreamCache() {
+	wg := new(sync.WaitGroup)
+	for _, otgt := range t.OutTargets {
+		if !otgt.IsStreaming() {
+			continue
+		}
+		wg.Add(1)
+		go func(otgt *FileTarget) {
+			defer wg.Done()
+			if err := otgt.replayStream(); err != nil {
+				t.logStructured(LevelWarning, "Could not replay cached stream", Fields{"path": otgt.streamCache.getPath(), "error": err})
+			}
+		}(otgt)
+	}
+	wg.Wait()
+}
+
+// Copy the cache file of the streamed output ft to its stream
+func (ft *FileTarget) replayStream() error {
+	f, err := ft.openStreamForWrite()
+	if f == nil {
+		return err
+	}
+	defer f.Close()
+	cf, err := os.Open(ft.streamCache.getPath())
+	if err != nil {
+		return err
+	}
+	defer cf.Close()
+	_, err = io.Copy(f, cf)
+	return err
+}
+
+// streamCacheTee copies what a command writes to the tee stream of a cached
+// streamed output to its stream, and to a temporary cache file
+type streamCacheTee struct {
+	otgt   *FileTarget
+	opened bool
+	err    error
+	done   chan struct{}
+	lock   sync.Mutex
+}
+
+// Start teeing the cached streamed outputs of the task to their cache
+// files, returning a function to call with the error of the command, once
+// it has run, which waits for the teeing to finish, and keeps the cache
+// files only if the command succeeded
+func (t *SciTask) teeStreamsToCache() func(error) {
+	tees := []*streamCacheTee{}
+	for _, otgt := range t.OutTargets {
+		if otgt.streamCache == nil {
+			continue
+		}
+		tee := &streamCacheTee{otgt: otgt, done: make(chan struct{})}
+		tees = append(tees, tee)
+		go tee.run()
+	}
+	return func(cmdErr error) {
+		for _, tee := range tees {
+			tee.finish(cmdErr)
+			if tee.err != nil {
+				t.logStructured(LevelWarning, "Could not cache stream", Fields{"path": tee.otgt.streamCache.getPath(), "error": tee.err})
+			}
+		}
+	}
+}
+
+// Copy the tee stream to the stream and the temporary cache file
+func (tee *streamCacheTee) run() {
+	defer close(tee.done)
+	// Blocks until the command opens the tee stream for writing
+	r, err := os.Open(Streams.GetReadPath(tee.otgt.streamCache.tee))
+	tee.lock.Lock()
+	tee.opened = true
+	tee.lock.Unlock()
+	if err != nil {
+		tee.err = err
+		return
+	}
+	defer r.Close()
+	// The stream is written even if the cache file can not be
+	writers := []io.Writer{}
+	cf, err := tee.createCacheFile()
+	if err != nil {
+		tee.err = err
+	} else {
+		defer cf.Close()
+		writers = append(writers, cf)
+	}
+	f, err := tee.otgt.openStreamForWrite()
+	if err != nil {
+		tee.err = err
+	} else if f != nil {
+		defer f.Close()
+		writers = append(writers, f)
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), r); err != nil {
+		tee.err = err
+	}
+}
+
+// Create the temporary cache file, and its directory
+func (tee *streamCacheTee) createCacheFile() (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(tee.otgt.streamCache.getPath()), 0777); err != nil {
+		return nil, err
+	}
+	return os.Create(tee.otgt.streamCache.getPath() + ".tmp")
+}
+
+// Wait for the teeing to finish, after the command has run with the error
+// cmdErr, and move the temporary cache file in place, unless the command,
+// or the teeing, failed
+func (tee *streamCacheTee) finish(cmdErr error) {
+	// Unblock the opening of the tee stream, if the command never opened it
+	tee.lock.Lock()
+	if !tee.opened {
+		if w, err := os.OpenFile(Streams.GetWritePath(tee.otgt.streamCache.tee), os.O_WRONLY, 0); err == nil {
+			w.Close()
+		}
+	}
+	tee.lock.Unlock()
+	<-tee.done
+	tmpPath := tee.otgt.streamCache.getPath() + ".tmp"
+	if cmdErr != nil || tee.err != nil {
+		os.Remove(tmpPath)
+		return
+	}
+	tee.err = os.Rename(tmpPath, tee.otgt.streamCache.getPath())
+}
@@ -0,0 +1,85 @@
+package scipipe
+
+import (
+	"fmt"
+	re "regexp"
+	str "strings"
+)
+
+// ======= Strict mode ========
+
+// Allow the values of the placeholders, given as TYPE:NAME, such as p:opts
+// for {p:opts}, to contain shell metacharacters, in strict mode (see
+// SciProcess.Strict), such as for params holding several options inserted
+// with the raw modifier. Values are only allowed for the type given, so that
+// allowing p:opts does not allow an in-port named opts.
+func (p *SciProcess) AllowUnsafeValues(placeHolders ...string) {
+	for _, ph := range placeHolders {
+		parts := str.SplitN(ph, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			Check(fmt.Errorf("Can not allow unsafe values of %q in process %s, since it is not on the form TYPE:NAME, such as p:opts", ph, p.Name))
+		}
+		p.UnsafeValuesAllowed[ph] = true
+	}
+}
+
+// Set up all SciProcesses of the pipeline to run in strict mode, if Strict
+// is set
+func (pl *PipelineRunner) setUpStrictMode() {
+	if !pl.Strict {
+		return
+	}
+	for _, proc := range flattenProcesses(pl.processes) {
+		if sp, ok := proc.(*SciProcess); ok {
+			sp.Strict = true
+		}
+	}
+}
+
+// Validate that the process can be run in strict mode, returning all
+// problems found
+func (p *SciProcess) validateStrictMode() []string {
+	problems := []string{}
+	patterns := []string{p.CommandPattern}
+	if p.CommandArgs != nil {
+		patterns = p.CommandArgs
+	}
+	for _, pattern := range patterns {
+		if !p.isTemplateCommand(pattern) {
+			continue
+		}
+		for _, use := range findTemplateFieldAccess(pattern) {
+			problems = append(problems, fmt.Sprintf("Template command of process %s uses %s, whose value is not checked in strict mode. Use placeholder functions, such as {{param \"NAME\"}}, instead.", p.Name, use))
+		}
+	}
+	return problems
+}
+
+// Check that the value val of the placeholder of type typ for name contains
+// no shell metacharacters, unless allowed for the placeholder (see
+// AllowUnsafeValues)
+func (p *SciProcess) checkSafeValue(typ string, name string, val *placeHolderValue) error {
+	if p.UnsafeValuesAllowed[typ+":"+name] {
+		return nil
+	}
+	for _, v := range val.values {
+		if m := getShellMetaCharsRegex(p.getShell()).FindString(v); m != "" {
+			return fmt.Errorf("Value %q of placeholder {%s:%s} in process %s contains the shell metacharacter %q, which is not allowed in strict mode (see SciProcess.AllowUnsafeValues)", v, typ, name, p.Name, m)
+		}
+	}
+	return nil
+}
+
+// Get the regex matching characters with special meaning to the shell, or
+// to bash, cmd and PowerShell alike, including quotes and newlines, but not
+// spaces. Backslashes are only matched for POSIX shells, as they separate
+// the parts of paths on Windows.
+func getShellMetaCharsRegex(shell string) *re.Regexp {
+	chars := "|&;<>()$`\"'*?\\[\\]{}~!#%^\\n\\r\\x00"
+	if isPosixShell(shell) {
+		chars += "\\\\"
+	}
+	r, err := re.Compile("[" + chars + "]")
+	Check(err)
+	return r
+}
@@ -0,0 +1,106 @@
+package scipipe
+
+import (
+	"sync"
+)
+
+// ======= SubWorkflow ========
+
+// SubWorkflow is a component wrapping a whole (sub-)workflow of processes,
+// exposing selected in- and out-ports of its processes as its own, so that
+// common pipelines (such as QC or alignment) can be packaged, reused, and
+// nested inside larger workflows, like any other process.
+//
+// The exposed ports are the ports of the inner processes, so connecting to
+// them connects directly to the inner processes.
+type SubWorkflow struct {
+	Process
+	Name      string
+	In        map[string]*InPort
+	Out       map[string]*OutPort
+	processes []Process
+}
+
+// Instantiate an empty SubWorkflow component
+func NewSubWorkflow(name string) *SubWorkflow {
+	return &SubWorkflow{
+		Name: name,
+		In:   make(map[string]*InPort),
+		Out:  make(map[string]*OutPort),
+	}
+}
+
+// Add processes to the sub-workflow
+func (wf *SubWorkflow) AddProcesses(procs ...Process) {
+	wf.processes = append(wf.processes, procs...)
+}
+
+// Get the processes of the sub-workflow
+func (wf *SubWorkflow) GetProcesses() []Process {
+	return wf.processes
+}
+
+// Expose the in-port inPort of one of the processes of the sub-workflow, as
+// the in-port name of the sub-workflow
+func (wf *SubWorkflow) ExposeInPort(name string, inPort *InPort) {
+	wf.In[name] = inPort
+}
+
+// Expose the out-port outPort of one of the processes of the sub-workflow,
+// as the out-port name of the sub-workflow
+func (wf *SubWorkflow) ExposeOutPort(name string, outPort *OutPort) {
+	wf.Out[name] = outPort
+}
+
+func (wf *SubWorkflow) IsConnected() bool {
+	isConnected := true
+	for _, proc := range wf.processes {
+		if !proc.IsConnected() {
+			isConnected = false
+		}
+	}
+	return isConnected
+}
+
+// Execute all processes of the sub-workflow, and wait for them to finish
+func (wf *SubWorkflow) Run() {
+	wg := new(sync.WaitGroup)
+	for _, proc := range wf.processes {
+		wg.Add(1)
+		go func(proc Process) {
+			defer wg.Done()
+			proc.Run()
+		}(proc)
+	}
+	wg.Wait()
+}
+
+// Get the processes procs, with sub-workflows (recursively) replaced by
+// their processes
+func flattenProcesses(procs []Process) []Process {
+	flat := []Process{}
+	for _, proc := range procs {
+		if wf, ok := proc.(*SubWorkflow); ok {
+			flat = append(flat, flattenProcesses(wf.processes)...)
+		} else {
+			flat = append(flat, proc)
+		}
+	}
+	return flat
+}
+
+// Add the SciProcesses among procs, including those in (nested)
+// sub-workflows, to qualified, by their qualified names: their names
+// prefixed with prefix, and the names of the sub-workflows they are in, as
+// in "outer.inner.proc", so that processes with the same name in different
+// sub-workflows are kept apart
+func qualifySciProcesses(prefix string, procs []Process, qualified map[string]*SciProcess) {
+	for _, proc := range procs {
+		switch proc := proc.(type) {
+		case *SciProcess:
+			qualified[prefix+proc.Name] = proc
+		case *SubWorkflow:
+			qualifySciProcesses(prefix+proc.Name+".", proc.processes, qualified)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package scipipe
+
+import (
+	"github.com/stretchr/testify/assert"
+	t "testing"
+)
+
+// Create a sub-workflow upper-casing and then reversing the lines of files
+func newUpperRevWorkflow(name string) *SubWorkflow {
+	upr := NewFromShell(name+"_upr", "tr a-z A-Z < {i:in} > {o:out}")
+	upr.SetPathExtend("in", "out", ".upr")
+	rev := NewFromShell(name+"_rev", "rev < {i:in} > {o:out}")
+	rev.SetPathExtend("in", "out", ".rev")
+	rev.In["in"].Connect(upr.Out["out"])
+
+	wf := NewSubWorkflow(name)
+	wf.AddProcesses(upr, rev)
+	wf.ExposeInPort("in", upr.In["in"])
+	wf.ExposeOutPort("out", rev.Out["out"])
+	return wf
+}
+
+func TestSubWorkflow(t *t.T) {
+	initTestLogs()
+
+	ft := NewFileTarget("/tmp/subwf_in.txt")
+	ft.WriteTempFile([]byte("abc\n"))
+	ft.Atomize()
+	fq := NewFileQueue("/tmp/subwf_in.txt")
+
+	// Nest a sub-workflow inside another one
+	inner := newUpperRevWorkflow("inner")
+	outer := NewSubWorkflow("outer")
+	outer.AddProcesses(inner)
+	outer.ExposeInPort("in", inner.In["in"])
+	outer.ExposeOutPort("out", inner.Out["out"])
+
+	cpy := NewFromShell("cpy", "cp {i:in} {o:out}")
+	cpy.SetPathStatic("out", "/tmp/subwf_out.txt")
+	snk := NewSink()
+
+	outer.In["in"].Connect(fq.Out)
+	cpy.In["in"].Connect(outer.Out["out"])
+	snk.Connect(cpy.Out["out"])
+
+	pl := NewPipelineRunner()
+	pl.AddProcesses(fq, outer, cpy, snk)
+	assert.Nil(t, pl.Validate())
+	pl.Run()
+
+	assert.EqualValues(t, "CBA\n", string(NewFileTarget("/tmp/subwf_out.txt").Read()))
+
+	cleanFiles("/tmp/subwf_in.txt", "/tmp/subwf_in.txt.upr", "/tmp/subwf_in.txt.upr.rev", "/tmp/subwf_out.txt")
+}
+
+func TestSubWorkflowStats(t *t.T) {
+	initTestLogs()
+
+	// Processes with the same name in different sub-workflows have their
+	// own stats
+	newEchoWorkflow := func(name string) *SubWorkflow {
+		src := NewFromShell("src", "echo "+name+" > {o:out}")
+		src.SetPathStatic("out", "/tmp/subwf_stats_"+name+".txt")
+		snk := NewSink()
+		snk.Connect(src.Out["out"])
+		wf := NewSubWorkflow(name)
+		wf.AddProcesses(src, snk)
+		return wf
+	}
+	wf := NewWorkflow("wf")
+	wf.AddProcesses(newEchoWorkflow("a"), newEchoWorkflow("b"))
+	assert.Nil(t, wf.Run())
+
+	stats := wf.GetStats()
+	assert.EqualValues(t, 1, stats.Processes["a.src"].TasksExecuted)
+	assert.EqualValues(t, 1, stats.Processes["b.src"].TasksExecuted)
+	assert.EqualValues(t, 2, stats.GetTotal().TasksExecuted)
+
+	cleanFiles("/tmp/subwf_stats_a.txt", "/tmp/subwf_stats_b.txt")
+}
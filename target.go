@@ -0,0 +1,39 @@
+package scipipe
+
+// ======= Target ========
+
+// Target is the interface for the data represented by a FileTarget, which is
+// what tasks use to decide whether outputs already exist, which paths to use
+// in commands, and how to finalize outputs. FileTarget implements it for
+// normal files, while custom target types (such as for directories, or other
+// storage systems) can implement it, and be output by out-ports with
+// SciProcess.SetOutTargetFunc, or be wrapped in a FileTarget with
+// NewFileTargetFromTarget, to be sent between processes and used by tasks.
+type Target interface {
+	// Get the (final) path of the data
+	GetPath() string
+	// Get the temporary path, to which a task writes its output, before it
+	// is atomized
+	GetTempPath() string
+	// Get the path of the FIFO file used when the data is streamed
+	GetFifoPath() string
+	// Check whether the (final) data exists
+	Exists() bool
+	// Finalize the data written to the temporary path
+	Atomize()
+	// Check whether the data is streamed via a FIFO, rather than stored
+	IsStreaming() bool
+}
+
+// Create a new FileTarget wrapping a custom Target implementation, so that it
+// can be sent on ports, and be used as input or output of tasks
+func NewFileTargetFromTarget(tgt Target) *FileTarget {
+	ft := NewFileTarget("")
+	ft.custom = tgt
+	return ft
+}
+
+// Get the custom Target wrapped by the FileTarget, if any
+func (ft *FileTarget) GetCustomTarget() Target {
+	return ft.custom
+}
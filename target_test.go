@@ -0,0 +1,61 @@
+package scipipe
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	t "testing"
+)
+
+func TestCustomTarget(t *t.T) {
+	initTestLogs()
+	defer os.RemoveAll("/tmp/custom_target_dir")
+	defer cleanFiles("/tmp/custom_target_dir.audit.json", "/tmp/custom_target_ls.txt")
+
+	dt := &dirTarget{path: "/tmp/custom_target_dir"}
+	ft := NewFileTargetFromTarget(dt)
+	assert.EqualValues(t, "/tmp/custom_target_dir", ft.GetPath())
+	assert.EqualValues(t, "/tmp/custom_target_dir.partial", ft.GetTempPath())
+	assert.False(t, ft.Exists())
+
+	mkd := NewFromShell("mkd", "mkdir {o:dir}")
+	mkd.SetOutTargetFunc("dir", func(task *SciTask) Target {
+		return dt
+	})
+	lst := NewFromShell("lst", "ls -d {i:dir} > {o:out}")
+	lst.SetPathStatic("out", "/tmp/custom_target_ls.txt")
+	lst.In["dir"].Connect(mkd.Out["dir"])
+	snk := NewSink()
+	snk.Connect(lst.Out["out"])
+	wf := NewWorkflow("custom_target")
+	wf.AddProcesses(mkd, lst, snk)
+	assert.Nil(t, wf.Run())
+
+	// The command writes to the temp path of the custom target, which
+	// atomizes it
+	assert.True(t, dt.atomized)
+	assert.True(t, ft.Exists())
+	fi, err := os.Stat("/tmp/custom_target_dir")
+	assert.Nil(t, err)
+	assert.True(t, fi.IsDir())
+	// ... and is sent to downstream processes like any target
+	assert.EqualValues(t, "/tmp/custom_target_dir\n", string(NewFileTarget("/tmp/custom_target_ls.txt").Read()))
+}
+
+// A custom target for a directory, using a different temp path suffix
+type dirTarget struct {
+	path     string
+	atomized bool
+}
+
+func (dt *dirTarget) GetPath() string     { return dt.path }
+func (dt *dirTarget) GetTempPath() string { return dt.path + ".partial" }
+func (dt *dirTarget) GetFifoPath() string { return dt.path + ".fifo" }
+func (dt *dirTarget) IsStreaming() bool   { return false }
+func (dt *dirTarget) Exists() bool {
+	_, err := os.Stat(dt.path)
+	return err == nil
+}
+func (dt *dirTarget) Atomize() {
+	Check(os.Rename(dt.GetTempPath(), dt.path))
+	dt.atomized = true
+}
@@ -1,49 +1,138 @@
 package scipipe
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"sort"
 	str "strings"
+	"sync"
+	"time"
 )
 
 // ================== SciTask ==================
 
 type SciTask struct {
-	Name          string
-	Command       string
-	CustomExecute func(*SciTask)
-	InTargets     map[string]*FileTarget
-	OutTargets    map[string]*FileTarget
-	Params        map[string]string
-	Done          chan int
+	Name           string
+	Index          int
+	Command        string
+	Args           []string
+	CustomExecute  func(*SciTask) error
+	InTargets      map[string]*FileTarget
+	OutTargets     map[string]*FileTarget
+	Params         map[string]string
+	AuditInfo      *AuditInfo
+	Done           chan int
+	process        *SciProcess
+	usesScratchDir bool
+	err            error
+	loggers        *loggers
+	logFile        *os.File
+	span           Span
+	// The signature of the task, if registered as running (see
+	// claimSignature)
+	signature string
+	// The content signature of the task, once computed (see
+	// getContentSignature)
+	contentSignature     string
+	contentSignatureOnce sync.Once
+	// The error formatting the command of the task, if any, as for invalid
+	// param values (see ParamSpec), or unsafe values in strict mode, which
+	// fails the task instead of executing its command
+	formatErr error
 }
 
 func NewSciTask(name string, cmdPat string, inTargets map[string]*FileTarget, outPathFuncs map[string]func(*SciTask) string, outPortsDoStream map[string]bool, params map[string]string, prepend string) *SciTask {
+	p := NewSciProcess(name, cmdPat)
+	p.PathFormatters = outPathFuncs
+	p.OutPortsDoStream = outPortsDoStream
+	p.Prepend = prepend
+	return newSciTaskFromProcess(p, inTargets, params, 0)
+}
+
+// Create a new task for the process p, with the given inputs and params,
+// taking the settings of the process into account. The index is the number
+// of the task among the tasks of the process, starting from 0.
+func newSciTaskFromProcess(p *SciProcess, inTargets map[string]*FileTarget, params map[string]string, index int) *SciTask {
 	t := &SciTask{
-		Name:       name,
-		InTargets:  inTargets,
-		OutTargets: make(map[string]*FileTarget),
-		Params:     params,
-		Command:    "",
-		Done:       make(chan int),
+		Name:          p.Name,
+		Index:         index,
+		InTargets:     inTargets,
+		OutTargets:    make(map[string]*FileTarget),
+		Params:        params,
+		Command:       "",
+		CustomExecute: p.CustomExecute,
+		AuditInfo:     NewAuditInfo(),
+		Done:          make(chan int),
+		process:       p,
+	}
+	// Inherit tags from all inputs, in order of in-port name, so that path
+	// formatters can use them
+	inNames := []string{}
+	for iname := range inTargets {
+		inNames = append(inNames, iname)
+	}
+	sort.Strings(inNames)
+	for _, iname := range inNames {
+		for k, v := range inTargets[iname].GetTags() {
+			t.AuditInfo.Tags[k] = v
+		}
 	}
 	// Create out targets
-	Debug.Printf("Task:%s: Creating outTargets now ... [%s]", name, cmdPat)
+	t.logStructured(LevelDebug, "Creating out-targets", Fields{"command_pattern": p.CommandPattern})
 	outTargets := make(map[string]*FileTarget)
-	for oname, ofun := range outPathFuncs {
-		opath := ofun(t)
-		otgt := NewFileTarget(opath)
-		if outPortsDoStream[oname] {
+	for oname, ofun := range p.PathFormatters {
+		var otgt *FileTarget
+		if tfun := p.OutPortsTargetFunc[oname]; tfun != nil {
+			otgt = NewFileTargetFromTarget(tfun(t))
+		} else {
+			opath := ofun(t)
+			if p.OutPortsCompress[oname] && !str.HasSuffix(opath, ".gz") {
+				opath = opath + ".gz"
+			}
+			otgt = NewFileTarget(opath)
+		}
+		if p.doesStream(oname) {
 			otgt.doStream = true
+			otgt.getStreamSignature = t.getContentSignature
+			if p.CustomExecute != nil {
+				otgt.pipe = newTargetPipe()
+			}
 		}
-		Debug.Printf("Task:%s: Creating outTarget with path %s ...\n", name, otgt.GetPath())
+		otgt.glob = p.OutPortsGlob[oname]
+		otgt.compress = p.OutPortsCompress[oname]
+		otgt.tempDir = p.OutPortsTempDir[oname]
+		if otgt.doStream && otgt.pipe == nil && p.OutPortsStreamCache[oname] != "" {
+			otgt.streamCache = newStreamCache(otgt, oname, p.OutPortsStreamCache[oname], t.getContentSignature)
+		}
+		t.logStructured(LevelDebug, "Creating out-target", Fields{"path": otgt.GetPath()})
 		outTargets[oname] = otgt
 	}
 	t.OutTargets = outTargets
-	t.Command = formatCommand(cmdPat, inTargets, outTargets, params, prepend)
-	Debug.Printf("Task:%s: Created formatted command: %s [%s]", name, t.Command, cmdPat)
+	if args := p.getCommandArgs(); args != nil {
+		t.Args = t.formatArgs(args)
+		t.Command = shellQuoteJoin(t.Args, " ") + t.formatPlaceHolders(p.getStdioPattern(), false)
+	} else {
+		t.Command = t.formatCommand(p.getShellCommandPattern())
+	}
+	t.logStructured(LevelDebug, "Created formatted command", Fields{"command": t.Command, "command_pattern": p.CommandPattern})
+	// Set up audit info, chaining in the audit info of the inputs
+	t.AuditInfo.Command = t.Command
+	for pname, pval := range params {
+		t.AuditInfo.Params[pname] = pval
+	}
+	for iname, itgt := range inTargets {
+		t.AuditInfo.Upstream[iname] = itgt.GetAuditInfo()
+	}
+	// Share the (not yet completed) audit info with the out targets, so that
+	// downstream tasks receiving streamed targets early get the full record
+	for _, otgt := range outTargets {
+		otgt.SetAuditInfo(t.AuditInfo)
+	}
 	return t
 }
 
@@ -53,39 +142,198 @@ func (t *SciTask) GetInPath(inPort string) string {
 	return t.InTargets[inPort].GetPath()
 }
 
+// Get the value of the tag with key key, as inherited from the task's inputs
+func (t *SciTask) GetTag(key string) string {
+	return t.AuditInfo.Tags[key]
+}
+
+// Create the file of the output oname for writing, for use in CustomExecute
+// functions. The file is created at the temporary path of the output (or,
+// for streaming outputs, is the FIFO file), so that it is atomized, as the
+// outputs of shell commands, when the function returns successfully. The
+// file must be closed by the caller.
+func (t *SciTask) CreateOut(oname string) (*os.File, error) {
+	otgt := t.OutTargets[oname]
+	if otgt == nil {
+		return nil, fmt.Errorf("Task %s has no output %s", t.Name, oname)
+	}
+	if otgt.IsStreaming() {
+		if otgt.pipe != nil {
+			if err := otgt.usePipeFifo(); err != nil {
+				return nil, err
+			}
+		}
+		return os.OpenFile(Streams.GetWritePath(otgt), os.O_WRONLY, 0)
+	}
+	return otgt.CreateTemp()
+}
+
+// Write dat to the output oname, as with CreateOut
+func (t *SciTask) WriteOut(oname string, dat []byte) error {
+	f, err := t.CreateOut(oname)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(dat); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Write the string s to the output oname, as with CreateOut
+func (t *SciTask) WriteOutString(oname string, s string) error {
+	return t.WriteOut(oname, []byte(s))
+}
+
 func (t *SciTask) Execute() {
 	defer close(t.Done)
-	if !t.anyOutputExists() && !t.fifosInOutTargetsMissing() {
-		Debug.Printf("Task:%-12s Executing task. [%s]\n", t.Name, t.Command)
-		if t.CustomExecute != nil {
-			Audit.Printf("Task:%-12s Executing custom execution function.\n", t.Name)
-			t.CustomExecute(t)
-		} else {
-			t.executeCommand(t.Command)
+	defer t.recoverPanic()
+	if t.process.dryRunWriter != nil {
+		t.printDryRun()
+		t.Done <- 1
+		return
+	}
+	if t.process.partialRun != partialRunExecute {
+		t.skipInPartialRun()
+		t.Done <- 1
+		return
+	}
+	if t.canReplayStreamCache() {
+		t.replayStreamCache()
+		t.process.recordTaskSkipped(t, "since its streamed outputs are cached")
+		for _, tgt := range t.OutTargets {
+			if !tgt.IsStreaming() {
+				tgt.SetAuditInfo(nil)
+			}
+		}
+	} else if !t.anyOutputExists() && !t.fifosInOutTargetsMissing() {
+		t.openLogFile()
+		t.logStructured(LevelDebug, "Executing task", Fields{"command": t.Command})
+		t.err = t.stageInTargets()
+		if t.err == nil {
+			t.err = t.linkStagedInputs()
+		}
+		t.executeScheduled()
+		t.finishExecution()
+		// Closed before sending Done, after which the task is read by the
+		// process
+		t.closeLogFile()
+	} else {
+		t.closeOutPipes(errors.New("Task " + t.Name + " was skipped"))
+		t.process.recordTaskSkipped(t, "since its outputs exist")
+		// Outputs were not produced by this task, so make sure their audit
+		// info is read from existing audit files instead
+		for _, tgt := range t.OutTargets {
+			if !tgt.IsStreaming() {
+				tgt.SetAuditInfo(nil)
+			}
 		}
-		Debug.Printf("Task:%-12s Atomizing targets. [%s]\n", t.Name, t.Command)
-		t.atomizeTargets()
 	}
-	Debug.Printf("Task:%s: Starting to send Done in t.Execute() ...) [%s]\n", t.Name, t.Command)
+	t.releaseSignature()
+	t.markInStreamsRead()
+	t.logStructured(LevelDebug, "Sending Done", nil)
+	// Nothing about the task is logged after sending Done, since the task
+	// then belongs to its process, and the run may be finished
 	t.Done <- 1
-	Debug.Printf("Task:%s: Done sending Done, in t.Execute() [%s]\n", t.Name, t.Command)
 }
 
 // --------------- SciTask Helper methods ----------------
 
+// Fail the task, if executing it panicked, as functions such as Check do on
+// errors, so that only the task fails, rather than the whole program, with
+// all runs in it (such as those of a Server). Since the task has an error,
+// its outputs are not sent on.
+func (t *SciTask) recoverPanic() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	t.err = fmt.Errorf("Task %s panicked: %v", t.Name, r)
+	t.closeOutPipes(t.err)
+	t.removeTempOutputs()
+	t.process.recordTaskFailed(t, t.err)
+	t.closeLogFile()
+	t.releaseSignature()
+	t.markInStreamsRead()
+}
+
+// Execute the command of the task (or its custom execution function, or
+// mock), holding a slot of the scheduler, if any, while doing so. Tasks
+// whose inputs could not be staged in (see stageInTargets and
+// linkStagedInputs) are not executed.
+func (t *SciTask) executeScheduled() {
+	var acquireErr error
+	if t.process.scheduler != nil {
+		acquireErr = t.process.scheduler.acquire(t)
+		if acquireErr == nil {
+			defer t.process.scheduler.release(t)
+		}
+	}
+	t.process.recordTaskStarted(t)
+	t.AuditInfo.update(func(ai *AuditInfo) { ai.StartTime = time.Now() })
+	if t.err != nil {
+		t.logStructured(LevelDebug, "Not executing, since staging in failed", Fields{"error": t.err})
+	} else if t.formatErr != nil {
+		t.err = t.formatErr
+	} else if acquireErr != nil {
+		t.err = acquireErr
+	} else if t.process.getContext().Err() != nil {
+		t.err = ErrCancelled
+	} else if t.process.mock != nil {
+		t.err = t.process.mock.execute(t)
+	} else if t.CustomExecute != nil {
+		t.logStructured(LevelAudit, "Executing custom execution function", nil)
+		t.err = t.executeCustom()
+	} else {
+		t.copyInPipesToFifos()
+		finishStreamCache := t.teeStreamsToCache()
+		t.err = t.executeCommand(t.Command)
+		finishStreamCache(t.err)
+	}
+	t.closeOutPipes(t.err)
+	t.AuditInfo.update(func(ai *AuditInfo) { ai.FinishTime = time.Now() })
+}
+
+// Finish the execution of the task, after its command has run, by cleaning
+// up after it if it failed, or else atomizing its outputs and writing their
+// audit info
+func (t *SciTask) finishExecution() {
+	if t.err == nil {
+		t.AuditInfo.update(func(ai *AuditInfo) {
+			ai.ExecTimeMS = ai.FinishTime.Sub(ai.StartTime).Nanoseconds() / int64(time.Millisecond)
+		})
+		t.moveScratchOutputs()
+		t.logStructured(LevelDebug, "Finalizing targets", nil)
+		t.err = t.finalizeTargets()
+	}
+	if t.err != nil {
+		t.removeTempOutputs()
+		if t.process.IsolateWorkDir {
+			t.logStructured(LevelInfo, "Keeping working directory of failed task", Fields{"path": t.GetStagingDir()})
+		} else {
+			t.removeStagingDir()
+		}
+		t.process.recordTaskFailed(t, t.err)
+		return
+	}
+	t.removeStagingDir()
+	t.process.recordTaskExecuted(t)
+}
+
 // Check if any output file target, or temporary file targets, exist
 func (t *SciTask) anyOutputExists() (anyFileExists bool) {
 	anyFileExists = false
 	for _, tgt := range t.OutTargets {
 		opath := tgt.GetPath()
 		otmpPath := tgt.GetTempPath()
-		if !tgt.doStream {
-			if _, err := os.Stat(opath); err == nil {
-				Info.Printf("Task:%-12s Output file already exists, so skipping: %s\n", t.Name, opath)
+		if !tgt.IsStreaming() {
+			if tgt.Exists() {
+				t.logStructured(LevelInfo, "Output file already exists, so skipping", Fields{"path": opath})
 				anyFileExists = true
 			}
 			if _, err := os.Stat(otmpPath); err == nil {
-				Warning.Printf("Task:%-12s Temp   file already exists, so skipping: %s (Note: If resuming form a failed run, clean up .tmp files first).\n", t.Name, otmpPath)
+				t.logStructured(LevelWarning, "Temp file already exists, so skipping (Note: If resuming from a failed run, clean up .tmp files first)", Fields{"path": otmpPath})
 				anyFileExists = true
 			}
 		}
@@ -98,9 +346,9 @@ func (t *SciTask) anyFifosExist() (anyFifosExist bool) {
 	anyFifosExist = false
 	for _, tgt := range t.OutTargets {
 		ofifoPath := tgt.GetFifoPath()
-		if tgt.doStream {
-			if _, err := os.Stat(ofifoPath); err == nil {
-				Warning.Printf("Task:%-12s Output FIFO already exists, so skipping: %s (Note: If resuming form a failed run, clean up .fifo files first).\n", t.Name, ofifoPath)
+		if tgt.IsStreaming() && tgt.pipe == nil {
+			if tgt.FifoExists() {
+				t.logStructured(LevelWarning, "Output FIFO already exists, so skipping (Note: If resuming from a failed run, clean up .fifo files first)", Fields{"path": ofifoPath})
 				anyFifosExist = true
 			}
 		}
@@ -112,10 +360,10 @@ func (t *SciTask) anyFifosExist() (anyFifosExist bool) {
 func (t *SciTask) fifosInOutTargetsMissing() (fifosInOutTargetsMissing bool) {
 	fifosInOutTargetsMissing = false
 	for _, tgt := range t.OutTargets {
-		if tgt.doStream {
+		if tgt.IsStreaming() && tgt.pipe == nil {
 			ofifoPath := tgt.GetFifoPath()
-			if _, err := os.Stat(ofifoPath); err != nil {
-				Warning.Printf("Task:%-12s FIFO Output file missing, for streaming output: %s. Check your workflow for correctness! [%s]\n", t.Name, t.Command, ofifoPath)
+			if !tgt.FifoExists() {
+				t.logStructured(LevelWarning, "FIFO output file missing, for streaming output. Check your workflow for correctness!", Fields{"path": ofifoPath, "command": t.Command})
 				fifosInOutTargetsMissing = true
 			}
 		}
@@ -123,113 +371,589 @@ func (t *SciTask) fifosInOutTargetsMissing() (fifosInOutTargetsMissing bool) {
 	return
 }
 
-func (t *SciTask) executeCommand(cmd string) {
-	Audit.Printf("Task:%-12s Executing command: %s\n", t.Name, cmd)
-	out, err := exec.Command("bash", "-c", cmd).CombinedOutput()
+func (t *SciTask) executeCommand(cmd string) error {
+	t.logStructured(LevelAudit, "Executing command", Fields{"command": cmd})
+	var command *exec.Cmd
+	if t.Args != nil {
+		command = exec.Command(t.Args[0], t.Args[1:]...)
+	} else {
+		command = newShellCommand(t.process.getShell(), cmd)
+	}
+	command.Env = t.getCommandEnv()
+	if t.process.IsolateWorkDir {
+		command.Dir = t.GetStagingDir()
+	}
+	var out []byte
+	var err error
+	if t.process.workers != nil {
+		var stdinPath, stdoutPath string
+		if t.Args != nil {
+			stdinPath, stdoutPath = t.getStdioPaths()
+		}
+		out, err = t.process.workers.execute(t, command, stdinPath, stdoutPath)
+	} else {
+		if t.Args != nil {
+			// Without a shell, stdin and stdout are redirected here
+			closeStdio, stdioErr := t.openStdio(command)
+			defer closeStdio()
+			if stdioErr != nil {
+				return stdioErr
+			}
+		}
+		out, err = t.runCommand(command)
+		if t.process.Profile && command.ProcessState != nil {
+			resources := getResourceUsage(command.ProcessState)
+			t.AuditInfo.update(func(ai *AuditInfo) { ai.Resources = resources })
+		}
+	}
+	if t.logFile != nil {
+		fmt.Fprintf(t.logFile, "---- Output of command ----\n%s---- End of output ----\n", string(out))
+	}
+	if err != nil && t.process.getContext().Err() != nil {
+		return ErrCancelled
+	}
+	if err != nil {
+		return fmt.Errorf("Command [%s] failed (%s), with output:\n%s", cmd, err, string(out))
+	}
+	return nil
+}
+
+// Run the command, returning its combined stdout and stderr, as
+// exec.Cmd.CombinedOutput does. With LiveOutput set for the process, the
+// output is also written, line by line, prefixed with the task name, to
+// LiveOutputWriter, while the command runs. If the workflow run is
+// cancelled, the command, and any processes it has started, are killed.
+func (t *SciTask) runCommand(command *exec.Cmd) ([]byte, error) {
+	out := new(bytes.Buffer)
+	var w io.Writer = out
+	var live *prefixWriter
+	if t.process.LiveOutput {
+		live = newPrefixWriter(LiveOutputWriter, t.getLiveOutputPrefix(LiveOutputWriter))
+		// Since stdout and stderr are the same writer, it is not written
+		// to concurrently
+		w = io.MultiWriter(out, live)
+	}
+	if command.Stdout == nil {
+		command.Stdout = w
+	}
+	command.Stderr = w
+	setKillableProcessGroup(command)
+	if err := command.Start(); err != nil {
+		return nil, err
+	}
+	ctx := t.process.getContext()
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			killProcessGroup(command)
+		case <-done:
+		}
+	}()
+	err := command.Wait()
+	close(done)
+	if live != nil {
+		live.Flush()
+	}
+	return out.Bytes(), err
+}
+
+// Remove the temporary files of the (non-streaming) outputs of a failed
+// task, so that they do not block later runs
+func (t *SciTask) removeTempOutputs() {
+	for _, tgt := range t.OutTargets {
+		if !tgt.IsStreaming() {
+			os.RemoveAll(tgt.GetTempPath())
+		}
+	}
+}
+
+// Get the path of the log file of the task, which is the path of its first
+// (non-streaming) output, by out-port name, with the extension .log added,
+// or an empty string if there is no such output
+func (t *SciTask) GetLogPath() string {
+	onames := []string{}
+	for oname, otgt := range t.OutTargets {
+		if !otgt.IsStreaming() {
+			onames = append(onames, oname)
+		}
+	}
+	if len(onames) == 0 {
+		return ""
+	}
+	sort.Strings(onames)
+	return t.OutTargets[onames[0]].GetPath() + ".log"
+}
+
+// Open the log file of the task, if the process is set to write task log
+// files, and make the log messages of the task (of the info level and
+// above) be written to it too
+func (t *SciTask) openLogFile() {
+	if !t.process.TaskLogFiles || t.GetLogPath() == "" {
+		return
+	}
+	logFile, err := os.Create(t.GetLogPath())
 	if err != nil {
-		Error.Println("Command failed, with output:\n", string(out))
-		os.Exit(126)
+		t.logStructured(LevelWarning, "Could not create log file", Fields{"error": err})
+		return
+	}
+	t.logFile = logFile
+	t.loggers = t.process.logs().tee(LevelInfo, logFile)
+}
+
+// Close the log file of the task, if open
+func (t *SciTask) closeLogFile() {
+	if t.logFile == nil {
+		return
+	}
+	t.loggers = nil
+	t.logFile.Close()
+	t.logFile = nil
+}
+
+// Get the loggers of the task, which are those of its process, unless
+// messages are also written to a log file of the task
+func (t *SciTask) logs() *loggers {
+	if t.loggers != nil {
+		return t.loggers
+	}
+	return t.process.logs()
+}
+
+// Execute the custom execution function of the task, returning its error,
+// or an error if it panics (as the helpers of FileTarget do, on errors), or
+// does not write all of the (non-streaming) outputs of the task
+func (t *SciTask) executeCustom() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Custom execution function of task %s panicked: %v", t.Name, r)
+		}
+	}()
+	if err := t.CustomExecute(t); err != nil {
+		return err
+	}
+	for oname, otgt := range t.OutTargets {
+		if otgt.IsStreaming() || otgt.IsFileSet() {
+			continue
+		}
+		if _, err := os.Stat(otgt.GetTempPath()); err == nil {
+			continue
+		}
+		if t.isScratchOutPort(oname) {
+			if _, err := os.Stat(t.getScratchOutPath(oname)); err == nil {
+				continue
+			}
+		}
+		return fmt.Errorf("Custom execution function of task %s did not write output %s (to %s)", t.Name, oname, otgt.GetTempPath())
 	}
+	return nil
+}
+
+// Print the command that the task would execute, unless its outputs already
+// exist, without executing it, as done in dry-run mode
+func (t *SciTask) printDryRun() {
+	if t.anyOutputExists() {
+		return
+	}
+	if t.CustomExecute != nil {
+		fmt.Fprintf(t.process.dryRunWriter, "%s: <custom execution function>\n", t.Name)
+		return
+	}
+	fmt.Fprintf(t.process.dryRunWriter, "%s: %s\n", t.Name, t.Command)
+}
+
+// Get the value of the environment variable name for the task, which is
+// either set on the process, or inherited
+func (t *SciTask) getEnv(name string) (string, bool) {
+	if val, ok := t.process.Env[name]; ok {
+		return val, true
+	}
+	return os.LookupEnv(name)
+}
+
+// Get the environment for the task's command, which is the inherited
+// environment, with the environment variables of the process added
+func (t *SciTask) getCommandEnv() []string {
+	return append(os.Environ(), t.getExtraEnv()...)
+}
+
+// Get the environment variables set for the process, on the form
+// NAME=VALUE, sorted by name
+func (t *SciTask) getExtraEnv() []string {
+	names := []string{}
+	for name := range t.process.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	env := []string{}
+	for _, name := range names {
+		env = append(env, name+"="+t.process.Env[name])
+	}
+	return env
 }
 
 // Create FIFO files for all out-ports that are specified to support streaming
 func (t *SciTask) createFifos() {
-	Debug.Printf("Task:%s: Now creating fifos for task [%s]\n", t.Name, t.Command)
+	t.logStructured(LevelDebug, "Creating FIFOs", nil)
 	for _, otgt := range t.OutTargets {
-		if otgt.doStream {
+		// Targets that can be streamed through in-memory pipes get FIFOs
+		// only if needed (see targetPipe)
+		if otgt.IsStreaming() && otgt.pipe == nil && !otgt.FifoExists() {
 			otgt.CreateFifo()
 		}
+		if otgt.streamCache != nil && !otgt.streamCache.tee.FifoExists() {
+			otgt.streamCache.tee.CreateFifo()
+		}
 	}
 }
 
-// Rename temporary output files to their proper file names
-func (t *SciTask) atomizeTargets() {
-	for _, tgt := range t.OutTargets {
-		if !tgt.doStream {
-			Debug.Printf("Atomizing file: %s -> %s", tgt.GetTempPath(), tgt.GetPath())
-			tgt.Atomize()
-			Debug.Printf("Done atomizing file: %s -> %s", tgt.GetTempPath(), tgt.GetPath())
-		} else {
-			Debug.Printf("Target is streaming, so not atomizing: %s", tgt.GetPath())
+// Finalize the (non-streaming) outputs of the task, by atomizing them (which
+// includes compressing them, if set to), writing their audit files, setting
+// their permissions and uploading remote ones. Outputs are finalized
+// concurrently, since this can take a while for large outputs, and it
+// returns when all are done, with the error of one that failed, if any, so
+// that the task fails.
+func (t *SciTask) finalizeTargets() error {
+	wg := new(sync.WaitGroup)
+	errs := make(chan error, len(t.OutTargets))
+	for oname, otgt := range t.OutTargets {
+		if otgt.IsStreaming() {
+			t.logs().Debug.Printf("Target is streaming, so not atomizing: %s", otgt.GetPath())
+			continue
+		}
+		wg.Add(1)
+		go func(oname string, otgt *FileTarget) {
+			defer wg.Done()
+			// The methods of FileTarget panic on errors
+			defer func() {
+				if r := recover(); r != nil {
+					errs <- fmt.Errorf("Could not finalize output %s (%s): %v", oname, otgt.GetPath(), r)
+				}
+			}()
+			t.logs().Debug.Printf("Atomizing file: %s -> %s", otgt.GetTempPath(), otgt.GetPath())
+			otgt.Atomize()
+			otgt.WriteAuditInfo()
+			t.setOutputPermissions(otgt)
+			if err := otgt.StageOut(); err != nil {
+				errs <- fmt.Errorf("Could not finalize output %s (%s): %s", oname, otgt.GetPath(), err)
+				return
+			}
+			t.logs().Debug.Printf("Done finalizing file: %s", otgt.GetPath())
+		}(oname, otgt)
+	}
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+// Download remote input files to their local paths, and create the local
+// staging directories for remote outputs, and the temp dirs of outputs,
+// returning the first error, so that the task fails without being executed
+func (t *SciTask) stageInTargets() error {
+	for _, itgt := range t.InTargets {
+		if err := itgt.StageIn(); err != nil {
+			return err
+		}
+	}
+	for _, otgt := range t.OutTargets {
+		if otgt.IsRemote() || otgt.tempDir != "" {
+			if err := os.MkdirAll(filepath.Dir(otgt.GetPath()), 0777); err != nil {
+				return err
+			}
+		}
+		if otgt.tempDir != "" {
+			if err := os.MkdirAll(otgt.tempDir, 0777); err != nil {
+				return err
+			}
+		}
+		if otgt.IsFileSet() {
+			// The command writes its files into the (temporary) directory
+			if err := os.MkdirAll(otgt.GetTempPath(), 0777); err != nil {
+				return err
+			}
 		}
 	}
+	return nil
 }
 
 // Clean up any remaining FIFOs
 // TODO: this is actually not really used anymore ...
 func (t *SciTask) cleanUpFifos() {
 	for _, tgt := range t.OutTargets {
-		if tgt.doStream {
-			Debug.Printf("Task:%s: Cleaning up FIFO for output target: %s [%s]\n", t.Name, tgt.GetFifoPath(), t.Command)
+		if tgt.IsStreaming() {
+			t.logStructured(LevelDebug, "Cleaning up FIFO for out-target", Fields{"path": tgt.GetFifoPath()})
 			tgt.RemoveFifo()
 		} else {
-			Debug.Printf("Task:%s: output target is not FIFO, so not removing any FIFO: %s [%s]\n", t.Name, tgt.GetPath(), t.Command)
+			t.logStructured(LevelDebug, "Out-target is not a FIFO, so not removing any FIFO", Fields{"path": tgt.GetPath()})
+		}
+	}
+}
+
+// ================== Helper methods ==================
+
+// Format the command pattern cmd into an executable command, by replacing
+// the placeholders with the paths of the task's targets, and its params
+func (t *SciTask) formatCommand(cmd string) string {
+	// The prepend string can use placeholders too, such as for the resources
+	// of the task
+	prepend := t.formatPlaceHolders(t.getPrepend(), false)
+	cmd = t.formatPlaceHolders(cmd, false)
+	// Add prepend string to the command
+	if prepend != "" {
+		cmd = fmt.Sprintf("%s %s", prepend, cmd)
+	}
+	return t.addToolEnvActivation(cmd)
+}
+
+// Get the prepend string of the task, which is selected by the PrependFunc
+// of its process, if set
+func (t *SciTask) getPrepend() string {
+	if t.process.PrependFunc != nil {
+		return t.process.PrependFunc(t)
+	}
+	return t.process.Prepend
+}
+
+// Get the total size, in bytes, of the files of the inputs of the task, as
+// for selecting how to execute it (see PrependBySize). In-memory and
+// streaming inputs, and missing files, are not counted.
+func (t *SciTask) GetInSize() int64 {
+	var size int64
+	for _, itgt := range t.InTargets {
+		if itgt.IsInMemory() || itgt.IsStreaming() {
+			continue
+		}
+		for _, path := range itgt.GetPaths() {
+			if fi, err := os.Stat(path); err == nil && !fi.IsDir() {
+				size += fi.Size()
+			}
 		}
 	}
+	return size
 }
 
-// ================== Helper functions==================
+// Format the argv of the task, for processes executed without a shell, by
+// replacing the placeholders in each of the args of the process, without
+// shell quoting (since no shell is involved)
+func (t *SciTask) formatArgs(args []string) []string {
+	fargs := []string{}
+	if prepend := t.getPrepend(); prepend != "" {
+		for _, arg := range str.Fields(prepend) {
+			fargs = append(fargs, t.formatPlaceHolders(arg, true))
+		}
+	}
+	for _, arg := range args {
+		fargs = append(fargs, t.formatPlaceHolders(arg, true))
+	}
+	return fargs
+}
 
-func formatCommand(cmd string, inTargets map[string]*FileTarget, outTargets map[string]*FileTarget, params map[string]string, prepend string) string {
+// Replace the placeholders in cmd, shell quoting the values unless raw is
+// true. All placeholders are replaced in one pass over cmd, so that
+// placeholder text in the values, such as in paths, is never replaced in
+// turn, which could break out of the quoting of the values.
+func (t *SciTask) formatPlaceHolders(cmd string, raw bool) string {
+	// Go text/template command patterns replace any legacy placeholders
+	// too (see executeCommandTemplate)
+	if t.process.isTemplateCommand(cmd) {
+		return t.executeCommandTemplate(cmd, raw)
+	}
+	return getCommandPlaceHolderRegex().ReplaceAllStringFunc(cmd, func(placeHolderStr string) string {
+		return t.formatCommandPlaceHolder(placeHolderStr, cmd, raw)
+	})
+}
 
-	// Debug.Println("Formatting command with the following data:")
-	// Debug.Println("prepend:", prepend)
-	// Debug.Println("cmd:", cmd)
-	// Debug.Println("inTargets:", inTargets)
-	// Debug.Println("outTargets:", outTargets)
-	// Debug.Println("params:", params)
+// Get the string that the placeholder placeHolderStr, for a port, param, tag
+// or env var, or for the identity of the task (see getCommandPlaceHolderRegex),
+// is replaced with in the command cmd, shell quoted unless raw is true
+func (t *SciTask) formatCommandPlaceHolder(placeHolderStr string, cmd string, raw bool) string {
+	if m := getShellCommandPlaceHolderRegex().FindStringSubmatch(placeHolderStr); m != nil {
+		mods := splitPlaceHolderModifiers(m[3])
+		if raw {
+			mods = append(mods, "raw")
+		}
+		return t.formatPlaceHolder(m[1], m[2], mods, cmd)
+	}
+	quote := t.process.getShellQuoter()
+	if raw {
+		quote = func(s string) string { return s }
+	}
+	switch placeHolderStr {
+	case "{task.name}":
+		return quote(t.Name)
+	case "{task.id}":
+		return quote(t.GetID())
+	case "{task.index}":
+		return quote(fmt.Sprintf("%d", t.Index))
+	case "{task.cores}":
+		return quote(fmt.Sprintf("%d", t.process.getCores()))
+	case "{task.memory}":
+		return quote(fmt.Sprintf("%d", t.process.MemoryMB))
+	}
+	return quote(t.GetScratchDir())
+}
 
+// Replace the placeholders for inputs, params and tags in the path pattern
+// pattern (see SciProcess.SetPathPattern), without shell quoting
+func (t *SciTask) formatPathPattern(pattern string) string {
 	r := getShellCommandPlaceHolderRegex()
-	ms := r.FindAllStringSubmatch(cmd, -1)
-	for _, m := range ms {
-		placeHolderStr := m[0]
-		typ := m[1]
-		name := m[2]
-		var filePath string
-		if typ == "o" || typ == "os" {
-			// Out-ports
-			if outTargets[name] == nil {
-				msg := fmt.Sprint("Missing outpath for outport '", name, "' for command '", cmd, "'")
-				Check(errors.New(msg))
-			} else {
-				if typ == "o" {
-					filePath = outTargets[name].GetTempPath() // Means important to Atomize afterwards!
-				} else if typ == "os" {
-					filePath = outTargets[name].GetFifoPath()
-				}
+	return r.ReplaceAllStringFunc(pattern, func(placeHolderStr string) string {
+		m := r.FindStringSubmatch(placeHolderStr)
+		typ, name, mods := m[1], m[2], append(splitPlaceHolderModifiers(m[3]), "raw")
+		switch typ {
+		case "i":
+			if t.InTargets[name] == nil {
+				Check(errors.New("Missing intarget for inport '" + name + "' for path pattern '" + pattern + "'"))
 			}
-		} else if typ == "i" {
-			// In-ports
-			if inTargets[name] == nil {
-				msg := fmt.Sprint("Missing intarget for inport '", name, "' for command '", cmd, "'")
-				Check(errors.New(msg))
-			} else if inTargets[name].GetPath() == "" {
-				msg := fmt.Sprint("Missing inpath for inport '", name, "' for command '", cmd, "'")
-				Check(errors.New(msg))
-			} else {
-				if inTargets[name].doStream {
-					filePath = inTargets[name].GetFifoPath()
-				} else {
-					filePath = inTargets[name].GetPath()
-				}
+			return parsePlaceHolderModifiers(typ, mods).format(newPlaceHolderValue(t.InTargets[name].GetPath()))
+		case "p", "t":
+			return t.formatPlaceHolder(typ, name, mods, pattern)
+		}
+		Check(errors.New("Placeholder " + placeHolderStr + " can not be used in path pattern '" + pattern + "'"))
+		return ""
+	})
+}
+
+// Get the string that a placeholder of type typ for the port, param or tag
+// name, with the modifiers mods, is replaced with in the command cmd,
+// substituting defaults for missing params and tags, or leaving out optional
+// ones
+func (t *SciTask) formatPlaceHolder(typ string, name string, mods []string, cmd string) string {
+	opts := parsePlaceHolderModifiers(typ, mods)
+	var val *placeHolderValue
+	if !t.hasPlaceHolderValue(typ, name) && opts.hasDefault {
+		val = newPlaceHolderValue(opts.defaultVal)
+	} else if !t.hasPlaceHolderValue(typ, name) && opts.optional {
+		return ""
+	} else {
+		val = t.resolvePlaceHolder(typ, name, cmd)
+	}
+	if t.process.Strict {
+		if err := t.process.checkSafeValue(typ, name, val); err != nil && t.formatErr == nil {
+			t.formatErr = err
+		}
+	}
+	val.quote = t.process.getShellQuoter()
+	return opts.format(val)
+}
+
+// Check whether the task has a value for an input, param, tag or env
+// placeholder (other types of placeholders are always considered to have
+// values)
+func (t *SciTask) hasPlaceHolderValue(typ string, name string) bool {
+	if typ == "i" {
+		return t.InTargets[name] != nil
+	}
+	if typ == "p" {
+		_, ok := t.Params[name]
+		return ok
+	}
+	if typ == "t" {
+		return t.AuditInfo.Tags[name] != ""
+	}
+	if typ == "env" {
+		_, ok := t.getEnv(name)
+		return ok
+	}
+	return true
+}
+
+// Get the value that a placeholder of type typ ("i", "o", "os", "p", "t" or "env")
+// for the port, param or tag name is replaced with in the command cmd
+func (t *SciTask) resolvePlaceHolder(typ string, name string, cmd string) *placeHolderValue {
+	inTargets := t.InTargets
+	outTargets := t.OutTargets
+	params := t.Params
+
+	var val *placeHolderValue
+	if typ == "o" || typ == "os" {
+		// Out-ports
+		if outTargets[name] == nil {
+			msg := fmt.Sprint("Missing outpath for outport '", name, "' for command '", cmd, "'")
+			Check(errors.New(msg))
+		} else {
+			if typ == "os" && !outTargets[name].IsStreaming() {
+				// Materialized, since read by several processes
+				typ = "o"
 			}
-		} else if typ == "p" {
-			if params[name] == "" {
-				msg := fmt.Sprint("Missing param value param '", name, "' for command '", cmd, "'")
-				Check(errors.New(msg))
+			if typ == "o" && t.isScratchOutPort(name) {
+				val = newPlaceHolderValue(t.getScratchOutPath(name)) // Moved back before atomizing
+			} else if typ == "o" {
+				val = newPlaceHolderValue(outTargets[name].GetTempPath()) // Means important to Atomize afterwards!
+			} else if typ == "os" {
+				val = newPlaceHolderValue(Streams.GetWritePath(outTargets[name].getStreamWriteTarget()))
+			}
+		}
+	} else if typ == "i" {
+		// In-ports
+		if inTargets[name] == nil {
+			msg := fmt.Sprint("Missing intarget for inport '", name, "' for command '", cmd, "'")
+			Check(errors.New(msg))
+		} else if inTargets[name].IsInMemory() {
+			val = newPlaceHolderValue(inTargets[name].GetValueString())
+		} else if inTargets[name].IsList() {
+			val = newPlaceHolderValue(inTargets[name].GetPaths()...)
+		} else if inTargets[name].GetPath() == "" {
+			msg := fmt.Sprint("Missing inpath for inport '", name, "' for command '", cmd, "'")
+			Check(errors.New(msg))
+		} else {
+			if inTargets[name].IsStreaming() {
+				val = newPlaceHolderValue(Streams.GetReadPath(inTargets[name]))
+			} else if inTargets[name].IsFileSet() {
+				val = newPlaceHolderValue(inTargets[name].GetPaths()...)
+			} else if t.isStagedInPort(name) {
+				val = newPlaceHolderValue(t.getStagedInPath(name))
+			} else if t.process.InPortsDecompress[name] && inTargets[name].IsCompressed() {
+				// Decompress on the fly, with bash process substitution
+				val = newPlaceHolderValue(inTargets[name].GetPath())
+				val.decompress = true
 			} else {
-				filePath = params[name]
+				val = newPlaceHolderValue(inTargets[name].GetPath())
+			}
+		}
+	} else if typ == "t" {
+		if t.AuditInfo.Tags[name] == "" {
+			msg := fmt.Sprint("Missing tag value for tag '", name, "' for command '", cmd, "'")
+			Check(errors.New(msg))
+		} else {
+			val = newPlaceHolderValue(t.AuditInfo.Tags[name])
+		}
+	} else if typ == "env" {
+		if envVal, ok := t.getEnv(name); !ok {
+			// Fails the task, rather than the whole program, since the
+			// environment can change after the workflow is validated
+			if t.formatErr == nil {
+				t.formatErr = fmt.Errorf("Missing environment variable '%s' for command '%s'", name, cmd)
 			}
+			val = newPlaceHolderValue("")
+		} else {
+			val = newPlaceHolderValue(envVal)
 		}
-		if filePath == "" {
-			msg := fmt.Sprint("Replace failed for port ", name, " for command '", cmd, "'")
+	} else if typ == "p" {
+		if _, ok := params[name]; !ok {
+			msg := fmt.Sprint("Missing param value param '", name, "' for command '", cmd, "'")
 			Check(errors.New(msg))
+		} else {
+			val = newPlaceHolderValue(params[name])
 		}
-		cmd = str.Replace(cmd, placeHolderStr, filePath, -1)
 	}
-	// Add prepend string to the command
-	if prepend != "" {
-		cmd = fmt.Sprintf("%s %s", prepend, cmd)
+	if val == nil {
+		msg := fmt.Sprint("Replace failed for port ", name, " for command '", cmd, "'")
+		Check(errors.New(msg))
+	}
+	if typ == "o" || typ == "os" || (typ == "i" && !inTargets[name].IsInMemory()) {
+		for i, path := range val.values {
+			// Use the path separator of the platform (\ on Windows)
+			path = filepath.FromSlash(path)
+			if t.process.IsolateWorkDir {
+				// Relative paths do not work from the working directory of
+				// the task
+				absPath, err := filepath.Abs(path)
+				Check(err)
+				path = absPath
+			}
+			val.values[i] = path
+		}
 	}
-	return cmd
+	return val
 }
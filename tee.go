@@ -0,0 +1,26 @@
+package scipipe
+
+import (
+	"fmt"
+	str "strings"
+)
+
+// ======= Tee ========
+
+// Create a process duplicating each target received on its in-port "in" to
+// its n streaming out-ports "out1" ... "outN", with the tee command, so that
+// a streaming output can be read by several processes, as each of them
+// reads its own FIFO file. (Streaming out-ports connected directly to
+// several in-ports write their outputs to files instead.) The paths of the
+// outputs are the path of the input with .tee1 ... .teeN added.
+func NewTee(name string, n int) *SciProcess {
+	outs := []string{}
+	for i := 1; i <= n; i++ {
+		outs = append(outs, fmt.Sprintf("{os:out%d}", i))
+	}
+	p := NewFromShell(name, fmt.Sprintf("tee %s < {i:in} > /dev/null", str.Join(outs, " ")))
+	for i := 1; i <= n; i++ {
+		p.SetPathExtend("in", fmt.Sprintf("out%d", i), fmt.Sprintf(".tee%d", i))
+	}
+	return p
+}
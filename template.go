@@ -0,0 +1,228 @@
+package scipipe
+
+import (
+	"bytes"
+	"fmt"
+	re "regexp"
+	"strconv"
+	str "strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// The command patterns of processes created with NewFromTemplate (or with
+// TemplateCommand set) are executed as Go text/template templates, with the
+// task (*SciTask) as data, so that e.g. {{.Name}},
+// {{.Params.NAME}} and {{.InTargets.NAME.GetPath}} can be used. In addition,
+// the following functions correspond to the legacy placeholders, and are
+// also used to set up the ports of the process:
+//
+//	{{in "PORTNAME"}}        same as {i:PORTNAME}
+//	{{out "PORTNAME"}}       same as {o:PORTNAME}
+//	{{outstream "PORTNAME"}} same as {os:PORTNAME}
+//	{{param "PARAMNAME"}}    same as {p:PARAMNAME}
+//	{{tag "TAGNAME"}}        same as {t:TAGNAME}
+//	{{env "NAME"}}           same as {env:NAME}
+//
+// As with placeholders, values are shell quoted, and modifiers can be given
+// as additional arguments, as in {{in "reads" "basename" "%.fastq.gz"}} or
+// {{param "extra_args" "raw"}}.
+//
+// The identity of the task is available as {{.Name}}, {{.GetID}}, {{.Index}}
+// and {{.GetScratchDir}}. Legacy placeholders can still be used in the text
+// of template command patterns, outside of actions. Since fields of the task
+// are inserted as they are, without shell quoting, only the functions can be
+// used in strict mode (see SciProcess.Strict).
+var templatePlaceHolderTypes = map[string]string{
+	"in":        "i",
+	"out":       "o",
+	"outstream": "os",
+	"param":     "p",
+	"tag":       "t",
+	"env":       "env",
+}
+
+// Create a process whose command pattern is a Go text/template template
+// (see templatePlaceHolderTypes), rather than only a pattern with
+// placeholders, which would leave "{{" as it is, as in awk programs
+func NewFromTemplate(name string, cmd string) *SciProcess {
+	initDefaultLog()
+	p := NewSciProcess(name, cmd)
+	p.TemplateCommand = true
+	p.initPortsFromCmdPattern(cmd, nil)
+	return p
+}
+
+// Check whether the command pattern cmd is executed as a text/template
+// template, which requires the process to have opted in to it
+func (p *SciProcess) isTemplateCommand(cmd string) bool {
+	return p.TemplateCommand && str.Contains(cmd, "{{")
+}
+
+// Get the template functions for the placeholder types, using format to get
+// the string to insert for a placeholder type, name and modifiers
+func getTemplateFuncMap(format func(typ string, name string, mods []string) string) template.FuncMap {
+	funcs := template.FuncMap{}
+	for funcName, typ := range templatePlaceHolderTypes {
+		typ := typ
+		funcs[funcName] = func(name string, mods ...string) string {
+			return format(typ, name, mods)
+		}
+	}
+	return funcs
+}
+
+// Parse the template command pattern cmd
+func parseCommandTemplate(cmd string, funcs template.FuncMap) *template.Template {
+	tpl, err := template.New("command").Option("missingkey=error").Funcs(funcs).Parse(cmd)
+	Check(err)
+	return tpl
+}
+
+// Call visit with each node of the template command pattern cmd, in order
+func walkCommandTemplate(cmd string, visit func(node parse.Node)) {
+	tpl := parseCommandTemplate(cmd, getTemplateFuncMap(func(typ string, name string, mods []string) string { return "" }))
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		visit(node)
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, sub := range n.Nodes {
+				walk(sub)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.TemplateNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Cmds {
+				walk(c)
+			}
+		case *parse.CommandNode:
+			for _, arg := range n.Args {
+				walk(arg)
+			}
+		case *parse.ChainNode:
+			walk(n.Node)
+		}
+	}
+	for _, t := range tpl.Templates() {
+		if t.Tree != nil {
+			walk(t.Tree.Root)
+		}
+	}
+}
+
+// Find the placeholders (as function calls with a literal name) in the
+// template command pattern cmd, on the same form as the matches of the
+// legacy placeholder regex, that is: [placeholder, type, name, modifiers]
+func findTemplatePlaceHolders(cmd string) [][]string {
+	ms := [][]string{}
+	walkCommandTemplate(cmd, func(node parse.Node) {
+		n, ok := node.(*parse.CommandNode)
+		if !ok || len(n.Args) < 2 {
+			return
+		}
+		ident, isIdent := n.Args[0].(*parse.IdentifierNode)
+		name, isString := n.Args[1].(*parse.StringNode)
+		if !isIdent || !isString {
+			return
+		}
+		if typ, ok := templatePlaceHolderTypes[ident.Ident]; ok {
+			modsStr := ""
+			for _, arg := range n.Args[2:] {
+				if mod, isString := arg.(*parse.StringNode); isString {
+					modsStr += "|" + mod.Text
+				}
+			}
+			ms = append(ms, []string{n.String(), typ, name.Text, modsStr})
+		}
+	})
+	return ms
+}
+
+// Find the uses of the task, or its fields and methods, such as
+// {{.Params.NAME}}, in the template command pattern cmd, whose values are
+// inserted without shell quoting, and so are not allowed in strict mode
+func findTemplateFieldAccess(cmd string) []string {
+	uses := []string{}
+	walkCommandTemplate(cmd, func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.DotNode, *parse.FieldNode, *parse.ChainNode:
+			uses = append(uses, n.String())
+		case *parse.VariableNode:
+			// Only $ refers to the task, while other variables hold values
+			// of placeholder functions
+			if n.Ident[0] == "$" {
+				uses = append(uses, n.String())
+			}
+		}
+	})
+	return uses
+}
+
+// Execute the template command pattern cmd for the task, shell quoting the
+// values unless raw is true. Legacy placeholders in the text of the template
+// are executed as calls of the placeholder function (see
+// templateLegacyPlaceHolders), so that the output of the template is never
+// scanned for placeholders again.
+func (t *SciTask) executeCommandTemplate(cmd string, raw bool) string {
+	if t.process.Strict && t.formatErr == nil {
+		if uses := findTemplateFieldAccess(cmd); len(uses) > 0 {
+			t.formatErr = fmt.Errorf("Template command of process %s uses %s, whose value is not checked in strict mode", t.process.Name, uses[0])
+		}
+	}
+	funcs := getTemplateFuncMap(func(typ string, name string, mods []string) string {
+		if raw {
+			mods = append(mods, "raw")
+		}
+		return t.formatPlaceHolder(typ, name, mods, cmd)
+	})
+	funcs["placeholder"] = func(placeHolderStr string) string {
+		return t.formatCommandPlaceHolder(placeHolderStr, cmd, raw)
+	}
+	tpl := parseCommandTemplate(templateLegacyPlaceHolders(cmd), funcs)
+	buf := &bytes.Buffer{}
+	err := tpl.Execute(buf, t)
+	Check(err)
+	return buf.String()
+}
+
+// Rewrite the legacy and task placeholders in the text of the template
+// command pattern cmd, outside of its actions, into actions calling the
+// placeholder function, as {{placeholder "{i:in}"}}
+func templateLegacyPlaceHolders(cmd string) string {
+	r := getCommandPlaceHolderRegex()
+	rewrite := func(text string) string {
+		return r.ReplaceAllStringFunc(text, func(placeHolderStr string) string {
+			return "{{placeholder " + strconv.Quote(placeHolderStr) + "}}"
+		})
+	}
+	actionRegex, err := re.Compile(`(?s){{.*?}}`)
+	Check(err)
+	res := ""
+	last := 0
+	for _, loc := range actionRegex.FindAllStringIndex(cmd, -1) {
+		res += rewrite(cmd[last:loc[0]]) + cmd[loc[0]:loc[1]]
+		last = loc[1]
+	}
+	return res + rewrite(cmd[last:])
+}
@@ -0,0 +1,76 @@
+package scipipe
+
+import (
+	str "strings"
+)
+
+// ======= Tool environments ========
+
+// ToolEnv is the environment that the tools of a process are installed in,
+// which is activated before each of its commands, by loading the (Lmod or
+// environment) modules, then activating the conda environment, and then the
+// Python virtualenv, of those that are set
+type ToolEnv struct {
+	Modules []string `json:",omitempty"`
+	// The name or path of a conda environment
+	Conda string `json:",omitempty"`
+	// The directory of a Python virtualenv
+	Venv string `json:",omitempty"`
+}
+
+// Load the modules modules before each command of the process, in order
+func (p *SciProcess) UseModules(modules ...string) {
+	p.ToolEnv.Modules = append(p.ToolEnv.Modules, modules...)
+}
+
+// Activate the conda environment env (a name or a path) before each command
+// of the process
+func (p *SciProcess) UseConda(env string) {
+	p.ToolEnv.Conda = env
+}
+
+// Activate the Python virtualenv in the directory dir before each command of
+// the process
+func (p *SciProcess) UseVenv(dir string) {
+	p.ToolEnv.Venv = dir
+}
+
+// Check whether no tool environment is set
+func (e ToolEnv) isEmpty() bool {
+	return len(e.Modules) == 0 && e.Conda == "" && e.Venv == ""
+}
+
+// Get the (POSIX shell) commands activating the tool environment, joined
+// with &&, or an empty string if none is set
+func (e ToolEnv) getActivation() string {
+	cmds := []string{}
+	if len(e.Modules) > 0 {
+		cmds = append(cmds, "module load "+shellQuoteJoin(e.Modules, " "))
+	}
+	if e.Conda != "" {
+		cmds = append(cmds, `eval "$(conda shell.posix hook)"`, "conda activate "+shellQuote(e.Conda))
+	}
+	if e.Venv != "" {
+		cmds = append(cmds, ". "+shellQuote(e.Venv+"/bin/activate"))
+	}
+	return str.Join(cmds, " && ")
+}
+
+// Add the activation of the tool environment of the process of the task to
+// the command cmd, and record the environment in the audit info of the task.
+// The shell exits if the activation fails, on a line of its own, so that no
+// part of a compound command, as in a; b, is executed without the tools.
+func (t *SciTask) addToolEnvActivation(cmd string) string {
+	env := t.process.ToolEnv
+	if env.isEmpty() {
+		return cmd
+	}
+	t.AuditInfo.update(func(ai *AuditInfo) {
+		ai.ToolEnv = &ToolEnv{
+			Modules: append([]string{}, env.Modules...),
+			Conda:   env.Conda,
+			Venv:    env.Venv,
+		}
+	})
+	return env.getActivation() + " || exit 1\n" + cmd
+}
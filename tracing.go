@@ -0,0 +1,285 @@
+package scipipe
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ======= Tracing ========
+
+// Tracer creates spans, for tracing workflow runs, with a root span for the
+// workflow, and a child span for each executed task. Set it as the Tracer
+// of a Workflow. OTLPTracer exports spans to an OpenTelemetry collector, or
+// to Jaeger or Tempo directly, while other tracing libraries (such as the
+// OpenTelemetry SDK) can be plugged in by implementing Tracer and Span.
+type Tracer interface {
+	// Start a span named name, as a child of parent, or as a root span if
+	// parent is nil
+	StartSpan(name string, parent Span) Span
+}
+
+// Span is a timed operation in a trace, such as the execution of a task
+type Span interface {
+	SetAttribute(key string, value string)
+	SetError(err error)
+	End()
+}
+
+// Set up tracing of the run of the workflow with its Tracer, if set,
+// returning the root span (or nil)
+func (wf *Workflow) startTracing() Span {
+	if wf.Tracer == nil {
+		return nil
+	}
+	root := wf.Tracer.StartSpan("workflow "+wf.Name, nil)
+	root.SetAttribute("scipipe.workflow", wf.Name)
+	if !wf.tracingHooksAdded {
+		wf.tracingHooksAdded = true
+		wf.OnTaskStart(func(t *SciTask) {
+			wf.lock.Lock()
+			parent := wf.rootSpan
+			wf.lock.Unlock()
+			if parent == nil {
+				return
+			}
+			t.span = wf.Tracer.StartSpan("task "+t.Name, parent)
+			t.setSpanAttributes()
+		})
+		wf.OnTaskSuccess(func(t *SciTask) {
+			if t.span != nil {
+				t.span.End()
+			}
+		})
+		wf.OnTaskFailure(func(t *SciTask, err error) {
+			if t.span != nil {
+				t.span.SetError(err)
+				t.span.End()
+			}
+		})
+	}
+	wf.lock.Lock()
+	wf.rootSpan = root
+	wf.lock.Unlock()
+	return root
+}
+
+// End the root span of the workflow run, and flush the spans, if the
+// tracer supports it
+func (wf *Workflow) endTracing(root Span, err error) {
+	if root == nil {
+		return
+	}
+	if err != nil {
+		root.SetError(err)
+	}
+	root.End()
+	wf.lock.Lock()
+	wf.rootSpan = nil
+	wf.lock.Unlock()
+	if flusher, ok := wf.Tracer.(interface {
+		Flush() error
+	}); ok {
+		if err := flusher.Flush(); err != nil {
+			Warning.Printf("Workflow %s: Could not export trace: %s\n", wf.Name, err)
+		}
+	}
+}
+
+// Set the attributes of the span of the task: the process name, index,
+// command, executor, and paths of inputs and outputs
+func (t *SciTask) setSpanAttributes() {
+	t.span.SetAttribute("scipipe.process", t.process.Name)
+	t.span.SetAttribute("scipipe.task.index", strconv.Itoa(t.Index))
+	t.span.SetAttribute("scipipe.task.id", t.GetID())
+	executor := t.process.getShell()
+	if t.CustomExecute != nil {
+		executor = "custom"
+	} else if t.Args != nil {
+		executor = "exec"
+	}
+	t.span.SetAttribute("scipipe.executor", executor)
+	if t.CustomExecute == nil {
+		t.span.SetAttribute("scipipe.command", t.Command)
+	}
+	for iname, itgt := range t.InTargets {
+		t.span.SetAttribute("scipipe.in."+iname, itgt.GetPath())
+	}
+	for oname, otgt := range t.OutTargets {
+		t.span.SetAttribute("scipipe.out."+oname, otgt.GetPath())
+	}
+}
+
+// ------- OTLP tracer -------
+
+// OTLPTracer collects spans, and exports them, in the OTLP/HTTP JSON format,
+// to Endpoint (such as "http://localhost:4318/v1/traces"), when flushed,
+// which a Workflow does at the end of each run
+type OTLPTracer struct {
+	Endpoint    string
+	ServiceName string
+	spans       []*otlpSpan
+	lock        *sync.Mutex
+}
+
+// Create a new OTLPTracer, exporting spans to endpoint, for the service
+// serviceName
+func NewOTLPTracer(endpoint string, serviceName string) *OTLPTracer {
+	return &OTLPTracer{
+		Endpoint:    endpoint,
+		ServiceName: serviceName,
+		lock:        new(sync.Mutex),
+	}
+}
+
+func (tr *OTLPTracer) StartSpan(name string, parent Span) Span {
+	s := &otlpSpan{
+		tracer:     tr,
+		name:       name,
+		spanID:     randomHex(8),
+		startTime:  time.Now(),
+		attributes: make(map[string]string),
+		lock:       new(sync.Mutex),
+	}
+	if p, ok := parent.(*otlpSpan); ok && p != nil {
+		s.traceID = p.traceID
+		s.parentSpanID = p.spanID
+	} else {
+		s.traceID = randomHex(16)
+	}
+	return s
+}
+
+// Export all ended spans, not yet exported, to the endpoint
+func (tr *OTLPTracer) Flush() error {
+	tr.lock.Lock()
+	spans := tr.spans
+	tr.spans = nil
+	tr.lock.Unlock()
+	if len(spans) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(tr.formatExport(spans))
+	if err != nil {
+		return err
+	}
+	resp, err := http.Post(tr.Endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Exporting spans to %s failed: %s", tr.Endpoint, resp.Status)
+	}
+	return nil
+}
+
+// Format the spans as an OTLP export request
+func (tr *OTLPTracer) formatExport(spans []*otlpSpan) map[string]interface{} {
+	jsonSpans := []map[string]interface{}{}
+	for _, s := range spans {
+		jsonSpans = append(jsonSpans, s.format())
+	}
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": formatOTLPAttributes(map[string]string{"service.name": tr.ServiceName}),
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]interface{}{"name": "scipipe"},
+						"spans": jsonSpans,
+					},
+				},
+			},
+		},
+	}
+}
+
+type otlpSpan struct {
+	tracer       *OTLPTracer
+	name         string
+	traceID      string
+	spanID       string
+	parentSpanID string
+	startTime    time.Time
+	endTime      time.Time
+	attributes   map[string]string
+	err          error
+	lock         *sync.Mutex
+}
+
+func (s *otlpSpan) SetAttribute(key string, value string) {
+	s.lock.Lock()
+	s.attributes[key] = value
+	s.lock.Unlock()
+}
+
+func (s *otlpSpan) SetError(err error) {
+	s.lock.Lock()
+	s.err = err
+	s.lock.Unlock()
+}
+
+func (s *otlpSpan) End() {
+	s.lock.Lock()
+	s.endTime = time.Now()
+	s.lock.Unlock()
+	s.tracer.lock.Lock()
+	s.tracer.spans = append(s.tracer.spans, s)
+	s.tracer.lock.Unlock()
+}
+
+// Format the span as in the OTLP JSON format, where IDs are hex encoded
+func (s *otlpSpan) format() map[string]interface{} {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	status := map[string]interface{}{"code": 1}
+	if s.err != nil {
+		status = map[string]interface{}{"code": 2, "message": s.err.Error()}
+	}
+	return map[string]interface{}{
+		"traceId":           s.traceID,
+		"spanId":            s.spanID,
+		"parentSpanId":      s.parentSpanID,
+		"name":              s.name,
+		"kind":              1,
+		"startTimeUnixNano": strconv.FormatInt(s.startTime.UnixNano(), 10),
+		"endTimeUnixNano":   strconv.FormatInt(s.endTime.UnixNano(), 10),
+		"attributes":        formatOTLPAttributes(s.attributes),
+		"status":            status,
+	}
+}
+
+// Format attributes as OTLP key-values, sorted by key
+func formatOTLPAttributes(attrs map[string]string) []interface{} {
+	keys := []string{}
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	kvs := []interface{}{}
+	for _, k := range keys {
+		kvs = append(kvs, map[string]interface{}{
+			"key":   k,
+			"value": map[string]interface{}{"stringValue": attrs[k]},
+		})
+	}
+	return kvs
+}
+
+// Get n random bytes, hex encoded
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	Check(err)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,48 @@
+package scipipe
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	t "testing"
+)
+
+func TestOTLPTracing(t *t.T) {
+	initTestLogs()
+
+	var export map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.EqualValues(t, "/v1/traces", r.URL.Path)
+		json.NewDecoder(r.Body).Decode(&export)
+	}))
+	defer srv.Close()
+
+	wf := NewWorkflow("wf")
+	wf.Tracer = NewOTLPTracer(srv.URL+"/v1/traces", "test")
+	foo := NewFromShell("foo", "echo foo > {o:out}")
+	foo.SetPathStatic("out", "/tmp/tracing_foo.txt")
+	wf.AddProcesses(foo, NewSink())
+	wf.Connect("foo.out", "sink.in")
+	err := wf.Run()
+	assert.Nil(t, err)
+
+	assert.NotNil(t, export)
+	resourceSpans := export["resourceSpans"].([]interface{})[0].(map[string]interface{})
+	scopeSpans := resourceSpans["scopeSpans"].([]interface{})[0].(map[string]interface{})
+	spans := scopeSpans["spans"].([]interface{})
+	assert.Len(t, spans, 2)
+	task := spans[0].(map[string]interface{})
+	root := spans[1].(map[string]interface{})
+	assert.EqualValues(t, "task foo", task["name"])
+	assert.EqualValues(t, "workflow wf", root["name"])
+	assert.EqualValues(t, root["traceId"], task["traceId"])
+	assert.EqualValues(t, root["spanId"], task["parentSpanId"])
+	assert.Len(t, task["traceId"], 32)
+	assert.Contains(t, task["attributes"], map[string]interface{}{
+		"key":   "scipipe.out.out",
+		"value": map[string]interface{}{"stringValue": "/tmp/tracing_foo.txt"},
+	})
+
+	cleanFiles("/tmp/tracing_foo.txt")
+}
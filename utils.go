@@ -3,9 +3,12 @@ package scipipe
 import (
 	// "github.com/go-errors/errors"
 	//"os"
+	"errors"
 	"os"
 	"os/exec"
+	"path/filepath"
 	re "regexp"
+	str "strings"
 )
 
 func ExecCmd(cmd string) string {
@@ -25,9 +28,336 @@ func Check(err error) {
 }
 
 // Return the regular expression used to parse the place-holder syntax for in-, out- and
-// parameter ports, that can be used to instantiate a SciProcess.
+// parameter ports, as well as tags and environment variables, that can be used to instantiate a SciProcess.
+// The name can be followed by modifiers, separated by "|", such as in
+// {i:reads|basename|%.fastq.gz}, which are captured as the third group.
+// Substituted values are shell quoted, unless the raw modifier is used, as
+// in {p:extra_args|raw}.
 func getShellCommandPlaceHolderRegex() *re.Regexp {
-	r, err := re.Compile("{(o|os|i|is|p):([^{}:]+)}")
+	r, err := re.Compile("{(o|os|i|is|p|t|env):([^{}:|]+)((?:\\|[^{}|]+)*)}")
 	Check(err)
 	return r
 }
+
+// Return the regular expression used to parse the placeholders for the
+// identity of the task: {task.name}, {task.id} (see SciTask.GetID),
+// {task.index} (the number of the task among the tasks of its process, as
+// for array jobs), {task.scratch} (see SciTask.GetScratchDir), as well as
+// {task.cores} and {task.memory} (the resources declared for the process)
+func getTaskPlaceHolderRegex() *re.Regexp {
+	r, err := re.Compile(`{task\.(name|id|index|scratch|cores|memory)}`)
+	Check(err)
+	return r
+}
+
+// Return the regular expression matching both the placeholders of shell
+// commands (see getShellCommandPlaceHolderRegex), and those for the identity
+// of the task (see getTaskPlaceHolderRegex), for replacing them in one pass
+func getCommandPlaceHolderRegex() *re.Regexp {
+	r, err := re.Compile(getShellCommandPlaceHolderRegex().String() + "|" + getTaskPlaceHolderRegex().String())
+	Check(err)
+	return r
+}
+
+// Split the modifiers part of a placeholder (e.g. "|basename|%.gz") into the
+// individual modifiers
+func splitPlaceHolderModifiers(modsStr string) []string {
+	if modsStr == "" {
+		return []string{}
+	}
+	return str.Split(str.TrimPrefix(modsStr, "|"), "|")
+}
+
+// ModifyPath applies path modifiers, in order, to path. The same modifiers
+// can be used in placeholders in command patterns, like {i:reads|basename},
+// and are available to path formatter functions through this function.
+// Available modifiers are:
+//
+//	basename  the last element of the path
+//	dirname   all but the last element of the path
+//	noext     the path without its (last) file extension
+//	%SUFFIX   the path with SUFFIX removed from its end, if present
+func ModifyPath(path string, modifiers ...string) string {
+	for _, mod := range modifiers {
+		switch {
+		case mod == "basename":
+			path = filepath.Base(path)
+		case mod == "dirname":
+			path = filepath.Dir(path)
+		case mod == "noext":
+			path = str.TrimSuffix(path, filepath.Ext(path))
+		case str.HasPrefix(mod, "%"):
+			path = str.TrimSuffix(path, mod[1:])
+		default:
+			Check(checkPathModifier(mod))
+		}
+	}
+	return path
+}
+
+// Check that mod is one of the path modifiers of ModifyPath
+func checkPathModifier(mod string) error {
+	if mod == "basename" || mod == "dirname" || mod == "noext" || str.HasPrefix(mod, "%") {
+		return nil
+	}
+	return errors.New("Unknown path modifier: " + mod)
+}
+
+// placeHolderValue is the value that a placeholder is replaced with in a
+// command: one or more paths (or other strings), which are shell quoted
+// unless the raw modifier is used, and optionally decompressed on the fly
+// via bash process substitution
+type placeHolderValue struct {
+	values     []string
+	sep        string
+	raw        bool
+	decompress bool
+	// The function quoting the values for the shell, or nil for shellQuote
+	quote func(string) string
+}
+
+func newPlaceHolderValue(values ...string) *placeHolderValue {
+	return &placeHolderValue{values: values, sep: " "}
+}
+
+// Apply the modifiers mods to the value. The raw modifier turns off shell
+// quoting, the join:SEP modifier sets the separator used between multiple
+// values (optionally in double quotes, as in join:" -I "), while other
+// modifiers are path modifiers (see ModifyPath), applied to each value.
+func (v *placeHolderValue) modify(mods ...string) *placeHolderValue {
+	for _, mod := range mods {
+		if mod == "raw" {
+			v.raw = true
+			continue
+		}
+		if str.HasPrefix(mod, "join:") {
+			v.sep = mod[len("join:"):]
+			if len(v.sep) >= 2 && str.HasPrefix(v.sep, `"`) && str.HasSuffix(v.sep, `"`) {
+				v.sep = v.sep[1 : len(v.sep)-1]
+			}
+			continue
+		}
+		for i := range v.values {
+			v.values[i] = ModifyPath(v.values[i], mod)
+		}
+	}
+	return v
+}
+
+// Get the string to insert in a command for the value
+func (v *placeHolderValue) String() string {
+	s := str.Join(v.values, v.sep)
+	if !v.raw {
+		quote := v.quote
+		if quote == nil {
+			quote = shellQuote
+		}
+		quoted := []string{}
+		for _, val := range v.values {
+			quoted = append(quoted, quote(val))
+		}
+		s = str.Join(quoted, v.sep)
+	}
+	if v.decompress {
+		s = "<(gzip -dc " + s + ")"
+	}
+	return s
+}
+
+// placeHolderOptions are the modifiers of a placeholder, parsed into the
+// modifiers applied to its value, and those deciding what to do when no
+// value is available
+type placeHolderOptions struct {
+	mods       []string
+	defaultVal string
+	hasDefault bool
+	optional   bool
+	flag       string
+}
+
+// Parse the modifiers mods of a placeholder of type typ. Besides the value
+// modifiers (raw and the path modifiers of ModifyPath), these are:
+//
+//	optional      substitute nothing if the value is missing
+//	flag:FLAG     put FLAG before the value, and remove both if the value is
+//	              missing and optional, as in {p:threads|optional|flag:-t}
+//	default:VAL   for params, tags and environment variables, a default
+//	              value, used if the value is missing
+//	DEFAULT       the same, for any other modifier that is not a word (of
+//	              letters only), which could be a misspelled modifier, as
+//	              in {p:threads|4}
+func parsePlaceHolderModifiers(typ string, mods []string) *placeHolderOptions {
+	opts := &placeHolderOptions{mods: []string{}}
+	for _, mod := range mods {
+		switch {
+		case mod == "optional":
+			opts.optional = true
+		case str.HasPrefix(mod, "flag:"):
+			opts.flag = mod[len("flag:"):]
+		case isValueModifier(mod) || !hasDefaultValues(typ):
+			opts.mods = append(opts.mods, mod)
+		case str.HasPrefix(mod, "default:"):
+			opts.defaultVal = mod[len("default:"):]
+			opts.hasDefault = true
+		default:
+			opts.defaultVal = mod
+			opts.hasDefault = true
+		}
+	}
+	return opts
+}
+
+// Check whether placeholders of type typ can have default values
+func hasDefaultValues(typ string) bool {
+	return typ == "p" || typ == "t" || typ == "env"
+}
+
+// Check the modifiers mods of a placeholder of type typ, returning an error
+// for the first one that is not known
+func checkPlaceHolderModifiers(typ string, mods []string) error {
+	for _, mod := range mods {
+		if hasDefaultValues(typ) && getWordRegex().MatchString(mod) && mod != "optional" && !isValueModifier(mod) {
+			return errors.New("Unknown modifier: " + mod + " (a default value that is a word is given as default:" + mod + ")")
+		}
+	}
+	for _, mod := range parsePlaceHolderModifiers(typ, mods).mods {
+		if mod == "raw" || str.HasPrefix(mod, "join:") {
+			continue
+		}
+		if err := checkPathModifier(mod); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getWordRegex() *re.Regexp {
+	r, err := re.Compile(`^[A-Za-z]+$`)
+	Check(err)
+	return r
+}
+
+// Check whether mod is a modifier that is applied to the value of a
+// placeholder
+func isValueModifier(mod string) bool {
+	return mod == "raw" || mod == "basename" || mod == "dirname" || mod == "noext" ||
+		str.HasPrefix(mod, "%") || str.HasPrefix(mod, "join:")
+}
+
+// Get the string to insert in a command for the value val, modified
+// according to the options
+func (opts *placeHolderOptions) format(val *placeHolderValue) string {
+	s := val.modify(opts.mods...).String()
+	if opts.flag != "" {
+		s = opts.flag + " " + s
+	}
+	return s
+}
+
+// Quote a string for safe use as a single word in a bash command, by putting
+// it inside single quotes, unless it contains only safe characters
+func shellQuote(s string) string {
+	if s != "" && !getShellUnsafeCharsRegex().MatchString(s) {
+		return s
+	}
+	return "'" + str.Replace(s, "'", `'"'"'`, -1) + "'"
+}
+
+// Quote all strings in ss with shellQuote, and join them with sep
+func shellQuoteJoin(ss []string, sep string) string {
+	quoted := []string{}
+	for _, s := range ss {
+		quoted = append(quoted, shellQuote(s))
+	}
+	return str.Join(quoted, sep)
+}
+
+func getShellUnsafeCharsRegex() *re.Regexp {
+	r, err := re.Compile(`[^\w@%+=:,./-]`)
+	Check(err)
+	return r
+}
+
+// Check whether the command pattern cmd uses no shell features, outside of
+// quotes and placeholders, so that it can be executed without a shell (see
+// ShellAuto)
+func isSimpleCommand(cmd string) bool {
+	cmd = getShellCommandPlaceHolderRegex().ReplaceAllString(cmd, "x")
+	cmd = getTaskPlaceHolderRegex().ReplaceAllString(cmd, "x")
+	args, err := splitCommandArgs(cmd)
+	if err != nil || len(args) == 0 {
+		return false
+	}
+	// Variable assignments before the command, as in FOO=bar cmd
+	if str.Contains(args[0], "=") {
+		return false
+	}
+	inQuote := rune(0)
+	for _, r := range cmd {
+		switch {
+		case inQuote != 0 && r == inQuote:
+			inQuote = 0
+		case inQuote == '\'':
+		case inQuote == '"':
+			if str.ContainsRune("$`\\!", r) {
+				return false
+			}
+		case r == '\'' || r == '"':
+			inQuote = r
+		case str.ContainsRune("|&;<>()$`\\*?[]{}~!#\n", r):
+			return false
+		}
+	}
+	return true
+}
+
+// Split the command pattern cmd into args on whitespace, as a shell would,
+// where single or double quotes group words into one arg, and are removed.
+// Placeholders are kept intact, even if they contain whitespace or quotes,
+// as in {i:bams|join:" -I "}. Backslash escapes and shell expansions are
+// not handled (see isSimpleCommand).
+func splitCommandArgs(cmd string) ([]string, error) {
+	placeHolders := []string{}
+	protect := func(s string) string {
+		placeHolders = append(placeHolders, s)
+		return "\x00"
+	}
+	cmd = getShellCommandPlaceHolderRegex().ReplaceAllStringFunc(cmd, protect)
+	args := []string{}
+	arg := ""
+	inArg := false
+	inQuote := rune(0)
+	for _, r := range cmd {
+		switch {
+		case inQuote != 0 && r == inQuote:
+			inQuote = 0
+		case inQuote != 0:
+			arg += string(r)
+		case r == '\'' || r == '"':
+			inQuote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, arg)
+			}
+			arg = ""
+			inArg = false
+		default:
+			arg += string(r)
+			inArg = true
+		}
+	}
+	if inQuote != 0 {
+		return nil, errors.New("Unterminated quote in command: " + cmd)
+	}
+	if inArg {
+		args = append(args, arg)
+	}
+	for i := range args {
+		for str.Contains(args[i], "\x00") {
+			args[i] = str.Replace(args[i], "\x00", placeHolders[0], 1)
+			placeHolders = placeHolders[1:]
+		}
+	}
+	return args, nil
+}
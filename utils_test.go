@@ -23,3 +23,60 @@ func TestCheck_Panics(t *testing.T) {
 	err := errors.New("A test-error")
 	Check(err)
 }
+
+func TestShellQuote(t *testing.T) {
+	for in, exp := range map[string]string{
+		"foo.txt":        "foo.txt",
+		"/tmp/a b.txt":   "'/tmp/a b.txt'",
+		"it's":           `'it'"'"'s'`,
+		"":               "''",
+		"x; rm -rf /tmp": "'x; rm -rf /tmp'",
+	} {
+		if out := shellQuote(in); out != exp {
+			t.Errorf("shellQuote(%q) = %s, want: %s", in, out, exp)
+		}
+	}
+}
+
+func TestModifyPath(t *testing.T) {
+	for _, tc := range []struct {
+		path string
+		mods []string
+		exp  string
+	}{
+		{"/data/a.fastq.gz", []string{"basename"}, "a.fastq.gz"},
+		{"/data/a.fastq.gz", []string{"dirname"}, "/data"},
+		{"/data/a.fastq.gz", []string{"noext"}, "/data/a.fastq"},
+		{"/data/a.fastq.gz", []string{"basename", "%.fastq.gz"}, "a"},
+		{"/data/a.bam", []string{"%.fastq.gz"}, "/data/a.bam"},
+	} {
+		if out := ModifyPath(tc.path, tc.mods...); out != tc.exp {
+			t.Errorf("ModifyPath(%q, %v) = %s, want: %s", tc.path, tc.mods, out, tc.exp)
+		}
+	}
+}
+
+func TestPlaceHolderModifiers(t *testing.T) {
+	cmd := expandCommandParamsAndPaths("cat {i:in|basename|%.txt} > {o:out|dirname}/x", nil,
+		map[string]string{"in": "/tmp/foo.txt"}, map[string]string{"out": "/tmp/out/y.txt"})
+	if cmd != "cat foo > /tmp/out/x" {
+		t.Errorf("Wrong expanded command: %s", cmd)
+	}
+}
+
+func TestPlaceHolderQuoting(t *testing.T) {
+	cmd := expandCommandParamsAndPaths("cat {i:in} | grep {p:args|raw} > {o:out}", map[string]string{"args": "-v -e '#'"},
+		map[string]string{"in": "/tmp/my file.txt"}, map[string]string{"out": "/tmp/out; rm -rf x"})
+	if cmd != `cat '/tmp/my file.txt' | grep -v -e '#' > '/tmp/out; rm -rf x'` {
+		t.Errorf("Wrong expanded command: %s", cmd)
+	}
+}
+
+func TestExpandPlaceHolderInValue(t *testing.T) {
+	initTestLogs()
+	cmd := expandCommandParamsAndPaths("cat {i:in} # {p:msg}", map[string]string{"msg": "a; b"},
+		map[string]string{"in": "/tmp/x{p:msg}y.txt"}, nil)
+	if cmd != `cat '/tmp/x{p:msg}y.txt' # 'a; b'` {
+		t.Errorf("Wrong expanded command: %s", cmd)
+	}
+}
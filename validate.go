@@ -0,0 +1,251 @@
+package scipipe
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	str "strings"
+)
+
+// ValidationError contains all the problems found when validating a
+// pipeline
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%d problem(s) found in pipeline:\n  %s", len(e.Problems), str.Join(e.Problems, "\n  "))
+}
+
+// Validate the pipeline (including any sub-workflows), before running it,
+// checking that all ports are connected, that streaming out-ports are
+// connected to in-ports of SciProcesses, that all placeholders in the
+// command patterns of processes have matching ports or params, and that
+// out-ports of different processes (or the same process) do not produce the
+// same paths. All problems found
+// are returned at once, in a *ValidationError, or nil if none are found.
+//
+// Out paths are checked by calling the path formatters with a probe task,
+// whose inputs and params have symbolic values, so that path formatters
+// that only depend on constant strings, or formatters that produce the same
+// paths for the same inputs, are detected.
+func (pl *PipelineRunner) Validate() error {
+	problems := []string{}
+	outPathPorts := make(map[string][]string)
+	procs := flattenProcesses(pl.processes)
+	receivers := make(map[interface{}][]Process)
+	for _, proc := range procs {
+		inPorts, _ := getProcessPorts(proc)
+		for _, chs := range inPorts {
+			for _, ch := range chs {
+				receivers[ch] = append(receivers[ch], proc)
+			}
+		}
+	}
+	for _, proc := range procs {
+		sp, ok := proc.(*SciProcess)
+		if !ok {
+			if !proc.IsConnected() {
+				problems = append(problems, fmt.Sprintf("Process of type %T is not connected", proc))
+			}
+			continue
+		}
+		problems = append(problems, sp.validate()...)
+		if pl.Strict || sp.Strict {
+			problems = append(problems, sp.validateStrictMode()...)
+		}
+		problems = append(problems, sp.validateStreamingReceivers(receivers)...)
+		for oname, opath := range sp.probeOutPaths() {
+			outPathPorts[opath] = append(outPathPorts[opath], sp.Name+"."+oname)
+		}
+	}
+	opaths := []string{}
+	for opath := range outPathPorts {
+		opaths = append(opaths, opath)
+	}
+	sort.Strings(opaths)
+	for _, opath := range opaths {
+		if len(outPathPorts[opath]) > 1 {
+			sort.Strings(outPathPorts[opath])
+			problems = append(problems, fmt.Sprintf("Out-ports %s produce the same path: %s", str.Join(outPathPorts[opath], ", "), opath))
+		}
+	}
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// Validate the process, returning all problems found
+func (p *SciProcess) validate() []string {
+	problems := []string{}
+	for _, iname := range sortedKeys(p.In) {
+		if !p.In[iname].IsConnected() && !p.isInPortOptional(iname) {
+			problems = append(problems, fmt.Sprintf("In-port %s of process %s is not connected", iname, p.Name))
+		}
+	}
+	for _, oname := range sortedKeys(p.Out) {
+		if !p.Out[oname].IsConnected() {
+			problems = append(problems, fmt.Sprintf("Out-port %s of process %s is not connected", oname, p.Name))
+		}
+		if p.PathFormatters[oname] == nil {
+			problems = append(problems, fmt.Sprintf("Out-port %s of process %s has no path formatter", oname, p.Name))
+		}
+	}
+	for _, pname := range sortedKeys(p.ParamPorts) {
+		if p.ParamPorts[pname].IsConnected() || p.isParamOptional(pname) {
+			continue
+		}
+		if given, ok := p.paramFlags[pname]; ok {
+			problems = append(problems, fmt.Sprintf("Param %s of process %s is required, but not given with %s", pname, p.Name, given))
+		} else {
+			problems = append(problems, fmt.Sprintf("Param port %s of process %s is not connected", pname, p.Name))
+		}
+	}
+	if !p.ToolEnv.isEmpty() && (p.getCommandArgs() != nil || !isPosixShell(p.getShell())) {
+		problems = append(problems, fmt.Sprintf("Process %s has a tool environment, which can only be activated for commands executed with a POSIX shell", p.Name))
+	}
+	for _, iname := range sortedKeys(p.In) {
+		if p.InPortsDecompress[iname] && (p.getCommandArgs() != nil || getShellName(p.getShell()) != "bash") {
+			problems = append(problems, fmt.Sprintf("In-port %s of process %s decompresses its inputs, which can only be done for commands executed with bash", iname, p.Name))
+		}
+	}
+	for _, m := range p.findPlaceHolders() {
+		typ, name := m[1], m[2]
+		missing := false
+		switch typ {
+		case "i":
+			missing = p.In[name] == nil
+		case "o", "os":
+			missing = p.Out[name] == nil
+		case "p":
+			missing = p.ParamPorts[name] == nil && p.ParamSpecs[name] == nil
+		}
+		if missing {
+			problems = append(problems, fmt.Sprintf("Placeholder %s in command of process %s has no matching port", m[0], p.Name))
+		}
+		mods := splitPlaceHolderModifiers(m[3])
+		if err := checkPlaceHolderModifiers(typ, mods); err != nil {
+			problems = append(problems, fmt.Sprintf("Placeholder %s in command of process %s is not valid: %s", m[0], p.Name, err))
+		} else if typ == "env" && !p.hasEnv(name) {
+			if opts := parsePlaceHolderModifiers(typ, mods); !opts.hasDefault && !opts.optional {
+				problems = append(problems, fmt.Sprintf("Placeholder %s in command of process %s has no value, since the environment variable %s is neither set for the process (see SciProcess.SetEnv), nor inherited", m[0], p.Name, name))
+			}
+		}
+	}
+	return problems
+}
+
+// Check whether the environment variable name is set for the process, or
+// inherited
+func (p *SciProcess) hasEnv(name string) bool {
+	if _, ok := p.Env[name]; ok {
+		return true
+	}
+	_, ok := os.LookupEnv(name)
+	return ok
+}
+
+// Validate that the streaming out-ports of the process are connected to
+// in-ports of SciProcesses, which read the FIFO files, rather than to
+// components that only pass the targets on (such as a Sink), which would
+// leave the task writing to the FIFO file blocked forever. The processes
+// receiving on each channel are given by receivers.
+func (p *SciProcess) validateStreamingReceivers(receivers map[interface{}][]Process) []string {
+	problems := []string{}
+	for _, oname := range sortedKeys(p.Out) {
+		if !p.doesStream(oname) {
+			continue
+		}
+		for _, ch := range p.Out[oname].getRemoteChans() {
+			for _, proc := range receivers[ch] {
+				if _, ok := proc.(*SciProcess); !ok {
+					problems = append(problems, fmt.Sprintf("Streaming out-port %s of process %s is connected to a %T, which does not read its FIFO file", oname, p.Name, proc))
+				}
+			}
+		}
+	}
+	return problems
+}
+
+// Find all placeholders in the command pattern (or args) of the process, on
+// the form [placeholder, type, name, modifiers]
+func (p *SciProcess) findPlaceHolders() [][]string {
+	patterns := []string{p.CommandPattern}
+	if p.CommandArgs != nil {
+		patterns = p.CommandArgs
+	}
+	patterns = append(patterns, p.getStdioPattern())
+	ms := [][]string{}
+	for _, pattern := range patterns {
+		ms = append(ms, getShellCommandPlaceHolderRegex().FindAllStringSubmatch(pattern, -1)...)
+		if p.isTemplateCommand(pattern) {
+			ms = append(ms, findTemplatePlaceHolders(pattern)...)
+		}
+	}
+	return ms
+}
+
+// Get the out paths that the path formatters of the process produce for a
+// probe task, with symbolic paths for inputs and values for params. Path
+// formatters that fail for the probe task are skipped.
+func (p *SciProcess) probeOutPaths() map[string]string {
+	probe := &SciTask{
+		Name:       p.Name,
+		InTargets:  make(map[string]*FileTarget),
+		OutTargets: make(map[string]*FileTarget),
+		Params:     make(map[string]string),
+		AuditInfo:  NewAuditInfo(),
+		process:    p,
+	}
+	for iname := range p.In {
+		probe.InTargets[iname] = NewFileTarget(fmt.Sprintf("<%s.%s>", p.Name, iname))
+	}
+	for pname := range p.ParamPorts {
+		probe.Params[pname] = fmt.Sprintf("<%s.%s>", p.Name, pname)
+	}
+	for pname, ps := range p.ParamSpecs {
+		if ps.HasDefault {
+			probe.Params[pname] = ps.Default
+		}
+	}
+	opaths := make(map[string]string)
+	for oname, ofun := range p.PathFormatters {
+		if opath, ok := probePathFormatter(ofun, probe); ok && opath != "" {
+			opaths[oname] = opath
+		}
+	}
+	return opaths
+}
+
+// Call the path formatter ofun with the probe task, recovering from any
+// panic, which is reported by ok being false
+func probePathFormatter(ofun func(*SciTask) string, probe *SciTask) (opath string, ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			ok = false
+		}
+	}()
+	return ofun(probe), true
+}
+
+// Get the keys of a map of ports, sorted
+func sortedKeys(ports interface{}) []string {
+	keys := []string{}
+	switch m := ports.(type) {
+	case map[string]*InPort:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*OutPort:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*ParamPort:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
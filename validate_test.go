@@ -0,0 +1,114 @@
+package scipipe
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"os"
+	t "testing"
+)
+
+func TestValidate(t *t.T) {
+	initTestLogs()
+
+	foo := NewFromShell("foo", "echo foo > {o:out}")
+	foo.SetPathStatic("out", "/tmp/validate.txt")
+	bar := NewFromShell("bar", "cat {i:in} > {o:out}; echo {i:other}")
+	bar.SetPathStatic("out", "/tmp/validate.txt")
+	delete(bar.In, "other")
+	baz := NewFromShell("baz", "cat {i:in} > {o:out}")
+	snk := NewSink()
+
+	bar.In["in"].Connect(foo.Out["out"])
+	baz.In["in"].Connect(bar.Out["out"])
+
+	pl := NewPipelineRunner()
+	pl.AddProcesses(foo, bar, baz, snk)
+	err := pl.Validate()
+	assert.NotNil(t, err)
+	assert.EqualValues(t, []string{
+		"Placeholder {i:other} in command of process bar has no matching port",
+		"Out-port out of process baz is not connected",
+		"Out-port out of process baz has no path formatter",
+		"Process of type *scipipe.Sink is not connected",
+		"Out-ports bar.out, foo.out produce the same path: /tmp/validate.txt",
+	}, err.(*ValidationError).Problems)
+
+	bar.SetPathExtend("in", "out", ".bar")
+	baz.SetPathExtend("in", "out", ".baz")
+	delete(baz.Out, "out")
+	bar.CommandPattern = "cat {i:in} > {o:out}"
+	baz.CommandPattern = "cat {i:in}"
+	pl = NewPipelineRunner()
+	pl.AddProcesses(foo, bar, baz)
+	assert.Nil(t, pl.Validate())
+
+	// Streaming out-ports must be read by SciProcesses
+	ls := NewFromShell("ls", "ls -l / > {os:out}")
+	ls.SetPathStatic("out", "/tmp/validate_ls.txt")
+	snk = NewSink()
+	snk.Connect(ls.Out["out"])
+	pl = NewPipelineRunner()
+	pl.AddProcesses(ls, snk)
+	err = pl.Validate()
+	assert.NotNil(t, err)
+	assert.EqualValues(t, []string{
+		"Streaming out-port out of process ls is connected to a *scipipe.Sink, which does not read its FIFO file",
+	}, err.(*ValidationError).Problems)
+
+	// Unknown path modifiers are found before anything is run
+	cpy := NewFromShell("cpy", "cp {i:in|basenam} {o:out|dirname}")
+	cpy.SetPathStatic("out", "/tmp/validate_cpy.txt")
+	cpy.In["in"].Connect(foo.Out["out"])
+	snk = NewSink()
+	snk.Connect(cpy.Out["out"])
+	pl = NewPipelineRunner()
+	pl.AddProcesses(foo, cpy, snk)
+	err = pl.Validate()
+	assert.NotNil(t, err)
+	assert.EqualValues(t, []string{
+		"Placeholder {i:in|basenam} in command of process cpy is not valid: Unknown path modifier: basenam",
+	}, err.(*ValidationError).Problems)
+}
+
+func TestValidateConnections(t *t.T) {
+	initTestLogs()
+
+	foo := NewFromShell("foo", "echo foo > {o:out}")
+	foo.SetPathStatic("out", "/tmp/validate_foo.txt")
+	bar := NewFromShell("bar", "cat {i:in} > {o:out}")
+	bar.SetPathExtend("in", "out", ".bar")
+
+	// Misspelled ports are not connected, rather than panicking
+	bar.In["inn"].Connect(foo.Out["out"])
+	bar.In["in"].Connect(foo.Out["outt"])
+	assert.False(t, bar.In["in"].IsConnected())
+
+	wf := NewWorkflow("wf")
+	wf.AddProcesses(foo, bar, NewSink())
+	wf.Connect("foo.out", "bar.in")
+	wf.Connect("foo.out", "bar.in")
+	wf.Connect("bar.out", "sink.in")
+	err := wf.Validate()
+	assert.NotNil(t, err)
+	assert.EqualValues(t, []string{
+		"Can not connect foo.out to bar.in: In-port and out-port are already connected to each other",
+	}, err.(*ValidationError).Problems)
+	assert.Equal(t, 1, foo.Out["out"].getConnectionCount())
+}
+
+func TestDryRun(t *t.T) {
+	initTestLogs()
+
+	wf := newTestFooBarWorkflow("/tmp/dryrun_")
+	wf.GetSciProcess("f2b").SetCommand(testF2bCommand + " # {p:note|default:none}")
+
+	buf := &bytes.Buffer{}
+	wf.DryRun = true
+	wf.DryRunWriter = buf
+	wf.Run()
+
+	assert.EqualValues(t, "foo: echo foo > /tmp/dryrun_foo.txt.tmp\n"+
+		"f2b: sed 's/foo/bar/' /tmp/dryrun_foo.txt > /tmp/dryrun_foo.txt.bar.tmp # none\n", buf.String())
+	_, err := os.Stat("/tmp/dryrun_foo.txt")
+	assert.True(t, os.IsNotExist(err), "No files should be created in dry-run mode")
+}
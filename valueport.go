@@ -0,0 +1,140 @@
+package scipipe
+
+// ======= Ports for Go values ========
+
+// ValueInPort is an in-port receiving Go values of the type T, such as
+// records, statistics or configuration structs, rather than file targets.
+// It can only be connected to a ValueOutPort of the same type, which is
+// checked when the workflow is compiled, if the ports are connected
+// directly, or when the workflow is validated, if connected with
+// Workflow.Connect. Components can have value ports alongside ports for
+// files, in fields of any name, such as:
+//
+//	type StatsCollector struct {
+//		In    *scipipe.InPort
+//		Stats *scipipe.ValueOutPort[Stats]
+//	}
+//
+// where the Stats port is connected by name as "collector.stats".
+type ValueInPort[T any] struct {
+	Chan      chan T
+	connected bool
+}
+
+func NewValueInPort[T any]() *ValueInPort[T] {
+	return &ValueInPort[T]{}
+}
+
+// Connect the in-port to the out-port outp
+func (inp *ValueInPort[T]) Connect(outp *ValueOutPort[T]) {
+	if inp.Chan != nil && outp.Chan != nil {
+		Error.Println("Both value in-port and out-port already have initialized channels, so can't choose which to use!")
+	} else if inp.Chan != nil {
+		outp.Chan = inp.Chan
+	} else if outp.Chan != nil {
+		inp.Chan = outp.Chan
+	} else {
+		ch := make(chan T, BUFSIZE)
+		inp.Chan = ch
+		outp.Chan = ch
+	}
+	inp.SetConnectedStatus(true)
+	outp.SetConnectedStatus(true)
+}
+
+func (inp *ValueInPort[T]) SetConnectedStatus(connected bool) {
+	inp.connected = connected
+}
+
+func (inp *ValueInPort[T]) IsConnected() bool {
+	return inp.connected
+}
+
+func (inp *ValueInPort[T]) getChan() interface{} {
+	if inp == nil || inp.Chan == nil {
+		return nil
+	}
+	return inp.Chan
+}
+
+// Connect the in-port to the port from, if it is a ValueOutPort of the same
+// type, returning whether it was
+func (inp *ValueInPort[T]) connectFrom(from interface{}) bool {
+	outp, ok := from.(*ValueOutPort[T])
+	if ok {
+		inp.Connect(outp)
+	}
+	return ok
+}
+
+// ValueOutPort is an out-port sending Go values of the type T (see
+// ValueInPort)
+type ValueOutPort[T any] struct {
+	Chan      chan T
+	connected bool
+}
+
+func NewValueOutPort[T any]() *ValueOutPort[T] {
+	return &ValueOutPort[T]{}
+}
+
+// Connect the out-port to the in-port inp
+func (outp *ValueOutPort[T]) Connect(inp *ValueInPort[T]) {
+	inp.Connect(outp)
+}
+
+// Send the value v on the port. Values sent on a port that is not
+// connected are discarded, since nothing would ever receive them.
+func (outp *ValueOutPort[T]) Send(v T) {
+	if outp.Chan == nil {
+		Debug.Println("Discarding value sent on a value out-port that is not connected")
+		return
+	}
+	outp.Chan <- v
+}
+
+func (outp *ValueOutPort[T]) SetConnectedStatus(connected bool) {
+	outp.connected = connected
+}
+
+func (outp *ValueOutPort[T]) IsConnected() bool {
+	return outp.connected
+}
+
+// Close the port, unless it is not connected
+func (outp *ValueOutPort[T]) Close() {
+	if outp.Chan != nil {
+		close(outp.Chan)
+	}
+}
+
+func (outp *ValueOutPort[T]) getChan() interface{} {
+	if outp == nil || outp.Chan == nil {
+		return nil
+	}
+	return outp.Chan
+}
+
+// Connect the out-port to the port to, if it is a ValueInPort of the same
+// type, returning whether it was
+func (outp *ValueOutPort[T]) connectTo(to interface{}) bool {
+	inp, ok := to.(*ValueInPort[T])
+	if ok {
+		inp.Connect(outp)
+	}
+	return ok
+}
+
+// valueInPort is implemented by all ValueInPorts, whatever the type of
+// their values
+type valueInPort interface {
+	getChan() interface{}
+	connectFrom(from interface{}) bool
+}
+
+// valueOutPort is implemented by all ValueOutPorts, whatever the type of
+// their values
+type valueOutPort interface {
+	getChan() interface{}
+	connectTo(to interface{}) bool
+}
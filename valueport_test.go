@@ -0,0 +1,73 @@
+package scipipe
+
+import (
+	"github.com/stretchr/testify/assert"
+	t "testing"
+)
+
+type testRecord struct {
+	Name  string
+	Count int
+}
+
+type testRecordSource struct {
+	Records []testRecord
+	Out     *ValueOutPort[testRecord]
+}
+
+func (p *testRecordSource) IsConnected() bool { return p.Out.IsConnected() }
+
+func (p *testRecordSource) Run() {
+	defer p.Out.Close()
+	for _, r := range p.Records {
+		p.Out.Send(r)
+	}
+}
+
+type testRecordSummer struct {
+	Records *ValueInPort[testRecord]
+	Counts  *ValueInPort[int]
+	Sum     int
+}
+
+func (p *testRecordSummer) IsConnected() bool { return p.Records.IsConnected() }
+
+func (p *testRecordSummer) Run() {
+	for r := range p.Records.Chan {
+		p.Sum += r.Count
+	}
+}
+
+func TestValuePorts(t *t.T) {
+	initTestLogs()
+
+	src := &testRecordSource{Records: []testRecord{{"a", 1}, {"b", 2}}, Out: NewValueOutPort[testRecord]()}
+	summer := &testRecordSummer{Records: NewValueInPort[testRecord](), Counts: NewValueInPort[int]()}
+	wf := NewWorkflow("wf")
+	wf.Add("src", src)
+	wf.Add("summer", summer)
+	wf.Connect("src.out", "summer.records")
+	assert.EqualValues(t, []Connection{{From: "src.out", To: "summer.records"}}, wf.GetConnections())
+	assert.Nil(t, wf.Run())
+	assert.EqualValues(t, 3, summer.Sum)
+
+	// Ports of different types can not be connected
+	src = &testRecordSource{Out: NewValueOutPort[testRecord]()}
+	summer = &testRecordSummer{Records: NewValueInPort[testRecord](), Counts: NewValueInPort[int]()}
+	wf = NewWorkflow("wf")
+	wf.Add("src", src)
+	wf.Add("summer", summer)
+	wf.Connect("src.out", "summer.counts")
+	assert.Error(t, wf.Validate())
+}
+
+func TestValueOutPortNotConnected(t *t.T) {
+	initTestLogs()
+
+	outp := NewValueOutPort[int]()
+	assert.NotPanics(t, func() {
+		// Should neither block nor panic
+		outp.Send(1)
+		outp.Close()
+	})
+}
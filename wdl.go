@@ -0,0 +1,288 @@
+package scipipe
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	re "regexp"
+	"sort"
+	"strconv"
+	str "strings"
+)
+
+// ======= WDL export ========
+
+// Write the workflow as a Workflow Description Language (WDL 1.0) document
+// to w, for running with WDL runners such as Cromwell (and so on Terra),
+// with a task for each SciProcess, and a workflow calling them, connected as
+// in the workflow.
+//
+// In-ports not connected to another SciProcess (such as those fed by a
+// FileSource) and params become inputs of the WDL workflow, named
+// PROCESSNAME_PORTNAME, and out-ports not connected to another SciProcess
+// become its outputs. Invalid characters in names are replaced with
+// underscores, and WDL keywords (such as "in") get an underscore appended.
+// As for CWL (see WriteCWL), output file names are found by calling the
+// path formatters, path modifiers of placeholders are not translated, and
+// processes with a CustomExecute function, or Go template command patterns,
+// can not be exported.
+func (wf *Workflow) WriteWDL(w io.Writer) error {
+	tasks := make(map[string]*wdlTask)
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "version 1.0\n")
+	for _, name := range wf.procNames {
+		p, ok := wf.procsByName[name].(*SciProcess)
+		if !ok {
+			continue
+		}
+		task, err := newWDLTask(p)
+		if err != nil {
+			return err
+		}
+		tasks[name] = task
+		fmt.Fprintf(buf, "\n%s", task.text)
+	}
+
+	// Find the SciProcess out-port that each in-port receives from
+	sources := make(map[string]string)
+	fedOutPorts := make(map[string]bool)
+	for _, c := range wf.GetConnections() {
+		from, to := str.SplitN(c.From, ".", 2), str.SplitN(c.To, ".", 2)
+		if tasks[from[0]] == nil || tasks[to[0]] == nil {
+			continue
+		}
+		sources[c.To] = wdlIdent(from[0]) + "." + wdlIdent(from[1])
+		fedOutPorts[c.From] = true
+	}
+
+	inputs := []string{}
+	calls := []string{}
+	outputs := []string{}
+	for _, name := range wf.procNames {
+		task := tasks[name]
+		if task == nil {
+			continue
+		}
+		callInputs := []string{}
+		for _, iname := range task.inputNames {
+			src, ok := sources[name+"."+iname]
+			if !ok {
+				src = wdlIdent(name + "_" + iname)
+				inputs = append(inputs, task.inputDecls[iname](src))
+			}
+			callInputs = append(callInputs, wdlIdent(iname)+" = "+src)
+		}
+		call := "call " + wdlIdent(name)
+		if len(callInputs) > 0 {
+			call += " { input: " + str.Join(callInputs, ", ") + " }"
+		}
+		calls = append(calls, call)
+		for _, oname := range task.outputNames {
+			if !fedOutPorts[name+"."+oname] {
+				outputs = append(outputs, "File "+wdlIdent(name+"_"+oname)+" = "+wdlIdent(name)+"."+wdlIdent(oname))
+			}
+		}
+	}
+	fmt.Fprintf(buf, "\nworkflow %s {\n", wdlIdent(wf.Name))
+	writeWDLSection(buf, "input", inputs)
+	for _, call := range calls {
+		fmt.Fprintf(buf, "  %s\n", call)
+	}
+	writeWDLSection(buf, "output", outputs)
+	fmt.Fprintf(buf, "}\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// wdlTask is the WDL task for a process, with functions for declaring its
+// inputs with a given name, and the names of its inputs and outputs, sorted
+type wdlTask struct {
+	text        string
+	inputDecls  map[string]func(name string) string
+	inputNames  []string
+	outputNames []string
+}
+
+// Create the WDL task for the process p
+func newWDLTask(p *SciProcess) (*wdlTask, error) {
+	if err := checkExportable(p, "WDL"); err != nil {
+		return nil, err
+	}
+	task := &wdlTask{inputDecls: make(map[string]func(string) string)}
+	tags := make(map[string]bool)
+	ref := func(typ string, name string) string {
+		switch typ {
+		case "i", "is", "p":
+			return "~{" + wdlIdent(name) + "}"
+		case "t":
+			tags[name] = true
+			return "~{" + wdlIdent("tag_"+name) + "}"
+		}
+		return "${" + name + "}"
+	}
+	basenameRef := func(typ string, name string) string {
+		if typ == "i" {
+			return "~{basename(" + wdlIdent(name) + ")}"
+		}
+		return ref(typ, name)
+	}
+
+	// Find the output file names, relative to the working directory
+	outFiles := make(map[string]string)
+	for oname := range p.Out {
+		task.outputNames = append(task.outputNames, oname)
+		outFiles[oname] = replaceExportMarkers(getExportOutPath(p, oname), basenameRef)
+	}
+	sort.Strings(task.outputNames)
+
+	// Translate the placeholders in the command
+	cmd := getShellCommandPlaceHolderRegex().ReplaceAllStringFunc(p.CommandPattern, func(ph string) string {
+		m := getShellCommandPlaceHolderRegex().FindStringSubmatch(ph)
+		if m[1] == "o" || m[1] == "os" {
+			return outFiles[m[2]]
+		}
+		return ref(m[1], m[2])
+	})
+	cmd = getTaskPlaceHolderRegex().ReplaceAllStringFunc(cmd, func(ph string) string {
+		switch ph {
+		case "{task.cores}":
+			return strconv.Itoa(p.getCores())
+		case "{task.memory}":
+			return strconv.Itoa(p.MemoryMB)
+		case "{task.scratch}":
+			return "${TMPDIR:-/tmp}"
+		}
+		return p.Name
+	})
+	if p.Prepend != "" {
+		cmd = p.Prepend + " " + cmd
+	}
+	envNames := []string{}
+	for k := range p.Env {
+		envNames = append(envNames, k)
+	}
+	sort.Strings(envNames)
+	for i := len(envNames) - 1; i >= 0; i-- {
+		cmd = "export " + envNames[i] + "=" + shellQuote(p.Env[envNames[i]]) + "\n" + cmd
+	}
+
+	for iname := range p.In {
+		decl := func(name string) string { return "File " + name }
+		if path, ok := p.InPortsDefault[iname]; ok {
+			decl = func(name string) string { return "File " + name + " = " + wdlQuote(path) }
+		} else if p.InPortsOptional[iname] {
+			decl = func(name string) string { return "File? " + name }
+		}
+		task.inputDecls[iname] = decl
+	}
+	for pname := range p.ParamPorts {
+		task.inputDecls[pname] = newWDLParamDecl(p.ParamSpecs[pname])
+	}
+	for tname := range tags {
+		task.inputDecls["tag_"+tname] = func(name string) string { return "String " + name }
+	}
+	for name := range task.inputDecls {
+		task.inputNames = append(task.inputNames, name)
+	}
+	sort.Strings(task.inputNames)
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "task %s {\n", wdlIdent(p.Name))
+	inputs := []string{}
+	for _, iname := range task.inputNames {
+		inputs = append(inputs, task.inputDecls[iname](wdlIdent(iname)))
+	}
+	writeWDLSection(buf, "input", inputs)
+	fmt.Fprintf(buf, "  command <<<\n")
+	for _, line := range str.Split(cmd, "\n") {
+		fmt.Fprintf(buf, "    %s\n", line)
+	}
+	fmt.Fprintf(buf, "  >>>\n")
+	outputs := []string{}
+	for _, oname := range task.outputNames {
+		outputs = append(outputs, "File "+wdlIdent(oname)+" = "+wdlQuote(outFiles[oname]))
+	}
+	writeWDLSection(buf, "output", outputs)
+	runtime := []string{}
+	if p.Cores > 0 {
+		runtime = append(runtime, fmt.Sprintf("cpu: %d", p.Cores))
+	}
+	if p.MemoryMB > 0 {
+		runtime = append(runtime, fmt.Sprintf("memory: \"%d MB\"", p.MemoryMB))
+	}
+	writeWDLSection(buf, "runtime", runtime)
+	fmt.Fprintf(buf, "}\n")
+	task.text = buf.String()
+	return task, nil
+}
+
+// Get a function declaring an input, with a given name, for a param with
+// the spec ps (which may be nil)
+func newWDLParamDecl(ps *ParamSpec) func(name string) string {
+	typ := "String"
+	if ps != nil {
+		switch ps.Type {
+		case ParamTypeInt:
+			typ = "Int"
+		case ParamTypeFloat:
+			typ = "Float"
+		case ParamTypeBool:
+			typ = "Boolean"
+		}
+	}
+	return func(name string) string {
+		switch {
+		case ps != nil && ps.HasDefault:
+			val := ps.Default
+			if typ == "String" {
+				val = wdlQuote(val)
+			}
+			return typ + " " + name + " = " + val
+		case ps != nil && ps.Optional:
+			return typ + "? " + name
+		}
+		return typ + " " + name
+	}
+}
+
+// Write a section, such as "input", with the lines, to buf, unless there
+// are no lines
+func writeWDLSection(buf *bytes.Buffer, section string, lines []string) {
+	if len(lines) == 0 {
+		return
+	}
+	fmt.Fprintf(buf, "  %s {\n", section)
+	for _, line := range lines {
+		fmt.Fprintf(buf, "    %s\n", line)
+	}
+	fmt.Fprintf(buf, "  }\n")
+}
+
+var wdlKeywords = map[string]bool{
+	"Array": true, "Boolean": true, "File": true, "Float": true, "Int": true, "Map": true,
+	"None": true, "Object": true, "Pair": true, "String": true, "alias": true, "as": true,
+	"call": true, "command": true, "else": true, "false": true, "if": true, "in": true,
+	"import": true, "input": true, "left": true, "meta": true, "object": true, "output": true,
+	"parameter_meta": true, "right": true, "runtime": true, "scatter": true, "struct": true,
+	"task": true, "then": true, "true": true, "version": true, "workflow": true,
+}
+
+var wdlInvalidIdentChars = re.MustCompile(`[^A-Za-z0-9_]`)
+
+// Get name as a valid WDL identifier, replacing invalid characters with
+// underscores, and appending an underscore to keywords
+func wdlIdent(name string) string {
+	ident := wdlInvalidIdentChars.ReplaceAllString(name, "_")
+	if ident == "" || !(ident[0] >= 'A' && ident[0] <= 'Z' || ident[0] >= 'a' && ident[0] <= 'z') {
+		ident = "x" + ident
+	}
+	if wdlKeywords[ident] {
+		ident += "_"
+	}
+	return ident
+}
+
+// Quote s as a WDL string, where ~{} placeholders are kept
+func wdlQuote(s string) string {
+	return `"` + str.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,66 @@
+package scipipe
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	t "testing"
+)
+
+func TestWriteWDL(t *t.T) {
+	initTestLogs()
+
+	wf := newTestFooBarWorkflow("/tmp/wdl_")
+	wf.Name = "my-wf"
+	foo := wf.GetSciProcess("foo")
+	foo.SetCommand("echo {p:word} > {o:out}")
+	foo.PathFormatters["out"] = func(t *SciTask) string { return "/tmp/" + t.Params["word"] + ".txt" }
+	foo.SetParamDefault("word", "foo")
+	wf.GetSciProcess("f2b").Cores = 2
+
+	buf := new(bytes.Buffer)
+	err := wf.WriteWDL(buf)
+	assert.Nil(t, err)
+	assert.EqualValues(t, `version 1.0
+
+task foo {
+  input {
+    String word = "foo"
+  }
+  command <<<
+    echo ~{word} > ~{word}.txt
+  >>>
+  output {
+    File out = "~{word}.txt"
+  }
+}
+
+task f2b {
+  input {
+    File in_
+  }
+  command <<<
+    sed 's/foo/bar/' ~{in_} > ~{basename(in_)}.bar
+  >>>
+  output {
+    File out = "~{basename(in_)}.bar"
+  }
+  runtime {
+    cpu: 2
+  }
+}
+
+workflow my_wf {
+  input {
+    String foo_word = "foo"
+  }
+  call foo { input: word = foo_word }
+  call f2b { input: in_ = foo.out }
+  output {
+    File f2b_out = f2b.out
+  }
+}
+`, buf.String())
+
+	assert.EqualValues(t, "x2x", wdlIdent("2x"))
+	assert.EqualValues(t, "call_", wdlIdent("call"))
+}
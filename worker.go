@@ -0,0 +1,451 @@
+package scipipe
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/scipipe/scipipe/workerpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	str "strings"
+	"sync"
+)
+
+// ======= Distributed execution ========
+
+// Commands of tasks can be executed on other machines, by worker agents
+// (see Worker), that the workflow, as coordinator, dispatches tasks to (see
+// WorkerPool). The workflow still creates and schedules the tasks, and
+// handles their inputs and outputs, so the workers must see the same
+// filesystem (such as a shared network filesystem), at the same paths, as
+// the workflow. The protocol is gRPC, with the Worker service of
+// workerpb/worker.proto, so that workers can be called, and tested, with
+// any gRPC client. Cancelling the call of Execute kills the command.
+
+// ------- Worker -------
+
+// Worker executes the commands of tasks, received from workflows on other
+// machines, acting as coordinators, executing at most Slots commands at the
+// same time.
+//
+// Since coordinators can execute any command, and read and write any file,
+// as the user running the worker, workers on TCP addresses, loopback ones
+// included, must authenticate coordinators, by a Token, or by client
+// certificates, with mutual TLS (see TLSConfig). Workers on unix sockets
+// rely on the file permissions of the socket instead. Tokens should only be
+// used over TLS, or on trusted networks, since they are sent in clear text
+// otherwise.
+type Worker struct {
+	Slots int
+	// If set, coordinators must send this token (see WorkerPool.Token)
+	Token string
+	// If set, requests are served over TLS, with this config, which gives
+	// the certificate of the worker. For mutual TLS, it should also require
+	// client certificates, signed by ClientCAs, with ClientAuth set to
+	// tls.RequireAndVerifyClientCert.
+	TLSConfig *tls.Config
+	slots     chan struct{}
+	slotsOnce sync.Once
+}
+
+// Create a new Worker, executing as many commands at the same time as there
+// are CPUs
+func NewWorker() *Worker {
+	return &Worker{
+		Slots: runtime.NumCPU(),
+	}
+}
+
+// Serve requests from coordinators on the address addr, which is either a
+// TCP address (such as "node1:7070"), requiring authentication (see
+// Worker), or the path of a unix socket, prefixed with "unix:" (such as
+// "unix:/run/scipipe/worker.sock"), that only the user running the worker
+// can connect to
+func (w *Worker) ListenAndServe(addr string) error {
+	var ln net.Listener
+	var err error
+	if path, isUnix := str.CutPrefix(addr, "unix:"); isUnix {
+		ln, err = listenUnix(path)
+	} else {
+		ln, err = net.Listen("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	return w.Serve(ln)
+}
+
+// Serve requests from coordinators on the listener ln, which must be on a
+// unix socket, unless the worker authenticates coordinators (see Worker).
+// The permissions of sockets not created by ListenAndServe are left to the
+// caller.
+func (w *Worker) Serve(ln net.Listener) error {
+	if _, err := w.getSlots(); err != nil {
+		ln.Close()
+		return err
+	}
+	if _, isUnix := ln.Addr().(*net.UnixAddr); !isUnix && !w.authenticates() {
+		ln.Close()
+		return fmt.Errorf("Worker: Not serving on %s, which is not a unix socket, without authenticating coordinators, by a Token or client certificates", ln.Addr())
+	}
+	opts := []grpc.ServerOption{}
+	if w.TLSConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(w.TLSConfig.Clone())))
+		Info.Printf("Worker: Serving on %s, over TLS, with %d slots\n", ln.Addr(), w.Slots)
+	} else {
+		Info.Printf("Worker: Serving on %s, with %d slots\n", ln.Addr(), w.Slots)
+	}
+	srv := grpc.NewServer(opts...)
+	workerpb.RegisterWorkerServer(srv, &workerServer{worker: w})
+	return srv.Serve(ln)
+}
+
+// Check whether the worker authenticates coordinators
+func (w *Worker) authenticates() bool {
+	return w.Token != "" || (w.TLSConfig != nil && w.TLSConfig.ClientAuth == tls.RequireAndVerifyClientCert)
+}
+
+// Check whether the call with the context ctx sends the token of the
+// worker, if it requires one
+func (w *Worker) authorized(ctx context.Context) bool {
+	if w.Token == "" {
+		return true
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, auth := range md.Get("authorization") {
+		if subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+w.Token)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// Get the slots of the worker, created on first use, so that workers not
+// created by NewWorker work too
+func (w *Worker) getSlots() (chan struct{}, error) {
+	if w.Slots < 1 {
+		return nil, fmt.Errorf("Worker: Slots must be at least 1, but is %d", w.Slots)
+	}
+	w.slotsOnce.Do(func() {
+		w.slots = make(chan struct{}, w.Slots)
+	})
+	return w.slots, nil
+}
+
+// Execute the command of the request, waiting for a free slot first, and
+// sending its status with send when it is queued, running and done. If ctx
+// is cancelled, as when the coordinator cancels the call, the command is
+// killed, or not started.
+func (w *Worker) execute(ctx context.Context, req *workerpb.ExecRequest, send func(*workerpb.ExecStatus)) {
+	status := &workerpb.ExecStatus{State: workerpb.ExecStatus_QUEUED}
+	status.Host, _ = os.Hostname()
+	send(status)
+	defer func() {
+		status.State = workerpb.ExecStatus_DONE
+		send(status)
+	}()
+	if len(req.Args) == 0 {
+		status.Error = "No command given"
+		return
+	}
+	slots, err := w.getSlots()
+	if err != nil {
+		status.Error = err.Error()
+		return
+	}
+	select {
+	case slots <- struct{}{}:
+		defer func() { <-slots }()
+	case <-ctx.Done():
+		status.Error = ErrCancelled.Error()
+		return
+	}
+	cmd := exec.Command(req.Args[0], req.Args[1:]...)
+	cmd.Env = append(os.Environ(), req.Env...)
+	cmd.Dir = req.Dir
+	setKillableProcessGroup(cmd)
+	// Since stdout and stderr are the same writer, it is not written to
+	// concurrently
+	out := new(bytes.Buffer)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if req.Stdin != "" {
+		f, err := os.Open(resolveWorkerPath(req.Dir, req.Stdin))
+		if err != nil {
+			status.Error = err.Error()
+			return
+		}
+		defer f.Close()
+		cmd.Stdin = f
+	}
+	if req.Stdout != "" {
+		f, err := os.OpenFile(resolveWorkerPath(req.Dir, req.Stdout), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			status.Error = err.Error()
+			return
+		}
+		defer f.Close()
+		cmd.Stdout = f
+	}
+	Audit.Printf("Worker: Executing task %s: %v\n", req.TaskName, req.Args)
+	if err := cmd.Start(); err != nil {
+		status.Error = err.Error()
+		return
+	}
+	status.State = workerpb.ExecStatus_RUNNING
+	send(status)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			Audit.Printf("Worker: Killing command of task %s, since the call was cancelled\n", req.TaskName)
+			killProcessGroup(cmd)
+		case <-done:
+		}
+	}()
+	err = cmd.Wait()
+	close(done)
+	status.Output = out.Bytes()
+	if err != nil {
+		status.Error = err.Error()
+		Warning.Printf("Worker: Task %s failed: %s\n", req.TaskName, err)
+	}
+}
+
+// workerServer serves the gRPC service of a worker
+type workerServer struct {
+	workerpb.UnimplementedWorkerServer
+	worker *Worker
+}
+
+func (s *workerServer) Execute(req *workerpb.ExecRequest, stream workerpb.Worker_ExecuteServer) error {
+	ctx := stream.Context()
+	if !s.worker.authorized(ctx) {
+		from := "unknown address"
+		if p, ok := peer.FromContext(ctx); ok {
+			from = p.Addr.String()
+		}
+		Warning.Printf("Worker: Refused call from %s, with a missing or invalid token\n", from)
+		return status.Error(codes.Unauthenticated, "Missing or invalid token")
+	}
+	var sendErr error
+	s.worker.execute(ctx, req, func(status *workerpb.ExecStatus) {
+		if sendErr == nil {
+			sendErr = stream.Send(status)
+		}
+	})
+	return sendErr
+}
+
+// Listen on a unix socket at path, that only the current user can connect
+// to. The socket is created in a private directory, and moved to path once
+// its permissions are set, so that no one can connect to it before.
+func listenUnix(path string) (net.Listener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".scipipe-worker-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	tmpPath := filepath.Join(dir, "worker.sock")
+	ln, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmpPath, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	ln.SetUnlinkOnClose(false)
+	err = os.Chmod(tmpPath, 0600)
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return &unixSocketListener{UnixListener: ln, path: path}, nil
+}
+
+// unixSocketListener is a listener on the unix socket at path, which is
+// removed when the listener is closed
+type unixSocketListener struct {
+	*net.UnixListener
+	path string
+}
+
+func (l *unixSocketListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: l.path, Net: "unix"}
+}
+
+func (l *unixSocketListener) Close() error {
+	err := l.UnixListener.Close()
+	os.Remove(l.path)
+	return err
+}
+
+// ------- WorkerPool -------
+
+// WorkerPool dispatches the commands of tasks to workers, in turn, for
+// execution. Set it as the Workers of a Workflow (or PipelineRunner), to
+// execute the commands of all its tasks on the workers. If a worker can not
+// be reached, the next one is tried.
+type WorkerPool struct {
+	// The addresses of the workers, as TCP addresses (such as
+	// "node1:7070"), or paths of unix sockets, prefixed with "unix:"
+	Addrs []string
+	// The token sent to the workers, if they require one (see Worker.Token)
+	Token string
+	// If set, workers are connected to over TLS, with this config, which
+	// should give a client certificate, for workers requiring mutual TLS
+	// (see Worker.TLSConfig)
+	TLSConfig *tls.Config
+	conns     map[string]*grpc.ClientConn
+	next      int
+	lock      sync.Mutex
+}
+
+// Create a new WorkerPool, with workers at the addresses addrs (such as
+// "node1:7070")
+func NewWorkerPool(addrs ...string) *WorkerPool {
+	return &WorkerPool{
+		Addrs: addrs,
+	}
+}
+
+// Get the client of the worker at addr, connecting to it on first use
+func (wp *WorkerPool) getClient(addr string) (workerpb.WorkerClient, error) {
+	wp.lock.Lock()
+	defer wp.lock.Unlock()
+	if conn, ok := wp.conns[addr]; ok {
+		return workerpb.NewWorkerClient(conn), nil
+	}
+	creds := insecure.NewCredentials()
+	if wp.TLSConfig != nil {
+		creds = credentials.NewTLS(wp.TLSConfig.Clone())
+	}
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(creds)}
+	if wp.Token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(workerToken(wp.Token)))
+	}
+	conn, err := grpc.NewClient(addr, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if wp.conns == nil {
+		wp.conns = map[string]*grpc.ClientConn{}
+	}
+	wp.conns[addr] = conn
+	return workerpb.NewWorkerClient(conn), nil
+}
+
+// Execute the command of the task t, given as command, on one of the
+// workers, returning its output and error as exec.Cmd.CombinedOutput does,
+// with its stdin and stdout redirected from and to the files at stdinPath
+// and stdoutPath, if not "". If the workflow run is cancelled, the command
+// is killed on the worker.
+func (wp *WorkerPool) execute(t *SciTask, command *exec.Cmd, stdinPath string, stdoutPath string) ([]byte, error) {
+	if len(wp.Addrs) == 0 {
+		return nil, errors.New("No workers in worker pool")
+	}
+	dir := command.Dir
+	if dir == "" {
+		dir, _ = os.Getwd()
+	}
+	req := &workerpb.ExecRequest{
+		Id:       randomHex(8),
+		TaskName: fmt.Sprintf("%s #%d", t.Name, t.Index),
+		Args:     command.Args,
+		Env:      t.getExtraEnv(),
+		Dir:      dir,
+		Stdin:    stdinPath,
+		Stdout:   stdoutPath,
+	}
+	wp.lock.Lock()
+	start := wp.next
+	wp.next = (wp.next + 1) % len(wp.Addrs)
+	wp.lock.Unlock()
+
+	ctx := t.process.getContext()
+	var lastErr error
+	for i := 0; i < len(wp.Addrs); i++ {
+		addr := wp.Addrs[(start+i)%len(wp.Addrs)]
+		var status *workerpb.ExecStatus
+		client, err := wp.getClient(addr)
+		if err == nil {
+			status, err = wp.call(ctx, t, client, addr, req)
+		}
+		if err == nil && (status == nil || status.State != workerpb.ExecStatus_DONE) {
+			err = errors.New("The worker did not report the command as done")
+		}
+		if ctx.Err() != nil {
+			return nil, ErrCancelled
+		}
+		if err != nil && status == nil {
+			// The worker could not be reached, so the next one is tried
+			t.logStructured(LevelWarning, "Could not execute command on worker", Fields{"worker": addr, "error": err})
+			lastErr = err
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("Executing command on worker %s failed: %s", addr, err)
+		}
+		t.logStructured(LevelAudit, "Executed command on worker", Fields{"worker": addr, "host": status.Host})
+		if status.Error != "" {
+			return status.Output, errors.New(status.Error)
+		}
+		return status.Output, nil
+	}
+	return nil, fmt.Errorf("Could not execute command on any worker: %s", lastErr)
+}
+
+// Call Execute of the worker at addr, with the request req, returning the
+// last status received, if any
+func (wp *WorkerPool) call(ctx context.Context, t *SciTask, client workerpb.WorkerClient, addr string, req *workerpb.ExecRequest) (*workerpb.ExecStatus, error) {
+	stream, err := client.Execute(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	var last *workerpb.ExecStatus
+	for {
+		status, err := stream.Recv()
+		if err == io.EOF {
+			return last, nil
+		} else if err != nil {
+			return last, err
+		}
+		t.logStructured(LevelDebug, "Command state changed on worker", Fields{"state": str.ToLower(status.State.String()), "worker": addr, "host": status.Host})
+		last = status
+	}
+}
+
+// workerToken is the token sent to workers, as gRPC credentials
+type workerToken string
+
+func (token workerToken) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(token)}, nil
+}
+
+// Tokens can be sent without TLS, to workers on trusted networks (see
+// Worker)
+func (token workerToken) RequireTransportSecurity() bool {
+	return false
+}
+
+// Get the path of the file at path, relative to the directory dir, unless
+// absolute
+func resolveWorkerPath(dir string, path string) string {
+	if filepath.IsAbs(path) || dir == "" {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
@@ -0,0 +1,222 @@
+package scipipe
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/scipipe/scipipe/workerpb"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	t "testing"
+	"time"
+)
+
+// Start a worker on a unix socket, which needs no authentication
+func startTestWorker(t *t.T) (addr string, stop func()) {
+	ln, err := listenUnix(filepath.Join(t.TempDir(), "worker.sock"))
+	assert.Nil(t, err)
+	go NewWorker().Serve(ln)
+	return "unix:" + ln.Addr().String(), func() { ln.Close() }
+}
+
+func startTestWorkerWith(t *t.T, w *Worker) (addr string, stop func()) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	go w.Serve(ln)
+	return ln.Addr().String(), func() { ln.Close() }
+}
+
+// Run a workflow with one task, executed by the worker pool wp, returning
+// the error of the run
+func runTestWorkerPool(wp *WorkerPool) error {
+	wf := NewWorkflow("wf")
+	wf.Workers = wp
+	foo := NewFromShell("foo", "echo foo > {o:out}")
+	foo.SetPathStatic("out", "/tmp/worker_auth_foo.txt")
+	wf.AddProcesses(foo, NewSink())
+	wf.Connect("foo.out", "sink.in")
+	defer cleanFiles("/tmp/worker_auth_foo.txt")
+	return wf.Run()
+}
+
+func TestWorkerPool(t *t.T) {
+	initTestLogs()
+
+	addr, stop := startTestWorker(t)
+	defer stop()
+
+	wf := newTestFooBarWorkflow("/tmp/worker_")
+	// The first address has no worker, so the next one should be used
+	wf.Workers = NewWorkerPool("127.0.0.1:1", addr)
+	foo := wf.GetSciProcess("foo")
+	foo.SetCommand("echo $WORD > {o:out}")
+	foo.SetEnv("WORD", "foo")
+	fail := NewFromShell("fail", "echo failed; exit 3; echo > {o:out}")
+	fail.SetPathStatic("out", "/tmp/worker_fail.txt")
+	wf.AddProcess(fail)
+	wf.Connect("fail.out", "sink.in")
+
+	err := wf.Run()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "exit status 3")
+	assert.Contains(t, err.Error(), "failed")
+	assert.EqualValues(t, "bar\n", string(NewFileTarget("/tmp/worker_foo.txt.bar").Read()))
+	assert.False(t, NewFileTarget("/tmp/worker_fail.txt").Exists())
+	cleanFiles("/tmp/worker_foo.txt", "/tmp/worker_foo.txt.bar")
+}
+
+func TestWorkerToken(t *t.T) {
+	initTestLogs()
+
+	w := NewWorker()
+	w.Token = "secret"
+	addr, stop := startTestWorkerWith(t, w)
+	defer stop()
+
+	err := runTestWorkerPool(NewWorkerPool(addr))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Missing or invalid token")
+
+	wp := NewWorkerPool(addr)
+	wp.Token = "secret"
+	assert.Nil(t, runTestWorkerPool(wp))
+}
+
+func TestWorkerServeOnlyUnixSocketsWithoutAuth(t *t.T) {
+	initTestLogs()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer ln.Close()
+	assert.Error(t, NewWorker().Serve(ln), "Loopback addresses should require authentication too")
+
+	path := filepath.Join(t.TempDir(), "worker.sock")
+	ln, err = listenUnix(path)
+	assert.Nil(t, err)
+	fi, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.EqualValues(t, os.FileMode(0600), fi.Mode().Perm())
+	ln.Close()
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "The socket should be removed when closed")
+}
+
+func TestWorkerSlots(t *t.T) {
+	initTestLogs()
+
+	ln, err := listenUnix(filepath.Join(t.TempDir(), "worker.sock"))
+	assert.Nil(t, err)
+	assert.Error(t, (&Worker{}).Serve(ln), "Workers without slots should not serve")
+
+	// Workers not created by NewWorker execute commands too
+	w := &Worker{Slots: 1}
+	var last *workerpb.ExecStatus
+	w.execute(context.Background(), &workerpb.ExecRequest{Args: []string{"echo", "foo"}}, func(s *workerpb.ExecStatus) { last = s })
+	assert.EqualValues(t, "", last.Error)
+	assert.EqualValues(t, "foo\n", string(last.Output))
+}
+
+func TestWorkerStatus(t *t.T) {
+	initTestLogs()
+
+	w := &Worker{Slots: 1}
+	states := []workerpb.ExecStatus_State{}
+	var last *workerpb.ExecStatus
+	w.execute(context.Background(), &workerpb.ExecRequest{Args: []string{"echo", "foo"}}, func(s *workerpb.ExecStatus) {
+		states = append(states, s.State)
+		last = s
+	})
+	assert.EqualValues(t, []workerpb.ExecStatus_State{workerpb.ExecStatus_QUEUED, workerpb.ExecStatus_RUNNING, workerpb.ExecStatus_DONE}, states)
+	assert.EqualValues(t, "foo\n", string(last.Output))
+	assert.EqualValues(t, "", last.Error)
+
+	// Cancelling the call kills the command
+	ctx, cancel := context.WithCancel(context.Background())
+	start := time.Now()
+	w.execute(ctx, &workerpb.ExecRequest{Args: []string{"sleep", "10"}}, func(s *workerpb.ExecStatus) {
+		if s.State == workerpb.ExecStatus_RUNNING {
+			cancel()
+		}
+		last = s
+	})
+	assert.True(t, time.Since(start) < 5*time.Second, "The command should be killed")
+	assert.EqualValues(t, workerpb.ExecStatus_DONE, last.State)
+	assert.NotEqual(t, "", last.Error)
+
+	// A command waiting for a slot is not started, if cancelled
+	slots, err := w.getSlots()
+	assert.Nil(t, err)
+	slots <- struct{}{}
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	w.execute(ctx, &workerpb.ExecRequest{Args: []string{"echo", "foo"}}, func(s *workerpb.ExecStatus) { last = s })
+	assert.EqualValues(t, ErrCancelled.Error(), last.Error)
+	assert.Empty(t, last.Output)
+}
+
+func TestWorkerMutualTLS(t *t.T) {
+	initTestLogs()
+
+	ca, caKey := newTestCert(t, nil, nil, true)
+	serverCert, serverKey := newTestCert(t, ca, caKey, false)
+	clientCert, clientKey := newTestCert(t, ca, caKey, false)
+	cas := x509.NewCertPool()
+	cas.AddCert(ca)
+
+	w := NewWorker()
+	w.TLSConfig = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{serverCert.Raw}, PrivateKey: serverKey}},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    cas,
+	}
+	ln, err := net.Listen("tcp", ":0")
+	assert.Nil(t, err)
+	defer ln.Close()
+	go w.Serve(ln)
+	addr := fmt.Sprintf("127.0.0.1:%d", ln.Addr().(*net.TCPAddr).Port)
+
+	wp := NewWorkerPool(addr)
+	wp.TLSConfig = &tls.Config{RootCAs: cas}
+	assert.Error(t, runTestWorkerPool(wp), "Calls without a client certificate should fail")
+
+	wp = NewWorkerPool(addr)
+	wp.TLSConfig = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{clientCert.Raw}, PrivateKey: clientKey}},
+		RootCAs:      cas,
+	}
+	assert.Nil(t, runTestWorkerPool(wp))
+}
+
+// Create a certificate for 127.0.0.1, signed by parent, or, if nil, self
+// signed, returning it and its key
+func newTestCert(t *t.T, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, isCA bool) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	assert.Nil(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+	return cert, key
+}
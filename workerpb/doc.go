@@ -0,0 +1,6 @@
+// Package workerpb contains the protocol buffer messages, and the gRPC
+// service, of scipipe workers (see scipipe.Worker), generated from
+// worker.proto.
+package workerpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative worker.proto
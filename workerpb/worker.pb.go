@@ -0,0 +1,331 @@
+// The service of scipipe workers, executing the commands of tasks for
+// workflows on other machines (see scipipe.Worker and scipipe.WorkerPool)
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        v5.29.3
+// source: worker.proto
+
+package workerpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type ExecStatus_State int32
+
+const (
+	// Waiting for a free slot of the worker
+	ExecStatus_QUEUED  ExecStatus_State = 0
+	ExecStatus_RUNNING ExecStatus_State = 1
+	ExecStatus_DONE    ExecStatus_State = 2
+)
+
+// Enum value maps for ExecStatus_State.
+var (
+	ExecStatus_State_name = map[int32]string{
+		0: "QUEUED",
+		1: "RUNNING",
+		2: "DONE",
+	}
+	ExecStatus_State_value = map[string]int32{
+		"QUEUED":  0,
+		"RUNNING": 1,
+		"DONE":    2,
+	}
+)
+
+func (x ExecStatus_State) Enum() *ExecStatus_State {
+	p := new(ExecStatus_State)
+	*p = x
+	return p
+}
+
+func (x ExecStatus_State) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ExecStatus_State) Descriptor() protoreflect.EnumDescriptor {
+	return file_worker_proto_enumTypes[0].Descriptor()
+}
+
+func (ExecStatus_State) Type() protoreflect.EnumType {
+	return &file_worker_proto_enumTypes[0]
+}
+
+func (x ExecStatus_State) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ExecStatus_State.Descriptor instead.
+func (ExecStatus_State) EnumDescriptor() ([]byte, []int) {
+	return file_worker_proto_rawDescGZIP(), []int{1, 0}
+}
+
+// A request to a worker to execute the command of a task
+type ExecRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// A unique ID of the request, for logging
+	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// The name of the task, for logging
+	TaskName string `protobuf:"bytes,2,opt,name=task_name,json=taskName,proto3" json:"task_name,omitempty"`
+	// The command, as argv
+	Args []string `protobuf:"bytes,3,rep,name=args,proto3" json:"args,omitempty"`
+	// Environment variables, on the form NAME=VALUE, added to those of the
+	// worker
+	Env []string `protobuf:"bytes,4,rep,name=env,proto3" json:"env,omitempty"`
+	// The working directory of the command
+	Dir string `protobuf:"bytes,5,opt,name=dir,proto3" json:"dir,omitempty"`
+	// The files that the stdin and stdout of the command are redirected
+	// from and to, if not empty
+	Stdin         string `protobuf:"bytes,6,opt,name=stdin,proto3" json:"stdin,omitempty"`
+	Stdout        string `protobuf:"bytes,7,opt,name=stdout,proto3" json:"stdout,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExecRequest) Reset() {
+	*x = ExecRequest{}
+	mi := &file_worker_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExecRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExecRequest) ProtoMessage() {}
+
+func (x *ExecRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_worker_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExecRequest.ProtoReflect.Descriptor instead.
+func (*ExecRequest) Descriptor() ([]byte, []int) {
+	return file_worker_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ExecRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *ExecRequest) GetTaskName() string {
+	if x != nil {
+		return x.TaskName
+	}
+	return ""
+}
+
+func (x *ExecRequest) GetArgs() []string {
+	if x != nil {
+		return x.Args
+	}
+	return nil
+}
+
+func (x *ExecRequest) GetEnv() []string {
+	if x != nil {
+		return x.Env
+	}
+	return nil
+}
+
+func (x *ExecRequest) GetDir() string {
+	if x != nil {
+		return x.Dir
+	}
+	return ""
+}
+
+func (x *ExecRequest) GetStdin() string {
+	if x != nil {
+		return x.Stdin
+	}
+	return ""
+}
+
+func (x *ExecRequest) GetStdout() string {
+	if x != nil {
+		return x.Stdout
+	}
+	return ""
+}
+
+// The status of a command executed on a worker, sent when it is queued,
+// when it starts running, and, with its result, when it is done
+type ExecStatus struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	State ExecStatus_State       `protobuf:"varint,1,opt,name=state,proto3,enum=scipipe.ExecStatus_State" json:"state,omitempty"`
+	// The combined stdout and stderr of the command
+	Output []byte `protobuf:"bytes,2,opt,name=output,proto3" json:"output,omitempty"`
+	// The error of the command, such as its exit status, if it failed
+	Error string `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	// The hostname of the worker
+	Host          string `protobuf:"bytes,4,opt,name=host,proto3" json:"host,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExecStatus) Reset() {
+	*x = ExecStatus{}
+	mi := &file_worker_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExecStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExecStatus) ProtoMessage() {}
+
+func (x *ExecStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_worker_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExecStatus.ProtoReflect.Descriptor instead.
+func (*ExecStatus) Descriptor() ([]byte, []int) {
+	return file_worker_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ExecStatus) GetState() ExecStatus_State {
+	if x != nil {
+		return x.State
+	}
+	return ExecStatus_QUEUED
+}
+
+func (x *ExecStatus) GetOutput() []byte {
+	if x != nil {
+		return x.Output
+	}
+	return nil
+}
+
+func (x *ExecStatus) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *ExecStatus) GetHost() string {
+	if x != nil {
+		return x.Host
+	}
+	return ""
+}
+
+var File_worker_proto protoreflect.FileDescriptor
+
+const file_worker_proto_rawDesc = "" +
+	"\n" +
+	"\fworker.proto\x12\ascipipe\"\xa0\x01\n" +
+	"\vExecRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1b\n" +
+	"\ttask_name\x18\x02 \x01(\tR\btaskName\x12\x12\n" +
+	"\x04args\x18\x03 \x03(\tR\x04args\x12\x10\n" +
+	"\x03env\x18\x04 \x03(\tR\x03env\x12\x10\n" +
+	"\x03dir\x18\x05 \x01(\tR\x03dir\x12\x14\n" +
+	"\x05stdin\x18\x06 \x01(\tR\x05stdin\x12\x16\n" +
+	"\x06stdout\x18\a \x01(\tR\x06stdout\"\xab\x01\n" +
+	"\n" +
+	"ExecStatus\x12/\n" +
+	"\x05state\x18\x01 \x01(\x0e2\x19.scipipe.ExecStatus.StateR\x05state\x12\x16\n" +
+	"\x06output\x18\x02 \x01(\fR\x06output\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\x12\x12\n" +
+	"\x04host\x18\x04 \x01(\tR\x04host\"*\n" +
+	"\x05State\x12\n" +
+	"\n" +
+	"\x06QUEUED\x10\x00\x12\v\n" +
+	"\aRUNNING\x10\x01\x12\b\n" +
+	"\x04DONE\x10\x022@\n" +
+	"\x06Worker\x126\n" +
+	"\aExecute\x12\x14.scipipe.ExecRequest\x1a\x13.scipipe.ExecStatus0\x01B%Z#github.com/scipipe/scipipe/workerpbb\x06proto3"
+
+var (
+	file_worker_proto_rawDescOnce sync.Once
+	file_worker_proto_rawDescData []byte
+)
+
+func file_worker_proto_rawDescGZIP() []byte {
+	file_worker_proto_rawDescOnce.Do(func() {
+		file_worker_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_worker_proto_rawDesc), len(file_worker_proto_rawDesc)))
+	})
+	return file_worker_proto_rawDescData
+}
+
+var file_worker_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_worker_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_worker_proto_goTypes = []any{
+	(ExecStatus_State)(0), // 0: scipipe.ExecStatus.State
+	(*ExecRequest)(nil),   // 1: scipipe.ExecRequest
+	(*ExecStatus)(nil),    // 2: scipipe.ExecStatus
+}
+var file_worker_proto_depIdxs = []int32{
+	0, // 0: scipipe.ExecStatus.state:type_name -> scipipe.ExecStatus.State
+	1, // 1: scipipe.Worker.Execute:input_type -> scipipe.ExecRequest
+	2, // 2: scipipe.Worker.Execute:output_type -> scipipe.ExecStatus
+	2, // [2:3] is the sub-list for method output_type
+	1, // [1:2] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_worker_proto_init() }
+func file_worker_proto_init() {
+	if File_worker_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_worker_proto_rawDesc), len(file_worker_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_worker_proto_goTypes,
+		DependencyIndexes: file_worker_proto_depIdxs,
+		EnumInfos:         file_worker_proto_enumTypes,
+		MessageInfos:      file_worker_proto_msgTypes,
+	}.Build()
+	File_worker_proto = out.File
+	file_worker_proto_goTypes = nil
+	file_worker_proto_depIdxs = nil
+}
@@ -0,0 +1,533 @@
+package scipipe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	str "strings"
+	"sync"
+	"time"
+)
+
+// ======= Workflow ========
+
+// Workflow is a pipeline runner where processes are added by name, so that
+// they can be looked up, and connected by name, as in
+// wf.Connect("align.bam", "sort.in"). Its Run method runs all processes,
+// waits for them to finish, and returns an error, rather than exiting the
+// program, if the workflow is not valid or if any task failed. The tasks of
+// each process that were created, executed, skipped and failed are
+// available as run statistics, with GetStats.
+//
+// All the settings of PipelineRunner, such as MaxConcurrentTasks and
+// DryRun, are available on Workflow too.
+type Workflow struct {
+	PipelineRunner
+	Name string
+	// If set, the progress of the run (see Progress) is reported every
+	// ProgressInterval, and when the run is done, to OnProgress, or, if
+	// OnProgress is not set, to the audit log
+	ProgressInterval time.Duration
+	OnProgress       func(Progress)
+	// If set, metrics for the run are served, in the Prometheus text
+	// format, at /metrics on this address (such as ":9090"), while the
+	// workflow runs (see WriteMetrics)
+	MetricsAddr string
+	// If set, a dashboard showing the status of the run is served on this
+	// address, while the workflow runs (see DashboardHandler)
+	DashboardAddr string
+	// If set, the run of the workflow, and each task, are traced with
+	// Tracer (see OTLPTracer)
+	Tracer Tracer
+	// If set, an HTML report of the timing of the run (see WriteReport) is
+	// written to this path when the workflow is done
+	ReportPath string
+	// If set, the state of the run (see RunState) is written to a file in
+	// this directory, when the run starts, and when it is done
+	StateDir string
+	// If set, the records of all tasks executed in the run are kept (see
+	// GetTaskRecords), as needed by WriteReport, WriteArchive and
+	// GetResourceReport after the run. They are kept anyway if ReportPath
+	// or StateDir is set, or if tasks are profiled.
+	KeepTaskRecords bool
+	// If set, the state of the run is also written to StateDir every
+	// CheckpointInterval while it runs, as a checkpoint of the tasks that
+	// are done, running and queued
+	CheckpointInterval time.Duration
+	// If set, and the latest run of the workflow recorded in StateDir was
+	// interrupted, such as by a crash, the run continues from its latest
+	// checkpoint: the tasks that were done are skipped, and the unfinished
+	// tasks that were running or queued are executed again (see
+	// RunState.GetUnfinishedPaths)
+	Restart bool
+	// If set, only part of the workflow is run: the processes named in
+	// RunFrom, and all processes downstream of them, and of those, the
+	// processes named in RunUntil, and all processes upstream of them. The
+	// tasks of the other processes are not executed, but the outputs of
+	// those directly upstream of the selected processes are assumed to
+	// exist.
+	RunFrom              []string
+	RunUntil             []string
+	spec                 *WorkflowSpec
+	noExecute            bool
+	taskRecords          []TaskRecord
+	queuedTasks          map[*SciTask]TaskRecord
+	runningTasks         map[*SciTask]TaskRecord
+	tracingHooksAdded    bool
+	recordHooksAdded     bool
+	checkpointHooksAdded bool
+	rootSpan             Span
+	procsByName          map[string]Process
+	procNames            []string
+	connectProblems      []string
+	stats                map[string]*ProcessStats
+	procsDone            map[string]bool
+	hooks                *hooks
+	notifying            *sync.WaitGroup
+	failureNotifiers     []*failureNotifier
+	startTime            time.Time
+	finishTime           time.Time
+	ctx                  context.Context
+	cancel               context.CancelFunc
+	lock                 *sync.Mutex
+}
+
+// Instantiate an empty Workflow
+func NewWorkflow(name string) *Workflow {
+	wf := &Workflow{
+		Name:         name,
+		procsByName:  make(map[string]Process),
+		stats:        make(map[string]*ProcessStats),
+		procsDone:    make(map[string]bool),
+		queuedTasks:  make(map[*SciTask]TaskRecord),
+		runningTasks: make(map[*SciTask]TaskRecord),
+		hooks:        newHooks(),
+		notifying:    new(sync.WaitGroup),
+		lock:         new(sync.Mutex),
+	}
+	wf.ctx, wf.cancel = context.WithCancel(context.Background())
+	return wf
+}
+
+// Add the process proc to the workflow, under the name name, which must be
+// unique within the workflow
+func (wf *Workflow) Add(name string, proc Process) {
+	if _, exists := wf.procsByName[name]; exists {
+		Check(fmt.Errorf("Workflow %s: A process named %s is already added", wf.Name, name))
+	}
+	wf.procsByName[name] = proc
+	wf.procNames = append(wf.procNames, name)
+	wf.PipelineRunner.AddProcess(proc)
+}
+
+// Add the process proc to the workflow, under the name in its Name field.
+// Processes without a name, such as Sink, are named after their type, made
+// unique by a number, as in "sink", "sink2" and so on.
+func (wf *Workflow) AddProcess(proc Process) {
+	name, ok := getProcessName(proc)
+	if !ok {
+		base := name
+		for i := 2; wf.procsByName[name] != nil; i++ {
+			name = fmt.Sprintf("%s%d", base, i)
+		}
+	}
+	wf.Add(name, proc)
+}
+
+// Add the processes procs to the workflow, under the names in their Name
+// fields
+func (wf *Workflow) AddProcesses(procs ...Process) {
+	for _, proc := range procs {
+		wf.AddProcess(proc)
+	}
+}
+
+// Get the process added under the name name, or nil if there is none
+func (wf *Workflow) GetProcess(name string) Process {
+	return wf.procsByName[name]
+}
+
+// Get the SciProcess added under the name name, or nil if there is no such
+// SciProcess
+func (wf *Workflow) GetSciProcess(name string) *SciProcess {
+	sp, _ := wf.procsByName[name].(*SciProcess)
+	return sp
+}
+
+// Get the names of the processes of the workflow, in the order they were
+// added
+func (wf *Workflow) GetProcessNames() []string {
+	return append([]string{}, wf.procNames...)
+}
+
+// Connect the port given by from to the port given by to, both on the form
+// PROCESSNAME.PORTNAME. The from port is an out-port or a param port
+// sending values (such as a port of a CSVSource, or a param out-port of a
+// SciProcess, see SetParamOut), and the to port an in-port or a param port. The single In and Out ports of components, such
+// as Filter, are named "in" and "out", and so is the in-port of a Sink,
+// which can be connected any number of times. An out-port connected to
+// several in-ports sends every target to all of them, and an in-port
+// connected to several out-ports merges their targets (see
+// InPort.SetMergeMode). Ports that can not be connected are reported as
+// problems when the workflow is validated.
+func (wf *Workflow) Connect(from string, to string) {
+	fromPort, err := wf.getPort(from, "Out", "ParamOutPorts", "ParamPorts")
+	if err != nil {
+		wf.connectProblems = append(wf.connectProblems, err.Error())
+		return
+	}
+	if sink, ok := wf.procsByName[str.SplitN(to, ".", 2)[0]].(*Sink); ok && str.HasSuffix(to, ".in") {
+		if fp, ok := fromPort.(*OutPort); ok {
+			sink.Connect(fp)
+			return
+		}
+	}
+	toPort, err := wf.getPort(to, "In", "ParamPorts")
+	if err != nil {
+		wf.connectProblems = append(wf.connectProblems, err.Error())
+		return
+	}
+	switch fp := fromPort.(type) {
+	case *OutPort:
+		if tp, ok := toPort.(*InPort); ok {
+			if err := tp.connect(fp, from); err != nil {
+				wf.connectProblems = append(wf.connectProblems, fmt.Sprintf("Can not connect %s to %s: %s", from, to, err))
+			}
+			return
+		}
+	case *ParamPort:
+		if tp, ok := toPort.(*ParamPort); ok {
+			tp.Connect(fp)
+			return
+		}
+	case valueOutPort:
+		if fp.connectTo(toPort) {
+			return
+		}
+	}
+	wf.connectProblems = append(wf.connectProblems, fmt.Sprintf("Can not connect %s to %s, since they are of different types", from, to))
+}
+
+// Get the port given by spec, on the form PROCESSNAME.PORTNAME, looking in
+// the fields fieldNames of the process, and, for ports of Go values (see
+// ValueInPort), in fields named as the port
+func (wf *Workflow) getPort(spec string, fieldNames ...string) (interface{}, error) {
+	parts := str.SplitN(spec, ".", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("Port %s is not on the form PROCESSNAME.PORTNAME", spec)
+	}
+	procName, portName := parts[0], parts[1]
+	proc, ok := wf.procsByName[procName]
+	if !ok {
+		return nil, fmt.Errorf("Port %s refers to a process %s, which is not in the workflow", spec, procName)
+	}
+	v := reflect.Indirect(reflect.ValueOf(proc))
+	if v.Kind() == reflect.Struct {
+		for _, fieldName := range fieldNames {
+			f := v.FieldByName(fieldName)
+			if !f.IsValid() {
+				continue
+			}
+			switch f.Kind() {
+			case reflect.Map:
+				if f.Type().Key().Kind() != reflect.String {
+					continue
+				}
+				if port := f.MapIndex(reflect.ValueOf(portName)); port.IsValid() && !port.IsNil() {
+					return port.Interface(), nil
+				}
+			case reflect.Ptr:
+				if portName == str.ToLower(fieldName) && !f.IsNil() {
+					return f.Interface(), nil
+				}
+			}
+		}
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Field(i)
+			if !v.Type().Field(i).IsExported() || str.ToLower(v.Type().Field(i).Name) != portName || f.Kind() != reflect.Ptr || f.IsNil() {
+				continue
+			}
+			switch f.Interface().(type) {
+			case valueInPort, valueOutPort:
+				return f.Interface(), nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("Process %s has no port %s", procName, portName)
+}
+
+// Validate the workflow, as PipelineRunner.Validate does, also reporting
+// ports that could not be connected
+func (wf *Workflow) Validate() error {
+	problems := append([]string{}, wf.connectProblems...)
+	if err := wf.PipelineRunner.Validate(); err != nil {
+		problems = append(problems, err.(*ValidationError).Problems...)
+	}
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// Run all processes of the workflow, and wait for them to finish. If the
+// workflow is not valid, nothing is run, and a *ValidationError is
+// returned. Tasks that fail do not stop the workflow, but their outputs
+// are not sent on to downstream processes, and their errors are returned
+// together, in a *RunError, along with those of results that Publishers
+// could not publish. Callbacks registered with OnWorkflowDone are
+// called with the returned error.
+func (wf *Workflow) Run() error {
+	root := wf.startTracing()
+	err := wf.run()
+	wf.endTracing(root, err)
+	wf.writeRunState(true, err)
+	wf.writeReportFile()
+	wf.logRunDone(err)
+	wf.hooks.callWorkflowDone(wf, err)
+	return err
+}
+
+// Log that the run of the workflow is done, and whether it failed (with the
+// error err, which is returned from Run, so not logged), to the structured
+// logger
+func (wf *Workflow) logRunDone(err error) {
+	total := wf.GetStats().GetTotal()
+	fields := Fields{
+		"workflow":        wf.Name,
+		"tasks_succeeded": total.TasksExecuted,
+		"tasks_failed":    total.TasksFailed,
+		"tasks_skipped":   total.TasksSkipped,
+	}
+	if err != nil {
+		logStructured(LevelError, "Workflow failed", fields)
+		return
+	}
+	logStructured(LevelInfo, "Workflow finished", fields)
+}
+
+func (wf *Workflow) run() error {
+	initDefaultLog()
+	if len(wf.processes) == 0 {
+		return fmt.Errorf("Workflow %s is empty. Did you forget to add the processes to it?", wf.Name)
+	}
+	if err := wf.setUpConfig(); err != nil {
+		return err
+	}
+	if err := wf.Validate(); err != nil {
+		return err
+	}
+	if err := wf.setUpPartialRun(); err != nil {
+		return err
+	}
+	wf.setUpScheduler()
+	wf.setUpDryRun()
+	wf.setUpMock()
+	wf.setUpLiveOutput()
+	wf.setUpProfiling()
+	wf.setUpStrictMode()
+	wf.setUpOutputPermissions()
+	wf.setUpWorkers()
+	wf.setUpStats()
+	wf.setUpNotifiers()
+	wf.setUpTaskRecords()
+	wf.setUpCheckpointing()
+	wf.restartFromCheckpoint()
+
+	wf.lock.Lock()
+	wf.startTime = time.Now()
+	wf.lock.Unlock()
+	logStructured(LevelInfo, "Workflow started", Fields{"workflow": wf.Name})
+	wf.writeRunState(false, nil)
+	stopCheckpointing := wf.startCheckpointing()
+	stopProgress := wf.startProgressReporting()
+	stopMetrics := wf.startHTTPServer(wf.MetricsAddr, "metrics", wf.metricsMux())
+	stopDashboard := wf.startHTTPServer(wf.DashboardAddr, "dashboard", wf.DashboardHandler())
+	wg := new(sync.WaitGroup)
+	for _, name := range wf.procNames {
+		wg.Add(1)
+		go func(name string, proc Process) {
+			defer wg.Done()
+			proc.Run()
+			wf.lock.Lock()
+			wf.procsDone[name] = true
+			wf.lock.Unlock()
+		}(name, wf.procsByName[name])
+	}
+	wg.Wait()
+	wf.lock.Lock()
+	wf.finishTime = time.Now()
+	wf.lock.Unlock()
+	stopCheckpointing()
+	stopProgress()
+	stopMetrics()
+	stopDashboard()
+
+	errs := []error{}
+	for _, name := range sortedStatsKeys(wf.stats) {
+		errs = append(errs, wf.stats[name].get().errors...)
+	}
+	errs = append(errs, getProcessRunErrors(wf.processes)...)
+	if len(errs) > 0 {
+		return &RunError{Errors: errs}
+	}
+	return nil
+}
+
+// Get the errors of the latest run of those of the processes procs (and of
+// the processes of sub-workflows among them) that are not SciProcesses, but
+// record their errors themselves, such as Publishers
+func getProcessRunErrors(procs []Process) []error {
+	errs := []error{}
+	for _, proc := range procs {
+		switch proc := proc.(type) {
+		case *SubWorkflow:
+			errs = append(errs, getProcessRunErrors(proc.processes)...)
+		case interface{ getRunErrors() []error }:
+			errs = append(errs, proc.getRunErrors()...)
+		}
+	}
+	return errs
+}
+
+// Set up the recording of run statistics, and the calling of lifecycle
+// hooks, for all SciProcesses of the workflow (including those in
+// sub-workflows, which are known by their qualified names, such as
+// "subwf.proc", see qualifySciProcesses)
+func (wf *Workflow) setUpStats() {
+	wf.lock.Lock()
+	defer wf.lock.Unlock()
+	procs := make(map[string]*SciProcess)
+	for _, name := range wf.procNames {
+		// Processes added to the workflow are known by the name they were
+		// added with
+		switch proc := wf.procsByName[name].(type) {
+		case *SciProcess:
+			procs[name] = proc
+		case *SubWorkflow:
+			qualifySciProcesses(name+".", proc.processes, procs)
+		}
+	}
+	for name, sp := range procs {
+		sp.stats = newProcessStats()
+		sp.hooks = wf.hooks
+		sp.ctx = wf.ctx
+		wf.stats[name] = sp.stats
+	}
+}
+
+// Cancel the run of the workflow: running commands are killed, and tasks
+// not yet started fail, without executing their commands, so that Run
+// returns soon, with an error for each task. It can be called from any
+// goroutine, also before the workflow is run, in which case all its tasks
+// fail.
+func (wf *Workflow) Cancel() {
+	Audit.Printf("Workflow %s: Cancelling run\n", wf.Name)
+	wf.cancel()
+}
+
+// Check whether the run of the workflow is cancelled (see Cancel)
+func (wf *Workflow) IsCancelled() bool {
+	return wf.ctx.Err() != nil
+}
+
+// Get the run statistics of the workflow, per SciProcess. They can be
+// read while the workflow is running.
+func (wf *Workflow) GetStats() RunStats {
+	wf.lock.Lock()
+	defer wf.lock.Unlock()
+	rs := RunStats{
+		StartTime:  wf.startTime,
+		FinishTime: wf.finishTime,
+		Processes:  make(map[string]ProcessStats),
+	}
+	for name, ps := range wf.stats {
+		rs.Processes[name] = ps.get()
+	}
+	return rs
+}
+
+// Get the current progress of the run of the workflow
+func (wf *Workflow) GetProgress() Progress {
+	rs := wf.GetStats()
+	now := time.Now()
+	if !rs.FinishTime.IsZero() {
+		now = rs.FinishTime
+	}
+	return newProgress(rs, now)
+}
+
+// Start reporting the progress every ProgressInterval, if set, returning a
+// function that stops the reporting, after reporting the final progress
+func (wf *Workflow) startProgressReporting() (stop func()) {
+	if wf.ProgressInterval <= 0 {
+		return func() {}
+	}
+	report := wf.OnProgress
+	if report == nil {
+		report = func(p Progress) {
+			Audit.Printf("Workflow %s: %s\n", wf.Name, p)
+		}
+	}
+	done := make(chan bool)
+	stopped := make(chan bool)
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(wf.ProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				report(wf.GetProgress())
+			case <-done:
+				report(wf.GetProgress())
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// ErrCancelled is the error of tasks that failed because the workflow run
+// was cancelled
+var ErrCancelled = errors.New("Workflow run cancelled")
+
+// RunError contains the errors of all tasks that failed in a run of a
+// workflow, and of all results that could not be published
+type RunError struct {
+	Errors []error
+}
+
+func (e *RunError) Error() string {
+	msgs := []string{}
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%d error(s) in run:\n  %s", len(e.Errors), str.Join(msgs, "\n  "))
+}
+
+// Get the name of the process proc, from its Name field, or, if it has
+// none, from its type, in which case ok is false
+func getProcessName(proc Process) (name string, ok bool) {
+	v := reflect.Indirect(reflect.ValueOf(proc))
+	if v.Kind() == reflect.Struct {
+		if f := v.FieldByName("Name"); f.IsValid() && f.Kind() == reflect.String && f.String() != "" {
+			return f.String(), true
+		}
+	}
+	return str.ToLower(v.Type().Name()), false
+}
+
+// Get the keys of a map of process stats, sorted
+func sortedStatsKeys(stats map[string]*ProcessStats) []string {
+	keys := []string{}
+	for k := range stats {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
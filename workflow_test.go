@@ -0,0 +1,100 @@
+package scipipe
+
+import (
+	"github.com/stretchr/testify/assert"
+	t "testing"
+	"time"
+)
+
+func TestWorkflow(t *t.T) {
+	initTestLogs()
+
+	wf := newTestFooBarWorkflow("/tmp/wf_")
+
+	assert.EqualValues(t, []string{"foo", "f2b", "sink"}, wf.GetProcessNames())
+	assert.EqualValues(t, "f2b", wf.GetSciProcess("f2b").Name)
+
+	err := wf.Run()
+	assert.Nil(t, err)
+	assert.EqualValues(t, "bar\n", string(NewFileTarget("/tmp/wf_foo.txt.bar").Read()))
+
+	stats := wf.GetStats()
+	assert.EqualValues(t, 1, stats.Processes["foo"].TasksExecuted)
+	assert.EqualValues(t, 1, stats.Processes["f2b"].TasksExecuted)
+	assert.EqualValues(t, 2, stats.GetTotal().TasksCreated)
+	assert.False(t, stats.FinishTime.Before(stats.StartTime))
+
+	cleanFiles("/tmp/wf_foo.txt", "/tmp/wf_foo.txt.bar")
+}
+
+func TestWorkflowErrors(t *t.T) {
+	initTestLogs()
+
+	// Ports that can not be connected are reported by Run
+	wf := NewWorkflow("wf")
+	foo := NewFromShell("foo", "echo foo > {o:out}")
+	foo.SetPathStatic("out", "/tmp/wf_err_foo.txt")
+	wf.AddProcesses(foo, NewSink())
+	wf.Connect("foo.bar", "sink.in")
+	err := wf.Run()
+	assert.IsType(t, &ValidationError{}, err)
+	assert.Contains(t, err.Error(), "Process foo has no port bar")
+
+	// Failed tasks do not stop the workflow, but are returned as errors
+	wf = NewWorkflow("wf")
+	ok := NewFromShell("ok", "echo ok > {o:out}")
+	ok.SetPathStatic("out", "/tmp/wf_err_ok.txt")
+	fail := NewFromShell("fail", "echo fail > {o:out}; exit 1")
+	fail.SetPathStatic("out", "/tmp/wf_err_fail.txt")
+	wf.AddProcesses(ok, fail, NewSink())
+	wf.Connect("ok.out", "sink.in")
+	wf.Connect("fail.out", "sink.in")
+	err = wf.Run()
+	assert.IsType(t, &RunError{}, err)
+	assert.Len(t, err.(*RunError).Errors, 1)
+	assert.EqualValues(t, 1, wf.GetStats().Processes["fail"].TasksFailed)
+	assert.EqualValues(t, "ok\n", string(NewFileTarget("/tmp/wf_err_ok.txt").Read()))
+	assert.False(t, NewFileTarget("/tmp/wf_err_fail.txt").Exists())
+	assert.False(t, NewFileTarget("/tmp/wf_err_fail.txt.tmp").Exists())
+
+	cleanFiles("/tmp/wf_err_ok.txt")
+}
+
+func TestWorkflowProgress(t *t.T) {
+	initTestLogs()
+
+	wf := NewWorkflow("wf")
+	wf.ProgressInterval = 10 * time.Millisecond
+	reports := []Progress{}
+	wf.OnProgress = func(p Progress) {
+		reports = append(reports, p)
+	}
+	abc := NewFromShell("abc", "sleep 0.05; echo {p:x} > {o:out}")
+	abc.PathFormatters["out"] = func(task *SciTask) string {
+		return "/tmp/wf_progress_" + task.Params["x"] + ".txt"
+	}
+	wf.AddProcesses(abc, NewSink())
+	wf.Connect("abc.out", "sink.in")
+	xs := NewParamPort()
+	abc.ParamPorts["x"].Connect(xs)
+	go func() {
+		defer xs.Close()
+		for _, x := range []string{"a", "b", "c"} {
+			xs.Chan <- x
+		}
+	}()
+
+	err := wf.Run()
+	assert.Nil(t, err)
+	assert.NotEmpty(t, reports)
+	last := reports[len(reports)-1]
+	assert.EqualValues(t, 3, last.TasksCreated)
+	assert.EqualValues(t, 3, last.TasksDone)
+	assert.EqualValues(t, 0, last.TasksRunning)
+	assert.EqualValues(t, "3/3 tasks done, 0 running", last.String())
+
+	p := Progress{TasksCreated: 310, TasksDone: 42, TasksRunning: 3, ETA: 12 * time.Minute}
+	assert.EqualValues(t, "42/310 tasks done, 3 running, ETA 12m0s", p.String())
+
+	cleanFiles("/tmp/wf_progress_a.txt", "/tmp/wf_progress_b.txt", "/tmp/wf_progress_c.txt")
+}
@@ -0,0 +1,215 @@
+package scipipe
+
+import (
+	"bytes"
+	"go/format"
+	"io"
+	"sort"
+	"strconv"
+	"text/template"
+)
+
+// ======= Standalone wrappers for processes ========
+
+// Write a CWL CommandLineTool document for the process to w, so that it can
+// be run on its own, outside the workflow, by CWL runners. See
+// Workflow.WriteCWL for how the process is translated.
+func (p *SciProcess) WriteCWLTool(w io.Writer) error {
+	tool, err := newCWLTool(p)
+	if err != nil {
+		return err
+	}
+	return writeCWL(w, tool.doc)
+}
+
+// Write the source code of a Go program (a main package) to w, running the
+// process on its own, outside the workflow, with the paths of its inputs and
+// outputs, and the values of its params, given as command line flags, named
+// after the ports and params, as in:
+//
+//	f2b -in foo.txt -out bar.txt
+//
+// Output paths can contain the same placeholders as path patterns (see
+// SetPathPattern), and default to the base name of the path that the path
+// formatter of the out-port creates. The cores and memory, the types of the
+// params, and the compression of the inputs and outputs, of the process are
+// kept. Processes with a CustomExecute function, or Go template command
+// patterns, can not be wrapped.
+func (p *SciProcess) WriteGoMain(w io.Writer) error {
+	if err := checkExportable(p, "a Go program"); err != nil {
+		return err
+	}
+	patternRef := func(typ string, name string) string {
+		return "{" + typ + ":" + name + "}"
+	}
+	basenameRef := func(typ string, name string) string {
+		if typ == "i" {
+			return "{i:" + name + "|basename}"
+		}
+		return patternRef(typ, name)
+	}
+	data := &goMainData{
+		Name:     strconv.Quote(p.Name),
+		Command:  strconv.Quote(p.CommandPattern),
+		Prepend:  strconv.Quote(p.Prepend),
+		Env:      make(map[string]string),
+		Cores:    p.Cores,
+		MemoryMB: p.MemoryMB,
+	}
+	for k, v := range p.Env {
+		data.Env[strconv.Quote(k)] = strconv.Quote(v)
+	}
+	for iname := range p.In {
+		f := goMainFlag{Name: strconv.Quote(iname), Default: `""`, Required: true, Compress: p.InPortsDecompress[iname]}
+		if path, ok := p.InPortsDefault[iname]; ok {
+			f.Default = strconv.Quote(path)
+			f.Required = false
+		} else if p.InPortsOptional[iname] {
+			f.Required = false
+			f.Optional = true
+		}
+		data.Inputs = append(data.Inputs, f)
+	}
+	for oname := range p.Out {
+		pattern := replaceExportMarkers(getExportOutPath(p, oname), basenameRef)
+		data.Outputs = append(data.Outputs, goMainFlag{Name: strconv.Quote(oname), Default: strconv.Quote(pattern), Compress: p.OutPortsCompress[oname]})
+	}
+	for pname := range p.ParamPorts {
+		f := goMainFlag{Name: strconv.Quote(pname), Default: `""`, Required: true}
+		if ps := p.ParamSpecs[pname]; ps != nil {
+			f.Default = strconv.Quote(ps.Default)
+			f.Required = !ps.HasDefault && !ps.Optional
+			f.Optional = ps.Optional && !ps.HasDefault
+			if ps.Type != ParamTypeString {
+				f.Type = goParamTypes[ps.Type]
+				for _, choice := range ps.Choices {
+					f.Type += ", " + strconv.Quote(choice)
+				}
+			}
+		}
+		data.Params = append(data.Params, f)
+	}
+	for _, flags := range [][]goMainFlag{data.Inputs, data.Outputs, data.Params} {
+		sort.Slice(flags, func(i, j int) bool { return flags[i].Name < flags[j].Name })
+	}
+	buf := new(bytes.Buffer)
+	if err := goMainTemplate.Execute(buf, data); err != nil {
+		return err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+// The names of the param types in generated Go programs
+var goParamTypes = map[ParamType]string{
+	ParamTypeInt:   "scipipe.ParamTypeInt",
+	ParamTypeFloat: "scipipe.ParamTypeFloat",
+	ParamTypeBool:  "scipipe.ParamTypeBool",
+	ParamTypeEnum:  "scipipe.ParamTypeEnum",
+}
+
+type goMainData struct {
+	Name     string
+	Command  string
+	Prepend  string
+	Env      map[string]string
+	Cores    int
+	MemoryMB int
+	Inputs   []goMainFlag
+	Outputs  []goMainFlag
+	Params   []goMainFlag
+}
+
+// goMainFlag is a command line flag of a generated Go program, where the
+// name and default value are quoted as Go strings. Compress is whether the
+// in-port decompresses, or the out-port compresses, its files, and Type the
+// arguments of SetParamType for params with other types than strings.
+type goMainFlag struct {
+	Name     string
+	Default  string
+	Required bool
+	Optional bool
+	Compress bool
+	Type     string
+}
+
+var goMainTemplate = template.Must(template.New("main").Parse(`// Code generated by scipipe, from the process {{.Name}}, to run it on its own.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/scipipe/scipipe"
+)
+
+func main() {
+	inPaths := map[string]*string{
+		{{range .Inputs}}{{.Name}}: flag.String({{.Name}}, {{.Default}}, "Path of the input file of the in-port "+{{.Name}}{{if .Required}}+" (required)"{{end}}),
+		{{end}}
+	}
+	outPaths := map[string]*string{
+		{{range .Outputs}}{{.Name}}: flag.String({{.Name}}, {{.Default}}, "Path of the output file of the out-port "+{{.Name}}),
+		{{end}}
+	}
+	params := map[string]*string{
+		{{range .Params}}{{.Name}}: flag.String({{.Name}}, {{.Default}}, "Value of the param "+{{.Name}}{{if .Required}}+" (required)"{{end}}),
+		{{end}}
+	}
+	required := []string{ {{range .Inputs}}{{if .Required}}{{.Name}}, {{end}}{{end}}{{range .Params}}{{if .Required}}{{.Name}}, {{end}}{{end}} }
+	optional := map[string]bool{ {{range .Params}}{{if .Optional}}{{.Name}}: true, {{end}}{{end}} }
+	flag.Parse()
+	given := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	for _, name := range required {
+		if !given[name] {
+			fmt.Fprintf(os.Stderr, "Missing required flag -%s\n", name)
+			flag.Usage()
+			os.Exit(2)
+		}
+	}
+
+	scipipe.InitLogAudit()
+	wf := scipipe.NewWorkflow({{.Name}})
+	p := scipipe.NewFromShell({{.Name}}, {{.Command}})
+	p.Prepend = {{.Prepend}}
+	{{if .Cores}}p.Cores = {{.Cores}}
+	{{end}}{{if .MemoryMB}}p.MemoryMB = {{.MemoryMB}}
+	{{end}}{{range $k, $v := .Env}}p.SetEnv({{$k}}, {{$v}})
+	{{end}}{{range .Inputs}}{{if .Optional}}p.SetInPortOptional({{.Name}})
+	{{end}}{{if .Compress}}p.SetInDecompress({{.Name}})
+	{{end}}{{end}}{{range .Outputs}}{{if .Compress}}p.SetOutCompress({{.Name}})
+	{{end}}{{end}}{{range .Params}}{{if .Type}}p.SetParamType({{.Name}}, {{.Type}})
+	{{end}}{{if .Optional}}p.SetParamOptional({{.Name}})
+	{{end}}{{end}}wf.Add({{.Name}}, p)
+	for name, path := range inPaths {
+		if *path == "" {
+			continue
+		}
+		wf.Add("in_"+name, scipipe.NewFileQueue(*path))
+		wf.Connect("in_"+name+".out", {{.Name}}+"."+name)
+	}
+	sink := scipipe.NewSink()
+	wf.Add("sink", sink)
+	for name, pattern := range outPaths {
+		p.SetPathPattern(name, *pattern)
+		wf.Connect({{.Name}}+"."+name, "sink.in")
+	}
+	for name, val := range params {
+		if optional[name] && !given[name] {
+			continue
+		}
+		p.SetParamDefault(name, *val)
+	}
+	if err := wf.Run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+`))
@@ -0,0 +1,60 @@
+package scipipe
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	t "testing"
+)
+
+func TestWriteCWLTool(t *t.T) {
+	initTestLogs()
+
+	p := newTestFooBarWorkflow("/tmp/wrapper_").GetSciProcess("f2b")
+	buf := new(bytes.Buffer)
+	err := p.WriteCWLTool(buf)
+	assert.Nil(t, err)
+	doc := make(map[string]interface{})
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &doc))
+	assert.EqualValues(t, "CommandLineTool", doc["class"])
+	assert.EqualValues(t, "f2b", doc["id"])
+}
+
+func TestWriteGoMain(t *t.T) {
+	initTestLogs()
+
+	p := NewFromShell("f2b", "sed 's/{p:from}/{p:to|default:bar}/' {i:in} > {o:out}")
+	p.SetPathExtend("in", "out", ".bar")
+	buf := new(bytes.Buffer)
+	err := p.WriteGoMain(buf)
+	assert.Nil(t, err)
+	src := buf.String()
+	assert.Contains(t, src, "package main\n")
+	assert.Contains(t, src, `"in": flag.String("in", "", "Path of the input file of the in-port "+"in"+" (required)"),`)
+	assert.Contains(t, src, `"out": flag.String("out", "{i:in|basename}.bar", "Path of the output file of the out-port "+"out"),`)
+	assert.Contains(t, src, `"to":   flag.String("to", "bar", "Value of the param "+"to"),`)
+	assert.Contains(t, src, `required := []string{"in", "from"}`)
+	assert.Contains(t, src, `p := scipipe.NewFromShell("f2b", "sed 's/{p:from}/{p:to|default:bar}/' {i:in} > {o:out}")`)
+
+	p = NewFromShell("head", "zcat {i:in} | head -n {p:n} | grep {p:mode} > {o:out}")
+	p.SetPathExtend("in", "out", ".head")
+	p.SetInDecompress("in")
+	p.SetOutCompress("out")
+	p.SetParamType("n", ParamTypeInt)
+	p.SetParamDefault("n", "10")
+	p.SetParamType("mode", ParamTypeEnum, "fast", "slow")
+	p.Cores = 4
+	buf.Reset()
+	assert.Nil(t, p.WriteGoMain(buf))
+	src = buf.String()
+	assert.Contains(t, src, "p.Cores = 4\n")
+	assert.Contains(t, src, `p.SetInDecompress("in")`)
+	assert.Contains(t, src, `p.SetOutCompress("out")`)
+	assert.Contains(t, src, `p.SetParamType("n", scipipe.ParamTypeInt)`)
+	assert.Contains(t, src, `p.SetParamType("mode", scipipe.ParamTypeEnum, "fast", "slow")`)
+	assert.NotContains(t, src, "p.MemoryMB")
+
+	custom := NewSciProcess("custom", "")
+	custom.CustomExecute = func(t *SciTask) error { return nil }
+	assert.Error(t, custom.WriteGoMain(buf))
+}